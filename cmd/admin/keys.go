@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/container"
+)
+
+// rotateReport summarises a rotate-keys run.
+type rotateReport struct {
+	Scanned   int               `json:"scanned"`
+	Rewrapped int               `json:"rewrapped"`
+	Encrypted int               `json:"encrypted"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+// runRotateKeys re-wraps every object's data key with the active master key.
+// Only metadata changes, so it is cheap even for a large bucket; once it
+// reports no failures the retired key can be removed from the key file.
+func runRotateKeys(ctx context.Context, ctr *container.Container, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	prefix := fs.String("prefix", "attachments/", "only process objects under this key prefix")
+	encryptPlaintext := fs.Bool("encrypt-plaintext", false, "also encrypt objects stored before encryption was enabled (re-uploads them)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.Encryption.KeyFile == "" {
+		return fmt.Errorf("STORAGE_ENCRYPTION_KEY_FILE is not set")
+	}
+
+	objects, err := ctr.S3Client.List(ctx, *prefix)
+	if err != nil {
+		return err
+	}
+
+	report := rotateReport{Failed: map[string]string{}}
+	for _, o := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Scanned++
+
+		changed, err := ctr.S3Client.Rewrap(ctx, o.Key)
+		if err != nil {
+			report.Failed[o.Key] = err.Error()
+			continue
+		}
+		if changed {
+			report.Rewrapped++
+			continue
+		}
+
+		if *encryptPlaintext {
+			encrypted, err := ctr.S3Client.EncryptInPlace(ctx, o.Key)
+			if err != nil {
+				report.Failed[o.Key] = err.Error()
+				continue
+			}
+			if encrypted {
+				report.Encrypted++
+			}
+		}
+	}
+
+	return printJSON(report)
+}
+
+// runReencryptFields brings encrypted database columns up to date with the
+// active field encryption key, as the scheduled task does. Once it finishes
+// the retired key can be removed from the key file.
+func runReencryptFields(ctx context.Context, ctr *container.Container, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reencrypt-fields", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.Encryption.FieldKeyFile == "" {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEY_FILE is not set")
+	}
+	return ctr.FieldCryptSvc.Reencrypt(ctx)
+}
@@ -0,0 +1,102 @@
+// Command admin runs one-off maintenance tasks against the same database and
+// bucket as the API, e.g.:
+//
+//	admin reconcile -delete -grace 48h
+//	admin rotate-keys -encrypt-plaintext
+//	admin reencrypt-fields
+//	admin purge -delete
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/container"
+	"github.com/jamesphm04/splose-clone-be/internal/logger"
+)
+
+// command is a subcommand: it parses its own flags and uses the container.
+type command struct {
+	summary string
+	run     func(ctx context.Context, ctr *container.Container, cfg *config.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"reconcile": {
+		summary: "compare attachment objects in S3 with the database and report (or delete) orphans",
+		run:     runReconcile,
+	},
+	"rotate-keys": {
+		summary: "re-wrap attachment data keys with the active master key",
+		run:     runRotateKeys,
+	},
+	"reencrypt-fields": {
+		summary: "re-encrypt database columns with the active field encryption key",
+		run:     runReencryptFields,
+	},
+	"purge": {
+		summary: "report (or purge) soft-deleted rows past their retention period",
+		run:     runPurge,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	log := logger.Must(os.Getenv("APP_ENV"))
+	defer log.Sync()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("failed to load configuration", zap.Error(err))
+	}
+
+	ctr, err := container.New(cfg, log)
+	if err != nil {
+		log.Fatal("failed to create container", zap.Error(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, ctr, cfg, os.Args[2:]); err != nil {
+		log.Fatal("command failed", zap.String("command", os.Args[1]), zap.Error(err))
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].summary)
+	}
+}
+
+// printJSON writes a report to stdout so it can be piped or archived.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
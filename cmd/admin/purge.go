@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/container"
+)
+
+func runPurge(ctx context.Context, ctr *container.Container, _ *config.Config, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	deleteRows := fs.Bool("delete", false, "purge the rows; without it the run only reports what is due")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := ctr.RetentionSvc.Purge(ctx, !*deleteRows)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
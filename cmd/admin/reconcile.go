@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/container"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+)
+
+func runReconcile(ctx context.Context, ctr *container.Container, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	deleteOrphans := fs.Bool("delete", false, "delete orphaned objects older than the grace period")
+	grace := fs.Duration("grace", cfg.Jobs.ReconcileGracePeriod, "minimum age before an orphan may be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := ctr.ReconcileSvc.Run(ctx, services.ReconcileOptions{
+		DeleteOrphans: *deleteOrphans,
+		GracePeriod:   *grace,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
@@ -36,7 +36,7 @@ func main() {
 		log.Fatal("failed to create container", zap.Error(err))
 	}
 	log.Info("container created")
-	defer ctr.Close()
+	ctr.StartWorkers(context.Background())
 
 	// HTTP Server
 	router := ctr.Router()
@@ -78,4 +78,8 @@ func main() {
 	} else {
 		log.Info("HTTP server stopped gracefully")
 	}
+
+	if err := ctr.Close(ctx); err != nil {
+		log.Error("closing container failed", zap.Error(err))
+	}
 }
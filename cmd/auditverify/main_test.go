@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// chain returns n sealed events, as the export would list them.
+func chain(t *testing.T, n int) []*entities.AuditEvent {
+	t.Helper()
+	var events []*entities.AuditEvent
+	var prev *entities.AuditEvent
+	for i := range n {
+		e := &entities.AuditEvent{
+			Action:       "patient.read",
+			ResourceType: "patient",
+			ResourceID:   "patient-1",
+			IP:           "198.51.100.7",
+			Details:      map[string]any{"page": i + 1, "ids": []string{"a", "b"}},
+			CreatedAt:    time.Date(2026, 10, 18, 9, 0, i, 0, time.UTC),
+		}
+		e.Seal(prev)
+		events = append(events, e)
+		prev = e
+	}
+	return events
+}
+
+func export(t *testing.T, events []*entities.AuditEvent) []string {
+	t.Helper()
+	lines := make([]string, len(events))
+	for i, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[i] = string(b)
+	}
+	return lines
+}
+
+func TestVerify(t *testing.T) {
+	events := chain(t, 4)
+	lines := export(t, events)
+
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		prev  string
+		want  []problem
+	}{
+		{"intact", lines, "", nil},
+		{"intact with a blank line", []string{lines[0], "", lines[1], lines[2], lines[3]}, "", nil},
+		{"field edited", []string{lines[0], strings.Replace(lines[1], `"ip":"198.51.100.7"`, `"ip":"203.0.113.9"`, 1), lines[2], lines[3]}, "", []problem{
+			{2, 2, "contents do not match hash"},
+		}},
+		{"details edited", []string{lines[0], lines[1], strings.Replace(lines[2], `"page":3`, `"page":4`, 1), lines[3]}, "", []problem{
+			{3, 3, "contents do not match hash"},
+		}},
+		{"row deleted", []string{lines[0], lines[2], lines[3]}, "", []problem{
+			{2, 3, "gap: expected seq 2"},
+		}},
+		{"rows reordered", []string{lines[0], lines[2], lines[1], lines[3]}, "", []problem{
+			{2, 3, "gap: expected seq 2"},
+			{3, 2, "gap: expected seq 4"},
+			{4, 4, "gap: expected seq 3"},
+		}},
+		{"relinked after a deletion", func() []string {
+			// Renumbering and rehashing the event after a deleted one
+			// moves the break to the next event, unless all are rewritten.
+			third := *events[2]
+			third.Seq, third.PrevHash = 2, events[0].Hash
+			third.Hash = third.ComputeHash()
+			return []string{lines[0], export(t, []*entities.AuditEvent{&third})[0], lines[3]}
+		}(), "", []problem{
+			{3, 4, "gap: expected seq 3"},
+		}},
+		{"range anchored with -prev", lines[2:], events[1].Hash, nil},
+		{"range with the wrong -prev", lines[2:], events[0].Hash, []problem{
+			{1, 3, "does not follow the -prev event"},
+		}},
+		{"range without -prev", lines[2:], "", nil},
+		{"not an event", []string{lines[0], "{", lines[1]}, "", []problem{
+			{2, 0, "not an audit event: unexpected end of JSON input"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := verify(strings.NewReader(strings.Join(tc.lines, "\n")), tc.prev)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if !slices.Equal(r.Problems, tc.want) {
+				t.Errorf("problems = %+v, want %+v", r.Problems, tc.want)
+			}
+			if r.Valid != (len(tc.want) == 0) {
+				t.Errorf("valid = %v with problems %+v", r.Valid, r.Problems)
+			}
+		})
+	}
+}
+
+func TestVerifyReportsHead(t *testing.T) {
+	events := chain(t, 3)
+	r, err := verify(strings.NewReader(strings.Join(export(t, events), "\n")+"\n"), "")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := report{Events: 3, FirstSeq: 1, HeadSeq: 3, HeadHash: events[2].Hash, Valid: true}
+	if r.Events != want.Events || r.FirstSeq != want.FirstSeq || r.HeadSeq != want.HeadSeq || r.HeadHash != want.HeadHash || !r.Valid {
+		t.Errorf("report = %+v, want %+v", *r, want)
+	}
+}
@@ -0,0 +1,127 @@
+// Package authz maps roles to the permissions they grant. Routes check
+// permissions with middleware.RequirePermission; services check them where
+// the decision depends on the request, e.g. which role may be assigned.
+// Record-level access is enforced by the repositories, from the Actor on
+// the request context.
+package authz
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+type Permission string
+
+const (
+	PatientRead  Permission = "patient.read"
+	PatientWrite Permission = "patient.write"
+	// PatientReadAll lifts record-level scoping: without it, only patients
+	// a user owns or is on the care team for are visible.
+	PatientReadAll Permission = "patient.read_all"
+	NoteRead       Permission = "note.read"
+	NoteWrite      Permission = "note.write"
+	NoteSign       Permission = "note.sign"
+	BillingManage  Permission = "billing.manage"
+	// UserManage covers listing staff, assigning roles and unlocking
+	// accounts.
+	UserManage Permission = "user.manage"
+	// SystemManage covers platform settings: MFA policies and API keys.
+	SystemManage Permission = "system.manage"
+	// PatientExport covers building a copy of a patient's whole record,
+	// clinical content included, for the patient.
+	PatientExport Permission = "patient.export"
+	// LegalHoldManage covers placing and releasing legal holds, which keep
+	// a patient's record from being purged.
+	LegalHoldManage Permission = "legal_hold.manage"
+)
+
+const (
+	RoleAdmin        = "admin"
+	RoleClinicAdmin  = "clinic_admin"
+	RolePractitioner = "practitioner"
+	RoleReceptionist = "receptionist"
+	RoleBilling      = "billing"
+)
+
+// DefaultRole is given to self-registered and provisioned users.
+const DefaultRole = RolePractitioner
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PatientRead, PatientWrite, PatientReadAll, NoteRead, NoteWrite, NoteSign,
+		PatientExport, LegalHoldManage, BillingManage, UserManage, SystemManage,
+	},
+	RoleClinicAdmin: {
+		PatientRead, PatientWrite, PatientReadAll, NoteRead, NoteWrite,
+		PatientExport, LegalHoldManage, BillingManage, UserManage,
+	},
+	RolePractitioner: {PatientRead, PatientWrite, NoteRead, NoteWrite, NoteSign, PatientExport},
+	// Front desk manages patient records but never sees clinical notes.
+	RoleReceptionist: {PatientRead, PatientWrite, PatientReadAll},
+	RoleBilling:      {PatientRead, PatientReadAll, BillingManage},
+}
+
+// Roles lists every role, most privileged first.
+var Roles = []string{RoleAdmin, RoleClinicAdmin, RolePractitioner, RoleReceptionist, RoleBilling}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Permissions returns what role grants; nil for an unknown role.
+func Permissions(role string) []Permission {
+	return rolePermissions[role]
+}
+
+// Has reports whether role grants perm.
+func Has(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// Check returns ErrForbidden unless role grants perm.
+func Check(role string, perm Permission) error {
+	if !Has(role, perm) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanManage reports whether a user with role actor may manage users who
+// have, or are to be given, role target. Only admins manage admins; anyone
+// else with UserManage manages the remaining roles.
+func CanManage(actor, target string) bool {
+	if !Has(actor, UserManage) {
+		return false
+	}
+	return target != RoleAdmin || actor == RoleAdmin
+}
+
+// Actor is the user a request acts for. Repositories read it from the
+// context to scope clinical records, see WithActor.
+type Actor struct {
+	UserID string
+	Role   string
+	// OrgID is the organisation the request acts in. Tenant-owned records
+	// of other organisations are invisible to it; empty means none.
+	OrgID string
+	// ImpersonatorID is the admin acting as UserID, if any.
+	ImpersonatorID string
+}
+
+type actorKey struct{}
+
+// WithActor attaches the actor to ctx. Contexts without one, such as those
+// of background jobs, are not scoped.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFrom returns the actor attached to ctx, if any.
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(Actor)
+	return a, ok
+}
+
+var ErrForbidden = errors.New("you do not have permission to do that")
@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -21,6 +23,15 @@ type Config struct {
 	AWS           AWSConfig
 	Security      SecurityConfig
 	SploseCloneAI SploseCloneAIConfig
+	Attachment    AttachmentConfig
+	Preview       PreviewConfig
+	Export        ExportConfig
+	Jobs          JobsConfig
+	Retention     RetentionConfig
+	Encryption    EncryptionConfig
+	Auth          AuthConfig
+	Mail          MailConfig
+	OIDC          OIDCConfig
 }
 
 type SploseCloneAIConfig struct {
@@ -31,6 +42,12 @@ type SploseCloneAIConfig struct {
 type ServerConfig struct {
 	Host string
 	Port string
+	// TrustedProxies are the addresses or CIDR ranges of the reverse
+	// proxies in front of the server. The client IP, used for API key
+	// allowlists, rate limits and login throttling, is read from
+	// X-Forwarded-For or X-Real-IP only on requests from one of them. With
+	// none, the default, it is the peer address and cannot be spoofed.
+	TrustedProxies []string
 }
 
 type DBConfig struct {
@@ -43,6 +60,9 @@ type DBConfig struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	// LogParams logs SQL with its parameter values, for debugging only:
+	// they may hold patient data. Otherwise statements show placeholders.
+	LogParams bool
 }
 
 // DSN returns the PostgreSQL connection string
@@ -54,9 +74,18 @@ func (d DBConfig) DSN() string {
 }
 
 type JWTConfig struct {
-	Secret     string
-	AccessTTL  time.Duration
-	RefreshTTL time.Duration
+	// Secret signs HS256 tokens. With SigningKeysDir set it only verifies
+	// tokens issued before the switch, and may be left empty.
+	Secret string
+	// SigningKeysDir holds <kid>.pem RS256/EdDSA keys; SigningKeyID names the
+	// one that signs. See auth.KeySet.
+	SigningKeysDir string
+	SigningKeyID   string
+	AccessTTL      time.Duration
+	RefreshTTL     time.Duration
+	// SessionCacheTTL bounds how long a revoked session's access tokens can
+	// still be accepted by other replicas.
+	SessionCacheTTL time.Duration
 }
 
 type AWSConfig struct {
@@ -69,9 +98,171 @@ type AWSConfig struct {
 	PresignedURLTTL time.Duration
 }
 
+// AttachmentConfig limits what can be uploaded as an attachment.
+type AttachmentConfig struct {
+	// MaxFileSize is the largest single upload accepted, in bytes.
+	MaxFileSize int64
+	// MaxNoteSize is the total size of all attachments on one note, in bytes.
+	MaxNoteSize int64
+	// AllowedTypes maps an upload use (e.g. "message") to the MIME types
+	// accepted for it. Entries may use a wildcard subtype ("image/*").
+	AllowedTypes map[string][]string
+}
+
+// PreviewConfig controls background thumbnail generation.
+type PreviewConfig struct {
+	Workers      int
+	QueueSize    int
+	MaxDimension int           // longest thumbnail side, in pixels
+	Timeout      time.Duration // per attachment
+	// PDFToPPMPath and PDFInfoPath point at poppler binaries. PDF previews
+	// are disabled when PDFToPPMPath is empty.
+	PDFToPPMPath string
+	PDFInfoPath  string
+}
+
+// ExportConfig controls patient record exports.
+type ExportConfig struct {
+	Workers int
+	Timeout time.Duration // per export
+	// LinkTTL is how long a finished archive can be downloaded; it is
+	// deleted from storage afterwards.
+	LinkTTL time.Duration
+}
+
+// RetentionConfig controls how long soft-deleted rows are kept before the
+// scheduled purge removes them, with their objects in storage, for good.
+type RetentionConfig struct {
+	PurgeInterval time.Duration // zero disables the task
+	// Rules are keyed by table: patients, notes, messages, attachments and
+	// prompts. Tables without a rule are never purged.
+	Rules map[string]RetentionRule
+}
+
+// RetentionRule is the retention period of one table. Health records have a
+// legal minimum, counted from when the record was last changed, and may
+// have a maximum.
+type RetentionRule struct {
+	// PurgeAfter is how long a row stays soft-deleted, and so restorable,
+	// before it is purged.
+	PurgeAfter time.Duration
+	// MinRetention keeps rows changed more recently than this, deleted or
+	// not.
+	MinRetention time.Duration
+	// MaxRetention purges deleted rows last changed longer ago than this
+	// without waiting for PurgeAfter. Zero means no maximum.
+	MaxRetention time.Duration
+}
+
+// JobsConfig controls scheduled background tasks. Only one replica should
+// run with SchedulerEnabled.
+type JobsConfig struct {
+	SchedulerEnabled       bool
+	ReconcileInterval      time.Duration // zero disables the task
+	ReconcileDeleteOrphans bool
+	ReconcileGracePeriod   time.Duration
+	SessionPruneInterval   time.Duration // zero disables the task
+	// SessionRetention is how long expired sessions are kept before pruning.
+	SessionRetention time.Duration
+	// FieldReencryptInterval is how often columns still encrypted with a
+	// retired key, or not at all, are re-encrypted. Zero disables the task.
+	FieldReencryptInterval time.Duration
+}
+
+// AuthConfig controls account recovery and verification.
+type AuthConfig struct {
+	// AppBaseURL is the web app that links in emails point at.
+	AppBaseURL       string
+	PasswordResetTTL time.Duration
+	EmailVerifyTTL   time.Duration
+	// InvitationTTL is how long a staff invitation can be accepted.
+	InvitationTTL time.Duration
+	// SelfRegistration opens /auth/register to the public. When off, new
+	// accounts only come from invitations (or SSO provisioning).
+	SelfRegistration bool
+	// ImpersonationTTL bounds an admin's impersonation session. It cannot
+	// be refreshed.
+	ImpersonationTTL time.Duration
+	// TokenIssueLimit caps reset/verification emails per user per hour.
+	TokenIssueLimit int
+	// TokenEndpointLimit caps requests per client IP per minute to the
+	// unauthenticated token endpoints.
+	TokenEndpointLimit int
+	// MFAIssuer labels the account in authenticator apps.
+	MFAIssuer string
+}
+
+// OIDCConfig enables single sign-on through one OpenID Connect provider.
+// SSO is off when Issuer is empty. For local testing, point Issuer at a
+// mock IdP (e.g. http://localhost:8080/default).
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the web app page the provider returns to; it posts the
+	// code and state to /auth/oidc/callback.
+	RedirectURL string
+	Scopes      []string
+	// AutoProvision creates a user on first sign-in when no account matches.
+	AutoProvision bool
+	// LinkByEmail links a first sign-in to an existing user with the same
+	// address, if the provider says the address is verified. Off by
+	// default: only enable it for a provider trusted to verify addresses,
+	// as whoever controls the address there takes over the account.
+	LinkByEmail bool
+	// RoleClaim names a claim (string or list) that sets the user's role in
+	// each of their organisations on every sign-in; AdminRoleValues are the
+	// values that map to "admin", and other role names (e.g.
+	// "receptionist") map to themselves. Leave RoleClaim empty to manage
+	// roles locally.
+	RoleClaim       string
+	AdminRoleValues []string
+	StateTTL        time.Duration
+}
+
+// MailConfig selects the outgoing mail backend: "smtp", or "log" which only
+// logs that messages were sent (and writes them to LogDir when set). "log"
+// is the default outside production and is refused in it.
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	LogDir       string
+}
+
+// EncryptionConfig enables client-side envelope encryption of stored
+// objects. Encryption is off when KeyFile is empty.
+type EncryptionConfig struct {
+	// KeyFile is a JSON file of master keys, see envelope.NewFileKeyProvider.
+	KeyFile string
+	// FieldKeyFile holds the keys for personal data and clinical content in
+	// the database, in the same format. It defaults to KeyFile; those
+	// columns are stored in plaintext when both are empty.
+	FieldKeyFile string
+}
+
 type SecurityConfig struct {
-	BcryptCost    int
-	RateLimiteRPS float64
+	BcryptCost int
+	// RateLimitStore is "memory" (per replica) or "postgres" (shared).
+	RateLimitStore string
+	// Token buckets per caller: the API as a whole, the unauthenticated
+	// auth endpoints, and AI send-message. A zero rate disables a bucket.
+	RateLimiteRPS      float64
+	RateLimitBurst     int
+	AuthRateLimitRPS   float64
+	AuthRateLimitBurst int
+	AIRateLimitRPS     float64
+	AIRateLimitBurst   int
+	// Login brute-force protection, see services.LoginGuard. Failures older
+	// than LoginFailureWindow are forgotten.
+	LoginFailureWindow    time.Duration
+	LoginDelayAfter       int
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	LoginIPThreshold      int
 }
 
 // Load reads configuration from .env.
@@ -89,6 +280,39 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid JWT_REFRESH_TTL: %w", err)
 	}
+	signingKeysDir := getEnv("JWT_SIGNING_KEYS_DIR", "")
+	signingKeyID := getEnv("JWT_SIGNING_KEY_ID", "")
+	jwtSecret := getEnv("JWT_SECRET", "")
+	switch {
+	case signingKeysDir == "" && jwtSecret == "":
+		return nil, fmt.Errorf("JWT_SECRET or JWT_SIGNING_KEYS_DIR must be set")
+	case signingKeysDir != "" && signingKeyID == "":
+		return nil, fmt.Errorf("JWT_SIGNING_KEY_ID is required with JWT_SIGNING_KEYS_DIR")
+	}
+	oidcStateTTL, err := time.ParseDuration(getEnv("OIDC_STATE_TTL", "10m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC_STATE_TTL: %w", err)
+	}
+	sessionCacheTTL, err := time.ParseDuration(getEnv("SESSION_CACHE_TTL", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SESSION_CACHE_TTL: %w", err)
+	}
+	passwordResetTTL, err := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORD_RESET_TTL: %w", err)
+	}
+	emailVerifyTTL, err := time.ParseDuration(getEnv("EMAIL_VERIFY_TTL", "48h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_VERIFY_TTL: %w", err)
+	}
+	invitationTTL, err := time.ParseDuration(getEnv("INVITATION_TTL", "168h")) // 7 days
+	if err != nil {
+		return nil, fmt.Errorf("invalid INVITATION_TTL: %w", err)
+	}
+	impersonationTTL, err := time.ParseDuration(getEnv("IMPERSONATION_TTL", "30m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMPERSONATION_TTL: %w", err)
+	}
 	connLifetime, err := time.ParseDuration(getEnv("DB_CONN_MAX_LIFETIME", "5m"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid DB_CONN_MAX_LIFETIME: %w", err)
@@ -97,17 +321,101 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid AWS_PRESIGNED_URL_TTL: %w", err)
 	}
+	previewTimeout, err := time.ParseDuration(getEnv("PREVIEW_TIMEOUT", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PREVIEW_TIMEOUT: %w", err)
+	}
+	reconcileInterval, err := time.ParseDuration(getEnv("RECONCILE_INTERVAL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RECONCILE_INTERVAL: %w", err)
+	}
+	reconcileGrace, err := time.ParseDuration(getEnv("RECONCILE_GRACE_PERIOD", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RECONCILE_GRACE_PERIOD: %w", err)
+	}
+	sessionPruneInterval, err := time.ParseDuration(getEnv("SESSION_PRUNE_INTERVAL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SESSION_PRUNE_INTERVAL: %w", err)
+	}
+	sessionRetention, err := time.ParseDuration(getEnv("SESSION_RETENTION", "720h")) // 30 days
+	if err != nil {
+		return nil, fmt.Errorf("invalid SESSION_RETENTION: %w", err)
+	}
+	exportTimeout, err := time.ParseDuration(getEnv("EXPORT_TIMEOUT", "30m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXPORT_TIMEOUT: %w", err)
+	}
+	exportLinkTTL, err := time.ParseDuration(getEnv("EXPORT_LINK_TTL", "72h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXPORT_LINK_TTL: %w", err)
+	}
+	retentionInterval, err := time.ParseDuration(getEnv("RETENTION_PURGE_INTERVAL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RETENTION_PURGE_INTERVAL: %w", err)
+	}
+	retentionRules := map[string]RetentionRule{}
+	for _, table := range []string{"patients", "notes", "messages", "attachments", "prompts"} {
+		// Clinical records are kept for at least 7 years by default.
+		minRetention := "7y"
+		if table == "prompts" {
+			minRetention = "0"
+		}
+		rule, err := loadRetentionRule(table, "30d", minRetention)
+		if err != nil {
+			return nil, err
+		}
+		retentionRules[table] = rule
+	}
+	storageKeyFile := getEnv("STORAGE_ENCRYPTION_KEY_FILE", "")
+	fieldReencryptInterval, err := time.ParseDuration(getEnv("FIELD_REENCRYPT_INTERVAL", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FIELD_REENCRYPT_INTERVAL: %w", err)
+	}
+
+	trustedProxies := getEnvList("TRUSTED_PROXIES", "")
+	for _, p := range trustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", p)
+		}
+	}
+
+	loginFailureWindow, err := time.ParseDuration(getEnv("LOGIN_FAILURE_WINDOW", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_FAILURE_WINDOW: %w", err)
+	}
+	loginLockoutDuration, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION: %w", err)
+	}
 
 	bcryptCost, _ := strconv.Atoi(getEnv("BCRYPT_COST", "12"))
+	loginDelayAfter, _ := strconv.Atoi(getEnv("LOGIN_DELAY_AFTER", "3"))
+	loginLockoutThreshold, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_THRESHOLD", "10"))
+	loginIPThreshold, _ := strconv.Atoi(getEnv("LOGIN_IP_THRESHOLD", "50"))
 	maxOpen, _ := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "25"))
 	maxIdle, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "10"))
+	tokenIssueLimit, _ := strconv.Atoi(getEnv("AUTH_TOKEN_ISSUE_LIMIT", "5"))
+	tokenEndpointLimit, _ := strconv.Atoi(getEnv("AUTH_TOKEN_ENDPOINT_LIMIT", "10"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
 	rps, _ := strconv.ParseFloat(getEnv("RATE_LIMIT_RPS", "100"), 64)
+	rateLimitBurst, _ := strconv.Atoi(getEnv("RATE_LIMIT_BURST", "200"))
+	authRPS, _ := strconv.ParseFloat(getEnv("AUTH_RATE_LIMIT_RPS", "0.5"), 64)
+	authBurst, _ := strconv.Atoi(getEnv("AUTH_RATE_LIMIT_BURST", "10"))
+	aiRPS, _ := strconv.ParseFloat(getEnv("AI_RATE_LIMIT_RPS", "0.2"), 64)
+	aiBurst, _ := strconv.Atoi(getEnv("AI_RATE_LIMIT_BURST", "5"))
+	maxFileSize, _ := strconv.ParseInt(getEnv("ATTACHMENT_MAX_FILE_SIZE", "26214400"), 10, 64)  // 25 MiB
+	maxNoteSize, _ := strconv.ParseInt(getEnv("ATTACHMENT_MAX_NOTE_SIZE", "262144000"), 10, 64) // 250 MiB
+	previewWorkers, _ := strconv.Atoi(getEnv("PREVIEW_WORKERS", "2"))
+	previewQueueSize, _ := strconv.Atoi(getEnv("PREVIEW_QUEUE_SIZE", "100"))
+	previewMaxDim, _ := strconv.Atoi(getEnv("PREVIEW_MAX_DIMENSION", "320"))
+	exportWorkers, _ := strconv.Atoi(getEnv("EXPORT_WORKERS", "1"))
 
 	cfg := &Config{
 		AppEnv: getEnv("APP_ENV", "development"),
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			TrustedProxies: trustedProxies,
 		},
 		DB: DBConfig{
 			Host:            mustEnv("DB_HOST"),
@@ -119,11 +427,15 @@ func Load() (*Config, error) {
 			MaxOpenConns:    maxOpen,
 			MaxIdleConns:    maxIdle,
 			ConnMaxLifetime: connLifetime,
+			LogParams:       getEnvBool("DB_LOG_PARAMS", false),
 		},
 		JWT: JWTConfig{
-			Secret:     mustEnv("JWT_SECRET"),
-			AccessTTL:  accessTTL,
-			RefreshTTL: refreshTTL,
+			Secret:          jwtSecret,
+			SigningKeysDir:  signingKeysDir,
+			SigningKeyID:    signingKeyID,
+			AccessTTL:       accessTTL,
+			RefreshTTL:      refreshTTL,
+			SessionCacheTTL: sessionCacheTTL,
 		},
 
 		AWS: AWSConfig{
@@ -135,13 +447,96 @@ func Load() (*Config, error) {
 			PresignedURLTTL: presignedURLTTL,
 		},
 		Security: SecurityConfig{
-			BcryptCost:    bcryptCost,
-			RateLimiteRPS: rps,
+			BcryptCost:     bcryptCost,
+			RateLimitStore: getEnv("RATE_LIMIT_STORE", "memory"),
+
+			RateLimiteRPS:      rps,
+			RateLimitBurst:     rateLimitBurst,
+			AuthRateLimitRPS:   authRPS,
+			AuthRateLimitBurst: authBurst,
+			AIRateLimitRPS:     aiRPS,
+			AIRateLimitBurst:   aiBurst,
+
+			LoginFailureWindow:    loginFailureWindow,
+			LoginDelayAfter:       loginDelayAfter,
+			LoginLockoutThreshold: loginLockoutThreshold,
+			LoginLockoutDuration:  loginLockoutDuration,
+			LoginIPThreshold:      loginIPThreshold,
 		},
 		SploseCloneAI: SploseCloneAIConfig{
 			APIKey:  mustEnv("SPLOSE_CLONE_AI_API_KEY"),
 			BaseURL: mustEnv("SPLOSE_CLONE_AI_BASE_URL"),
 		},
+		Attachment: AttachmentConfig{
+			MaxFileSize: maxFileSize,
+			MaxNoteSize: maxNoteSize,
+			AllowedTypes: map[string][]string{
+				"message": getEnvList("ATTACHMENT_MESSAGE_ALLOWED_TYPES",
+					"application/pdf,image/png,image/jpeg,image/gif,image/webp,text/plain"),
+			},
+		},
+		Preview: PreviewConfig{
+			Workers:      previewWorkers,
+			QueueSize:    previewQueueSize,
+			MaxDimension: previewMaxDim,
+			Timeout:      previewTimeout,
+			PDFToPPMPath: getEnv("PREVIEW_PDFTOPPM_PATH", "pdftoppm"),
+			PDFInfoPath:  getEnv("PREVIEW_PDFINFO_PATH", "pdfinfo"),
+		},
+		Export: ExportConfig{
+			Workers: exportWorkers,
+			Timeout: exportTimeout,
+			LinkTTL: exportLinkTTL,
+		},
+		Jobs: JobsConfig{
+			SchedulerEnabled:       getEnvBool("SCHEDULER_ENABLED", true),
+			ReconcileInterval:      reconcileInterval,
+			ReconcileDeleteOrphans: getEnvBool("RECONCILE_DELETE_ORPHANS", false),
+			ReconcileGracePeriod:   reconcileGrace,
+			SessionPruneInterval:   sessionPruneInterval,
+			SessionRetention:       sessionRetention,
+			FieldReencryptInterval: fieldReencryptInterval,
+		},
+		Retention: RetentionConfig{
+			PurgeInterval: retentionInterval,
+			Rules:         retentionRules,
+		},
+		Encryption: EncryptionConfig{
+			KeyFile:      storageKeyFile,
+			FieldKeyFile: getEnv("FIELD_ENCRYPTION_KEY_FILE", storageKeyFile),
+		},
+		Auth: AuthConfig{
+			AppBaseURL:         strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:3000"), "/"),
+			PasswordResetTTL:   passwordResetTTL,
+			EmailVerifyTTL:     emailVerifyTTL,
+			InvitationTTL:      invitationTTL,
+			SelfRegistration:   getEnvBool("SELF_REGISTRATION", true),
+			ImpersonationTTL:   impersonationTTL,
+			TokenIssueLimit:    tokenIssueLimit,
+			TokenEndpointLimit: tokenEndpointLimit,
+			MFAIssuer:          getEnv("MFA_ISSUER", "Splose Clone"),
+		},
+		OIDC: OIDCConfig{
+			Issuer:          getEnv("OIDC_ISSUER", ""),
+			ClientID:        getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:     getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:          getEnvList("OIDC_SCOPES", "openid,email,profile"),
+			AutoProvision:   getEnvBool("OIDC_AUTO_PROVISION", false),
+			LinkByEmail:     getEnvBool("OIDC_LINK_BY_EMAIL", false),
+			RoleClaim:       getEnv("OIDC_ROLE_CLAIM", ""),
+			AdminRoleValues: getEnvList("OIDC_ADMIN_ROLE_VALUES", ""),
+			StateTTL:        oidcStateTTL,
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "no-reply@splose-clone.local"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     smtpPort,
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			LogDir:       getEnv("MAIL_LOG_DIR", ""),
+		},
 	}
 
 	return cfg, nil
@@ -154,6 +549,70 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvBool parses a boolean variable, falling back on absence or typo.
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(getEnv(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvList splits a comma-separated variable into trimmed, non-empty items.
+func getEnvList(key, fallback string) []string {
+	var out []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// loadRetentionRule reads RETENTION_<TABLE>_PURGE_AFTER, _MIN and _MAX.
+func loadRetentionRule(table, purgeAfter, minRetention string) (RetentionRule, error) {
+	prefix := "RETENTION_" + strings.ToUpper(table) + "_"
+	var rule RetentionRule
+	for _, v := range []struct {
+		name     string
+		fallback string
+		dst      *time.Duration
+	}{
+		{"PURGE_AFTER", purgeAfter, &rule.PurgeAfter},
+		{"MIN", minRetention, &rule.MinRetention},
+		{"MAX", "0", &rule.MaxRetention},
+	} {
+		d, err := parseRetention(getEnv(prefix+v.name, v.fallback))
+		if err != nil {
+			return rule, fmt.Errorf("invalid %s%s: %w", prefix, v.name, err)
+		}
+		*v.dst = d
+	}
+	if rule.MaxRetention != 0 && rule.MaxRetention < rule.MinRetention {
+		return rule, fmt.Errorf("invalid %sMAX: shorter than %sMIN", prefix, prefix)
+	}
+	return rule, nil
+}
+
+// parseRetention parses a Go duration, or a whole number of days ("30d")
+// or years ("7y", of 365.25 days).
+func parseRetention(s string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "y"):
+		unit = 8766 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid retention period %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
 // mustEnv panics with a descriptive message when a required variable is absent.
 func mustEnv(key string) string {
 	v := os.Getenv(key)
@@ -3,6 +3,7 @@ package container
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -11,9 +12,16 @@ import (
 	"github.com/jamesphm04/splose-clone-be/internal/config"
 	"github.com/jamesphm04/splose-clone-be/internal/database"
 	"github.com/jamesphm04/splose-clone-be/internal/handlers"
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
 	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+	"github.com/jamesphm04/splose-clone-be/pkg/envelope"
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
+	"github.com/jamesphm04/splose-clone-be/pkg/mailer"
+	"github.com/jamesphm04/splose-clone-be/pkg/oidc"
+	"github.com/jamesphm04/splose-clone-be/pkg/preview"
+	"github.com/jamesphm04/splose-clone-be/pkg/ratelimit"
 	"github.com/jamesphm04/splose-clone-be/pkg/storage"
 )
 
@@ -27,27 +35,75 @@ type Container struct {
 	JWTManager          *auth.Manager
 	S3Client            *storage.Client
 	SploseCloneAIClient *clients.SploseCloneAIClient
+	PreviewQueue        *jobs.Queue
+	MailQueue           *jobs.Queue
+	ExportQueue         *jobs.Queue
+	Mailer              mailer.Mailer
+	Scheduler           *jobs.Scheduler
+	RateLimitStore      ratelimit.Store
+	Fields              *fieldcrypt.Cipher
 
 	// Repositories
 	UserRepo       repositories.UserRepository
 	PatientRepo    repositories.PatientRepository
+	CareTeamRepo   repositories.CareTeamRepository
 	NoteRepo       repositories.NoteRepository
 	ConvRepo       repositories.ConversationRepository
 	MessageRepo    repositories.MessageRepository
 	AttachmentRepo repositories.AttachmentRepository
+	BlobRepo       repositories.BlobRepository
+	SessionRepo    repositories.SessionRepository
+	UserTokenRepo  repositories.UserTokenRepository
+	RecoveryRepo   repositories.RecoveryCodeRepository
+	MFAPolicyRepo  repositories.MFAPolicyRepository
+	IdentityRepo   repositories.IdentityRepository
+	APIKeyRepo     repositories.APIKeyRepository
+	ThrottleRepo   repositories.LoginThrottleRepository
+	OrgRepo        repositories.OrganizationRepository
+	InviteRepo     repositories.InvitationRepository
+	AuditRepo      repositories.AuditRepository
+	FieldCryptRepo repositories.FieldEncryptionRepository
+	ExportRepo     repositories.PatientExportRepository
+	HoldRepo       repositories.LegalHoldRepository
+	RetentionRepo  repositories.RetentionRepository
+	// RateLimitRepo is nil unless RATE_LIMIT_STORE=postgres.
+	RateLimitRepo repositories.RateLimitRepository
 	// Services
 	UserSvc       *services.UserService
+	SessionSvc    *services.SessionService
+	LoginGuard    *services.LoginGuard
+	AccountSvc    *services.AccountService
+	MFASvc        *services.MFAService
+	OIDCSvc       *services.OIDCService // nil unless OIDC_ISSUER is set
+	APIKeySvc     *services.APIKeyService
+	OrgSvc        *services.OrganizationService
+	InviteSvc     *services.InvitationService
+	AuditSvc      *services.AuditService
 	PatientSvc    *services.PatientService
 	NoteSvc       *services.NoteService
 	ConvSvc       *services.ConversationService
 	MessageSvc    *services.MessageService
 	AttachmentSvc *services.AttachmentService
+	PreviewSvc    *services.PreviewService
+	ReconcileSvc  *services.ReconcileService
+	FieldCryptSvc *services.FieldEncryptionService
+	ExportSvc     *services.PatientExportService
+	RetentionSvc  *services.RetentionService
 	// Handlers
 	AuthHandler    *handlers.AuthHandler
 	UserHandler    *handlers.UserHandler
 	PatientHandler *handlers.PatientHandler
 	NoteHandler    *handlers.NoteHandler
 	ConvHandler    *handlers.ConversationHandler
+	AttachHandler  *handlers.AttachmentHandler
+	MFAHandler     *handlers.MFAHandler
+	OIDCHandler    *handlers.OIDCHandler
+	APIKeyHandler  *handlers.APIKeyHandler
+	OrgHandler     *handlers.OrganizationHandler
+	InviteHandler  *handlers.InvitationHandler
+	AuditHandler   *handlers.AuditHandler
+	ExportHandler  *handlers.PatientExportHandler
+	RetainHandler  *handlers.RetentionHandler
 }
 
 // New wires the fill dependency graph and returns a ready Container
@@ -69,8 +125,23 @@ func New(cfg *config.Config, log *zap.Logger) (*Container, error) {
 }
 
 func (c *Container) buildInfrastructure() error {
+	// Field encryption
+	var ring fieldcrypt.Keyring
+	if c.cfg.Encryption.FieldKeyFile != "" {
+		keys, err := envelope.NewFileKeyProvider(c.cfg.Encryption.FieldKeyFile)
+		if err != nil {
+			return fmt.Errorf("field encryption keys: %w", err)
+		}
+		ring = keys
+	}
+	fields, err := fieldcrypt.New(ring)
+	if err != nil {
+		return fmt.Errorf("field encryption: %w", err)
+	}
+	c.Fields = fields
+
 	// Database
-	db, err := database.Connect(c.cfg.DB, c.cfg.AppEnv, c.log)
+	db, err := database.Connect(c.cfg.DB, c.cfg.AppEnv, c.Fields, c.log)
 	if err != nil {
 		return fmt.Errorf("database: %w", err)
 	}
@@ -80,12 +151,29 @@ func (c *Container) buildInfrastructure() error {
 	c.db = db
 
 	// JWT
+	var jwtOpts []auth.Option
+	if c.cfg.JWT.SigningKeysDir != "" {
+		keys, err := auth.LoadKeySet(c.cfg.JWT.SigningKeysDir, c.cfg.JWT.SigningKeyID)
+		if err != nil {
+			return fmt.Errorf("jwt signing keys: %w", err)
+		}
+		jwtOpts = append(jwtOpts, auth.WithKeySet(keys))
+	}
 	c.JWTManager = auth.NewManager(
 		c.cfg.JWT.Secret,
 		c.cfg.JWT.AccessTTL,
 		c.cfg.JWT.RefreshTTL,
+		jwtOpts...,
 	)
 	// S3
+	var s3Opts []storage.Option
+	if c.cfg.Encryption.KeyFile != "" {
+		keys, err := envelope.NewFileKeyProvider(c.cfg.Encryption.KeyFile)
+		if err != nil {
+			return fmt.Errorf("encryption keys: %w", err)
+		}
+		s3Opts = append(s3Opts, storage.WithEncryption(envelope.NewEncryptor(keys)))
+	}
 	s3, err := storage.NewClient(
 		context.Background(),
 		c.cfg.AWS.Region,
@@ -95,6 +183,7 @@ func (c *Container) buildInfrastructure() error {
 		c.cfg.AWS.S3Endpoint,
 		c.cfg.AWS.PresignedURLTTL,
 		c.log,
+		s3Opts...,
 	)
 	if err != nil {
 		return fmt.Errorf("s3: %w", err)
@@ -104,24 +193,140 @@ func (c *Container) buildInfrastructure() error {
 	// Splose Clone AI Client
 	c.SploseCloneAIClient = clients.NewSploseCloneAIClient(c.cfg.SploseCloneAI.APIKey, c.cfg.SploseCloneAI.BaseURL, c.log)
 
+	// Background queues (started by StartWorkers)
+	c.PreviewQueue = jobs.NewQueue("previews", c.cfg.Preview.Workers, c.cfg.Preview.QueueSize, c.cfg.Preview.Timeout, c.log)
+	c.ExportQueue = jobs.NewQueue("exports", c.cfg.Export.Workers, 20, c.cfg.Export.Timeout, c.log)
+	c.Scheduler = jobs.NewScheduler(c.log)
+
+	// Mail
+	switch c.cfg.Mail.Driver {
+	case "smtp":
+		if c.cfg.Mail.SMTPHost == "" {
+			return fmt.Errorf("mail: SMTP_HOST is required with MAIL_DRIVER=smtp")
+		}
+		c.Mailer = mailer.NewSMTPMailer(c.cfg.Mail.SMTPHost, c.cfg.Mail.SMTPPort, c.cfg.Mail.SMTPUsername, c.cfg.Mail.SMTPPassword, c.cfg.Mail.From)
+	case "log":
+		// Nothing would be delivered, and MAIL_LOG_DIR would collect live
+		// reset and invitation links.
+		if c.cfg.AppEnv == "production" {
+			return fmt.Errorf("mail: MAIL_DRIVER=log is not allowed in production; use smtp")
+		}
+		c.Mailer = mailer.NewLogMailer(c.cfg.Mail.From, c.cfg.Mail.LogDir, c.log)
+	default:
+		return fmt.Errorf("mail: unknown MAIL_DRIVER %q", c.cfg.Mail.Driver)
+	}
+	c.MailQueue = jobs.NewQueue("mail", 2, 100, 30*time.Second, c.log)
+
+	// Rate limiting
+	switch c.cfg.Security.RateLimitStore {
+	case "postgres":
+		c.RateLimitRepo = repositories.NewRateLimitRepository(c.db, c.log)
+		c.RateLimitStore = c.RateLimitRepo
+	case "memory":
+		c.RateLimitStore = ratelimit.NewMemoryStore()
+	default:
+		return fmt.Errorf("rate limit: unknown RATE_LIMIT_STORE %q", c.cfg.Security.RateLimitStore)
+	}
+
 	return nil
 }
 
 func (c *Container) buildRepositories() {
 	c.UserRepo = repositories.NewUserRepository(c.db, c.log)
-	c.PatientRepo = repositories.NewPatientRepository(c.db, c.log)
+	c.PatientRepo = repositories.NewPatientRepository(c.db, c.Fields, c.log)
+	c.CareTeamRepo = repositories.NewCareTeamRepository(c.db, c.log)
 	c.NoteRepo = repositories.NewNoteRepository(c.db, c.log)
 	c.ConvRepo = repositories.NewConversationRepository(c.db, c.log)
 	c.MessageRepo = repositories.NewMessageRepository(c.db, c.log)
 	c.AttachmentRepo = repositories.NewAttachmentRepository(c.db, c.log)
+	c.BlobRepo = repositories.NewBlobRepository(c.db, c.log)
+	c.SessionRepo = repositories.NewSessionRepository(c.db, c.log)
+	c.UserTokenRepo = repositories.NewUserTokenRepository(c.db, c.log)
+	c.RecoveryRepo = repositories.NewRecoveryCodeRepository(c.db, c.log)
+	c.MFAPolicyRepo = repositories.NewMFAPolicyRepository(c.db, c.log)
+	c.IdentityRepo = repositories.NewIdentityRepository(c.db, c.log)
+	c.APIKeyRepo = repositories.NewAPIKeyRepository(c.db, c.log)
+	c.ThrottleRepo = repositories.NewLoginThrottleRepository(c.db, c.log)
+	c.OrgRepo = repositories.NewOrganizationRepository(c.db, c.log)
+	c.InviteRepo = repositories.NewInvitationRepository(c.db, c.log)
+	c.AuditRepo = repositories.NewAuditRepository(c.db, c.log)
+	c.FieldCryptRepo = repositories.NewFieldEncryptionRepository(c.db, c.Fields, c.log)
+	c.ExportRepo = repositories.NewPatientExportRepository(c.db, c.log)
+	c.HoldRepo = repositories.NewLegalHoldRepository(c.db, c.log)
+	c.RetentionRepo = repositories.NewRetentionRepository(c.db, c.log)
 }
 
 func (c *Container) buildServices() error {
-	c.UserSvc = services.NewUserService(c.UserRepo, c.JWTManager, c.cfg.Security.BcryptCost, c.log)
-	c.PatientSvc = services.NewPatientService(c.PatientRepo, c.log)
+	c.SessionSvc = services.NewSessionService(c.SessionRepo, c.UserRepo, c.MFAPolicyRepo, c.OrgRepo, c.JWTManager, c.cfg.JWT.SessionCacheTTL, c.log)
+	c.LoginGuard = services.NewLoginGuard(c.ThrottleRepo, c.cfg.Security, c.log)
+	c.MFASvc = services.NewMFAService(c.UserRepo, c.RecoveryRepo, c.MFAPolicyRepo, c.SessionSvc, c.LoginGuard, c.JWTManager, c.cfg.Auth.MFAIssuer, c.log)
+	c.AuditSvc = services.NewAuditService(c.AuditRepo, c.log)
+	c.OrgSvc = services.NewOrganizationService(c.OrgRepo, c.UserRepo, c.SessionSvc, c.log)
+	c.UserSvc = services.NewUserService(c.UserRepo, c.SessionSvc, c.MFASvc, c.OrgSvc, c.AuditSvc, c.LoginGuard, c.cfg.Security.BcryptCost, c.cfg.Auth.ImpersonationTTL, c.cfg.Auth.SelfRegistration, c.log)
+	c.APIKeySvc = services.NewAPIKeyService(c.APIKeyRepo, c.UserRepo, c.OrgRepo, c.log)
+	if c.cfg.OIDC.Issuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       c.cfg.OIDC.Issuer,
+			ClientID:     c.cfg.OIDC.ClientID,
+			ClientSecret: c.cfg.OIDC.ClientSecret,
+			RedirectURL:  c.cfg.OIDC.RedirectURL,
+			Scopes:       c.cfg.OIDC.Scopes,
+		}, nil)
+		c.OIDCSvc = services.NewOIDCService(provider, c.IdentityRepo, c.UserRepo, c.OrgRepo, c.UserSvc, c.cfg.OIDC, c.log)
+	}
+	c.AccountSvc = services.NewAccountService(
+		c.UserRepo,
+		c.UserTokenRepo,
+		c.SessionSvc,
+		c.Mailer,
+		c.MailQueue,
+		c.cfg.Auth,
+		c.cfg.Security.BcryptCost,
+		c.log)
+	c.InviteSvc = services.NewInvitationService(
+		c.InviteRepo,
+		c.UserRepo,
+		c.OrgRepo,
+		c.LoginGuard,
+		c.JWTManager,
+		c.Mailer,
+		c.MailQueue,
+		c.cfg.Auth,
+		c.cfg.Security.BcryptCost,
+		c.log)
+	c.PatientSvc = services.NewPatientService(c.PatientRepo, c.CareTeamRepo, c.OrgRepo, c.log)
 	c.NoteSvc = services.NewNoteService(c.NoteRepo, c.log)
 	c.MessageSvc = services.NewMessageService(c.MessageRepo, c.log)
-	c.AttachmentSvc = services.NewAttachmentService(c.AttachmentRepo, c.S3Client, c.log)
+	c.PreviewSvc = services.NewPreviewService(
+		c.AttachmentRepo,
+		c.S3Client,
+		preview.NewGenerator(c.cfg.Preview.MaxDimension, c.cfg.Preview.PDFToPPMPath, c.cfg.Preview.PDFInfoPath),
+		c.PreviewQueue,
+		c.log)
+	c.AttachmentSvc = services.NewAttachmentService(c.AttachmentRepo, c.BlobRepo, c.S3Client, c.PreviewSvc, c.cfg.Attachment, c.log)
+	c.ReconcileSvc = services.NewReconcileService(c.AttachmentRepo, c.BlobRepo, c.S3Client, c.log)
+	c.FieldCryptSvc = services.NewFieldEncryptionService(c.FieldCryptRepo, c.log)
+	c.ExportSvc = services.NewPatientExportService(
+		c.ExportRepo,
+		c.PatientRepo,
+		c.NoteRepo,
+		c.ConvRepo,
+		c.AttachmentRepo,
+		c.S3Client,
+		c.AuditSvc,
+		c.ExportQueue,
+		c.cfg.Export.LinkTTL,
+		c.log)
+	c.RetentionSvc = services.NewRetentionService(
+		c.RetentionRepo,
+		c.HoldRepo,
+		c.PatientRepo,
+		c.ExportRepo,
+		c.AttachmentSvc,
+		c.S3Client,
+		c.AuditSvc,
+		c.cfg.Retention,
+		c.log)
 	c.ConvSvc = services.NewConversationService(
 		c.ConvRepo,
 		c.SploseCloneAIClient,
@@ -134,11 +339,22 @@ func (c *Container) buildServices() error {
 }
 
 func (c *Container) buildHandlers() error {
-	c.AuthHandler = handlers.NewAuthHandler(c.UserSvc, c.log)
-	c.UserHandler = handlers.NewUserHandler(c.UserSvc, c.log)
+	c.AuthHandler = handlers.NewAuthHandler(c.UserSvc, c.SessionSvc, c.AccountSvc, c.MFASvc, c.log)
+	c.UserHandler = handlers.NewUserHandler(c.UserSvc, c.SessionSvc, c.AccountSvc, c.log)
 	c.PatientHandler = handlers.NewPatientHandler(c.PatientSvc, c.log)
 	c.NoteHandler = handlers.NewNoteHandler(c.NoteSvc, c.ConvSvc, c.log)
 	c.ConvHandler = handlers.NewConversationHandler(c.ConvSvc, c.MessageSvc, c.AttachmentSvc, c.log)
+	c.AttachHandler = handlers.NewAttachmentHandler(c.AttachmentSvc, c.log)
+	c.MFAHandler = handlers.NewMFAHandler(c.MFASvc, c.log)
+	c.APIKeyHandler = handlers.NewAPIKeyHandler(c.APIKeySvc, c.log)
+	c.OrgHandler = handlers.NewOrganizationHandler(c.OrgSvc, c.SessionSvc, c.log)
+	c.InviteHandler = handlers.NewInvitationHandler(c.InviteSvc, c.log)
+	c.AuditHandler = handlers.NewAuditHandler(c.AuditSvc, c.log)
+	c.ExportHandler = handlers.NewPatientExportHandler(c.ExportSvc, c.log)
+	c.RetainHandler = handlers.NewRetentionHandler(c.RetentionSvc, c.log)
+	if c.OIDCSvc != nil {
+		c.OIDCHandler = handlers.NewOIDCHandler(c.OIDCSvc, c.log)
+	}
 	return nil
 }
 
@@ -146,15 +362,86 @@ func (c *Container) buildHandlers() error {
 func (c *Container) Router() interface{} {
 	return handlers.SetupRouter(handlers.RouterDeps{
 		Log:            c.log,
+		TrustedProxies: c.cfg.Server.TrustedProxies,
 		JWTManager:     c.JWTManager,
+		Sessions:       c.SessionSvc,
+		APIKeys:        c.APIKeySvc,
+		Audit:          c.AuditSvc,
+		RateLimits: handlers.RateLimits{
+			Store:         c.RateLimitStore,
+			API:           ratelimit.Limit{Rate: c.cfg.Security.RateLimiteRPS, Burst: c.cfg.Security.RateLimitBurst},
+			Auth:          ratelimit.Limit{Rate: c.cfg.Security.AuthRateLimitRPS, Burst: c.cfg.Security.AuthRateLimitBurst},
+			AI:            ratelimit.Limit{Rate: c.cfg.Security.AIRateLimitRPS, Burst: c.cfg.Security.AIRateLimitBurst},
+			TokenEndpoint: ratelimit.PerMinute(c.cfg.Auth.TokenEndpointLimit),
+		},
 		AuthHandler:    c.AuthHandler,
 		UserHandler:    c.UserHandler,
 		PatientHandler: c.PatientHandler,
 		NoteHandler:    c.NoteHandler,
 		ConvHandler:    c.ConvHandler,
+		AttachHandler:  c.AttachHandler,
+		MFAHandler:     c.MFAHandler,
+		OIDCHandler:    c.OIDCHandler,
+		APIKeyHandler:  c.APIKeyHandler,
+		OrgHandler:     c.OrgHandler,
+		InviteHandler:  c.InviteHandler,
+		AuditHandler:   c.AuditHandler,
+		ExportHandler:  c.ExportHandler,
+		RetainHandler:  c.RetainHandler,
 	})
 }
 
-func (c *Container) Close() error {
+// StartWorkers starts background processing. It is separate from New so
+// one-off commands can build a Container without running jobs.
+func (c *Container) StartWorkers(ctx context.Context) {
+	c.PreviewQueue.Start()
+	c.MailQueue.Start()
+	c.ExportQueue.Start()
+	if err := c.PreviewSvc.ResumePending(ctx); err != nil {
+		c.log.Error("resuming pending previews failed", zap.Error(err))
+	}
+	if err := c.ExportSvc.ResumePending(ctx); err != nil {
+		c.log.Error("resuming pending patient exports failed", zap.Error(err))
+	}
+
+	if !c.cfg.Jobs.SchedulerEnabled {
+		c.log.Info("scheduler disabled on this instance")
+		return
+	}
+	c.Scheduler.Every("reconcile-attachments", c.cfg.Jobs.ReconcileInterval, func(ctx context.Context) error {
+		_, err := c.ReconcileSvc.Run(ctx, services.ReconcileOptions{
+			DeleteOrphans: c.cfg.Jobs.ReconcileDeleteOrphans,
+			GracePeriod:   c.cfg.Jobs.ReconcileGracePeriod,
+		})
+		return err
+	})
+	c.Scheduler.Every("reencrypt-fields", c.cfg.Jobs.FieldReencryptInterval, c.FieldCryptSvc.Reencrypt)
+	c.Scheduler.Every("prune-sessions", c.cfg.Jobs.SessionPruneInterval, func(ctx context.Context) error {
+		return c.SessionSvc.Prune(ctx, c.cfg.Jobs.SessionRetention)
+	})
+	c.Scheduler.Every("prune-patient-exports", c.cfg.Jobs.SessionPruneInterval, c.ExportSvc.PruneExpired)
+	c.Scheduler.Every("purge-retention", c.cfg.Retention.PurgeInterval, func(ctx context.Context) error {
+		_, err := c.RetentionSvc.Purge(ctx, false)
+		return err
+	})
+	c.Scheduler.Every("prune-login-throttles", c.cfg.Jobs.SessionPruneInterval, c.LoginGuard.Prune)
+	if c.RateLimitRepo != nil {
+		c.Scheduler.Every("prune-rate-limits", c.cfg.Jobs.SessionPruneInterval, func(ctx context.Context) error {
+			_, err := c.RateLimitRepo.DeleteIdle(ctx, time.Now())
+			return err
+		})
+	}
+	if c.OIDCSvc != nil {
+		c.Scheduler.Every("prune-oidc-states", c.cfg.Jobs.SessionPruneInterval, c.OIDCSvc.Prune)
+	}
+	c.Scheduler.Start()
+}
+
+// Close drains background queues, giving in-flight jobs until ctx is done.
+func (c *Container) Close(ctx context.Context) error {
+	c.Scheduler.Stop(ctx)
+	c.PreviewQueue.Stop(ctx)
+	c.MailQueue.Stop(ctx)
+	c.ExportQueue.Stop(ctx)
 	return nil
 }
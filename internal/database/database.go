@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,21 +15,31 @@ import (
 
 	"github.com/jamesphm04/splose-clone-be/internal/config"
 	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
 )
 
 // Connect opens a PostgreSQL connection pool using the supplied config and
-// returns a configured *gorm.DB instance.
+// returns a configured *gorm.DB instance. Columns tagged for encryption are
+// encrypted with fields.
 // The provided *zap.Logger is used for GORM's internal SQL logging.
-func Connect(cfg config.DBConfig, appEnv string, log *zap.Logger) (*gorm.DB, error) {
-	gormLog := newZapGORMLogger(log.Named("gorm"), appEnv)
+func Connect(cfg config.DBConfig, appEnv string, fields *fieldcrypt.Cipher, log *zap.Logger) (*gorm.DB, error) {
+	gormLog := newZapGORMLogger(log.Named("gorm"), appEnv, cfg.LogParams)
 
 	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
 		Logger:  gormLog,
 		NowFunc: func() time.Time { return time.Now().UTC() },
+		// Report constraint violations as gorm.ErrDuplicatedKey and friends.
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("gorm.Open: %w", err)
 	}
+	if err := db.Use(tenancy{}); err != nil {
+		return nil, fmt.Errorf("registering tenancy: %w", err)
+	}
+	if err := db.Use(fieldEncryption{cipher: fields}); err != nil {
+		return nil, fmt.Errorf("registering field encryption: %w", err)
+	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -50,23 +61,251 @@ func Connect(cfg config.DBConfig, appEnv string, log *zap.Logger) (*gorm.DB, err
 func Migrate(db *gorm.DB, log *zap.Logger) error {
 	log.Info("running auto-migration")
 
+	// Accounts created before email verification existed are treated as
+	// verified. Decide before migrating, while the column is still missing.
+	backfillVerified := db.Migrator().HasTable(&entities.User{}) &&
+		!db.Migrator().HasColumn(&entities.User{}, "EmailVerifiedAt")
+
+	// Roles used to be global, held by the user rather than the membership.
+	rolesOnUsers := db.Migrator().HasColumn("users", "role")
+
+	if err := backfillOrganization(db, log); err != nil {
+		return err
+	}
+
 	err := db.AutoMigrate(
 		&entities.User{},
+		&entities.Organization{},
+		&entities.Membership{},
+		&entities.Invitation{},
+		&entities.AuditEvent{},
 		&entities.Patient{},
+		&entities.CareTeamMember{},
 		&entities.Note{},
 		&entities.Conversation{},
 		&entities.Message{},
 		&entities.Attachment{},
+		&entities.PatientExport{},
+		&entities.LegalHold{},
+		&entities.PurgeReport{},
+		&entities.Blob{},
+		&entities.Session{},
+		&entities.UserToken{},
+		&entities.RecoveryCode{},
+		&entities.MFAPolicy{},
+		&entities.UserIdentity{},
+		&entities.OIDCLoginState{},
+		&entities.APIKey{},
+		&entities.LoginThrottle{},
+		&entities.RateLimitBucket{},
 		&entities.Prompt{},
 	)
 	if err != nil {
 		return fmt.Errorf("AutoMigrate: %w", err)
 	}
 
+	// Patient emails used to be unique across all organisations.
+	if db.Migrator().HasIndex(&entities.Patient{}, "idx_patients_email") {
+		if err := db.Migrator().DropIndex(&entities.Patient{}, "idx_patients_email"); err != nil {
+			return fmt.Errorf("dropping global patient email index: %w", err)
+		}
+	}
+	// Now that emails are encrypted, uniqueness is on their blind index.
+	if db.Migrator().HasIndex(&entities.Patient{}, "idx_patients_org_email") {
+		if err := db.Migrator().DropIndex(&entities.Patient{}, "idx_patients_org_email"); err != nil {
+			return fmt.Errorf("dropping patient email index: %w", err)
+		}
+	}
+
+	if backfillVerified {
+		res := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL")
+		if res.Error != nil {
+			return fmt.Errorf("backfilling email_verified_at: %w", res.Error)
+		}
+		log.Info("existing users marked as verified", zap.Int64("count", res.RowsAffected))
+	}
+
+	if rolesOnUsers {
+		if err := moveRolesToMemberships(db, log); err != nil {
+			return err
+		}
+	}
+	res := db.Exec(`UPDATE mfa_policies SET role = 'practitioner' WHERE role = 'user'
+		AND NOT EXISTS (SELECT 1 FROM mfa_policies WHERE role = 'practitioner')`)
+	if res.Error != nil {
+		return fmt.Errorf("migrating mfa policy role: %w", res.Error)
+	}
+
+	if err := sealAuditEvents(db, log); err != nil {
+		return err
+	}
+	// Lists record the patients shown in their details, see AuditFilter.
+	err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_events_patient_ids
+		ON audit_events USING GIN ((details->'patientIds') jsonb_path_ops)`).Error
+	if err != nil {
+		return fmt.Errorf("indexing audit event patients: %w", err)
+	}
+
 	log.Info("migration completed successfully")
 	return nil
 }
 
+// tenantTables hold rows owned by an organisation, see tenancy.
+var tenantTables = []string{"patients", "notes", "conversations", "messages", "attachments", "prompts", "api_keys"}
+
+// backfillOrganization moves data that predates organisations into a
+// default organisation, which every existing user joins. It runs before
+// AutoMigrate, which could not add the NOT NULL organization_id columns to
+// tables that already have rows.
+func backfillOrganization(db *gorm.DB, log *zap.Logger) error {
+	var pending []string
+	for _, table := range tenantTables {
+		if db.Migrator().HasTable(table) && !db.Migrator().HasColumn(table, "organization_id") {
+			pending = append(pending, table)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&entities.User{}, &entities.Organization{}, &entities.Membership{}); err != nil {
+			return fmt.Errorf("creating organisations: %w", err)
+		}
+		org := entities.Organization{Name: "Default clinic", Slug: "default"}
+		if err := tx.Where("slug = ?", org.Slug).FirstOrCreate(&org).Error; err != nil {
+			return fmt.Errorf("creating default organisation: %w", err)
+		}
+
+		for _, table := range pending {
+			if err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN organization_id uuid").Error; err != nil {
+				return fmt.Errorf("adding %s.organization_id: %w", table, err)
+			}
+			if err := tx.Exec("UPDATE "+table+" SET organization_id = ?", org.ID).Error; err != nil {
+				return fmt.Errorf("backfilling %s.organization_id: %w", table, err)
+			}
+		}
+
+		res := tx.Exec(`INSERT INTO memberships (organization_id, user_id, created_at)
+			SELECT ?, id, NOW() FROM users WHERE deleted_at IS NULL ON CONFLICT DO NOTHING`, org.ID)
+		if res.Error != nil {
+			return fmt.Errorf("adding users to default organisation: %w", res.Error)
+		}
+
+		log.Info("existing data moved to default organisation",
+			zap.String("organizationID", org.ID),
+			zap.Strings("tables", pending),
+			zap.Int64("members", res.RowsAffected),
+		)
+		return nil
+	})
+}
+
+// moveRolesToMemberships gives every membership the role its user held
+// while roles were global, then drops the users' column. The catch-all
+// "user" role predates authz roles; it had full clinical access, which is
+// what practitioner grants.
+func moveRolesToMemberships(db *gorm.DB, log *zap.Logger) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(`UPDATE memberships m
+			SET role = CASE WHEN u.role IS NULL OR u.role = 'user' THEN 'practitioner' ELSE u.role END
+			FROM users u WHERE u.id = m.user_id`)
+		if res.Error != nil {
+			return fmt.Errorf("copying user roles to memberships: %w", res.Error)
+		}
+		if err := tx.Exec("ALTER TABLE users DROP COLUMN role").Error; err != nil {
+			return fmt.Errorf("dropping users.role: %w", err)
+		}
+		log.Info("user roles moved to memberships", zap.Int64("memberships", res.RowsAffected))
+		return nil
+	})
+}
+
+// sealAuditEvents chains audit events recorded before the hash chain, in
+// the order they happened, and then makes the table append-only.
+func sealAuditEvents(db *gorm.DB, log *zap.Logger) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", entities.AuditChainLock).Error; err != nil {
+			return err
+		}
+		// Only the columns such events have; the chain's are still NULL.
+		var unsealed []entities.AuditEvent
+		err := tx.Select("id, actor_id, impersonator_id, action, resource_type, resource_id, details, created_at").
+			Where("seq IS NULL").Order("created_at, id").Find(&unsealed).Error
+		if err != nil {
+			return err
+		}
+		if len(unsealed) == 0 {
+			return nil
+		}
+
+		var prev *entities.AuditEvent
+		var last entities.AuditEvent
+		err = tx.Where("seq IS NOT NULL").Order("seq DESC").Take(&last).Error
+		switch {
+		case err == nil:
+			prev = &last
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		for i := range unsealed {
+			e := &unsealed[i]
+			e.Seal(prev)
+			err := tx.Model(e).Updates(map[string]any{
+				"seq":        e.Seq,
+				"prev_hash":  e.PrevHash,
+				"hash":       e.Hash,
+				"outcome":    e.Outcome,
+				"created_at": e.CreatedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			prev = e
+		}
+		log.Info("existing audit events chained", zap.Int("count", len(unsealed)))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("chaining audit events: %w", err)
+	}
+
+	// Rows can still be sealed, in case an older instance appended some
+	// during a rolling deploy; nothing else may change.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+			BEGIN
+				IF TG_LEVEL = 'ROW' AND TG_OP = 'UPDATE' THEN
+					IF OLD.seq IS NULL THEN
+						RETURN NEW;
+					END IF;
+				END IF;
+				RAISE EXCEPTION 'audit_events is append-only';
+			END
+			$$ LANGUAGE plpgsql`).Error
+		if err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			"DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events",
+			"DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events",
+			`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+				FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`,
+			`CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+				FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("making audit events append-only: %w", err)
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // zapGORMLogger – adapts *zap.Logger to the gorm/logger.Interface contract.
 // ---------------------------------------------------------------------------
@@ -76,13 +315,15 @@ type zapGORMLogger struct {
 	slowThreshold             time.Duration
 	ignoreRecordNotFoundError bool
 	level                     gormlogger.LogLevel
+	params                    bool
 }
 
-func newZapGORMLogger(log *zap.Logger, env string) gormlogger.Interface {
+func newZapGORMLogger(log *zap.Logger, env string, params bool) gormlogger.Interface {
 	l := &zapGORMLogger{
 		log:                       log,
 		slowThreshold:             200 * time.Millisecond,
 		ignoreRecordNotFoundError: true,
+		params:                    params,
 	}
 	if env == "production" {
 		l.level = gormlogger.Warn // only log slow queries + errors in production
@@ -98,6 +339,17 @@ func (z *zapGORMLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface
 	return &clone
 }
 
+var unfilledPlaceholder = regexp.MustCompile(`\$(\d+)\$`)
+
+// ParamsFilter leaves parameters out of logged SQL, which then shows their
+// placeholders, unless they were asked for.
+func (z *zapGORMLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if !z.params {
+		return sql, nil
+	}
+	return sql, params
+}
+
 func (z *zapGORMLogger) Info(_ context.Context, msg string, data ...interface{}) {
 	if z.level >= gormlogger.Info {
 		z.log.Sugar().Infof(msg, data...)
@@ -123,6 +375,10 @@ func (z *zapGORMLogger) Trace(_ context.Context, begin time.Time, fc func() (sql
 
 	elapsed := time.Since(begin)
 	sql, rows := fc()
+	if !z.params {
+		// Explain marks placeholders it had no parameter for as $1$.
+		sql = unfilledPlaceholder.ReplaceAllString(sql, "$$$1")
+	}
 
 	fields := []zap.Field{
 		zap.Duration("elapsed", elapsed),
@@ -0,0 +1,78 @@
+// Package databasetest opens the PostgreSQL database used by tests that
+// need real SQL, such as record-level access scoping.
+//
+// Tests using it are skipped unless TEST_DB_NAME names a database they may
+// write to. TEST_DB_HOST, TEST_DB_PORT, TEST_DB_USER, TEST_DB_PASSWORD and
+// TEST_DB_SSL_MODE default to a local server. Rows are never cleaned up,
+// so tests should create their own organisation and users and only assert
+// on those. `make test-db` runs them against a throwaway server.
+package databasetest
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/database"
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
+)
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
+// Open connects to the test database, migrating it on first use, or skips
+// t if none is configured.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	name := os.Getenv("TEST_DB_NAME")
+	if name == "" {
+		t.Skip("TEST_DB_NAME not set; skipping database test")
+	}
+
+	db, err := database.Connect(config.DBConfig{
+		Host:            getEnv("TEST_DB_HOST", "localhost"),
+		Port:            getEnv("TEST_DB_PORT", "5432"),
+		User:            getEnv("TEST_DB_USER", "postgres"),
+		Password:        os.Getenv("TEST_DB_PASSWORD"),
+		Name:            name,
+		SSLMode:         getEnv("TEST_DB_SSL_MODE", "disable"),
+		MaxOpenConns:    5,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Minute,
+	}, "test", Fields(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	migrateOnce.Do(func() { migrateErr = database.Migrate(db, zap.NewNop()) })
+	if migrateErr != nil {
+		t.Fatalf("migrating test database: %v", migrateErr)
+	}
+	return db
+}
+
+// Fields returns a cipher for the columns of the test database. It does
+// not encrypt, so rows can be inspected by hand.
+func Fields() *fieldcrypt.Cipher {
+	fields, _ := fieldcrypt.New(nil) // cannot fail without keys
+	return fields
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
+)
+
+// fieldEncryption encrypts tagged string columns and maintains their blind
+// indexes, which are *string fields:
+//
+//	Email      string  `gorm:"serializer:encrypted"`
+//	EmailIndex *string `gorm:"type:varchar(64);index;blindIndex:Email"`
+//
+// Values are bound to their table and column ("patients.email"), which is
+// also the context of the blind index: look rows up by the column's
+// fieldcrypt.Cipher.BlindIndexes in that context.
+//
+// Write these columns from the struct (Create, Save, or Updates with the
+// model): updates from a map bypass both the encryption and the index.
+type fieldEncryption struct {
+	cipher *fieldcrypt.Cipher
+}
+
+func (fieldEncryption) Name() string { return "field_encryption" }
+
+func (f fieldEncryption) Initialize(db *gorm.DB) error {
+	schema.RegisterSerializer("encrypted", encryptedSerializer{cipher: f.cipher})
+
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("field_encryption:create", f.setBlindIndexes); err != nil {
+		return err
+	}
+	return cb.Update().Before("gorm:update").Register("field_encryption:update", f.setBlindIndexes)
+}
+
+// fieldContext is what an encrypted column's values, and its blind index,
+// are bound to.
+func fieldContext(field *schema.Field) string {
+	return field.Schema.Table + "." + field.DBName
+}
+
+func (f fieldEncryption) setBlindIndexes(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	for _, field := range db.Statement.Schema.Fields {
+		name := field.TagSettings["BLINDINDEX"]
+		if name == "" {
+			continue
+		}
+		src := db.Statement.Schema.LookUpField(name)
+		if src == nil {
+			db.AddError(fmt.Errorf("blind index %s: no field %q", field.Name, name))
+			return
+		}
+
+		set := func(rv reflect.Value) {
+			value := src.ReflectValueOf(ctx, rv).String()
+			var index *string
+			if idx := f.cipher.BlindIndex(fieldContext(src), value); idx != "" {
+				index = &idx
+			}
+			field.ReflectValueOf(ctx, rv).Set(reflect.ValueOf(index))
+		}
+		switch rv := db.Statement.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				set(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			set(rv)
+		}
+	}
+}
+
+// encryptedSerializer stores a string field through the Cipher.
+type encryptedSerializer struct {
+	cipher *fieldcrypt.Cipher
+}
+
+func (s encryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("%s: cannot decrypt %T", fieldContext(field), dbValue)
+	}
+
+	plaintext, err := s.cipher.Decrypt(stored, fieldContext(field))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fieldContext(field), err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (s encryptedSerializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue any) (any, error) {
+	plaintext, _ := fieldValue.(string)
+	return s.cipher.Encrypt(plaintext, fieldContext(field))
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// tenancy keeps organisations apart. On entities.TenantOwned models, when
+// a statement's context carries an authz.Actor, queries, updates and
+// deletes only match rows of the actor's organisation, and creates stamp it
+// on new rows. An actor without an organisation matches nothing and cannot
+// create anything.
+//
+// Raw SQL is not scoped, and neither are contexts without an actor, such
+// as those of background jobs and migrations.
+type tenancy struct{}
+
+func (tenancy) Name() string { return "tenancy" }
+
+func (tenancy) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("tenancy:create", stampTenant); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("tenancy:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenancy:update", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenancy:delete", scopeTenant); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("tenancy:row", scopeTenant)
+}
+
+// tenantOf returns the statement's organisation field and the actor's
+// organisation, or false if the statement is not to be scoped.
+func tenantOf(db *gorm.DB) (*schema.Field, string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, "", false
+	}
+	if _, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(entities.TenantOwned); !ok {
+		return nil, "", false
+	}
+	field := db.Statement.Schema.LookUpField("OrganizationID")
+	if field == nil {
+		return nil, "", false
+	}
+	a, ok := authz.ActorFrom(db.Statement.Context)
+	if !ok {
+		return nil, "", false
+	}
+	return field, a.OrgID, true
+}
+
+func scopeTenant(db *gorm.DB) {
+	field, orgID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	var cond clause.Expression = clause.Expr{SQL: "FALSE"}
+	if orgID != "" {
+		cond = clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: orgID}
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{cond}})
+}
+
+func stampTenant(db *gorm.DB) {
+	field, orgID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	if orgID == "" {
+		db.AddError(ErrNoOrganization)
+		return
+	}
+
+	ctx := db.Statement.Context
+	stamp := func(rv reflect.Value) {
+		v, zero := field.ValueOf(ctx, rv)
+		if zero {
+			if err := field.Set(ctx, rv, orgID); err != nil {
+				db.AddError(err)
+			}
+			return
+		}
+		if v != orgID {
+			db.AddError(ErrCrossTenant)
+		}
+	}
+
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+}
+
+var (
+	ErrNoOrganization = errors.New("no organisation selected")
+	ErrCrossTenant    = errors.New("record belongs to another organisation")
+)
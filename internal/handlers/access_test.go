@@ -0,0 +1,350 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/database/databasetest"
+	"github.com/jamesphm04/splose-clone-be/internal/handlers"
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+)
+
+// accessFixture is one clinic with a patient, owned by owner and cared for
+// by carer, and everything hanging off it: a note, its conversation, a
+// message, an attachment and an export. outsider is a practitioner in the same clinic
+// with no link to the patient.
+type accessFixture struct {
+	router *gin.Engine
+	orgID  string
+
+	owner, carer, outsider string
+
+	patientID, noteID, messageID, attachmentID, exportID string
+}
+
+const testUserHeader = "X-Test-User"
+
+func newAccessFixture(t *testing.T) *accessFixture {
+	t.Helper()
+	db := databasetest.Open(t)
+	f := &accessFixture{}
+	f.seed(t, db)
+	f.router = f.newRouter(t, db)
+	return f
+}
+
+// seed writes the fixture's rows without an actor, so they are neither
+// scoped nor stamped.
+func (f *accessFixture) seed(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	tag := uuid.NewString()[:8]
+	create := func(v any) {
+		t.Helper()
+		if err := db.Omit(clause.Associations).Create(v).Error; err != nil {
+			t.Fatalf("seeding %T: %v", v, err)
+		}
+	}
+
+	org := &entities.Organization{Name: "Access " + tag, Slug: "access-" + tag}
+	create(org)
+	f.orgID = org.ID
+
+	for _, id := range []*string{&f.owner, &f.carer, &f.outsider} {
+		u := &entities.User{Email: uuid.NewString() + "@example.com", Username: "practitioner", PasswordHash: "-"}
+		create(u)
+		create(&entities.Membership{OrganizationID: org.ID, UserID: u.ID, Role: authz.RolePractitioner})
+		*id = u.ID
+	}
+
+	patient := &entities.Patient{
+		OrganizationID: org.ID,
+		Email:          "patient-" + tag + "@example.com",
+		FirstName:      "Pat",
+		LastName:       "Ient",
+		PhoneNumber:    "+6140000" + tag[:4],
+		Gender:         entities.GenderUnknown,
+		UserID:         f.owner,
+	}
+	create(patient)
+	f.patientID = patient.ID
+	create(&entities.CareTeamMember{PatientID: patient.ID, UserID: f.carer, AddedBy: f.owner})
+
+	note := &entities.Note{OrganizationID: org.ID, PatientID: patient.ID, UserID: f.owner, Title: "Initial assessment", Content: "history"}
+	create(note)
+	f.noteID = note.ID
+
+	conv := &entities.Conversation{OrganizationID: org.ID, NoteID: note.ID}
+	create(conv)
+	msg := &entities.Message{OrganizationID: org.ID, ConversationID: conv.ID, Role: entities.RoleUser, Content: "summarise"}
+	create(msg)
+	f.messageID = msg.ID
+
+	att := &entities.Attachment{
+		OrganizationID: org.ID,
+		NoteID:         note.ID,
+		MessageID:      msg.ID,
+		URL:            "attachments/" + tag,
+		Name:           "referral.txt",
+		Type:           "text/plain",
+		Size:           8,
+		S3Key:          "attachments/" + tag,
+		PreviewStatus:  entities.PreviewNone,
+	}
+	create(att)
+	f.attachmentID = att.ID
+
+	expires := time.Now().Add(time.Hour)
+	export := &entities.PatientExport{
+		OrganizationID: org.ID,
+		PatientID:      patient.ID,
+		RequestedBy:    f.owner,
+		Status:         entities.ExportReady,
+		S3Key:          "exports/" + tag,
+		ExpiresAt:      &expires,
+	}
+	create(export)
+	f.exportID = export.ID
+}
+
+// newRouter mounts the clinical routes behind a stand-in for Authenticate
+// that signs the request in as the user named in testUserHeader.
+func (f *accessFixture) newRouter(t *testing.T, db *gorm.DB) *gin.Engine {
+	t.Helper()
+	log := zap.NewNop()
+
+	s3, err := storage.NewClient(context.Background(), "us-east-1", "key", "secret", "bucket", "http://localhost:1", time.Minute, log)
+	if err != nil {
+		t.Fatalf("storage.NewClient: %v", err)
+	}
+
+	orgRepo := repositories.NewOrganizationRepository(db, log)
+	patientRepo := repositories.NewPatientRepository(db, databasetest.Fields(), log)
+	noteRepo := repositories.NewNoteRepository(db, log)
+	convRepo := repositories.NewConversationRepository(db, log)
+	attachmentRepo := repositories.NewAttachmentRepository(db, log)
+	patientSvc := services.NewPatientService(patientRepo, repositories.NewCareTeamRepository(db, log), orgRepo, log)
+	noteSvc := services.NewNoteService(noteRepo, log)
+	messageSvc := services.NewMessageService(repositories.NewMessageRepository(db, log), log)
+	attachmentSvc := services.NewAttachmentService(attachmentRepo, repositories.NewBlobRepository(db, log), s3, nil, config.AttachmentConfig{}, log)
+	convSvc := services.NewConversationService(convRepo, nil, messageSvc, noteSvc, patientSvc, attachmentSvc, log)
+	exportSvc := services.NewPatientExportService(repositories.NewPatientExportRepository(db, log), patientRepo, noteRepo, convRepo, attachmentRepo, s3, nil, nil, time.Hour, log)
+
+	patientH := handlers.NewPatientHandler(patientSvc, log)
+	noteH := handlers.NewNoteHandler(noteSvc, convSvc, log)
+	convH := handlers.NewConversationHandler(convSvc, messageSvc, attachmentSvc, log)
+	attachH := handlers.NewAttachmentHandler(attachmentSvc, log)
+	exportH := handlers.NewPatientExportHandler(exportSvc, log)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api/v1", func(c *gin.Context) {
+		a := authz.Actor{UserID: c.GetHeader(testUserHeader), Role: authz.RolePractitioner, OrgID: f.orgID}
+		c.Set(middleware.ContextKeyUserID, a.UserID)
+		c.Set(middleware.ContextKeyRole, a.Role)
+		c.Set(middleware.ContextKeyOrgID, a.OrgID)
+		c.Request = c.Request.WithContext(authz.WithActor(c.Request.Context(), a))
+		c.Next()
+	})
+	api.GET("/patients", patientH.List)
+	api.GET("/patients/:id", patientH.GetByID)
+	api.PATCH("/patients/:id", patientH.Update)
+	api.GET("/patients/:id/care-team", patientH.ListCareTeam)
+	api.POST("/patients/:id/care-team", patientH.AddCareTeamMember)
+	api.DELETE("/patients/:id/care-team/:userID", patientH.RemoveCareTeamMember)
+	api.POST("/patients/:id/exports", exportH.Create)
+	api.GET("/patients/:id/exports", exportH.List)
+	api.GET("/patients/:id/exports/:exportID", exportH.GetByID)
+	api.GET("/patients/:id/exports/:exportID/download", exportH.Download)
+	api.POST("/notes", noteH.Create)
+	api.GET("/notes", noteH.List)
+	api.GET("/notes/patient/:patientID", noteH.ListByPatientID)
+	api.GET("/notes/:id", noteH.GetByID)
+	api.PATCH("/notes/:id", noteH.Update)
+	api.DELETE("/notes/:id", noteH.Delete)
+	api.POST("/conversations/send-message", convH.SendMessage)
+	api.GET("/conversations/messages", convH.ListMessagesByNoteID)
+	api.GET("/attachments", attachH.ListByNoteID)
+	api.GET("/attachments/:id", attachH.GetByID)
+	api.GET("/attachments/:id/content", attachH.Content)
+	api.GET("/attachments/:id/preview", attachH.Preview)
+	return r
+}
+
+func (f *accessFixture) do(t *testing.T, userID string, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	req.Header.Set(testUserHeader, userID)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// sendMessage posts a chat message about noteID, as the client's form does.
+func sendMessage(t *testing.T, noteID string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("noteID", noteID)
+	_ = mw.WriteField("message", "what changed since last visit?")
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/send-message", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// ids returns the IDs of the records in a list response.
+func ids(t *testing.T, w *httptest.ResponseRecorder) map[string]bool {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	var res struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decoding list: %v", err)
+	}
+	out := make(map[string]bool, len(res.Data))
+	for _, r := range res.Data {
+		out[r.ID] = true
+	}
+	return out
+}
+
+func TestRecordsOfOtherPractitionersAreNotFound(t *testing.T) {
+	f := newAccessFixture(t)
+
+	get := func(path string) func(*testing.T) *http.Request {
+		return func(*testing.T) *http.Request { return httptest.NewRequest(http.MethodGet, path, nil) }
+	}
+	send := func(method, path, body string) func(*testing.T) *http.Request {
+		return func(*testing.T) *http.Request {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}
+	}
+	patient := "/api/v1/patients/" + f.patientID
+	note := "/api/v1/notes/" + f.noteID
+	export := patient + "/exports/" + f.exportID
+	cases := []struct {
+		name string
+		req  func(*testing.T) *http.Request
+		// visible is whether owner and carer get a 200. Endpoints that
+		// change the record or reach storage or the AI service are only
+		// checked for the outsider.
+		visible bool
+	}{
+		{"patient", get(patient), true},
+		{"update patient", send(http.MethodPatch, patient, `{"firstName":"Changed"}`), false},
+		{"care team", get(patient + "/care-team"), true},
+		{"join care team", send(http.MethodPost, patient+"/care-team", `{"userId":"`+f.outsider+`"}`), false},
+		{"remove from care team", send(http.MethodDelete, patient+"/care-team/"+f.carer, ""), false},
+		{"exports", get(patient + "/exports"), true},
+		{"export", get(export), true},
+		{"request export", send(http.MethodPost, patient+"/exports", ""), false},
+		{"download export", get(export + "/download"), false},
+		{"note", get(note), true},
+		{"create note", send(http.MethodPost, "/api/v1/notes", `{"patientId":"`+f.patientID+`","userId":"`+f.outsider+`","content":"mine now"}`), false},
+		{"update note", send(http.MethodPatch, note, `{"content":"changed"}`), false},
+		{"delete note", send(http.MethodDelete, note, ""), false},
+		{"attachment", get("/api/v1/attachments/" + f.attachmentID), true},
+		{"attachment content", get("/api/v1/attachments/" + f.attachmentID + "/content"), false},
+		{"attachment preview", get("/api/v1/attachments/" + f.attachmentID + "/preview"), false},
+		{"send message", func(t *testing.T) *http.Request { return sendMessage(t, f.noteID) }, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := f.do(t, f.outsider, tc.req(t)); w.Code != http.StatusNotFound {
+				t.Errorf("outsider: status = %d, want 404; body %s", w.Code, w.Body)
+			}
+			if !tc.visible {
+				return
+			}
+			for who, userID := range map[string]string{"owner": f.owner, "care team member": f.carer} {
+				if w := f.do(t, userID, tc.req(t)); w.Code != http.StatusOK {
+					t.Errorf("%s: status = %d, want 200; body %s", who, w.Code, w.Body)
+				}
+			}
+		})
+	}
+
+	// The outsider's writes above must not have gone through regardless
+	// of the status they got.
+	t.Run("nothing changed", func(t *testing.T) {
+		w := f.do(t, f.owner, httptest.NewRequest(http.MethodGet, patient, nil))
+		var res struct {
+			Data struct {
+				FirstName string `json:"firstName"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Data.FirstName != "Pat" {
+			t.Errorf("patient first name = %q (%v), want %q", res.Data.FirstName, err, "Pat")
+		}
+		if w := f.do(t, f.owner, httptest.NewRequest(http.MethodGet, note, nil)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"content":"history"`) {
+			t.Errorf("note: status = %d, body %s; want it unchanged", w.Code, w.Body)
+		}
+		if notes := ids(t, f.do(t, f.owner, httptest.NewRequest(http.MethodGet, "/api/v1/notes/patient/"+f.patientID, nil))); len(notes) != 1 {
+			t.Errorf("patient has %d notes, want 1", len(notes))
+		}
+		members := f.do(t, f.owner, httptest.NewRequest(http.MethodGet, patient+"/care-team", nil)).Body.String()
+		if !strings.Contains(members, f.carer) || strings.Contains(members, f.outsider) {
+			t.Errorf("care team = %s, want the carer and not the outsider", members)
+		}
+		if exports := ids(t, f.do(t, f.owner, httptest.NewRequest(http.MethodGet, patient+"/exports", nil))); len(exports) != 1 {
+			t.Errorf("patient has %d exports, want 1", len(exports))
+		}
+	})
+}
+
+func TestListsLeaveOutRecordsOfOtherPractitioners(t *testing.T) {
+	f := newAccessFixture(t)
+
+	cases := []struct {
+		name, path, id string
+	}{
+		{"patients", "/api/v1/patients?pageSize=100", f.patientID},
+		{"notes", "/api/v1/notes?pageSize=100", f.noteID},
+		{"notes of patient", "/api/v1/notes/patient/" + f.patientID, f.noteID},
+		{"messages of note", "/api/v1/conversations/messages?noteID=" + f.noteID, f.messageID},
+		{"attachments of note", "/api/v1/attachments?noteID=" + f.noteID, f.attachmentID},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			list := func(userID string) map[string]bool {
+				return ids(t, f.do(t, userID, httptest.NewRequest(http.MethodGet, tc.path, nil)))
+			}
+			if list(f.outsider)[tc.id] {
+				t.Errorf("outsider's list includes %s", tc.id)
+			}
+			if !list(f.owner)[tc.id] {
+				t.Errorf("owner's list is missing %s", tc.id)
+			}
+			if !list(f.carer)[tc.id] {
+				t.Errorf("care team member's list is missing %s", tc.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// APIKeyHandler lets admins manage API keys for integrations.
+type APIKeyHandler struct {
+	apiKeySvc *services.APIKeyService
+	validate  *validator.Validate
+	log       *zap.Logger
+}
+
+func NewAPIKeyHandler(apiKeySvc *services.APIKeyService, log *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{apiKeySvc: apiKeySvc, validate: validator.New(), log: log.Named("api_key_handler")}
+}
+
+// Create  POST /api/v1/admin/api-keys  (admin only)
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var in services.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	key, err := h.apiKeySvc.Create(c.Request.Context(), middleware.GetUserID(c), middleware.GetOrgID(c), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAPIKeyScope),
+			errors.Is(err, services.ErrInvalidAPIKeyExpiry),
+			errors.Is(err, services.ErrInvalidAllowedIP),
+			errors.Is(err, services.ErrAPIKeyUserNotMember),
+			errors.Is(err, services.ErrNoOrganization):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "user")
+		default:
+			h.log.Error("create api key failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	// The key itself is only ever returned here.
+	utils.Created(c, key)
+}
+
+// List  GET /api/v1/admin/api-keys  (admin only)
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.apiKeySvc.List(c.Request.Context())
+	if err != nil {
+		h.log.Error("list api keys failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, keys, nil)
+}
+
+// Revoke  DELETE /api/v1/admin/api-keys/:id  (admin only)
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	if err := h.apiKeySvc.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "api key")
+			return
+		}
+		h.log.Error("revoke api key failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OK(c, gin.H{"message": "api key revoked"})
+}
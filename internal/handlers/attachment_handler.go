@@ -1 +1,145 @@
 package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/dtos"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// AttachmentHandler serves attachment metadata with download and preview links.
+type AttachmentHandler struct {
+	attachmentSvc *services.AttachmentService
+	log           *zap.Logger
+}
+
+func NewAttachmentHandler(attachmentSvc *services.AttachmentService, log *zap.Logger) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentSvc: attachmentSvc,
+		log:           log.Named("attachment_handler"),
+	}
+}
+
+// GetByID  GET /api/v1/attachments/:id
+func (h *AttachmentHandler) GetByID(c *gin.Context) {
+	att, err := h.attachmentSvc.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "attachment")
+			return
+		}
+		h.log.Error("get attachment failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	url, previewURL, err := h.attachmentSvc.URLs(c.Request.Context(), att)
+	if err != nil {
+		h.log.Error("presigning attachment failed", zap.String("attachmentID", att.ID), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, dtos.ToAttachmentDTO(att, url, previewURL))
+}
+
+// Content  GET /api/v1/attachments/:id/content
+func (h *AttachmentHandler) Content(c *gin.Context) {
+	h.stream(c, false)
+}
+
+// Preview  GET /api/v1/attachments/:id/preview
+func (h *AttachmentHandler) Preview(c *gin.Context) {
+	h.stream(c, true)
+}
+
+// stream proxies an attachment (or its preview) from storage, decrypting it
+// on the way through.
+func (h *AttachmentHandler) stream(c *gin.Context, preview bool) {
+	ctx := c.Request.Context()
+
+	att, err := h.attachmentSvc.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "attachment")
+			return
+		}
+		h.log.Error("get attachment failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	body, err := h.attachmentSvc.Open(ctx, att, preview)
+	if err != nil {
+		if errors.Is(err, services.ErrPreviewNotReady) {
+			utils.NotFound(c, "preview")
+			return
+		}
+		h.log.Error("opening attachment failed", zap.String("attachmentID", att.ID), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	defer body.Close()
+
+	contentType, size := att.Type, att.Size
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": att.Name})
+	if preview {
+		contentType, size = "image/jpeg", -1
+		disposition = "inline"
+	}
+
+	c.Header("Content-Disposition", disposition)
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", contentType)
+	if size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
+	c.Status(http.StatusOK)
+
+	// Headers are sent by now, so a failure part-way (e.g. a chunk that
+	// fails authentication) can only be logged; the client sees a short body.
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		h.log.Error("streaming attachment failed", zap.String("attachmentID", att.ID), zap.Error(err))
+	}
+}
+
+// ListByNoteID  GET /api/v1/attachments?noteID=xxx
+func (h *AttachmentHandler) ListByNoteID(c *gin.Context) {
+	noteID := c.Query("noteID")
+	if noteID == "" {
+		utils.BadRequest(c, "noteID is required")
+		return
+	}
+	middleware.SetAuditDetail(c, "noteId", noteID)
+
+	attachments, err := h.attachmentSvc.ListByNoteID(c.Request.Context(), noteID)
+	if err != nil {
+		h.log.Error("list attachments failed", zap.String("noteID", noteID), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	out := make([]*dtos.AttachmentDTO, 0, len(attachments))
+	for i := range attachments {
+		url, previewURL, err := h.attachmentSvc.URLs(c.Request.Context(), &attachments[i])
+		if err != nil {
+			h.log.Error("presigning attachment failed", zap.String("attachmentID", attachments[i].ID), zap.Error(err))
+			utils.InternalError(c)
+			return
+		}
+		out = append(out, dtos.ToAttachmentDTO(&attachments[i], url, previewURL))
+	}
+
+	utils.OKList(c, out, nil)
+}
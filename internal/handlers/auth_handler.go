@@ -2,27 +2,43 @@ package handlers
 
 import (
 	"errors"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
 )
 
 // AuthHandler handle authentication endpoints
 type AuthHandler struct {
-	userSvc  *services.UserService
-	validate *validator.Validate
-	log      *zap.Logger
+	userSvc    *services.UserService
+	sessionSvc *services.SessionService
+	accountSvc *services.AccountService
+	mfaSvc     *services.MFAService
+	validate   *validator.Validate
+	log        *zap.Logger
 }
 
-func NewAuthHandler(userSvc *services.UserService, log *zap.Logger) *AuthHandler {
+func NewAuthHandler(
+	userSvc *services.UserService,
+	sessionSvc *services.SessionService,
+	accountSvc *services.AccountService,
+	mfaSvc *services.MFAService,
+	log *zap.Logger,
+) *AuthHandler {
 	return &AuthHandler{
-		userSvc:  userSvc,
-		validate: validator.New(),
-		log:      log.Named("auth_handler"),
+		userSvc:    userSvc,
+		sessionSvc: sessionSvc,
+		accountSvc: accountSvc,
+		mfaSvc:     mfaSvc,
+		validate:   validator.New(),
+		log:        log.Named("auth_handler"),
 	}
 }
 
@@ -45,12 +61,21 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			utils.Conflict(c, err.Error())
 			return
 		}
+		if errors.Is(err, services.ErrRegistrationClosed) {
+			utils.ForbiddenMsg(c, err.Error())
+			return
+		}
 
 		h.log.Error("register failed", zap.Error(err))
 		utils.InternalError(c)
 		return
 	}
 
+	// The account exists either way; the user can ask for another email.
+	if err := h.accountSvc.SendVerification(c.Request.Context(), user); err != nil {
+		h.log.Error("sending verification email failed", zap.String("userID", user.ID), zap.Error(err))
+	}
+
 	utils.Created(c, user)
 }
 
@@ -66,23 +91,85 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, pair, err := h.userSvc.Login(c.Request.Context(), in)
+	user, result, err := h.userSvc.Login(c.Request.Context(), in, clientInfo(c))
 	if err != nil {
+		if lockedOut(c, err) {
+			return
+		}
 		if errors.Is(err, services.ErrInvalidCredentials) {
 			utils.Unauthorized(c, err.Error())
 			return
 		}
+		if errors.Is(err, services.ErrAccountDisabled) {
+			utils.ForbiddenMsg(c, err.Error())
+			return
+		}
 		h.log.Error("login failed", zap.Error(err))
 		utils.InternalError(c)
 		return
 	}
 
+	respondLogin(c, user, result)
+}
+
+// VerifyMFA  POST /api/v1/auth/mfa/verify
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var in services.MFAVerifyInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	user, pair, err := h.mfaSvc.CompleteLogin(c.Request.Context(), in, clientInfo(c))
+	if err != nil {
+		if lockedOut(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMFAChallenge) || errors.Is(err, services.ErrInvalidMFACode) {
+			utils.Unauthorized(c, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrAccountDisabled) {
+			utils.ForbiddenMsg(c, err.Error())
+			return
+		}
+		h.log.Error("mfa verification failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	loginResponse(c, user, pair)
+}
+
+// lockedOut answers 429 with a Retry-After header if err is a login lockout.
+func lockedOut(c *gin.Context, err error) bool {
+	var locked *services.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+	utils.TooManyRequests(c, locked.Error())
+	return true
+}
+
+// respondLogin writes the tokens of a finished login, or the challenge for
+// its second step (POST /auth/mfa/verify).
+func respondLogin(c *gin.Context, user *entities.User, result *services.LoginResult) {
+	if result.MFAChallenge != "" {
+		utils.OK(c, gin.H{
+			"mfaRequired":    true,
+			"challengeToken": result.MFAChallenge,
+		})
+		return
+	}
+	loginResponse(c, user, result.Tokens)
+}
+
+func loginResponse(c *gin.Context, user *entities.User, pair *services.TokenPair) {
 	utils.OK(c, gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"email":    user.Email,
 			"username": user.Username,
-			"role":     user.Role,
 		},
 		"tokens": gin.H{
 			"accessToken":  pair.AccessToken,
@@ -101,14 +188,170 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	pair, err := h.userSvc.RefreshTokens(c.Request.Context(), body.RefreshToken)
+	pair, err := h.sessionSvc.Refresh(c.Request.Context(), body.RefreshToken, clientInfo(c))
 	if err != nil {
-		utils.Unauthorized(c, err.Error())
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			utils.Unauthorized(c, err.Error())
+			return
+		}
+		h.log.Error("refresh failed", zap.Error(err))
+		utils.InternalError(c)
 		return
 	}
 
-	// Not send a new refresh token, just return the existing one
-	pair.RefreshToken = body.RefreshToken
-
+	// The presented refresh token is now spent; the client must keep the new one.
 	utils.OK(c, pair)
 }
+
+// Logout  POST /api/v1/auth/logout
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := middleware.GetSessionID(c)
+	if sessionID == "" {
+		utils.BadRequest(c, "token is not bound to a session")
+		return
+	}
+
+	if err := h.sessionSvc.Logout(c.Request.Context(), middleware.GetUserID(c), sessionID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "session")
+			return
+		}
+		h.log.Error("logout failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, gin.H{"message": "logged out"})
+}
+
+// EndImpersonation  POST /api/v1/auth/impersonation/end
+func (h *AuthHandler) EndImpersonation(c *gin.Context) {
+	err := h.userSvc.EndImpersonation(c.Request.Context(), middleware.GetUserID(c), middleware.GetSessionID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotImpersonating):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "session")
+		default:
+			h.log.Error("ending impersonation failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	utils.OK(c, gin.H{"message": "impersonation ended"})
+}
+
+// LogoutAll  POST /api/v1/auth/logout-all
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	n, err := h.sessionSvc.RevokeAll(c.Request.Context(), middleware.GetUserID(c), entities.SessionRevokedLogoutAll)
+	if err != nil {
+		h.log.Error("logout-all failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, gin.H{"message": "logged out of all devices", "sessionsRevoked": n})
+}
+
+// ForgotPassword  POST /api/v1/auth/password/forgot
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var in services.ForgotPasswordInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	if err := h.accountSvc.ForgotPassword(c.Request.Context(), in); err != nil {
+		h.log.Error("forgot password failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.Accepted(c, gin.H{"message": "if the address is registered, a reset link has been sent"})
+}
+
+// ResetPassword  POST /api/v1/auth/password/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var in services.ResetPasswordInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	if err := h.accountSvc.ResetPassword(c.Request.Context(), in); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Error("reset password failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, gin.H{"message": "password updated; sign in again"})
+}
+
+// VerifyEmail  POST /api/v1/auth/email/verify
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var in services.VerifyEmailInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	if err := h.accountSvc.VerifyEmail(c.Request.Context(), in); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Error("verify email failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	// Access tokens still carry the restriction; a refresh clears it.
+	utils.OK(c, gin.H{"message": "email verified; refresh your tokens"})
+}
+
+// ResendVerification  POST /api/v1/auth/email/resend
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	user, err := h.userSvc.GetByID(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		utils.NotFound(c, "user")
+		return
+	}
+
+	if err := h.accountSvc.SendVerification(c.Request.Context(), user); err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			utils.Conflict(c, err.Error())
+		case errors.Is(err, services.ErrTooManyAccountTokens):
+			utils.TooManyRequests(c, err.Error())
+		default:
+			h.log.Error("resend verification failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	utils.Accepted(c, gin.H{"message": "verification email sent"})
+}
+
+// bind decodes and validates a JSON body, writing the 400 itself on failure.
+func (h *AuthHandler) bind(c *gin.Context, in any) bool {
+	if err := c.ShouldBindJSON(in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return false
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return false
+	}
+	return true
+}
+
+// clientInfo describes the caller's device for session bookkeeping and
+// login throttling. The IP only comes from proxy headers set by one of
+// RouterDeps.TrustedProxies.
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/handlers"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+)
+
+// noUsers knows no accounts, so every login fails.
+type noUsers struct {
+	repositories.UserRepository
+}
+
+func (noUsers) FindByEmail(context.Context, string) (*entities.User, error) {
+	return nil, repositories.ErrNotFound
+}
+
+// memoryThrottles keeps login throttles in a map.
+type memoryThrottles struct {
+	repositories.LoginThrottleRepository
+	throttles map[string]*entities.LoginThrottle
+}
+
+func (r *memoryThrottles) Find(_ context.Context, key string) (*entities.LoginThrottle, error) {
+	if t, ok := r.throttles[key]; ok {
+		return t, nil
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *memoryThrottles) RecordFailure(_ context.Context, key string, now, _ time.Time) (int, error) {
+	t, ok := r.throttles[key]
+	if !ok {
+		t = &entities.LoginThrottle{Key: key}
+		r.throttles[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	return t.Failures, nil
+}
+
+func (r *memoryThrottles) Lock(_ context.Context, key string, until time.Time) error {
+	r.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func TestLoginThrottlesPeerAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const peer = "203.0.113.9"
+	throttles := &memoryThrottles{throttles: map[string]*entities.LoginThrottle{}}
+	guard := services.NewLoginGuard(throttles, config.SecurityConfig{
+		LoginFailureWindow:   time.Hour,
+		LoginIPThreshold:     3,
+		LoginLockoutDuration: time.Hour,
+	}, zap.NewNop())
+	userSvc := services.NewUserService(noUsers{}, nil, nil, nil, nil, guard, bcrypt.MinCost, time.Hour, false, zap.NewNop())
+	r := handlers.SetupRouter(handlers.RouterDeps{
+		Log:         zap.NewNop(),
+		AuthHandler: handlers.NewAuthHandler(userSvc, nil, nil, nil, zap.NewNop()),
+	})
+
+	// One password tried against a different account each time, with a
+	// made-up X-Forwarded-For to pass for a different client too.
+	login := func(i int) int {
+		body := `{"email":"user` + strconv.Itoa(i) + `@example.com","password":"Spring2026!"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "10.0.0."+strconv.Itoa(i))
+		req.RemoteAddr = peer + ":52000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := range 3 {
+		if code := login(i); code != http.StatusUnauthorized {
+			t.Fatalf("login %d: status %d, want 401", i+1, code)
+		}
+	}
+	if got := throttles.throttles["ip:"+peer]; got == nil || got.Failures != 3 {
+		t.Fatalf("failures counted against the peer address: %+v, want 3", got)
+	}
+	if code := login(3); code != http.StatusTooManyRequests {
+		t.Errorf("login after the IP threshold: status %d, want 429", code)
+	}
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
 	"github.com/jamesphm04/splose-clone-be/internal/models/dtos"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
 	"go.uber.org/zap"
@@ -50,6 +53,7 @@ func (h *ConversationHandler) SendMessage(c *gin.Context) {
 		utils.BadRequest(c, "noteID is required")
 		return
 	}
+	middleware.SetAuditDetail(c, "noteId", noteID)
 
 	// ─── Optional Attachment ──────────────────────────────
 	file, header, err := c.Request.FormFile("attachment")
@@ -65,10 +69,20 @@ func (h *ConversationHandler) SendMessage(c *gin.Context) {
 		FileHeader: header,
 	})
 	if err != nil {
-		utils.BadRequest(c, fmt.Sprintf("failed to send message: %v", err))
+		switch {
+		case errors.Is(err, services.ErrAttachmentTooLarge), errors.Is(err, services.ErrNoteQuotaExceeded):
+			utils.PayloadTooLarge(c, err.Error())
+		case errors.Is(err, services.ErrAttachmentTypeNotAllowed):
+			utils.UnsupportedMediaType(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "note")
+		default:
+			utils.BadRequest(c, fmt.Sprintf("failed to send message: %v", err))
+		}
 		return
 	}
 
+	middleware.SetAuditResource(c, assistantMsg.ID)
 	utils.OK(c, dtos.ToDTO(assistantMsg))
 }
 
@@ -80,6 +94,7 @@ func (h *ConversationHandler) ListMessagesByNoteID(c *gin.Context) {
 		utils.BadRequest(c, "noteID is required")
 		return
 	}
+	middleware.SetAuditDetail(c, "noteId", noteID)
 
 	messages, err := h.messageSvc.ListByNoteID(c.Request.Context(), noteID)
 	if err != nil {
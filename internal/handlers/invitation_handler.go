@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// InvitationHandler serves staff invitations: managing them within the
+// caller's organisation, and accepting one.
+type InvitationHandler struct {
+	invitationSvc *services.InvitationService
+	validate      *validator.Validate
+	log           *zap.Logger
+}
+
+func NewInvitationHandler(invitationSvc *services.InvitationService, log *zap.Logger) *InvitationHandler {
+	return &InvitationHandler{
+		invitationSvc: invitationSvc,
+		validate:      validator.New(),
+		log:           log.Named("invitation_handler"),
+	}
+}
+
+// Create  POST /api/v1/invitations
+func (h *InvitationHandler) Create(c *gin.Context) {
+	var in services.InviteInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	inv, err := h.invitationSvc.Invite(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), middleware.GetOrgID(c), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrNoOrganization):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, authz.ErrForbidden):
+			utils.Forbidden(c)
+		case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrInvitationPending):
+			utils.Conflict(c, err.Error())
+		default:
+			h.log.Error("create invitation failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	utils.Created(c, inv)
+}
+
+// List  GET /api/v1/invitations
+func (h *InvitationHandler) List(c *gin.Context) {
+	page, pageSize, offset := utils.Pagination(c)
+	invs, total, err := h.invitationSvc.List(c.Request.Context(), offset, pageSize)
+	if err != nil {
+		h.log.Error("list invitations failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, invs, utils.BuildMeta(page, pageSize, total))
+}
+
+// Resend  POST /api/v1/invitations/:id/resend
+func (h *InvitationHandler) Resend(c *gin.Context) {
+	inv, err := h.invitationSvc.Resend(c.Request.Context(), middleware.GetRole(c), c.Param("id"))
+	if err != nil {
+		h.respondError(c, "resend invitation failed", err)
+		return
+	}
+	utils.OK(c, inv)
+}
+
+// Revoke  DELETE /api/v1/invitations/:id
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	if err := h.invitationSvc.Revoke(c.Request.Context(), middleware.GetRole(c), c.Param("id")); err != nil {
+		h.respondError(c, "revoke invitation failed", err)
+		return
+	}
+	utils.OK(c, gin.H{"message": "invitation revoked"})
+}
+
+// Accept  POST /api/v1/auth/invitations/accept
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	var in services.AcceptInvitationInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.invitationSvc.Accept(c.Request.Context(), in, clientInfo(c))
+	if err != nil {
+		h.respondAcceptError(c, err)
+		return
+	}
+
+	// The user signs in as usual; the new clinic is among their organisations.
+	utils.OK(c, user)
+}
+
+// AcceptSignedIn  POST /api/v1/invitations/accept
+// For users who sign in without a password, e.g. through single sign-on.
+func (h *InvitationHandler) AcceptSignedIn(c *gin.Context) {
+	var in services.AcceptSignedInInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.invitationSvc.AcceptSignedIn(c.Request.Context(), middleware.GetUserID(c), in)
+	if err != nil {
+		h.respondAcceptError(c, err)
+		return
+	}
+
+	// Switch organisation to act in the new clinic.
+	utils.OK(c, user)
+}
+
+func (h *InvitationHandler) respondAcceptError(c *gin.Context, err error) {
+	if lockedOut(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidInvitation), errors.Is(err, services.ErrUsernameRequired),
+		errors.Is(err, services.ErrSignInToAccept):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrInvalidCredentials):
+		utils.Unauthorized(c, err.Error())
+	case errors.Is(err, services.ErrAccountDisabled):
+		utils.ForbiddenMsg(c, err.Error())
+	default:
+		h.log.Error("accept invitation failed", zap.Error(err))
+		utils.InternalError(c)
+	}
+}
+
+func (h *InvitationHandler) respondError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.NotFound(c, "invitation")
+	case errors.Is(err, authz.ErrForbidden):
+		utils.Forbidden(c)
+	case errors.Is(err, services.ErrInvitationClosed):
+		utils.Conflict(c, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		utils.InternalError(c)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// MFAHandler handles MFA enrolment for the signed-in user and the admin
+// per-role MFA policies.
+type MFAHandler struct {
+	mfaSvc   *services.MFAService
+	validate *validator.Validate
+	log      *zap.Logger
+}
+
+func NewMFAHandler(mfaSvc *services.MFAService, log *zap.Logger) *MFAHandler {
+	return &MFAHandler{mfaSvc: mfaSvc, validate: validator.New(), log: log.Named("mfa_handler")}
+}
+
+// BeginSetup  POST /api/v1/users/me/mfa/setup
+func (h *MFAHandler) BeginSetup(c *gin.Context) {
+	setup, err := h.mfaSvc.BeginSetup(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.fail(c, "mfa setup failed", err)
+		return
+	}
+	utils.OK(c, setup)
+}
+
+// ConfirmSetup  POST /api/v1/users/me/mfa/confirm
+func (h *MFAHandler) ConfirmSetup(c *gin.Context) {
+	var in services.MFACodeInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	codes, err := h.mfaSvc.ConfirmSetup(c.Request.Context(), middleware.GetUserID(c), in)
+	if err != nil {
+		h.fail(c, "mfa confirm failed", err)
+		return
+	}
+	// Recovery codes are only ever shown here.
+	utils.OK(c, gin.H{"recoveryCodes": codes})
+}
+
+// Disable  POST /api/v1/users/me/mfa/disable
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var in services.MFACodeInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	if err := h.mfaSvc.Disable(c.Request.Context(), middleware.GetUserID(c), in); err != nil {
+		h.fail(c, "mfa disable failed", err)
+		return
+	}
+	utils.OK(c, gin.H{"message": "mfa disabled"})
+}
+
+// RegenerateRecoveryCodes  POST /api/v1/users/me/mfa/recovery-codes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var in services.MFACodeInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	codes, err := h.mfaSvc.RegenerateRecoveryCodes(c.Request.Context(), middleware.GetUserID(c), in)
+	if err != nil {
+		h.fail(c, "regenerating recovery codes failed", err)
+		return
+	}
+	utils.OK(c, gin.H{"recoveryCodes": codes})
+}
+
+// ListPolicies  GET /api/v1/admin/mfa-policies  (admin only)
+func (h *MFAHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.mfaSvc.ListPolicies(c.Request.Context())
+	if err != nil {
+		h.log.Error("list mfa policies failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, policies, nil)
+}
+
+// SetPolicy  PUT /api/v1/admin/mfa-policies/:role  (system.manage)
+func (h *MFAHandler) SetPolicy(c *gin.Context) {
+	role := c.Param("role")
+	if !authz.ValidRole(role) {
+		utils.BadRequest(c, "unknown role")
+		return
+	}
+
+	var in services.MFAPolicyInput
+	if !h.bind(c, &in) {
+		return
+	}
+
+	policy, err := h.mfaSvc.SetPolicy(c.Request.Context(), role, in)
+	if err != nil {
+		h.log.Error("set mfa policy failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OK(c, policy)
+}
+
+func (h *MFAHandler) bind(c *gin.Context, in any) bool {
+	if err := c.ShouldBindJSON(in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return false
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return false
+	}
+	return true
+}
+
+func (h *MFAHandler) fail(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrMFAAlreadyEnabled),
+		errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFANotPending),
+		errors.Is(err, services.ErrMFARequiredByPolicy):
+		utils.Conflict(c, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		utils.InternalError(c)
+	}
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"slices"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
 	"go.uber.org/zap"
@@ -43,24 +47,35 @@ func (h *NoteHandler) Create(c *gin.Context) {
 		return
 	}
 
-	h.log.Info("note create request", zap.String("request", fmt.Sprintf("%+v", in)))
 	// then validate the request body
 	if err := h.validate.Struct(in); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
+	middleware.SetAuditPatient(c, in.PatientID)
 
 	// create the note
 	note, err := h.noteSvc.Create(c.Request.Context(), in)
 	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
 		utils.BadRequest(c, err.Error())
 		return
 	}
 
+	middleware.SetAuditResource(c, note.ID)
+
 	// create the conversation
 	conv, err := h.convSvc.Create(c.Request.Context(), services.CreateConversationInput{
 		NoteID: note.ID,
 	})
+	if err != nil {
+		h.log.Error("create note conversation failed", zap.String("noteID", note.ID), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
 
 	res := CreateNoteResponse{
 		NoteID:         note.ID,
@@ -76,7 +91,19 @@ func (h *NoteHandler) List(c *gin.Context) {
 	notes, total, err := h.noteSvc.List(c.Request.Context(), offset, pageSize)
 	if err != nil {
 		utils.InternalError(c)
+		return
+	}
+	ids := make([]string, len(notes))
+	var patientIDs []string
+	for i := range notes {
+		ids[i] = notes[i].ID
+		if !slices.Contains(patientIDs, notes[i].PatientID) {
+			patientIDs = append(patientIDs, notes[i].PatientID)
+		}
 	}
+	middleware.SetAuditDetail(c, "noteIds", ids)
+	// So the view turns up in each patient's audit trail.
+	middleware.SetAuditDetail(c, "patientIds", patientIDs)
 	utils.OKList(c, notes, utils.BuildMeta(page, pageSize, total))
 }
 
@@ -85,7 +112,12 @@ func (h *NoteHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
 	note, err := h.noteSvc.GetByID(c.Request.Context(), id)
 	if err != nil {
-		utils.NotFound(c, "patient")
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "note")
+			return
+		}
+		h.log.Error("get note failed", zap.String("noteID", id), zap.Error(err))
+		utils.InternalError(c)
 		return
 	}
 	utils.OK(c, note)
@@ -97,7 +129,8 @@ func (h *NoteHandler) ListByPatientID(c *gin.Context) {
 
 	notes, err := h.noteSvc.ListByPatientID(c.Request.Context(), patientID)
 	if err != nil {
-		utils.NotFound(c, "patient")
+		h.log.Error("list patient notes failed", zap.String("patientID", patientID), zap.Error(err))
+		utils.InternalError(c)
 		return
 	}
 	utils.OKList(c, notes, nil)
@@ -119,7 +152,36 @@ func (h *NoteHandler) Update(c *gin.Context) {
 
 	note, err := h.noteSvc.Update(c.Request.Context(), id, in)
 	if err != nil {
-		utils.BadRequest(c, err.Error())
+		switch {
+		case errors.Is(err, services.ErrNoteSigned):
+			utils.Conflict(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "note")
+		default:
+			utils.BadRequest(c, err.Error())
+		}
+		return
+	}
+	utils.OK(c, note)
+}
+
+// Sign POST /api/v1/notes/:id/sign
+func (h *NoteHandler) Sign(c *gin.Context) {
+	id := c.Param("id")
+	note, err := h.noteSvc.Sign(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "note")
+		case errors.Is(err, authz.ErrForbidden):
+			utils.Forbidden(c)
+		case errors.Is(err, services.ErrNoteSigned):
+			utils.Conflict(c, err.Error())
+		default:
+			h.log.Error("sign note failed", zap.String("noteID", id), zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
 	}
 	utils.OK(c, note)
 }
@@ -128,7 +190,14 @@ func (h *NoteHandler) Update(c *gin.Context) {
 func (h *NoteHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	if err := h.noteSvc.SoftDelete(c.Request.Context(), id); err != nil {
-		utils.BadRequest(c, err.Error())
+		switch {
+		case errors.Is(err, services.ErrNoteSigned):
+			utils.Conflict(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "note")
+		default:
+			utils.BadRequest(c, err.Error())
+		}
 		return
 	}
 	utils.OK(c, gin.H{"message": "note deleted"})
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// OIDCHandler handles single sign-on through the configured OpenID provider.
+type OIDCHandler struct {
+	oidcSvc  *services.OIDCService
+	validate *validator.Validate
+	log      *zap.Logger
+}
+
+func NewOIDCHandler(oidcSvc *services.OIDCService, log *zap.Logger) *OIDCHandler {
+	return &OIDCHandler{oidcSvc: oidcSvc, validate: validator.New(), log: log.Named("oidc_handler")}
+}
+
+// oidcStateCookie ties a login to the browser that started it. It is sent
+// only to the OIDC endpoints, and never to other sites' requests.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/auth/oidc"
+)
+
+// Authorize  GET /api/v1/auth/oidc/authorize
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	authz, err := h.oidcSvc.Begin(c.Request.Context())
+	if err != nil {
+		h.log.Error("starting oidc login failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, authz.State, int(time.Until(authz.ExpiresAt).Seconds()), oidcStateCookiePath, "", true, true)
+	utils.OK(c, authz)
+}
+
+// Callback  POST /api/v1/auth/oidc/callback
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var in services.OIDCCallbackInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	// The state is single-use, so the cookie is dropped whatever happens.
+	browserState, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", true, true)
+
+	user, result, err := h.oidcSvc.Complete(c.Request.Context(), in, browserState, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidOIDCState), errors.Is(err, services.ErrOIDCLoginFailed):
+			utils.Unauthorized(c, err.Error())
+		case errors.Is(err, services.ErrOIDCNoAccount), errors.Is(err, services.ErrAccountDisabled):
+			utils.ForbiddenMsg(c, err.Error())
+		default:
+			h.log.Error("oidc login failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	respondLogin(c, user, result)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// OrganizationHandler serves a user's own organisations, and the admin
+// endpoints that set organisations up.
+type OrganizationHandler struct {
+	orgSvc     *services.OrganizationService
+	sessionSvc *services.SessionService
+	validate   *validator.Validate
+	log        *zap.Logger
+}
+
+func NewOrganizationHandler(orgSvc *services.OrganizationService, sessionSvc *services.SessionService, log *zap.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgSvc:     orgSvc,
+		sessionSvc: sessionSvc,
+		validate:   validator.New(),
+		log:        log.Named("organization_handler"),
+	}
+}
+
+// ListMine  GET /api/v1/organizations
+func (h *OrganizationHandler) ListMine(c *gin.Context) {
+	memberships, err := h.orgSvc.ListForUser(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.log.Error("list organizations failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, memberships, nil)
+}
+
+// Switch  POST /api/v1/auth/switch-organization
+func (h *OrganizationHandler) Switch(c *gin.Context) {
+	var in services.SwitchOrganizationInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	pair, err := h.sessionSvc.SwitchOrganization(c.Request.Context(), middleware.GetUserID(c), middleware.GetSessionID(c), in.OrganizationID, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotMember):
+			utils.ForbiddenMsg(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "session")
+		default:
+			h.log.Error("switch organization failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	// The session's previous refresh token is spent; the client must keep the new pair.
+	utils.OK(c, pair)
+}
+
+// Create  POST /api/v1/admin/organizations  (admin only)
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	var in services.CreateOrganizationInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	// The admin joins the clinic with the role they act in now.
+	org, err := h.orgSvc.Create(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSlug):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, services.ErrSlugTaken):
+			utils.Conflict(c, err.Error())
+		default:
+			h.log.Error("create organization failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	utils.Created(c, org)
+}
+
+// List  GET /api/v1/admin/organizations  (admin only)
+func (h *OrganizationHandler) List(c *gin.Context) {
+	page, pageSize, offset := utils.Pagination(c)
+	orgs, total, err := h.orgSvc.List(c.Request.Context(), offset, pageSize)
+	if err != nil {
+		h.log.Error("list organizations failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, orgs, utils.BuildMeta(page, pageSize, total))
+}
+
+// ListMembers  GET /api/v1/admin/organizations/:id/members  (admin only)
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	members, err := h.orgSvc.ListMembers(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "organization")
+			return
+		}
+		h.log.Error("list organization members failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, members, nil)
+}
+
+// AddMember  POST /api/v1/admin/organizations/:id/members  (admin only)
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	var in services.AddMemberInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	member, err := h.orgSvc.AddMember(c.Request.Context(), c.Param("id"), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownMember), errors.Is(err, services.ErrInvalidRole):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "organization")
+		default:
+			h.log.Error("add organization member failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	utils.Created(c, member)
+}
+
+// RemoveMember  DELETE /api/v1/admin/organizations/:id/members/:userID  (admin only)
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	if err := h.orgSvc.RemoveMember(c.Request.Context(), c.Param("id"), c.Param("userID")); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "member")
+			return
+		}
+		h.log.Error("remove organization member failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OK(c, gin.H{"message": "member removed"})
+}
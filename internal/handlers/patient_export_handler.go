@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/dtos"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// PatientExportHandler requests and serves copies of a patient's record.
+type PatientExportHandler struct {
+	exportSvc *services.PatientExportService
+	log       *zap.Logger
+}
+
+func NewPatientExportHandler(exportSvc *services.PatientExportService, log *zap.Logger) *PatientExportHandler {
+	return &PatientExportHandler{
+		exportSvc: exportSvc,
+		log:       log.Named("patient_export_handler"),
+	}
+}
+
+// Create  POST /api/v1/patients/:id/exports
+func (h *PatientExportHandler) Create(c *gin.Context) {
+	export, err := h.exportSvc.Request(c.Request.Context(), c.Param("id"), middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
+		h.log.Error("request export failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	middleware.SetAuditDetail(c, "exportId", export.ID)
+
+	utils.Accepted(c, dtos.ToPatientExportDTO(export, ""))
+}
+
+// List  GET /api/v1/patients/:id/exports
+func (h *PatientExportHandler) List(c *gin.Context) {
+	exports, err := h.exportSvc.ListByPatientID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
+		h.log.Error("list exports failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	out := make([]*dtos.PatientExportDTO, 0, len(exports))
+	for i := range exports {
+		dto, ok := h.toDTO(c, &exports[i])
+		if !ok {
+			return
+		}
+		out = append(out, dto)
+	}
+
+	utils.OKList(c, out, nil)
+}
+
+// GetByID  GET /api/v1/patients/:id/exports/:exportID
+func (h *PatientExportHandler) GetByID(c *gin.Context) {
+	export, ok := h.find(c)
+	if !ok {
+		return
+	}
+	dto, ok := h.toDTO(c, export)
+	if !ok {
+		return
+	}
+
+	utils.OK(c, dto)
+}
+
+// Download  GET /api/v1/patients/:id/exports/:exportID/download
+func (h *PatientExportHandler) Download(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	export, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	body, err := h.exportSvc.Open(ctx, export)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrExportExpired):
+			utils.Gone(c, "export has expired")
+		case errors.Is(err, services.ErrExportNotReady):
+			utils.Conflict(c, "export is not ready")
+		default:
+			h.log.Error("opening export failed", zap.String("exportID", export.ID), zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	defer body.Close()
+
+	filename := "patient-export-" + export.ID + ".zip"
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Length", strconv.FormatInt(export.Size, 10))
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		h.log.Error("streaming export failed", zap.String("exportID", export.ID), zap.Error(err))
+	}
+}
+
+func (h *PatientExportHandler) find(c *gin.Context) (*entities.PatientExport, bool) {
+	exportID := c.Param("exportID")
+	middleware.SetAuditDetail(c, "exportId", exportID)
+
+	export, err := h.exportSvc.Get(c.Request.Context(), c.Param("id"), exportID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "export")
+			return nil, false
+		}
+		h.log.Error("get export failed", zap.Error(err))
+		utils.InternalError(c)
+		return nil, false
+	}
+	return export, true
+}
+
+func (h *PatientExportHandler) toDTO(c *gin.Context, export *entities.PatientExport) (*dtos.PatientExportDTO, bool) {
+	url, err := h.exportSvc.DownloadURL(c.Request.Context(), export)
+	if err != nil {
+		h.log.Error("presigning export failed", zap.String("exportID", export.ID), zap.Error(err))
+		utils.InternalError(c)
+		return nil, false
+	}
+	return dtos.ToPatientExportDTO(export, url), true
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
 )
@@ -44,6 +48,7 @@ func (h *PatientHandler) Create(c *gin.Context) {
 		utils.BadRequest(c, err.Error())
 		return
 	}
+	middleware.SetAuditResource(c, patient.ID)
 
 	utils.Created(c, patient)
 }
@@ -53,7 +58,12 @@ func (h *PatientHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
 	patient, err := h.patientSvc.GetByID(c.Request.Context(), id)
 	if err != nil {
-		utils.NotFound(c, "patient")
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
+		h.log.Error("get patient failed", zap.String("patientID", id), zap.Error(err))
+		utils.InternalError(c)
 		return
 	}
 	utils.OK(c, patient)
@@ -67,6 +77,12 @@ func (h *PatientHandler) List(c *gin.Context) {
 		utils.InternalError(c)
 		return
 	}
+	ids := make([]string, len(patients))
+	for i := range patients {
+		ids[i] = patients[i].ID
+	}
+	// So the view turns up in each patient's audit trail.
+	middleware.SetAuditDetail(c, "patientIds", ids)
 	utils.OKList(c, patients, utils.BuildMeta(page, pageSize, total))
 }
 
@@ -85,8 +101,74 @@ func (h *PatientHandler) Update(c *gin.Context) {
 
 	patient, err := h.patientSvc.Update(c.Request.Context(), id, in)
 	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
 		utils.BadRequest(c, err.Error())
 		return
 	}
 	utils.OK(c, patient)
 }
+
+// ListCareTeam  GET /api/v1/patients/:id/care-team
+func (h *PatientHandler) ListCareTeam(c *gin.Context) {
+	id := c.Param("id")
+	members, err := h.patientSvc.ListCareTeam(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
+		h.log.Error("list care team failed", zap.String("patientID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OKList(c, members, nil)
+}
+
+// AddCareTeamMember  POST /api/v1/patients/:id/care-team
+func (h *PatientHandler) AddCareTeamMember(c *gin.Context) {
+	id := c.Param("id")
+	var in services.AddCareTeamMemberInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	middleware.SetAuditDetail(c, "userId", in.UserID)
+
+	member, err := h.patientSvc.AddCareTeamMember(c.Request.Context(), id, middleware.GetUserID(c), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "patient")
+		case errors.Is(err, services.ErrCareTeamOwner), errors.Is(err, services.ErrUnknownCareTeamUser):
+			utils.BadRequest(c, err.Error())
+		default:
+			h.log.Error("add care team member failed", zap.String("patientID", id), zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	utils.Created(c, member)
+}
+
+// RemoveCareTeamMember  DELETE /api/v1/patients/:id/care-team/:userID
+func (h *PatientHandler) RemoveCareTeamMember(c *gin.Context) {
+	id, userID := c.Param("id"), c.Param("userID")
+	middleware.SetAuditDetail(c, "userId", userID)
+	if err := h.patientSvc.RemoveCareTeamMember(c.Request.Context(), id, userID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "care team member")
+			return
+		}
+		h.log.Error("remove care team member failed", zap.String("patientID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OK(c, gin.H{"message": "care team member removed"})
+}
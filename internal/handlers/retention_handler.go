@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/services"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+)
+
+// RetentionHandler manages legal holds on patients and serves the reports
+// of the retention purge.
+type RetentionHandler struct {
+	retentionSvc *services.RetentionService
+	validate     *validator.Validate
+	log          *zap.Logger
+}
+
+func NewRetentionHandler(retentionSvc *services.RetentionService, log *zap.Logger) *RetentionHandler {
+	return &RetentionHandler{
+		retentionSvc: retentionSvc,
+		validate:     validator.New(),
+		log:          log.Named("retention_handler"),
+	}
+}
+
+// PlaceHold  POST /api/v1/patients/:id/legal-holds
+func (h *RetentionHandler) PlaceHold(c *gin.Context) {
+	var in services.PlaceLegalHoldInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	hold, err := h.retentionSvc.PlaceHold(c.Request.Context(), c.Param("id"), middleware.GetUserID(c), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "patient")
+		case errors.Is(err, services.ErrHoldReasonRequired):
+			utils.BadRequest(c, err.Error())
+		default:
+			h.log.Error("place legal hold failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+	middleware.SetAuditDetail(c, "holdId", hold.ID)
+
+	utils.Created(c, hold)
+}
+
+// ListHolds  GET /api/v1/patients/:id/legal-holds
+func (h *RetentionHandler) ListHolds(c *gin.Context) {
+	holds, err := h.retentionSvc.ListHolds(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "patient")
+			return
+		}
+		h.log.Error("list legal holds failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OKList(c, holds, nil)
+}
+
+// ReleaseHold  DELETE /api/v1/patients/:id/legal-holds/:holdID
+func (h *RetentionHandler) ReleaseHold(c *gin.Context) {
+	holdID := c.Param("holdID")
+	middleware.SetAuditDetail(c, "holdId", holdID)
+
+	hold, err := h.retentionSvc.ReleaseHold(c.Request.Context(), c.Param("id"), holdID, middleware.GetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "legal hold")
+		case errors.Is(err, services.ErrHoldReleased):
+			utils.Conflict(c, err.Error())
+		default:
+			h.log.Error("release legal hold failed", zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	utils.OK(c, hold)
+}
+
+// ListReports  GET /api/v1/admin/purge-reports  (admin only)
+func (h *RetentionHandler) ListReports(c *gin.Context) {
+	page, pageSize, offset := utils.Pagination(c)
+	reports, total, err := h.retentionSvc.ListReports(c.Request.Context(), offset, pageSize)
+	if err != nil {
+		h.log.Error("list purge reports failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OKList(c, reports, utils.BuildMeta(page, pageSize, total))
+}
+
+// GetReport  GET /api/v1/admin/purge-reports/:id  (admin only)
+func (h *RetentionHandler) GetReport(c *gin.Context) {
+	report, err := h.retentionSvc.GetReport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "purge report")
+			return
+		}
+		h.log.Error("get purge report failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, report)
+}
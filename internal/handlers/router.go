@@ -8,36 +8,75 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
 	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
 	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+	"github.com/jamesphm04/splose-clone-be/pkg/ratelimit"
 )
 
 // RouterDeps bundles every dependency needed to build the HTTP router.
 // It is populated by the DI Container and passed to SetupRouter.
 type RouterDeps struct {
 	Log            *zap.Logger // root logger – middleware uses named children
+	TrustedProxies []string    // see config.ServerConfig
 	JWTManager     *auth.Manager
+	Sessions       middleware.SessionChecker
+	APIKeys        middleware.APIKeyVerifier
+	Audit          middleware.AuditRecorder
+	RateLimits     RateLimits
 	AuthHandler    *AuthHandler
 	UserHandler    *UserHandler
 	PatientHandler *PatientHandler
 	NoteHandler    *NoteHandler
 	ConvHandler    *ConversationHandler
+	AttachHandler  *AttachmentHandler
+	MFAHandler     *MFAHandler
+	APIKeyHandler  *APIKeyHandler
+	OrgHandler     *OrganizationHandler
+	InviteHandler  *InvitationHandler
+	AuditHandler   *AuditHandler
+	ExportHandler  *PatientExportHandler
+	RetainHandler  *RetentionHandler
+	// OIDCHandler is nil when single sign-on is not configured.
+	OIDCHandler *OIDCHandler
 	// PromptHandler  *PromptHandler
-	// AttachHandler  *AttachmentHandler
+}
+
+// RateLimits are the token buckets applied per caller, see
+// middleware.RateLimit. A zero Limit disables its bucket.
+type RateLimits struct {
+	Store ratelimit.Store
+	// API applies to every authenticated request.
+	API ratelimit.Limit
+	// Auth applies to the public auth endpoints, per client IP.
+	Auth ratelimit.Limit
+	// AI applies to sending messages to the AI assistant.
+	AI ratelimit.Limit
+	// TokenEndpoint further caps account token endpoints (password reset,
+	// email verification).
+	TokenEndpoint ratelimit.Limit
 }
 
 // SetupRoter builds and returns a configured *gin.Engine
 func SetupRouter(deps RouterDeps) *gin.Engine {
 	r := gin.New()
+	// Gin trusts every proxy unless told otherwise, which would let any
+	// client choose its IP with a header. The list is validated on load;
+	// should it still be refused, trust none rather than all.
+	if err := r.SetTrustedProxies(deps.TrustedProxies); err != nil {
+		deps.Log.Error("invalid trusted proxies; trusting none", zap.Error(err))
+		_ = r.SetTrustedProxies(nil)
+	}
 
 	// Global middleware (order matters)
 	r.Use(middleware.Recovery(deps.Log))      // catch panics first
 	r.Use(middleware.RequestLogger(deps.Log)) // then log all requests
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // Restrict in production.
-		AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key"},
+		ExposeHeaders:    []string{"Content-Length", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
@@ -45,54 +84,204 @@ func SetupRouter(deps RouterDeps) *gin.Engine {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Public keys for services that verify our tokens themselves.
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, deps.JWTManager.JWKS())
+	})
+
 	// Endpoints
 	v1 := r.Group("/api/v1")
 
+	limits := deps.RateLimits
+	tokenLimit := middleware.RateLimit(limits.Store, "token", limits.TokenEndpoint, deps.Log)
+	// audit records each request for clinical data or the audit log, allowed
+	// or not, so it goes before the permission checks.
+	audit := func(action string) gin.HandlerFunc { return middleware.Audit(deps.Audit, action, deps.Log) }
+
 	// Public
 	authGroup := v1.Group("/auth")
+	authGroup.Use(middleware.RateLimit(limits.Store, "auth", limits.Auth, deps.Log))
 	{
 		authGroup.POST("/register", deps.AuthHandler.Register)
 		authGroup.POST("/login", deps.AuthHandler.Login)
 		authGroup.POST("/refresh", deps.AuthHandler.Refresh)
+		authGroup.POST("/password/forgot", tokenLimit, deps.AuthHandler.ForgotPassword)
+		authGroup.POST("/password/reset", tokenLimit, deps.AuthHandler.ResetPassword)
+		authGroup.POST("/email/verify", tokenLimit, deps.AuthHandler.VerifyEmail)
+		authGroup.POST("/mfa/verify", tokenLimit, deps.AuthHandler.VerifyMFA)
+		authGroup.POST("/invitations/accept", tokenLimit, deps.InviteHandler.Accept)
+		if deps.OIDCHandler != nil {
+			authGroup.GET("/oidc/authorize", tokenLimit, deps.OIDCHandler.Authorize)
+			authGroup.POST("/oidc/callback", tokenLimit, deps.OIDCHandler.Callback)
+		}
 	}
 
-	// Protected (JWT required)
+	// Protected (JWT or API key required)
 	protected := v1.Group("")
-	protected.Use(middleware.Authenticate(deps.JWTManager))
+	protected.Use(
+		middleware.Authenticate(deps.JWTManager, deps.Sessions, deps.APIKeys),
+		middleware.RateLimit(limits.Store, "api", limits.API, deps.Log),
+	)
 	{
+		// Account and admin routes are for people; API keys only reach
+		// clinical routes, and only with the matching scope.
+		account := protected.Group("")
+		account.Use(middleware.RejectAPIKeys())
+
+		// Session endpoints
+		// Impersonation tokens act as someone else, so they stay away from
+		// anything that changes the account's credentials or speaks for its
+		// owner.
+		noImp := middleware.RejectImpersonation()
+
+		sessions := account.Group("/auth")
+		{
+			sessions.POST("/logout", deps.AuthHandler.Logout)
+			sessions.POST("/logout-all", noImp, deps.AuthHandler.LogoutAll)
+			sessions.POST("/switch-organization", noImp, deps.OrgHandler.Switch)
+			sessions.POST("/email/resend", tokenLimit, deps.AuthHandler.ResendVerification)
+			sessions.POST("/impersonation/end", deps.AuthHandler.EndImpersonation)
+		}
+
 		// User endpoints
-		users := protected.Group("/users")
+		users := account.Group("/users")
 		{
 			users.GET("/me", deps.UserHandler.GetMe)
-			users.PATCH("/:id", deps.UserHandler.Update)
-			users.DELETE("/:id", deps.UserHandler.Delete)
-			users.GET("", middleware.RequireRole("admin"), deps.UserHandler.List)
+			users.GET("/me/sessions", deps.UserHandler.ListSessions)
+			users.DELETE("/me/sessions/:id", noImp, deps.UserHandler.RevokeSession)
+			users.PATCH("/:id", noImp, deps.UserHandler.Update)
+			users.DELETE("/:id", noImp, deps.UserHandler.Delete)
+			manage := middleware.RequirePermission(authz.UserManage)
+			users.PATCH("/:id/role", noImp, manage, deps.UserHandler.ChangeRole)
+			users.POST("/:id/unlock", noImp, manage, deps.UserHandler.Unlock)
+			users.GET("", manage, deps.UserHandler.List)
+
+			// MFA enrolment stays reachable for restricted tokens, since
+			// completing it is how a mfa_setup_required restriction is lifted.
+			users.POST("/me/mfa/setup", noImp, deps.MFAHandler.BeginSetup)
+			users.POST("/me/mfa/confirm", noImp, deps.MFAHandler.ConfirmSetup)
+			users.POST("/me/mfa/disable", noImp, deps.MFAHandler.Disable)
+			users.POST("/me/mfa/recovery-codes", noImp, deps.MFAHandler.RegenerateRecoveryCodes)
+		}
+
+		account.GET("/roles", middleware.RequirePermission(authz.UserManage), deps.UserHandler.ListRoles)
+		account.GET("/organizations", deps.OrgHandler.ListMine)
+
+		account.POST("/invitations/accept", noImp, deps.InviteHandler.AcceptSignedIn)
+
+		// Invitation endpoints, within the caller's organisation
+		invitations := account.Group("/invitations")
+		invitations.Use(noImp, middleware.RequirePermission(authz.UserManage))
+		{
+			invitations.POST("", deps.InviteHandler.Create)
+			invitations.GET("", deps.InviteHandler.List)
+			invitations.POST("/:id/resend", deps.InviteHandler.Resend)
+			invitations.DELETE("/:id", deps.InviteHandler.Revoke)
+		}
+
+		// Admin endpoints
+		admin := account.Group("/admin")
+		// Roles belong to memberships, so admins act through the admin
+		// role of the organisation they are signed in to.
+		admin.Use(
+			middleware.RequirePermission(authz.SystemManage),
+			middleware.RejectRestricted(),
+		)
+		{
+			admin.GET("/mfa-policies", deps.MFAHandler.ListPolicies)
+			admin.PUT("/mfa-policies/:role", deps.MFAHandler.SetPolicy)
+			admin.POST("/api-keys", deps.APIKeyHandler.Create)
+			admin.GET("/api-keys", deps.APIKeyHandler.List)
+			admin.DELETE("/api-keys/:id", deps.APIKeyHandler.Revoke)
+			admin.POST("/organizations", deps.OrgHandler.Create)
+			admin.GET("/organizations", deps.OrgHandler.List)
+			admin.GET("/organizations/:id/members", deps.OrgHandler.ListMembers)
+			admin.POST("/organizations/:id/members", deps.OrgHandler.AddMember)
+			admin.DELETE("/organizations/:id/members/:userID", deps.OrgHandler.RemoveMember)
+			// Role changes are the same as PATCH /users/:id/role, listed here
+			// with the other account administration.
+			admin.PATCH("/users/:id/role", deps.UserHandler.ChangeRole)
+			admin.POST("/users/:id/disable", deps.UserHandler.Disable)
+			admin.POST("/users/:id/enable", deps.UserHandler.Enable)
+			admin.POST("/users/:id/restore", deps.UserHandler.Restore)
+			admin.POST("/users/:id/logout", deps.UserHandler.ForceLogout)
+			admin.POST("/users/:id/impersonate", deps.UserHandler.Impersonate)
+			admin.GET("/audit-events", audit("audit.read"), deps.AuditHandler.List)
+			admin.GET("/audit-events/export", audit("audit.export"), deps.AuditHandler.Export)
+			admin.GET("/purge-reports", deps.RetainHandler.ListReports)
+			admin.GET("/purge-reports/:id", deps.RetainHandler.GetReport)
 		}
+
+		// Clinical data is off limits to restricted (e.g. unverified) accounts.
+		// Each route needs both the role permission and, for API keys, the
+		// matching scope.
+		clinical := protected.Group("")
+		clinical.Use(middleware.RejectRestricted())
+
 		// Patient endpoints
-		patients := protected.Group("/patients")
+		patients := clinical.Group("/patients")
 		{
-			patients.POST("", deps.PatientHandler.Create)
-			patients.GET("/:id", deps.PatientHandler.GetByID)
-			patients.GET("", deps.PatientHandler.List)
-			patients.PATCH("/:id", deps.PatientHandler.Update)
+			read := middleware.RequireAccess(authz.PatientRead, entities.ScopePatientsRead)
+			write := middleware.RequireAccess(authz.PatientWrite, entities.ScopePatientsWrite)
+			patients.POST("", audit("patient.create"), write, deps.PatientHandler.Create)
+			patients.GET("/:id", audit("patient.read"), read, deps.PatientHandler.GetByID)
+			patients.GET("", audit("patient.list"), read, deps.PatientHandler.List)
+			patients.PATCH("/:id", audit("patient.update"), write, deps.PatientHandler.Update)
+			patients.GET("/:id/care-team", audit("patient.care_team_read"), read, deps.PatientHandler.ListCareTeam)
+			patients.POST("/:id/care-team", audit("patient.care_team_add"), write, deps.PatientHandler.AddCareTeamMember)
+			patients.DELETE("/:id/care-team/:userID", audit("patient.care_team_remove"), write, deps.PatientHandler.RemoveCareTeamMember)
+
+			// Exports copy the whole record out, so they are for signed-in
+			// users acting as themselves, not API keys or impersonators.
+			noKeys, noImp := middleware.RejectAPIKeys(), middleware.RejectImpersonation()
+			export := middleware.RequirePermission(authz.PatientExport)
+			patients.POST("/:id/exports", audit("patient.export"), noKeys, noImp, export, deps.ExportHandler.Create)
+			patients.GET("/:id/exports", audit("patient.export_list"), noKeys, noImp, export, deps.ExportHandler.List)
+			patients.GET("/:id/exports/:exportID", audit("patient.export_read"), noKeys, noImp, export, deps.ExportHandler.GetByID)
+			patients.GET("/:id/exports/:exportID/download", audit("patient.export_download"), noKeys, noImp, export, deps.ExportHandler.Download)
+
+			// Legal holds apply to deleted patients too.
+			hold := middleware.RequirePermission(authz.LegalHoldManage)
+			patients.POST("/:id/legal-holds", audit("patient.legal_hold_place"), noKeys, noImp, hold, deps.RetainHandler.PlaceHold)
+			patients.GET("/:id/legal-holds", audit("patient.legal_hold_list"), noKeys, hold, deps.RetainHandler.ListHolds)
+			patients.DELETE("/:id/legal-holds/:holdID", audit("patient.legal_hold_release"), noKeys, noImp, hold, deps.RetainHandler.ReleaseHold)
 		}
 
 		// Progress note endpoints
-		notes := protected.Group("/notes")
+		notes := clinical.Group("/notes")
 		{
-			notes.POST("", deps.NoteHandler.Create)
-			notes.GET("", deps.NoteHandler.List)
-			notes.GET("/patient/:patientID", deps.NoteHandler.ListByPatientID)
-			notes.GET("/:id", deps.NoteHandler.GetByID)
-			notes.PATCH("/:id", deps.NoteHandler.Update)
-			notes.DELETE("/:id", deps.NoteHandler.Delete)
+			read := middleware.RequireAccess(authz.NoteRead, entities.ScopeNotesRead)
+			write := middleware.RequireAccess(authz.NoteWrite, entities.ScopeNotesWrite)
+			notes.POST("", audit("note.create"), write, deps.NoteHandler.Create)
+			notes.GET("", audit("note.list"), read, deps.NoteHandler.List)
+			notes.GET("/patient/:patientID", audit("note.list"), read, deps.NoteHandler.ListByPatientID)
+			notes.GET("/:id", audit("note.read"), read, deps.NoteHandler.GetByID)
+			notes.PATCH("/:id", audit("note.update"), write, deps.NoteHandler.Update)
+			notes.DELETE("/:id", audit("note.delete"), write, deps.NoteHandler.Delete)
+			// Signing attests authorship, so it is for people only.
+			notes.POST("/:id/sign", audit("note.sign"), middleware.RejectAPIKeys(), middleware.RejectImpersonation(), middleware.RequirePermission(authz.NoteSign), deps.NoteHandler.Sign)
 		}
 
 		// Conversation endpoints
-		conversations := protected.Group("/conversations")
+		conversations := clinical.Group("/conversations")
+		{
+			// Conversations are about a note, so they share its permissions.
+			read := middleware.RequireAccess(authz.NoteRead, entities.ScopeConversationsRead)
+			write := middleware.RequireAccess(authz.NoteWrite, entities.ScopeConversationsWrite)
+			aiLimit := middleware.RateLimit(limits.Store, "ai", limits.AI, deps.Log)
+			conversations.POST("/send-message", audit("message.create"), write, aiLimit, deps.ConvHandler.SendMessage)
+			conversations.GET("/messages", audit("message.list"), read, deps.ConvHandler.ListMessagesByNoteID)
+		}
+
+		// Attachment endpoints
+		attachments := clinical.Group("/attachments")
 		{
-			conversations.POST("/send-message", deps.ConvHandler.SendMessage)
-			conversations.GET("/messages", deps.ConvHandler.ListMessagesByNoteID)
+			read := middleware.RequireAccess(authz.NoteRead, entities.ScopeAttachmentsRead)
+			attachments.GET("", audit("attachment.list"), read, deps.AttachHandler.ListByNoteID)
+			attachments.GET("/:id", audit("attachment.read"), read, deps.AttachHandler.GetByID)
+			attachments.GET("/:id/content", audit("attachment.download"), read, deps.AttachHandler.Content)
+			attachments.GET("/:id/preview", audit("attachment.preview"), read, deps.AttachHandler.Preview)
 		}
 	}
 
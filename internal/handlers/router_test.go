@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/handlers"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// allowlistedKey accepts any key from the IPs in allowed, and remembers
+// the IPs it was asked about.
+type allowlistedKey struct {
+	allowed []string
+	seen    []string
+}
+
+func (k *allowlistedKey) VerifyAPIKey(_ context.Context, _, ip string) (*auth.APIKeyPrincipal, error) {
+	k.seen = append(k.seen, ip)
+	if !slices.Contains(k.allowed, ip) {
+		return nil, nil
+	}
+	return &auth.APIKeyPrincipal{KeyID: "key", UserID: "user", Scopes: []string{"patients:read"}}, nil
+}
+
+func TestAPIKeyAllowlistUsesTrustedClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		proxy   = "203.0.113.9"
+		allowed = "198.51.100.7"
+	)
+
+	for _, tc := range []struct {
+		name           string
+		trustedProxies []string
+		wantIP         string
+		// API keys that get through authentication are turned away from
+		// account routes with 403; refused ones get 401.
+		wantStatus int
+	}{
+		{"spoofed header from an untrusted peer", nil, proxy, http.StatusUnauthorized},
+		{"header set by a trusted proxy", []string{"203.0.113.0/24"}, allowed, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keys := &allowlistedKey{allowed: []string{allowed}}
+			r := handlers.SetupRouter(handlers.RouterDeps{Log: zap.NewNop(), TrustedProxies: tc.trustedProxies, APIKeys: keys})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+			req.RemoteAddr = proxy + ":41000"
+			req.Header.Set("X-API-Key", "sk_live_anything")
+			req.Header.Set("X-Forwarded-For", allowed)
+			req.Header.Set("X-Real-IP", allowed)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.wantStatus, w.Body)
+			}
+			if len(keys.seen) != 1 || keys.seen[0] != tc.wantIP {
+				t.Errorf("key checked against %v, want %s", keys.seen, tc.wantIP)
+			}
+		})
+	}
+}
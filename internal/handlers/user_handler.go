@@ -7,7 +7,9 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
 	"github.com/jamesphm04/splose-clone-be/internal/middleware"
+	"github.com/jamesphm04/splose-clone-be/internal/models/dtos"
 	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"github.com/jamesphm04/splose-clone-be/internal/services"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
@@ -15,13 +17,15 @@ import (
 
 // UserHandler handles user management endpoints.
 type UserHandler struct {
-	userSvc  *services.UserService
-	validate *validator.Validate
-	log      *zap.Logger
+	userSvc    *services.UserService
+	sessionSvc *services.SessionService
+	accountSvc *services.AccountService
+	validate   *validator.Validate
+	log        *zap.Logger
 }
 
-func NewUserHandler(userSvc *services.UserService, log *zap.Logger) *UserHandler {
-	return &UserHandler{userSvc: userSvc, validate: validator.New(), log: log.Named("user_handler")}
+func NewUserHandler(userSvc *services.UserService, sessionSvc *services.SessionService, accountSvc *services.AccountService, log *zap.Logger) *UserHandler {
+	return &UserHandler{userSvc: userSvc, sessionSvc: sessionSvc, accountSvc: accountSvc, validate: validator.New(), log: log.Named("user_handler")}
 }
 
 // GetMe  GET /api/v1/users/me
@@ -34,7 +38,38 @@ func (h *UserHandler) GetMe(c *gin.Context) {
 	utils.OK(c, user)
 }
 
-// List  GET /api/v1/users  (admin only)
+// ListSessions  GET /api/v1/users/me/sessions
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.sessionSvc.ListActive(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		h.log.Error("list sessions failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	current := middleware.GetSessionID(c)
+	out := make([]*dtos.SessionDTO, 0, len(sessions))
+	for i := range sessions {
+		out = append(out, dtos.ToSessionDTO(&sessions[i], current))
+	}
+	utils.OKList(c, out, nil)
+}
+
+// RevokeSession  DELETE /api/v1/users/me/sessions/:id
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	if err := h.sessionSvc.Logout(c.Request.Context(), middleware.GetUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "session")
+			return
+		}
+		h.log.Error("revoke session failed", zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+	utils.OK(c, gin.H{"message": "session revoked"})
+}
+
+// List  GET /api/v1/users  (user.manage)
 func (h *UserHandler) List(c *gin.Context) {
 	page, pageSize, offset := utils.Pagination(c)
 	users, total, err := h.userSvc.List(c.Request.Context(), offset, pageSize)
@@ -49,11 +84,7 @@ func (h *UserHandler) List(c *gin.Context) {
 // Update  PATCH /api/v1/users/:id
 func (h *UserHandler) Update(c *gin.Context) {
 	id := c.Param("id")
-	callerID := middleware.GetUserID(c)
-	callerRole := middleware.GetRole(c)
-
-	if id != callerID && callerRole != "admin" {
-		utils.Forbidden(c)
+	if !h.canManage(c, id) {
 		return
 	}
 
@@ -81,17 +112,75 @@ func (h *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// A changed address leaves the user restricted until they follow this
+	// link; their sessions were revoked so the restriction applies.
+	if in.Email != "" && user.EmailVerifiedAt == nil {
+		if err := h.accountSvc.SendVerification(c.Request.Context(), user); err != nil {
+			h.log.Error("sending verification email failed", zap.String("userID", user.ID), zap.Error(err))
+		}
+	}
+
 	utils.OK(c, user)
 }
 
+// ChangeRole  PATCH /api/v1/users/:id/role  (user.manage)
+// The role changes in the caller's organisation only.
+func (h *UserHandler) ChangeRole(c *gin.Context) {
+	var in services.ChangeRoleInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	id := c.Param("id")
+	member, err := h.userSvc.AssignRole(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), middleware.GetOrgID(c), id, in)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "user")
+			return
+		case errors.Is(err, authz.ErrForbidden):
+			utils.Forbidden(c)
+			return
+		case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrOwnRole), errors.Is(err, services.ErrNoOrganization):
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Error("change role failed", zap.String("userID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, member)
+}
+
+// Unlock  POST /api/v1/users/:id/unlock  (user.manage)
+func (h *UserHandler) Unlock(c *gin.Context) {
+	id := c.Param("id")
+	if !h.canManage(c, id) {
+		return
+	}
+	if err := h.userSvc.Unlock(c.Request.Context(), id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "user")
+			return
+		}
+		h.log.Error("unlock user failed", zap.String("userID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, gin.H{"unlocked": true})
+}
+
 // Delete  DELETE /api/v1/users/:id
 func (h *UserHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	callerID := middleware.GetUserID(c)
-	callerRole := middleware.GetRole(c)
-
-	if id != callerID && callerRole != "admin" {
-		utils.Forbidden(c)
+	if !h.canManage(c, id) {
 		return
 	}
 
@@ -107,3 +196,147 @@ func (h *UserHandler) Delete(c *gin.Context) {
 
 	utils.OK(c, gin.H{"message": "user deleted"})
 }
+
+// Disable  POST /api/v1/admin/users/:id/disable  (admin only)
+func (h *UserHandler) Disable(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// Enable  POST /api/v1/admin/users/:id/enable  (admin only)
+func (h *UserHandler) Enable(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *UserHandler) setDisabled(c *gin.Context, disabled bool) {
+	id := c.Param("id")
+	user, err := h.userSvc.SetDisabled(c.Request.Context(), middleware.GetUserID(c), id, disabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "user")
+		case errors.Is(err, services.ErrOwnAccount):
+			utils.BadRequest(c, err.Error())
+		default:
+			h.log.Error("changing user disabled state failed", zap.String("userID", id), zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	utils.OK(c, user)
+}
+
+// Restore  POST /api/v1/admin/users/:id/restore  (admin only)
+func (h *UserHandler) Restore(c *gin.Context) {
+	id := c.Param("id")
+	user, err := h.userSvc.Restore(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "deleted user")
+			return
+		}
+		h.log.Error("restore user failed", zap.String("userID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	utils.OK(c, user)
+}
+
+// ForceLogout  POST /api/v1/admin/users/:id/logout  (admin only)
+func (h *UserHandler) ForceLogout(c *gin.Context) {
+	var in services.ForceLogoutInput
+	// The body is optional; without one the user is only signed out.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			utils.BadRequest(c, "invalid request body")
+			return
+		}
+	}
+
+	id := c.Param("id")
+	user, err := h.userSvc.ForceLogout(c.Request.Context(), id, in)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.NotFound(c, "user")
+			return
+		}
+		h.log.Error("force logout failed", zap.String("userID", id), zap.Error(err))
+		utils.InternalError(c)
+		return
+	}
+
+	if in.ResetPassword {
+		// The password is cleared either way; the user can ask for another email.
+		if err := h.accountSvc.SendPasswordReset(c.Request.Context(), user); err != nil {
+			h.log.Error("sending password reset email failed", zap.String("userID", id), zap.Error(err))
+		}
+	}
+
+	utils.OK(c, gin.H{"message": "user logged out"})
+}
+
+// Impersonate  POST /api/v1/admin/users/:id/impersonate  (admin only)
+func (h *UserHandler) Impersonate(c *gin.Context) {
+	var in services.ImpersonateInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		utils.BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.validate.Struct(in); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	id := c.Param("id")
+	imp, err := h.userSvc.Impersonate(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), id, in, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			utils.NotFound(c, "user")
+		case errors.Is(err, services.ErrImpersonateAdmin):
+			utils.ForbiddenMsg(c, err.Error())
+		case errors.Is(err, services.ErrImpersonateSelf), errors.Is(err, services.ErrAccountDisabled):
+			utils.BadRequest(c, err.Error())
+		default:
+			h.log.Error("impersonation failed", zap.String("userID", id), zap.Error(err))
+			utils.InternalError(c)
+		}
+		return
+	}
+
+	utils.Created(c, imp)
+}
+
+// ListRoles  GET /api/v1/roles  (user.manage)
+func (h *UserHandler) ListRoles(c *gin.Context) {
+	type role struct {
+		Name        string             `json:"name"`
+		Permissions []authz.Permission `json:"permissions"`
+		Assignable  bool               `json:"assignable"`
+	}
+	caller := middleware.GetRole(c)
+	roles := make([]role, 0, len(authz.Roles))
+	for _, r := range authz.Roles {
+		roles = append(roles, role{Name: r, Permissions: authz.Permissions(r), Assignable: authz.CanManage(caller, r)})
+	}
+	utils.OKList(c, roles, nil)
+}
+
+// canManage lets callers act on their own account, and on others' if their
+// role allows it. It writes the error response and returns false otherwise.
+func (h *UserHandler) canManage(c *gin.Context, id string) bool {
+	err := h.userSvc.CheckManage(c.Request.Context(), middleware.GetUserID(c), middleware.GetRole(c), id)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authz.ErrForbidden):
+		utils.Forbidden(c)
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.NotFound(c, "user")
+	default:
+		h.log.Error("checking user access failed", zap.String("userID", id), zap.Error(err))
+		utils.InternalError(c)
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Package jobs runs background work outside the request path.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Job is a unit of background work. Name is used for logging only.
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Queue is an in-process, bounded job queue drained by a fixed worker pool.
+// Jobs are lost on restart, so anything enqueued must be recoverable by
+// re-scanning the database (e.g. records left in a "pending" state).
+type Queue struct {
+	name    string
+	jobs    chan Job
+	workers int
+	timeout time.Duration
+	log     *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+}
+
+// NewQueue creates a queue with the given worker count and buffer size.
+// timeout bounds each job's run time; zero means no limit.
+func NewQueue(name string, workers, size int, timeout time.Duration, log *zap.Logger) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		name:    name,
+		jobs:    make(chan Job, size),
+		workers: workers,
+		timeout: timeout,
+		log:     log.Named("jobs").With(zap.String("queue", name)),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start launches the worker goroutines. Calling it twice is a no-op.
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started || q.closed {
+		return
+	}
+	q.started = true
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.log.Info("queue started", zap.Int("workers", q.workers))
+}
+
+// Enqueue adds a job without blocking. It fails when the buffer is full or
+// the queue has been stopped.
+func (q *Queue) Enqueue(job Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		q.log.Warn("queue full, job dropped", zap.String("job", job.Name))
+		return ErrQueueFull
+	}
+}
+
+// Stop stops accepting jobs, lets workers finish what is buffered and waits
+// for them until ctx is done, after which running jobs are cancelled.
+func (q *Queue) Stop(ctx context.Context) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.log.Warn("queue stop timed out, cancelling running jobs")
+	}
+	q.cancel()
+	q.log.Info("queue stopped")
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.run(job)
+	}
+}
+
+func (q *Queue) run(job Job) {
+	ctx := q.ctx
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			q.log.Error("job panicked", zap.String("job", job.Name), zap.Any("panic", rec))
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		q.log.Error("job failed",
+			zap.String("job", job.Name),
+			zap.Duration("elapsed", time.Since(start)),
+			zap.Error(err),
+		)
+		return
+	}
+	q.log.Debug("job completed", zap.String("job", job.Name), zap.Duration("elapsed", time.Since(start)))
+}
+
+var (
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrQueueClosed = errors.New("job queue is closed")
+)
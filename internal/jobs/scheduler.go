@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type task struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered tasks on fixed intervals. Each task runs on its
+// own goroutine and never overlaps with itself. It has no cross-process
+// coordination: enable it on one replica only.
+type Scheduler struct {
+	tasks []task
+	log   *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(log *zap.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		log:    log.Named("scheduler"),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Every registers a task. It must be called before Start; a non-positive
+// interval disables the task.
+func (s *Scheduler) Every(name string, interval time.Duration, run func(ctx context.Context) error) {
+	if interval <= 0 {
+		s.log.Info("task disabled", zap.String("task", name))
+		return
+	}
+	s.tasks = append(s.tasks, task{name: name, interval: interval, run: run})
+}
+
+// Start launches every registered task. The first run happens one interval
+// after start so a restart loop does not hammer downstream systems.
+func (s *Scheduler) Start() {
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(t)
+		s.log.Info("task scheduled", zap.String("task", t.name), zap.Duration("interval", t.interval))
+	}
+}
+
+// Stop cancels running tasks and waits for them to return or ctx to end.
+func (s *Scheduler) Stop(ctx context.Context) {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.log.Info("scheduler stopped")
+	case <-ctx.Done():
+		s.log.Warn("scheduler stop timed out")
+	}
+}
+
+func (s *Scheduler) loop(t task) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.runOnce(t)
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(t task) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.log.Error("task panicked", zap.String("task", t.name), zap.Any("panic", rec))
+		}
+	}()
+
+	start := time.Now()
+	if err := t.run(s.ctx); err != nil {
+		s.log.Error("task failed",
+			zap.String("task", t.name),
+			zap.Duration("elapsed", time.Since(start)),
+			zap.Error(err),
+		)
+		return
+	}
+	s.log.Info("task completed", zap.String("task", t.name), zap.Duration("elapsed", time.Since(start)))
+}
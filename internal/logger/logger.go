@@ -11,6 +11,8 @@ import (
 //
 // - "production" -> JSON encoder, Info level, no caller/stacktraces on Info
 // - everything else -> conosle encoder, Debug level, caller enabled
+//
+// Either way entries pass through Redaction, so patient data is masked.
 
 func New(env string) (*zap.Logger, error) {
 	var cfg zap.Config
@@ -28,7 +30,7 @@ func New(env string) (*zap.Logger, error) {
 		cfg.DisableCaller = false
 	}
 
-	log, err := cfg.Build()
+	log, err := cfg.Build(zap.WrapCore(Redaction.Core))
 	if err != nil {
 		return nil, fmt.Errorf("failed to build zap logger: %w", err)
 	}
@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces masked values in log output.
+const Redacted = "[REDACTED]"
+
+// Redaction is applied to every logger built by New. Packages that log
+// other sensitive fields register their keys with it at init.
+var Redaction = NewRedactor()
+
+func init() {
+	Redaction.RegisterKeys(
+		// Patient details
+		"email", "phone", "phoneNumber", "dateOfBirth", "dob",
+		"firstName", "lastName", "fullName", "fullAddress", "address",
+		// Clinical content and uploads
+		"content", "title", "filename",
+		// Credentials
+		"password", "token", "refreshToken", "secret",
+		// Whole request payloads and searches
+		"input", "request", "body", "q", "search",
+	)
+	Redaction.RegisterPatterns(
+		// Email addresses
+		regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		// Dates: 1990-01-31, 31/01/1990
+		regexp.MustCompile(`\d{4}-\d{1,2}-\d{1,2}|\d{1,2}/\d{1,2}/\d{2,4}`),
+		// Phone numbers: 8 to 15 digits, grouped by spaces, '-' or brackets
+		regexp.MustCompile(`\+?(?:\(?\d\)?[ \-]?){7,14}\d`),
+	)
+}
+
+// Redactor masks the values of sensitive keys, and substrings matching
+// sensitive patterns in any other string.
+type Redactor struct {
+	mu       sync.RWMutex
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{keys: map[string]bool{}}
+}
+
+// RegisterKeys marks field keys whose values are always masked. Keys match
+// regardless of case, '_' and '-': "phone_number" is "phoneNumber".
+func (r *Redactor) RegisterKeys(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range keys {
+		r.keys[normalizeKey(k)] = true
+	}
+}
+
+// RegisterPatterns adds patterns masked wherever they appear. A match that
+// runs into a letter, digit, '-' or '_' is left alone, so identifiers such
+// as UUIDs and hashes are not mangled.
+func (r *Redactor) RegisterPatterns(patterns ...*regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patterns...)
+}
+
+// SensitiveKey reports whether values logged under key are masked.
+func (r *Redactor) SensitiveKey(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[normalizeKey(key)]
+}
+
+// String masks the sensitive patterns in s.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, re := range r.patterns {
+		s = replaceBounded(re, s)
+	}
+	return s
+}
+
+// Query masks a raw URL query string: the values of sensitive keys, and
+// sensitive patterns in the others once decoded.
+func (r *Redactor) Query(raw string) string {
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if !ok {
+			parts[i] = url.QueryEscape(r.String(key))
+			continue
+		}
+		if r.SensitiveKey(key) {
+			parts[i] = url.QueryEscape(key) + "=" + Redacted
+			continue
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		value = strings.ReplaceAll(url.QueryEscape(r.String(value)), url.QueryEscape(Redacted), Redacted)
+		parts[i] = url.QueryEscape(key) + "=" + value
+	}
+	return strings.Join(parts, "&")
+}
+
+// Core wraps core so every entry is redacted before it is encoded.
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core, r: r}
+}
+
+// Fields returns fields with their sensitive values masked.
+func (r *Redactor) Fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, r.field(f)...)
+	}
+	return out
+}
+
+func (r *Redactor) field(f zapcore.Field) []zapcore.Field {
+	if f.Type == zapcore.InlineMarshalerType {
+		// The object's fields are added at the top level.
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		out := make([]zapcore.Field, 0, len(enc.Fields))
+		for k, v := range enc.Fields {
+			out = append(out, r.field(zap.Any(k, v))...)
+		}
+		return out
+	}
+	if r.SensitiveKey(f.Key) {
+		return []zapcore.Field{zap.String(f.Key, Redacted)}
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.String(f.String)
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		f = zap.String(f.Key, r.String(string(f.Interface.([]byte))))
+	case zapcore.ErrorType:
+		f = zap.String(f.Key, r.String(f.Interface.(error).Error()))
+	case zapcore.StringerType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		f = zap.String(f.Key, r.String(fmt.Sprint(enc.Fields[f.Key])))
+	case zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType, zapcore.ReflectType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		f = zap.Reflect(f.Key, r.value(enc.Fields[f.Key]))
+	}
+	return []zapcore.Field{f}
+}
+
+// value masks a structured value as it would be encoded to JSON.
+func (r *Redactor) value(v any) any {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return Redacted
+	}
+	return r.walk(decoded)
+}
+
+func (r *Redactor) walk(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case []any:
+		for i := range v {
+			v[i] = r.walk(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			if r.SensitiveKey(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = r.walk(v[k])
+			}
+		}
+	}
+	return v
+}
+
+type redactingCore struct {
+	zapcore.Core
+	r *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.Fields(fields)), r: c.r}
+}
+
+// Check lets the wrapped core decide whether to log e, as it may sample or
+// filter entries beyond their level, and if so has e written through c.
+func (c *redactingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(e, nil) == nil {
+		return ce
+	}
+	return ce.AddCore(e, c)
+}
+
+func (c *redactingCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = c.r.String(e.Message)
+	return c.Core.Write(e, c.r.Fields(fields))
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// replaceBounded masks the matches of re in s that stand on their own.
+func replaceBounded(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if joined(s, m[0]-1) || joined(s, m[1]) {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(Redacted)
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// joined reports whether the byte at i continues an identifier.
+func joined(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	c := rune(s[i])
+	return c == '-' || c == '_' || c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c))
+}
@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/types"
+)
+
+// fixturePatient holds made-up patient details, each distinctive enough to
+// be spotted anywhere in the output.
+var fixturePatient = entities.Patient{
+	ID:          "5f0c8f2e-8d53-4a57-9a57-2b1c3c0b9e11",
+	Email:       "janet.quokka@example.com",
+	FirstName:   "Janet",
+	LastName:    "Quokkington",
+	PhoneNumber: "+61 412 345 678",
+	DateOfBirth: &types.Date{Time: time.Date(1984, 3, 9, 0, 0, 0, 0, time.UTC)},
+	Gender:      entities.GenderFemale,
+	FullAddress: "12 Wattlebird Crescent, Fitzroy",
+}
+
+const fixtureNote = "Reports intermittent chest pain since the weekend"
+
+// fixtureValues is every detail that must never reach the output.
+var fixtureValues = []string{
+	fixturePatient.Email, fixturePatient.FirstName, fixturePatient.LastName,
+	fixturePatient.PhoneNumber, "1984-03-09", "09/03/1984", fixturePatient.FullAddress,
+	fixtureNote,
+}
+
+type contact struct{ email, phone string }
+
+func (c contact) String() string { return c.email + " / " + c.phone }
+
+// newTestLogger builds a logger the way New does, writing JSON to buf.
+func newTestLogger(buf *bytes.Buffer, wrap ...func(zapcore.Core) zapcore.Core) *zap.Logger {
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zapcore.DebugLevel)
+	for _, w := range wrap {
+		core = w(core)
+	}
+	return zap.New(Redaction.Core(core))
+}
+
+func TestRedactionMasksPatientDataOnEveryPath(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf)
+	p := fixturePatient
+	details := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("email", p.Email)
+		enc.AddString("fullName", p.FirstName+" "+p.LastName)
+		enc.AddString("summary", "call "+p.PhoneNumber)
+		return nil
+	})
+
+	paths := []struct {
+		name string
+		log  func()
+	}{
+		{"sensitive keys", func() {
+			log.Info("patient created",
+				zap.String("email", p.Email), zap.String("firstName", p.FirstName), zap.String("lastName", p.LastName),
+				zap.String("phone_number", p.PhoneNumber), zap.Stringer("dateOfBirth", p.DateOfBirth), zap.String("fullAddress", p.FullAddress),
+				zap.String("content", fixtureNote))
+		}},
+		{"message", func() {
+			log.Warn("no patient " + p.Email + " or " + p.PhoneNumber + ", born 09/03/1984")
+		}},
+		{"patterns in other keys", func() {
+			log.Info("lookup", zap.String("patientRef", p.Email), zap.String("callback", p.PhoneNumber), zap.String("born", "1984-03-09"))
+		}},
+		{"error", func() {
+			log.Error("create failed", zap.Error(fmt.Errorf("duplicate patient %s", p.Email)))
+		}},
+		{"byte string", func() {
+			log.Info("payload", zap.ByteString("raw", []byte(`{"contact":"`+p.Email+`"}`)))
+		}},
+		{"stringer", func() {
+			log.Info("contact", zap.Stringer("contact", contact{p.Email, p.PhoneNumber}))
+		}},
+		{"struct", func() {
+			log.Info("patient", zap.Any("patient", p))
+		}},
+		{"slice of structs", func() {
+			log.Info("patients", zap.Any("patients", []entities.Patient{p}))
+		}},
+		{"string array", func() {
+			log.Info("recipients", zap.Strings("recipients", []string{p.Email, p.PhoneNumber}))
+		}},
+		{"object", func() {
+			log.Info("details", zap.Object("details", details))
+		}},
+		{"inline object", func() {
+			log.Info("details", zap.Inline(details))
+		}},
+		{"with", func() {
+			log.With(zap.String("email", p.Email), zap.String("ref", p.PhoneNumber)).Info("scoped")
+		}},
+		{"named", func() {
+			log.Named("patient_service").Info("updated", zap.String("fullAddress", p.FullAddress))
+		}},
+		{"checked", func() {
+			if ce := log.Check(zap.InfoLevel, "checked "+p.Email); ce != nil {
+				ce.Write(zap.String("lastName", p.LastName))
+			}
+		}},
+		{"sugared", func() {
+			s := log.Sugar()
+			s.Infof("calling %s about %s", p.PhoneNumber, p.Email)
+			s.Infow("updated", "firstName", p.FirstName, "fullAddress", p.FullAddress, "note", p.Email)
+		}},
+	}
+
+	for _, path := range paths {
+		t.Run(path.name, func(t *testing.T) {
+			buf.Reset()
+			path.log()
+			out := buf.String()
+			if out == "" {
+				t.Fatal("nothing was logged")
+			}
+			if !strings.Contains(out, Redacted) {
+				t.Errorf("nothing was redacted in %s", out)
+			}
+			for _, v := range fixtureValues {
+				if strings.Contains(out, v) {
+					t.Errorf("%q leaked: %s", v, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactionKeepsWrappedCoreSampling(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf, func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewSamplerWithOptions(c, time.Minute, 1, 0)
+	})
+
+	for range 3 {
+		log.Info("repeated", zap.String("email", fixturePatient.Email))
+	}
+
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("wrote %d entries, want the sampler to pass only the first:\n%s", n, buf.String())
+	}
+}
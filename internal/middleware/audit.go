@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// Context keys handlers use to describe the audited request, see Audit.
+const (
+	ContextKeyAuditResource = "auditResource"
+	ContextKeyAuditPatient  = "auditPatient"
+	ContextKeyAuditDetails  = "auditDetails"
+)
+
+// AuditRecorder appends events to the audit log.
+type AuditRecorder interface {
+	RecordEvent(ctx context.Context, e *entities.AuditEvent) error
+}
+
+// Audit records action on every request to the routes it guards, whatever
+// the outcome, so it should come before the permission checks. The
+// resource type is the part of action before the dot; the resource is the
+// :id parameter unless the handler names it with SetAuditResource, and the
+// patient is taken from SetAuditPatient, a :patientID parameter or, for
+// patient resources, the resource itself. Must be applied after
+// Authenticate.
+//
+// The response has been written by the time the event is, so a failure to
+// record can only be logged.
+func Audit(rec AuditRecorder, action string, log *zap.Logger) gin.HandlerFunc {
+	log = log.Named("audit")
+	resourceType, _, _ := strings.Cut(action, ".")
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		e := &entities.AuditEvent{
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   c.Param("id"),
+			IP:           c.ClientIP(),
+			Outcome:      auditOutcome(status),
+			Details:      map[string]any{"status": status},
+		}
+		if v, ok := c.Get(ContextKeyAuditResource); ok {
+			e.ResourceID = v.(string)
+		}
+		patientID := c.Param("patientID")
+		if resourceType == "patient" {
+			patientID = e.ResourceID
+		}
+		if v, ok := c.Get(ContextKeyAuditPatient); ok {
+			patientID = v.(string)
+		}
+		if patientID != "" {
+			e.PatientID = &patientID
+		}
+		if v, ok := c.Get(ContextKeyAuditDetails); ok {
+			for k, d := range v.(map[string]any) {
+				e.Details[k] = d
+			}
+		}
+		if id := GetAPIKeyID(c); id != "" {
+			e.Details["apiKeyId"] = id
+		}
+
+		// Recorded even if the client has gone away.
+		if err := rec.RecordEvent(context.WithoutCancel(c.Request.Context()), e); err != nil {
+			log.Error("recording audit event failed",
+				zap.String("action", action),
+				zap.String("resourceID", e.ResourceID),
+				zap.String("userID", GetUserID(c)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return entities.AuditFailure
+	case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusNotFound:
+		// Records the actor may not see are reported as not found.
+		return entities.AuditDenied
+	case status >= http.StatusBadRequest:
+		return entities.AuditInvalid
+	default:
+		return entities.AuditSuccess
+	}
+}
+
+// SetAuditResource names the audited resource, for requests that create
+// one or do not carry its ID in the path.
+func SetAuditResource(c *gin.Context, id string) {
+	c.Set(ContextKeyAuditResource, id)
+}
+
+// SetAuditPatient names the patient whose data the request touched.
+func SetAuditPatient(c *gin.Context, patientID string) {
+	c.Set(ContextKeyAuditPatient, patientID)
+}
+
+// SetAuditDetail adds a detail to the audit event, e.g. the note a
+// message belongs to ("noteId"), which also attributes it to the note's
+// patient.
+func SetAuditDetail(c *gin.Context, key string, value any) {
+	v, ok := c.Get(ContextKeyAuditDetails)
+	if !ok {
+		v = map[string]any{}
+		c.Set(ContextKeyAuditDetails, v)
+	}
+	v.(map[string]any)[key] = value
+}
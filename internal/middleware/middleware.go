@@ -4,11 +4,15 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/logger"
 	"github.com/jamesphm04/splose-clone-be/internal/utils"
 	"github.com/jamesphm04/splose-clone-be/pkg/auth"
 	"go.uber.org/zap"
@@ -16,12 +20,21 @@ import (
 
 // Context keys userd to pass values between middleware and handlers
 const (
-	ContextKeyUserID = "userID"
-	ContextKeyRole   = "role"
+	ContextKeyUserID    = "userID"
+	ContextKeyRole      = "role"
+	ContextKeySessionID = "sessionID"
+	ContextKeyOrgID     = "orgID"
+	ContextKeyRestrict  = "restrictions"
+	ContextKeyAPIKeyID  = "apiKeyID"
+	ContextKeyScopes    = "scopes"
+	// ContextKeyImpersonatorID holds the admin behind an impersonation
+	// token; ContextKeyUserID is then the impersonated user.
+	ContextKeyImpersonatorID = "impersonatorID"
 )
 
 // RequestLogger logs one structured line per request: method, path, status, latency, client IP and
-// the authenticated user ID (when present).
+// the authenticated user ID (when present), with the impersonating admin's ID under impersonation.
+// Query strings are logged with patient data masked, see logger.Redactor.Query.
 // It uses a named child logger so log lines are easy to filter
 func RequestLogger(log *zap.Logger) gin.HandlerFunc {
 	reqLog := log.Named("http")
@@ -48,12 +61,15 @@ func RequestLogger(log *zap.Logger) gin.HandlerFunc {
 		}
 
 		if query != "" {
-			fields = append(fields, zap.String("query", query))
+			fields = append(fields, zap.String("query", logger.Redaction.Query(query)))
 		}
 
 		if uid, ok := userID.(string); ok && uid != "" {
 			fields = append(fields, zap.String("userID", uid))
 		}
+		if imp := GetImpersonatorID(c); imp != "" {
+			fields = append(fields, zap.String("impersonatorID", imp))
+		}
 
 		if errs := c.Errors.String(); errs != "" {
 			fields = append(fields, zap.String("errors", errs))
@@ -96,10 +112,31 @@ func Recovery(log *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-// Authenticate validates the Bearer JWT in the Authorization header
-// On success it stores userID and role in the Gin context
-func Authenticate(jwtManager *auth.Manager) gin.HandlerFunc {
+// SessionChecker reports whether the session behind an access token is
+// still active. Implementations are expected to cache: it runs per request.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, userID, sessionID string) (bool, error)
+}
+
+// APIKeyVerifier resolves API keys to the principal they act as. It
+// returns nil, without an error, for keys that are not currently usable.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key, ip string) (*auth.APIKeyPrincipal, error)
+}
+
+// Authenticate validates the Bearer JWT in the Authorization header and
+// rejects tokens whose session has been revoked. API keys are accepted as
+// the Bearer credential or in X-API-Key.
+// On success it stores userID, role, organisation and session ID (or API
+// key ID and scopes) in the Gin context, and the caller as the request's
+// authz.Actor.
+func Authenticate(jwtManager *auth.Manager, sessions SessionChecker, apiKeys APIKeyVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, apiKeys, key)
+			return
+		}
+
 		header := c.GetHeader("Authorization")
 		if header == "" {
 			utils.Unauthorized(c, "authorization header required")
@@ -114,6 +151,10 @@ func Authenticate(jwtManager *auth.Manager) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if auth.IsAPIKey(parts[1]) {
+			authenticateAPIKey(c, apiKeys, parts[1])
+			return
+		}
 
 		// Parse the token
 		claims, err := jwtManager.Parse(parts[1])
@@ -134,28 +175,156 @@ func Authenticate(jwtManager *auth.Manager) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens without a session predate session tracking and cannot be
+		// revoked, so they are no longer accepted.
+		if claims.SessionID == "" {
+			utils.Unauthorized(c, "invalid token")
+			c.Abort()
+			return
+		}
+		active, err := sessions.SessionActive(c.Request.Context(), claims.UserID, claims.SessionID)
+		if err != nil {
+			c.Error(err)
+			utils.InternalError(c)
+			c.Abort()
+			return
+		}
+		if !active {
+			utils.Unauthorized(c, "session has been revoked")
+			c.Abort()
+			return
+		}
+
 		// Authenticate
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyRole, claims.Role)
+		c.Set(ContextKeySessionID, claims.SessionID)
+		c.Set(ContextKeyRestrict, claims.Restrictions)
+		if claims.ImpersonatorID != "" {
+			c.Set(ContextKeyImpersonatorID, claims.ImpersonatorID)
+		}
+		setActor(c, authz.Actor{UserID: claims.UserID, Role: claims.Role, OrgID: claims.OrgID, ImpersonatorID: claims.ImpersonatorID})
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyVerifier, key string) {
+	principal, err := apiKeys.VerifyAPIKey(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		c.Error(err)
+		utils.InternalError(c)
+		c.Abort()
+		return
+	}
+	if principal == nil {
+		utils.Unauthorized(c, "invalid api key")
+		c.Abort()
+		return
+	}
+
+	c.Set(ContextKeyUserID, principal.UserID)
+	c.Set(ContextKeyRole, principal.Role)
+	c.Set(ContextKeyAPIKeyID, principal.KeyID)
+	c.Set(ContextKeyScopes, principal.Scopes)
+	setActor(c, authz.Actor{UserID: principal.UserID, Role: principal.Role, OrgID: principal.OrgID})
+	c.Next()
+}
+
+// setActor puts the caller on the request context, where repositories use
+// it to scope clinical records.
+func setActor(c *gin.Context, a authz.Actor) {
+	c.Set(ContextKeyOrgID, a.OrgID)
+	c.Request = c.Request.WithContext(authz.WithActor(c.Request.Context(), a))
+}
+
+// RequireScope lets API keys through only if they hold scope. User tokens
+// are not scoped and always pass. Must be applied after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetAPIKeyID(c) != "" && !slices.Contains(GetScopes(c), scope) {
+			utils.ForbiddenMsg(c, "api key lacks scope "+scope)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RejectAPIKeys keeps API keys off routes that act on a user's own account
+// or administer the system. Must be applied after Authenticate.
+func RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetAPIKeyID(c) != "" {
+			utils.ForbiddenMsg(c, "not available to api keys")
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-// RequireRole allows only users whose role is in the permitted list.
+// RejectImpersonation keeps impersonation tokens off routes where acting
+// as someone else would be misleading or dangerous, such as signing notes
+// or changing credentials. Must be applied after Authenticate.
+func RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetImpersonatorID(c) != "" {
+			utils.ForbiddenMsg(c, "not available while impersonating")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission allows only users whose role in the organisation they
+// are signed in to grants perm. API keys are checked against the role of
+// the user they act as, in the key's organisation.
 // Must be applied after Authenticate.
-func RequireRole(roles ...string) gin.HandlerFunc {
-	allowed := make(map[string]struct{}, len(roles))
-	for _, r := range roles {
-		allowed[r] = struct{}{}
+func RequirePermission(perm authz.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authz.Has(GetRole(c), perm) {
+			utils.Forbidden(c)
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
+}
 
+// RequireAccess combines RequirePermission and RequireScope, for routes
+// open to both users and API keys.
+func RequireAccess(perm authz.Permission, scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, _ := c.Get(ContextKeyRole)
-		if _, ok := allowed[role.(string)]; !ok {
+		if !authz.Has(GetRole(c), perm) {
 			utils.Forbidden(c)
 			c.Abort()
 			return
 		}
+		if GetAPIKeyID(c) != "" && !slices.Contains(GetScopes(c), scope) {
+			utils.ForbiddenMsg(c, "api key lacks scope "+scope)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RejectRestricted blocks tokens that carry account restrictions (e.g. an
+// unverified email), other than those listed in allow. Apply it to routes
+// that expose clinical data; account management routes stay reachable so
+// the user can lift the restriction.
+// Must be applied after Authenticate.
+func RejectRestricted(allow ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, _ := c.Get(ContextKeyRestrict)
+		r, _ := v.([]string)
+		r = slices.DeleteFunc(slices.Clone(r), func(s string) bool { return slices.Contains(allow, s) })
+		if len(r) > 0 {
+			utils.ForbiddenMsg(c, "account restricted: "+strings.Join(r, ", "))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -167,6 +336,45 @@ func GetUserID(c *gin.Context) string {
 	return id
 }
 
+// GetSessionID extracts the session the access token belongs to. It is
+// empty for tokens issued before sessions were introduced.
+func GetSessionID(c *gin.Context) string {
+	v, _ := c.Get(ContextKeySessionID)
+	id, _ := v.(string)
+	return id
+}
+
+// GetOrgID returns the organisation the request acts in, or "" for users
+// who belong to none.
+func GetOrgID(c *gin.Context) string {
+	v, _ := c.Get(ContextKeyOrgID)
+	id, _ := v.(string)
+	return id
+}
+
+// GetAPIKeyID returns the ID of the API key that authenticated the
+// request, or "" for user tokens.
+func GetAPIKeyID(c *gin.Context) string {
+	v, _ := c.Get(ContextKeyAPIKeyID)
+	id, _ := v.(string)
+	return id
+}
+
+// GetScopes returns the API key's scopes; it is nil for user tokens.
+func GetScopes(c *gin.Context) []string {
+	v, _ := c.Get(ContextKeyScopes)
+	s, _ := v.([]string)
+	return s
+}
+
+// GetImpersonatorID returns the admin behind an impersonation token, or
+// "" for everyone else.
+func GetImpersonatorID(c *gin.Context) string {
+	v, _ := c.Get(ContextKeyImpersonatorID)
+	id, _ := v.(string)
+	return id
+}
+
 // GetRole extracts the authenticated user's role from the Gin context.
 func GetRole(c *gin.Context) string {
 	v, _ := c.Get(ContextKeyRole)
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+	"github.com/jamesphm04/splose-clone-be/pkg/ratelimit"
+)
+
+// RateLimit applies a token bucket named name to the routes it guards. The
+// caller is the API key or user when authenticated, else the client IP
+// (only taken from proxy headers set by a trusted proxy), so it should sit
+// after Authenticate where there is one. Every response
+// carries RateLimit-Limit, -Remaining and -Reset headers; rejected ones also
+// carry Retry-After. A disabled limit lets everything through.
+//
+// If the store fails, the request is let through: an outage of the limiter
+// should not take the API down with it.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, log *zap.Logger) gin.HandlerFunc {
+	if !limit.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	log = log.Named("rate_limit")
+
+	return func(c *gin.Context) {
+		key := name + ":" + rateLimitKey(c)
+		res, err := store.Take(c.Request.Context(), key, limit, time.Now())
+		if err != nil {
+			log.Warn("rate limit store failed; allowing request", zap.String("bucket", name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			utils.TooManyRequests(c, "too many requests; try again later")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func rateLimitKey(c *gin.Context) string {
+	if id := GetAPIKeyID(c); id != "" {
+		return "key:" + id
+	}
+	if id := GetUserID(c); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
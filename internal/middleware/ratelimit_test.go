@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/pkg/ratelimit"
+)
+
+func TestRateLimitKeysOnPeerAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// As SetupRouter does when no proxy is configured.
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	// Two requests, then one every 10 minutes.
+	limit := ratelimit.Limit{Rate: 1.0 / 600, Burst: 2}
+	r.POST("/login", RateLimit(ratelimit.NewMemoryStore(), "auth", limit, zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	login := func(peer, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = peer + ":52000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A fresh X-Forwarded-For on every request must not buy a fresh bucket.
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := login("203.0.113.9", "10.0.0."+strconv.Itoa(i))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want 204", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %q", i+1, got, wantRemaining)
+		}
+		if got := w.Header().Get("Retry-After"); got != "" {
+			t.Errorf("request %d: Retry-After = %q on an allowed request", i+1, got)
+		}
+	}
+
+	w := login("203.0.113.9", "10.0.0.99")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status %d, want 429", w.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "1200",
+		"Retry-After":         "600",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	if w := login("203.0.113.10", "10.0.0.99"); w.Code != http.StatusNoContent {
+		t.Errorf("another client: status %d, want 204", w.Code)
+	}
+}
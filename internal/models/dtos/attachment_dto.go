@@ -0,0 +1,43 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// AttachmentDTO exposes an attachment with short-lived download links in
+// place of the raw storage location.
+type AttachmentDTO struct {
+	ID            string    `json:"id"`
+	NoteID        string    `json:"noteId"`
+	MessageID     string    `json:"messageId"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Size          int64     `json:"size"`
+	URL           string    `json:"url"`
+	PreviewURL    string    `json:"previewUrl,omitempty"`
+	PreviewStatus string    `json:"previewStatus"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	PageCount     int       `json:"pageCount,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func ToAttachmentDTO(a *entities.Attachment, url, previewURL string) *AttachmentDTO {
+	return &AttachmentDTO{
+		ID:            a.ID,
+		NoteID:        a.NoteID,
+		MessageID:     a.MessageID,
+		Name:          a.Name,
+		Type:          a.Type,
+		Size:          a.Size,
+		URL:           url,
+		PreviewURL:    previewURL,
+		PreviewStatus: string(a.PreviewStatus),
+		Width:         a.Width,
+		Height:        a.Height,
+		PageCount:     a.PageCount,
+		CreatedAt:     a.CreatedAt,
+	}
+}
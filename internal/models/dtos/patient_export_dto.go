@@ -0,0 +1,39 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// PatientExportDTO exposes an export with its expiring download link once
+// the archive is ready.
+type PatientExportDTO struct {
+	ID          string     `json:"id"`
+	PatientID   string     `json:"patientId"`
+	RequestedBy string     `json:"requestedBy"`
+	Status      string     `json:"status"`
+	Size        int64      `json:"size,omitempty"`
+	SHA256      string     `json:"sha256,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func ToPatientExportDTO(e *entities.PatientExport, downloadURL string) *PatientExportDTO {
+	return &PatientExportDTO{
+		ID:          e.ID,
+		PatientID:   e.PatientID,
+		RequestedBy: e.RequestedBy,
+		Status:      string(e.Status),
+		Size:        e.Size,
+		SHA256:      e.SHA256,
+		Error:       e.Error,
+		DownloadURL: downloadURL,
+		CompletedAt: e.CompletedAt,
+		ExpiresAt:   e.ExpiresAt,
+		CreatedAt:   e.CreatedAt,
+	}
+}
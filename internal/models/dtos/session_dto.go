@@ -0,0 +1,34 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+)
+
+// SessionDTO describes a signed-in device. Current marks the session the
+// request itself was made from; Impersonated marks one an admin opened to
+// act as the user.
+type SessionDTO struct {
+	ID           string    `json:"id"`
+	UserAgent    string    `json:"userAgent"`
+	IP           string    `json:"ip"`
+	Current      bool      `json:"current"`
+	Impersonated bool      `json:"impersonated"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastSeenAt   time.Time `json:"lastSeenAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+func ToSessionDTO(s *entities.Session, currentSessionID string) *SessionDTO {
+	return &SessionDTO{
+		ID:           s.ID,
+		UserAgent:    s.UserAgent,
+		IP:           s.IP,
+		Current:      s.ID == currentSessionID,
+		Impersonated: s.ImpersonatorID != nil,
+		CreatedAt:    s.CreatedAt,
+		LastSeenAt:   s.LastSeenAt,
+		ExpiresAt:    s.ExpiresAt,
+	}
+}
@@ -0,0 +1,61 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey lets an integration call the API as UserID without a login. Only
+// the SHA-256 of the key is stored; Prefix is kept so admins can tell keys
+// apart.
+type APIKey struct {
+	ID             string     `gorm:"type:uuid;primaryKey"                  json:"id"`
+	Name           string     `gorm:"type:varchar(100);not null"            json:"name"`
+	Prefix         string     `gorm:"type:varchar(16);not null"             json:"prefix"`
+	KeyHash        string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	UserID         string     `gorm:"type:uuid;not null;index"              json:"userId"`         // principal the key acts as
+	OrganizationID string     `gorm:"type:uuid;not null;index"              json:"organizationId"` // the clinic whose data the key reaches
+	CreatedBy      string     `gorm:"type:uuid;not null"                    json:"createdBy"`
+	Scopes         []string   `gorm:"serializer:json;type:jsonb;not null"   json:"scopes"`
+	AllowedIPs     []string   `gorm:"serializer:json;type:jsonb"            json:"allowedIps"` // CIDRs; empty allows any address
+	ExpiresAt      *time.Time `                                             json:"expiresAt"`
+	LastUsedAt     *time.Time `                                             json:"lastUsedAt"`
+	RevokedAt      *time.Time `                                             json:"revokedAt,omitempty"`
+	CreatedAt      time.Time  `                                             json:"createdAt"`
+}
+
+func (k *APIKey) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&k.ID)
+	return nil
+}
+
+func (*APIKey) tenantOwned() {}
+
+// Usable reports whether the key is neither revoked nor expired at now.
+func (k *APIKey) Usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Scopes grantable to API keys. A key can only reach routes that require
+// one of its scopes.
+const (
+	ScopePatientsRead       = "patients:read"
+	ScopePatientsWrite      = "patients:write"
+	ScopeNotesRead          = "notes:read"
+	ScopeNotesWrite         = "notes:write"
+	ScopeConversationsRead  = "conversations:read"
+	ScopeConversationsWrite = "conversations:write"
+	ScopeAttachmentsRead    = "attachments:read"
+)
+
+// APIKeyScopes lists every valid scope.
+var APIKeyScopes = []string{
+	ScopePatientsRead,
+	ScopePatientsWrite,
+	ScopeNotesRead,
+	ScopeNotesWrite,
+	ScopeConversationsRead,
+	ScopeConversationsWrite,
+	ScopeAttachmentsRead,
+}
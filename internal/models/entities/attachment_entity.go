@@ -9,19 +9,41 @@ import (
 // Attachment stores metadata about a file uploaded to S3.
 // The actual binary is stored in S3; only the URL and metadata live in DB.
 type Attachment struct {
-	ID        string         `gorm:"type:uuid;primaryKey"              json:"id"`
-	NoteID    string         `gorm:"type:uuid;index"                   json:"noteId"`
-	MessageID string         `gorm:"type:uuid;index"                   json:"messageId"`
-	URL       string         `gorm:"not null"                          json:"url"`
-	Name      string         `gorm:"not null"                          json:"name"`
-	Type      string         `gorm:"type:varchar(100)"                 json:"type"` // MIME type
-	Size      int64          `                                         json:"size"` // bytes
-	S3Key     string         `gorm:"type:varchar(256);not null;index"  json:"_"`
-	CreatedAt time.Time      `                                         json:"createdAt"`
-	DeletedAt gorm.DeletedAt `gorm:"index"                             json:"-"`
+	ID             string         `gorm:"type:uuid;primaryKey"              json:"id"`
+	OrganizationID string         `gorm:"type:uuid;not null;index"          json:"organizationId"`
+	NoteID         string         `gorm:"type:uuid;index"                   json:"noteId"`
+	MessageID      string         `gorm:"type:uuid;index"                   json:"messageId"`
+	URL            string         `gorm:"not null"                          json:"url"`
+	Name           string         `gorm:"not null"                          json:"name"`
+	Type           string         `gorm:"type:varchar(100)"                 json:"type"` // MIME type
+	Size           int64          `                                         json:"size"` // bytes
+	S3Key          string         `gorm:"type:varchar(256);not null;index"  json:"-"`
+	SHA256         string         `gorm:"type:varchar(64);index"            json:"sha256,omitempty"` // FK → blobs.hash; empty for pre-dedup uploads
+	CreatedAt      time.Time      `                                         json:"createdAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"                             json:"-"`
+
+	// Preview thumbnail, generated in the background after upload.
+	// Width/Height are pixels for images and points (first page) for PDFs.
+	PreviewStatus PreviewStatus `gorm:"type:varchar(20);default:'none'"   json:"previewStatus"`
+	PreviewKey    string        `gorm:"type:varchar(256)"                 json:"-"`
+	Width         int           `                                         json:"width,omitempty"`
+	Height        int           `                                         json:"height,omitempty"`
+	PageCount     int           `                                         json:"pageCount,omitempty"`
 }
 
+type PreviewStatus string
+
+const (
+	PreviewNone        PreviewStatus = "none" // type has no preview
+	PreviewPending     PreviewStatus = "pending"
+	PreviewReady       PreviewStatus = "ready"
+	PreviewFailed      PreviewStatus = "failed"
+	PreviewUnsupported PreviewStatus = "unsupported"
+)
+
 func (a *Attachment) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&a.ID)
 	return nil
 }
+
+func (*Attachment) tenantOwned() {}
@@ -0,0 +1,122 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditEvent records who did what to which resource, and how it went.
+// Events form a hash chain: each carries the next sequence number and the
+// hash of the one before it, and its own Hash covers both, so an edited,
+// inserted or deleted row breaks the chain from there on. Rows are only
+// ever inserted; the database rejects updates and deletes.
+type AuditEvent struct {
+	ID             string         `gorm:"type:uuid;primaryKey"                         json:"id"`
+	Seq            int64          `gorm:"uniqueIndex"                                  json:"seq"`
+	ActorID        *string        `gorm:"type:uuid;index"                              json:"actorId"`        // nil for system actions
+	ImpersonatorID *string        `gorm:"type:uuid;index"                              json:"impersonatorId"` // admin acting as the actor, if any
+	OrganizationID *string        `gorm:"type:uuid;index"                              json:"organizationId"` // organisation the actor acted in
+	Action         string         `gorm:"type:varchar(100);not null;index"             json:"action"`
+	ResourceType   string         `gorm:"type:varchar(50);not null"                    json:"resourceType"`
+	ResourceID     string         `gorm:"type:varchar(100);not null;index"             json:"resourceId"`
+	PatientID      *string        `gorm:"type:uuid;index"                              json:"patientId"` // patient whose data was touched, if any
+	IP             string         `gorm:"type:varchar(64)"                             json:"ip"`
+	Outcome        string         `gorm:"type:varchar(20);not null;default:'success'"  json:"outcome"`
+	Details        map[string]any `gorm:"serializer:json;type:jsonb"                   json:"details,omitempty"`
+	CreatedAt      time.Time      `gorm:"index"                                        json:"createdAt"`
+	PrevHash       string         `gorm:"type:varchar(64)"                             json:"prevHash"`
+	Hash           string         `gorm:"type:varchar(64)"                             json:"hash"`
+}
+
+// AuditChainLock is the Postgres advisory lock held while appending to the
+// chain, so each event links to the one committed before it.
+const AuditChainLock = 0x617564697400
+
+func (e *AuditEvent) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&e.ID)
+	return nil
+}
+
+// Seal links the event after prev, or starts the chain if prev is nil,
+// and sets its hash. CreatedAt is rounded to what Postgres stores, so the
+// hash can be recomputed from the row.
+func (e *AuditEvent) Seal(prev *AuditEvent) {
+	newUUID(&e.ID)
+	if e.Outcome == "" {
+		e.Outcome = AuditSuccess
+	}
+	e.Seq, e.PrevHash = 1, ""
+	if prev != nil {
+		e.Seq, e.PrevHash = prev.Seq+1, prev.Hash
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	// Details are stored as JSON; hash them as they will read back.
+	if len(e.Details) == 0 {
+		e.Details = nil
+	} else {
+		b, _ := json.Marshal(e.Details)
+		e.Details = nil
+		_ = json.Unmarshal(b, &e.Details)
+	}
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash returns the hash the event should carry: SHA-256 over its
+// content and PrevHash.
+func (e *AuditEvent) ComputeHash() string {
+	// Field order is fixed by the struct, and map keys are sorted by
+	// encoding/json, so the encoding is stable.
+	content, _ := json.Marshal(struct {
+		ID             string         `json:"id"`
+		Seq            int64          `json:"seq"`
+		ActorID        *string        `json:"actorId"`
+		ImpersonatorID *string        `json:"impersonatorId"`
+		OrganizationID *string        `json:"organizationId"`
+		Action         string         `json:"action"`
+		ResourceType   string         `json:"resourceType"`
+		ResourceID     string         `json:"resourceId"`
+		PatientID      *string        `json:"patientId"`
+		IP             string         `json:"ip"`
+		Outcome        string         `json:"outcome"`
+		Details        map[string]any `json:"details"`
+		CreatedAt      int64          `json:"createdAt"`
+		PrevHash       string         `json:"prevHash"`
+	}{
+		e.ID, e.Seq, e.ActorID, e.ImpersonatorID, e.OrganizationID, e.Action, e.ResourceType,
+		e.ResourceID, e.PatientID, e.IP, e.Outcome, e.Details, e.CreatedAt.UnixMicro(), e.PrevHash,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Outcomes recorded in AuditEvent.Outcome.
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"  // not permitted, or not visible to the actor
+	AuditInvalid = "invalid" // rejected as malformed or conflicting
+	AuditFailure = "failure" // a server error
+)
+
+// Audited actions.
+const (
+	AuditUserRoleChanged = "user.role_changed"
+	AuditUserDisabled    = "user.disabled"
+	AuditUserEnabled     = "user.enabled"
+	AuditUserDeleted     = "user.deleted"
+	AuditUserRestored    = "user.restored"
+	AuditUserLoggedOut   = "user.logged_out"
+
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationEnded   = "impersonation.ended"
+
+	// Recorded by the retention purge, without an actor.
+	AuditRetentionPurged = "retention.purged"
+	AuditPatientPurged   = "patient.purged"
+)
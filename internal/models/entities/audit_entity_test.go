@@ -0,0 +1,109 @@
+package entities
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func sealedEvent(prev *AuditEvent, details map[string]any) *AuditEvent {
+	actor := "8f0c2a4e-7c1d-4a51-9a55-1f3c9d7e2b10"
+	e := &AuditEvent{
+		ActorID:      &actor,
+		Action:       AuditUserRoleChanged,
+		ResourceType: "user",
+		ResourceID:   "0b7e5a52-3c59-4f7d-8d2e-5b1c1e0f9a33",
+		IP:           "198.51.100.7",
+		Details:      details,
+		CreatedAt:    time.Date(2026, 10, 18, 9, 30, 0, 123456789, time.FixedZone("AEST", 10*3600)),
+	}
+	e.Seal(prev)
+	return e
+}
+
+func TestSealLinksEvents(t *testing.T) {
+	first := sealedEvent(nil, nil)
+	second := sealedEvent(first, nil)
+
+	if first.Seq != 1 || first.PrevHash != "" || first.Outcome != AuditSuccess {
+		t.Errorf("first event: seq %d, prev %q, outcome %q", first.Seq, first.PrevHash, first.Outcome)
+	}
+	if second.Seq != 2 || second.PrevHash != first.Hash {
+		t.Errorf("second event: seq %d, prev %q; want 2 after %q", second.Seq, second.PrevHash, first.Hash)
+	}
+	if first.Hash == "" || first.Hash == second.Hash {
+		t.Errorf("hashes %q and %q", first.Hash, second.Hash)
+	}
+	// Postgres keeps microseconds; the hash must not depend on the rest.
+	if first.CreatedAt.Location() != time.UTC || first.CreatedAt.Nanosecond()%1000 != 0 {
+		t.Errorf("CreatedAt = %v, want UTC in whole microseconds", first.CreatedAt)
+	}
+}
+
+func TestComputeHashCoversEveryField(t *testing.T) {
+	other := "c7d1e3a2-9b84-4f0e-a6c5-2d8b7e1f4a90"
+	for _, tc := range []struct {
+		name string
+		edit func(e *AuditEvent)
+	}{
+		{"id", func(e *AuditEvent) { e.ID = other }},
+		{"seq", func(e *AuditEvent) { e.Seq++ }},
+		{"actor", func(e *AuditEvent) { e.ActorID = &other }},
+		{"actor removed", func(e *AuditEvent) { e.ActorID = nil }},
+		{"impersonator", func(e *AuditEvent) { e.ImpersonatorID = &other }},
+		{"organization", func(e *AuditEvent) { e.OrganizationID = &other }},
+		{"action", func(e *AuditEvent) { e.Action = AuditUserDeleted }},
+		{"resource type", func(e *AuditEvent) { e.ResourceType = "patient" }},
+		{"resource", func(e *AuditEvent) { e.ResourceID = other }},
+		{"patient", func(e *AuditEvent) { e.PatientID = &other }},
+		{"ip", func(e *AuditEvent) { e.IP = "203.0.113.9" }},
+		{"outcome", func(e *AuditEvent) { e.Outcome = AuditDenied }},
+		{"details", func(e *AuditEvent) { e.Details["role"] = "admin" }},
+		{"details removed", func(e *AuditEvent) { e.Details = nil }},
+		{"created at", func(e *AuditEvent) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) }},
+		{"prev hash", func(e *AuditEvent) { e.PrevHash = e.Hash }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := sealedEvent(sealedEvent(nil, nil), map[string]any{"role": "practitioner"})
+			tc.edit(e)
+			if e.ComputeHash() == e.Hash {
+				t.Error("edit does not change the hash")
+			}
+		})
+	}
+}
+
+func TestHashSurvivesJSONRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		details map[string]any
+	}{
+		{"none", nil},
+		{"empty", map[string]any{}},
+		{"strings", map[string]any{"from": "practitioner", "to": "admin"}},
+		{"ints", map[string]any{"patients": 3, "notes": int64(42), "bytes": uint32(1 << 20)}},
+		{"beyond float precision", map[string]any{"n": int64(1<<53 + 1)}},
+		{"floats", map[string]any{"ratio": 0.1, "big": 1e21, "whole": 2.0}},
+		{"nested", map[string]any{"ids": []string{"a", "b"}, "counts": map[string]int{"notes": 2}, "ok": true, "none": nil}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := sealedEvent(sealedEvent(nil, nil), tc.details)
+
+			// Details are stored as jsonb and the rest as columns; read back,
+			// numbers come out as float64 and times in the server's zone.
+			raw, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back AuditEvent
+			if err := json.Unmarshal(raw, &back); err != nil {
+				t.Fatal(err)
+			}
+			back.CreatedAt = back.CreatedAt.In(time.FixedZone("CET", 3600))
+
+			if got := back.ComputeHash(); got != e.Hash {
+				t.Errorf("hash after round trip = %s, want %s; stored %s", got, e.Hash, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package entities
+
+import (
+	"time"
+)
+
+// Blob is a content-addressed object in S3 shared by every attachment whose
+// bytes hash to the same SHA-256. RefCount is the number of attachment rows,
+// soft-deleted ones included, that still point at it; the object is removed
+// when the last of them is purged.
+//
+// A blob is pending until its object is known to be in S3. Uploads only
+// deduplicate against uploaded blobs; while a blob is pending, every
+// uploader puts the (identical) object itself.
+type Blob struct {
+	Hash      string     `gorm:"type:varchar(64);primaryKey"                  json:"hash"` // hex SHA-256
+	S3Key     string     `gorm:"type:varchar(256);not null"                   json:"-"`
+	Type      string     `gorm:"type:varchar(100)"                            json:"type"`
+	Size      int64      `                                                    json:"size"`
+	RefCount  int64      `gorm:"not null;default:0"                           json:"refCount"`
+	Status    BlobStatus `gorm:"type:varchar(20);not null;default:'uploaded'" json:"status"`
+	CreatedAt time.Time  `                                                    json:"createdAt"`
+	UpdatedAt time.Time  `                                                    json:"updatedAt"`
+}
+
+type BlobStatus string
+
+const (
+	BlobPending  BlobStatus = "pending"
+	BlobUploaded BlobStatus = "uploaded" // default, so blobs from before the status are uploaded
+)
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// CareTeamMember gives a user access to a patient they do not own.
+type CareTeamMember struct {
+	PatientID string    `gorm:"type:uuid;primaryKey"              json:"patientId"`
+	UserID    string    `gorm:"type:uuid;primaryKey;index"        json:"userId"`
+	AddedBy   string    `gorm:"type:uuid;not null"                json:"addedBy"`
+	CreatedAt time.Time `                                         json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:UserID" json:"user"`
+}
@@ -9,10 +9,11 @@ import (
 // Conversation represents an AI chat session tied to a Note.
 
 type Conversation struct {
-	ID        string    `gorm:"type:uuid;primaryKey"     json:"id"`
-	NoteID    string    `gorm:"type:uuid;not null;index" json:"noteId"`
-	CreatedAt time.Time `                                json:"createdAt"`
-	UpdatedAt time.Time `                                json:"updatedAt"`
+	ID             string    `gorm:"type:uuid;primaryKey"     json:"id"`
+	OrganizationID string    `gorm:"type:uuid;not null;index" json:"organizationId"`
+	NoteID         string    `gorm:"type:uuid;not null;index" json:"noteId"`
+	CreatedAt      time.Time `                                json:"createdAt"`
+	UpdatedAt      time.Time `                                json:"updatedAt"`
 
 	// Associations
 	Note     Note      `gorm:"foreignKey:NoteID"      json:"-"`
@@ -23,3 +24,5 @@ func (c *Conversation) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&c.ID)
 	return nil
 }
+
+func (*Conversation) tenantOwned() {}
@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external identity
+// provider. (Issuer, Subject) is the provider's stable user identifier;
+// the email may change there and is kept for reference only.
+type UserIdentity struct {
+	ID        string    `gorm:"type:uuid;primaryKey"                          json:"id"`
+	UserID    string    `gorm:"type:uuid;not null;index"                      json:"userId"`
+	Issuer    string    `gorm:"not null;uniqueIndex:idx_identity_issuer_sub"  json:"issuer"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_identity_issuer_sub"  json:"subject"`
+	Email     string    `                                                     json:"email"`
+	CreatedAt time.Time `                                                     json:"createdAt"`
+	UpdatedAt time.Time `                                                     json:"updatedAt"`
+}
+
+func (i *UserIdentity) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&i.ID)
+	return nil
+}
+
+// OIDCLoginState remembers an SSO login between the redirect to the
+// provider and its callback. It is keyed by the SHA-256 of the state
+// parameter and deleted when the callback redeems it.
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"type:varchar(64);primaryKey"   json:"-"`
+	Nonce        string    `gorm:"not null"                      json:"-"`
+	CodeVerifier string    `gorm:"not null"                      json:"-"`
+	ExpiresAt    time.Time `gorm:"not null;index"                json:"expiresAt"`
+	CreatedAt    time.Time `                                     json:"createdAt"`
+}
@@ -0,0 +1,38 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation asks someone to join an organisation with a role. The emailed
+// link carries a signed token whose "jti" must match TokenID; resending
+// replaces TokenID, so only the newest link works.
+type Invitation struct {
+	ID             string     `gorm:"type:uuid;primaryKey"              json:"id"`
+	OrganizationID string     `gorm:"type:uuid;not null;index"          json:"organizationId"`
+	Email          string     `gorm:"type:varchar(255);not null;index"  json:"email"`
+	Role           string     `gorm:"type:varchar(50);not null"         json:"role"`
+	TokenID        string     `gorm:"type:uuid;not null;uniqueIndex"    json:"-"`
+	InvitedBy      string     `gorm:"type:uuid;not null"                json:"invitedBy"`
+	ExpiresAt      time.Time  `gorm:"not null"                          json:"expiresAt"`
+	SentAt         time.Time  `                                         json:"sentAt"`
+	AcceptedAt     *time.Time `                                         json:"acceptedAt,omitempty"`
+	AcceptedBy     *string    `gorm:"type:uuid"                         json:"acceptedBy,omitempty"`
+	RevokedAt      *time.Time `                                         json:"revokedAt,omitempty"`
+	CreatedAt      time.Time  `                                         json:"createdAt"`
+	UpdatedAt      time.Time  `                                         json:"updatedAt"`
+}
+
+func (i *Invitation) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&i.ID)
+	return nil
+}
+
+func (*Invitation) tenantOwned() {}
+
+// Pending reports whether the invitation can still be accepted at t.
+func (i *Invitation) Pending(t time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && t.Before(i.ExpiresAt)
+}
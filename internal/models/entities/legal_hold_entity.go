@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LegalHold stops a patient's record, deleted or not, from being purged,
+// e.g. while it may be needed as evidence. Released holds are kept as a
+// history of who held the record and why.
+type LegalHold struct {
+	ID             string     `gorm:"type:uuid;primaryKey"              json:"id"`
+	OrganizationID string     `gorm:"type:uuid;not null;index"          json:"organizationId"`
+	PatientID      string     `gorm:"type:uuid;not null;index"          json:"patientId"`
+	Reason         string     `gorm:"type:text;not null"                json:"reason"`
+	PlacedBy       string     `gorm:"type:uuid;not null"                json:"placedBy"`
+	ReleasedBy     *string    `gorm:"type:uuid"                         json:"releasedBy,omitempty"`
+	ReleasedAt     *time.Time `gorm:"index"                             json:"releasedAt,omitempty"` // nil while the hold is active
+	CreatedAt      time.Time  `                                         json:"createdAt"`
+}
+
+func (h *LegalHold) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&h.ID)
+	return nil
+}
+
+func (*LegalHold) tenantOwned() {}
+
+// Active reports whether the hold has not been released.
+func (h *LegalHold) Active() bool {
+	return h.ReleasedAt == nil
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key: an account (by
+// hashed email, whether or not it is registered) or a client IP.
+type LoginThrottle struct {
+	Key           string     `gorm:"type:varchar(80);primaryKey"       json:"key"`
+	Failures      int        `gorm:"not null;default:0"                json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null;index"                    json:"lastFailureAt"`
+	LockedUntil   *time.Time `                                         json:"lockedUntil,omitempty"`
+}
@@ -16,9 +16,10 @@ const (
 // Message stores a single message in a conversation.
 type Message struct {
 	ID             string         `gorm:"type:uuid;primaryKey"              json:"id"`
+	OrganizationID string         `gorm:"type:uuid;not null;index"          json:"organizationId"`
 	ConversationID string         `gorm:"type:uuid;not null;index"          json:"conversationId"`
 	Role           MessageRole    `gorm:"type:varchar(20);not null"         json:"role"`
-	Content        string         `gorm:"type:text"                         json:"content"`
+	Content        string         `gorm:"type:text;serializer:encrypted"    json:"content"`
 	CreatedAt      time.Time      `                                         json:"createdAt"`
 	DeletedAt      gorm.DeletedAt `gorm:"index"                             json:"-"`
 
@@ -31,3 +32,5 @@ func (m *Message) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&m.ID)
 	return nil
 }
+
+func (*Message) tenantOwned() {}
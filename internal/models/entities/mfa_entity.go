@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a single-use fallback for a lost authenticator. Only the
+// SHA-256 of the normalised code is stored.
+type RecoveryCode struct {
+	ID        string     `gorm:"type:uuid;primaryKey"              json:"id"`
+	UserID    string     `gorm:"type:uuid;not null;index"          json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;index"   json:"-"`
+	UsedAt    *time.Time `                                         json:"usedAt,omitempty"`
+	CreatedAt time.Time  `                                         json:"createdAt"`
+}
+
+func (r *RecoveryCode) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&r.ID)
+	return nil
+}
+
+// MFAPolicy records whether users with Role must enrol in MFA. Roles
+// without a row do not require it.
+type MFAPolicy struct {
+	Role      string    `gorm:"type:varchar(50);primaryKey"       json:"role"`
+	Required  bool      `gorm:"not null;default:false"            json:"required"`
+	UpdatedAt time.Time `                                         json:"updatedAt"`
+}
@@ -8,14 +8,17 @@ import (
 
 // Note represents a clinical note written by a User for a Patient.
 type Note struct {
-	ID        string         `gorm:"type:uuid;primaryKey"           json:"id"`
-	PatientID string         `gorm:"type:uuid;not null;index"       json:"patientId"`
-	UserID    string         `gorm:"type:uuid;not null;index"       json:"userId"`
-	Title     string         `gorm:"type:varchar(255)"              json:"title"`
-	Content   string         `gorm:"type:text"                      json:"content"`
-	CreatedAt time.Time      `                                      json:"createdAt"`
-	UpdatedAt time.Time      `                                      json:"updatedAt"`
-	DeletedAt gorm.DeletedAt `gorm:"index"                          json:"-"`
+	ID             string         `gorm:"type:uuid;primaryKey"           json:"id"`
+	OrganizationID string         `gorm:"type:uuid;not null;index"       json:"organizationId"`
+	PatientID      string         `gorm:"type:uuid;not null;index"       json:"patientId"`
+	UserID         string         `gorm:"type:uuid;not null;index"       json:"userId"`
+	Title          string         `gorm:"type:varchar(255)"              json:"title"`
+	Content        string         `gorm:"type:text;serializer:encrypted" json:"content"`
+	SignedAt       *time.Time     `                                      json:"signedAt,omitempty"` // set once; a signed note is final
+	SignedBy       *string        `gorm:"type:uuid"                      json:"signedBy,omitempty"`
+	CreatedAt      time.Time      `                                      json:"createdAt"`
+	UpdatedAt      time.Time      `                                      json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"                          json:"-"`
 
 	// Associations
 	Patient       Patient        `gorm:"foreignKey:PatientID"    json:"-"`
@@ -28,3 +31,5 @@ func (n *Note) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&n.ID)
 	return nil
 }
+
+func (*Note) tenantOwned() {}
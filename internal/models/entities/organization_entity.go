@@ -0,0 +1,44 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Organization is a clinic. Patients and everything recorded about them
+// belong to one organisation, and a user only sees the data of the
+// organisation their session is signed in to.
+type Organization struct {
+	ID        string         `gorm:"type:uuid;primaryKey"                   json:"id"`
+	Name      string         `gorm:"type:varchar(255);not null"             json:"name"`
+	Slug      string         `gorm:"type:varchar(100);not null;uniqueIndex" json:"slug"`
+	CreatedAt time.Time      `                                              json:"createdAt"`
+	UpdatedAt time.Time      `                                              json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index"                                  json:"-"`
+}
+
+func (o *Organization) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&o.ID)
+	return nil
+}
+
+// Membership lets a user sign in to an organisation, with the role they
+// hold there. A user's roles in different organisations are independent.
+type Membership struct {
+	OrganizationID string    `gorm:"type:uuid;primaryKey"                              json:"organizationId"`
+	UserID         string    `gorm:"type:uuid;primaryKey;index"                        json:"userId"`
+	Role           string    `gorm:"type:varchar(50);not null;default:'practitioner'" json:"role"`
+	CreatedAt      time.Time `                                                         json:"createdAt"`
+
+	// Associations (one or the other is loaded, depending on the listing)
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	User         *User         `gorm:"foreignKey:UserID"         json:"user,omitempty"`
+}
+
+// TenantOwned marks models whose rows belong to the organisation in their
+// OrganizationID field. Queries on them are scoped to the caller's
+// organisation; see database.tenancy.
+type TenantOwned interface {
+	tenantOwned()
+}
@@ -16,27 +16,33 @@ const (
 	GenderUnknown Gender = "unknown"
 )
 
-// Patient stores personal patient information, linked to a User.
+// Patient stores personal patient information, linked to a User. Contact
+// details are encrypted at rest; EmailIndex and PhoneNumberIndex are their
+// blind indexes, for lookups by equality.
 type Patient struct {
-	ID          string         `gorm:"type:uuid;primaryKey"           json:"id"`
-	Email       string         `gorm:"uniqueIndex"                    json:"email,omitempty"`
-	FirstName   string         `gorm:"not null"                       json:"firstName"`
-	LastName    string         `gorm:"not null"                       json:"lastName"`
-	PhoneNumber string         `gorm:"type:varchar(30)"               json:"phoneNumber,omitempty"`
-	DateOfBirth *types.Date    `                                      json:"dateOfBirth,omitempty"`
-	Gender      Gender         `gorm:"type:varchar(10)"               json:"gender,omitempty"`
-	FullAddress string         `gorm:"type:text"                      json:"fullAddress,omitempty"`
-	UserID      string         `gorm:"type:uuid;not null;index"       json:"userId"`
-	CreatedAt   time.Time      `                                      json:"createdAt"`
-	UpdatedAt   time.Time      `                                      json:"updatedAt"`
-	DeletedAt   gorm.DeletedAt `gorm:"index"                          json:"-"`
-
+	ID               string         `gorm:"type:uuid;primaryKey"                                                        json:"id"`
+	OrganizationID   string         `gorm:"type:uuid;not null;uniqueIndex:idx_patients_org_email_bidx"                  json:"organizationId"`
+	Email            string         `gorm:"type:text;serializer:encrypted"                                              json:"email,omitempty"`
+	EmailIndex       *string        `gorm:"type:varchar(64);uniqueIndex:idx_patients_org_email_bidx;blindIndex:Email"   json:"-"` // unique within the organisation
+	FirstName        string         `gorm:"not null"                                                                    json:"firstName"`
+	LastName         string         `gorm:"not null"                                                                    json:"lastName"`
+	PhoneNumber      string         `gorm:"type:text;serializer:encrypted"                                              json:"phoneNumber,omitempty"`
+	PhoneNumberIndex *string        `gorm:"type:varchar(64);index;blindIndex:PhoneNumber"                               json:"-"`
+	DateOfBirth      *types.Date    `                                                                                   json:"dateOfBirth,omitempty"`
+	Gender           Gender         `gorm:"type:varchar(10)"                                                            json:"gender,omitempty"`
+	FullAddress      string         `gorm:"type:text;serializer:encrypted"                                              json:"fullAddress,omitempty"`
+	UserID           string         `gorm:"type:uuid;not null;index"                                                    json:"userId"`
+	CreatedAt        time.Time      `                                                                                   json:"createdAt"`
+	UpdatedAt        time.Time      `                                                                                   json:"updatedAt"`
+	DeletedAt        gorm.DeletedAt `gorm:"index"                                                                       json:"-"`
 	// Associations (not loaded by default)
-	User  User   `gorm:"foreignKey:UserID"  json:"-"`
-	Notes []Note `gorm:"foreignKey:PatientID" json:"-"`
+	User  User   `gorm:"foreignKey:UserID"                                     json:"-"`
+	Notes []Note `gorm:"foreignKey:PatientID"                                  json:"-"`
 }
 
 func (p *Patient) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&p.ID)
 	return nil
 }
+
+func (*Patient) tenantOwned() {}
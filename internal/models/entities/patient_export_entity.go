@@ -0,0 +1,48 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PatientExport is a copy of a patient's record requested under their
+// right of access. The archive is built in the background and kept in
+// storage until ExpiresAt, after which it is deleted.
+type PatientExport struct {
+	ID             string       `gorm:"type:uuid;primaryKey"              json:"id"`
+	OrganizationID string       `gorm:"type:uuid;not null;index"          json:"organizationId"`
+	PatientID      string       `gorm:"type:uuid;not null;index"          json:"patientId"`
+	RequestedBy    string       `gorm:"type:uuid;not null"                json:"requestedBy"`
+	Status         ExportStatus `gorm:"type:varchar(20);not null;index"   json:"status"`
+	S3Key          string       `gorm:"type:varchar(256)"                 json:"-"`
+	Size           int64        `                                         json:"size,omitempty"` // bytes
+	SHA256         string       `gorm:"type:varchar(64)"                  json:"sha256,omitempty"`
+	Error          string       `gorm:"type:text"                         json:"error,omitempty"`
+	CompletedAt    *time.Time   `                                         json:"completedAt,omitempty"`
+	ExpiresAt      *time.Time   `gorm:"index"                             json:"expiresAt,omitempty"` // set once ready
+	CreatedAt      time.Time    `                                         json:"createdAt"`
+	UpdatedAt      time.Time    `                                         json:"updatedAt"`
+}
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+	ExportExpired ExportStatus = "expired" // archive deleted
+)
+
+func (e *PatientExport) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&e.ID)
+	return nil
+}
+
+func (*PatientExport) tenantOwned() {}
+
+// Downloadable reports whether the archive can be fetched at t.
+func (e *PatientExport) Downloadable(t time.Time) bool {
+	return e.Status == ExportReady && e.ExpiresAt != nil && t.Before(*e.ExpiresAt)
+}
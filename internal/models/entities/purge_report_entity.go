@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PurgeReport records one run of the retention purge: what was eligible,
+// what was removed for good and what went wrong. Reports hold row IDs
+// only, never record content. HeldPatients counts deleted patients kept
+// only because of a legal hold; OverduePatients counts live patients last
+// changed longer ago than the maximum retention, which are reported for
+// review but never purged.
+type PurgeReport struct {
+	ID              string        `gorm:"type:uuid;primaryKey"        json:"id"`
+	DryRun          bool          `gorm:"not null;default:false"      json:"dryRun"`
+	Tables          []PurgedTable `gorm:"serializer:json;type:jsonb"  json:"tables"`
+	HeldPatients    int           `                                   json:"heldPatients"`
+	OverduePatients int           `                                   json:"overduePatients"`
+	Errors          []string      `gorm:"serializer:json;type:jsonb"  json:"errors,omitempty"`
+	StartedAt       time.Time     `                                   json:"startedAt"`
+	FinishedAt      time.Time     `gorm:"index"                       json:"finishedAt"`
+}
+
+// PurgedTable counts the purge of one table. Rows removed along with a
+// parent are counted under the parent only.
+type PurgedTable struct {
+	Table    string   `json:"table"`
+	Eligible int      `json:"eligible"`
+	Purged   int      `json:"purged"`
+	Failed   int      `json:"failed"`
+	Gone     int      `json:"gone,omitempty"` // deleted meanwhile, e.g. by another purge
+	IDs      []string `json:"ids,omitempty"`  // purged, or eligible on a dry run
+}
+
+func (r *PurgeReport) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&r.ID)
+	return nil
+}
@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// RateLimitBucket is a token bucket shared by all API replicas, see
+// ratelimit.Bucket.
+type RateLimitBucket struct {
+	Key     string    `gorm:"type:varchar(200);primaryKey" json:"key"`
+	Tokens  float64   `gorm:"not null"                     json:"tokens"`
+	TakenAt time.Time `gorm:"not null"                     json:"takenAt"`
+	// IdleAt is when the bucket will have refilled and can be dropped.
+	IdleAt time.Time `gorm:"not null;index" json:"idleAt"`
+}
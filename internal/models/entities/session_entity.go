@@ -0,0 +1,51 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is one refresh-token family. It starts at login and every refresh
+// rotates CurrentTokenID; presenting any earlier token of the family means a
+// token leaked, and the whole session is revoked.
+type Session struct {
+	ID             string     `gorm:"type:uuid;primaryKey"              json:"id"` // the "sid" claim
+	UserID         string     `gorm:"type:uuid;not null;index"          json:"userId"`
+	CurrentTokenID string     `gorm:"type:uuid;not null"                json:"-"`              // "jti" of the only valid refresh token
+	OrganizationID *string    `gorm:"type:uuid"                         json:"organizationId"` // active organisation; nil for users without one
+	ImpersonatorID *string    `gorm:"type:uuid;index"                   json:"impersonatorId"` // admin acting as the user; such sessions cannot be refreshed
+	ExpiresAt      time.Time  `gorm:"not null;index"                    json:"expiresAt"`
+	RevokedAt      *time.Time `                                         json:"revokedAt,omitempty"`
+	RevokedReason  string     `gorm:"type:varchar(50)"                  json:"revokedReason,omitempty"`
+	UserAgent      string     `gorm:"type:varchar(512)"                 json:"userAgent"`
+	IP             string     `gorm:"type:varchar(64)"                  json:"ip"`
+	LastSeenAt     time.Time  `                                         json:"lastSeenAt"`
+	CreatedAt      time.Time  `                                         json:"createdAt"`
+	UpdatedAt      time.Time  `                                         json:"updatedAt"`
+}
+
+// Reasons recorded in Session.RevokedReason.
+const (
+	SessionRevokedLogout        = "logout"
+	SessionRevokedLogoutAll     = "logout_all"
+	SessionRevokedReuse         = "token_reuse"
+	SessionRevokedUserDeleted   = "user_deleted"
+	SessionRevokedRoleChanged   = "role_changed"
+	SessionRevokedPasswordReset = "password_reset"
+	SessionRevokedMembership    = "membership_removed"
+	SessionRevokedUserDisabled  = "user_disabled"
+	SessionRevokedAdmin         = "admin_logout"
+	SessionRevokedImpersonation = "impersonation_ended"
+	SessionRevokedEmailChanged  = "email_changed"
+)
+
+func (s *Session) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&s.ID)
+	return nil
+}
+
+// Active reports whether the session can still be refreshed at t.
+func (s *Session) Active(t time.Time) bool {
+	return s.RevokedAt == nil && t.Before(s.ExpiresAt)
+}
@@ -15,14 +15,19 @@ func newUUID(id *string) {
 
 // User represents an authenticated system user
 type User struct {
-	ID           string         `gorm:"type:uuid;primaryKey"              json:"id"`
-	Email        string         `gorm:"uniqueIndex;not null"              json:"email"`
-	PasswordHash string         `gorm:"not null"                          json:"-"` // never expose password hash in API responses
-	Username     string         `gorm:"not null"                          json:"username"`
-	Role         string         `gorm:"type:varchar(50);default:'user'"   json:"role"`
-	CreatedAt    time.Time      `                                         json:"createdAt"`
-	UpdatedAt    time.Time      `                                         json:"updatedAt"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"                             json:"-"`
+	ID               string         `gorm:"type:uuid;primaryKey"              json:"id"`
+	Email            string         `gorm:"uniqueIndex;not null"              json:"email"`
+	PasswordHash     string         `gorm:"not null"                          json:"-"` // never expose password hash in API responses
+	Username         string         `gorm:"not null"                          json:"username"`
+	EmailVerifiedAt  *time.Time     `                                         json:"emailVerifiedAt"` // nil until the verification link is followed
+	DisabledAt       *time.Time     `                                         json:"disabledAt"`      // set while an admin has blocked the account
+	MFAEnabledAt     *time.Time     `                                         json:"mfaEnabledAt"`
+	MFASecret        string         `gorm:"type:varchar(64)"                  json:"-"` // base32 TOTP secret, set once enrolment is confirmed
+	MFAPendingSecret string         `gorm:"type:varchar(64)"                  json:"-"` // secret awaiting its first code
+	MFALastStep      int64          `gorm:"not null;default:0"                json:"-"` // last accepted TOTP step, blocks replays
+	CreatedAt        time.Time      `                                         json:"createdAt"`
+	UpdatedAt        time.Time      `                                         json:"updatedAt"`
+	DeletedAt        gorm.DeletedAt `gorm:"index"                             json:"-"`
 
 	// Associations (not loaded by default)
 	Patients []Patient `gorm:"foreignKey:UserID" json:"-"`
@@ -34,3 +39,9 @@ func (u *User) BeforeCreate(_ *gorm.DB) error {
 	newUUID(&u.ID)
 	return nil
 }
+
+// Disabled reports whether an admin has blocked the account. A disabled
+// user cannot sign in, refresh tokens or use existing access tokens.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
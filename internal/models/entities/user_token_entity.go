@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenPurpose says what a UserToken may be redeemed for.
+type TokenPurpose string
+
+const (
+	TokenPasswordReset TokenPurpose = "password_reset"
+	TokenEmailVerify   TokenPurpose = "email_verify"
+)
+
+// UserToken is a single-use secret sent to a user by email. Only the
+// SHA-256 of the token is stored.
+type UserToken struct {
+	ID        string       `gorm:"type:uuid;primaryKey"                       json:"id"`
+	UserID    string       `gorm:"type:uuid;not null;index:idx_user_purpose"  json:"userId"`
+	Purpose   TokenPurpose `gorm:"type:varchar(30);not null;index:idx_user_purpose" json:"purpose"`
+	TokenHash string       `gorm:"type:varchar(64);not null;uniqueIndex"      json:"-"`
+	ExpiresAt time.Time    `gorm:"not null"                                   json:"expiresAt"`
+	UsedAt    *time.Time   `                                                  json:"usedAt,omitempty"`
+	CreatedAt time.Time    `gorm:"index"                                      json:"createdAt"`
+}
+
+func (t *UserToken) BeforeCreate(_ *gorm.DB) error {
+	newUUID(&t.ID)
+	return nil
+}
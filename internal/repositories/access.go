@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+)
+
+// Record-level access. Queries made for a request carry its actor in ctx
+// (see authz.WithActor) and only match clinical records the actor may see:
+// patients they own or are on the care team for, and everything hanging
+// off those patients. Anything else reads as ErrNotFound, so a record's
+// existence does not leak. Contexts without an actor, such as background
+// jobs, are not restricted.
+
+// visiblePatientIDs selects the IDs of patients visible to one user, who
+// is bound to both placeholders.
+const visiblePatientIDs = `SELECT p.id FROM patients p WHERE p.deleted_at IS NULL AND (p.user_id = ? OR EXISTS (
+	SELECT 1 FROM care_team_members m WHERE m.patient_id = p.id AND m.user_id = ?))`
+
+// visibleNoteIDs selects the IDs of notes on visiblePatientIDs.
+const visibleNoteIDs = `SELECT n.id FROM notes n WHERE n.patient_id IN (` + visiblePatientIDs + `)`
+
+// restrictedActor returns the user to scope by, or false if ctx is not
+// scoped or its actor may see every patient.
+func restrictedActor(ctx context.Context) (string, bool) {
+	a, ok := authz.ActorFrom(ctx)
+	if !ok || authz.Has(a.Role, authz.PatientReadAll) {
+		return "", false
+	}
+	return a.UserID, true
+}
+
+// scopeByColumn limits a query to rows whose column is in the subquery
+// sub, which binds the restricted user twice.
+func scopeByColumn(ctx context.Context, column, sub string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		userID, ok := restrictedActor(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(column+" IN ("+sub+")", userID, userID)
+	}
+}
+
+func patientAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "patients.id", visiblePatientIDs)
+}
+
+func noteAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "notes.patient_id", visiblePatientIDs)
+}
+
+func conversationAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "conversations.note_id", visibleNoteIDs)
+}
+
+func attachmentAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "attachments.note_id", visibleNoteIDs)
+}
+
+// memberAccess limits a query on users to members of the actor's
+// organisation, unless the actor administers the whole system.
+func memberAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		a, ok := authz.ActorFrom(ctx)
+		if !ok || authz.Has(a.Role, authz.SystemManage) {
+			return db
+		}
+		if a.OrgID == "" {
+			return db.Where("FALSE")
+		}
+		return db.Where("users.id IN (SELECT m.user_id FROM memberships m WHERE m.organization_id = ?)", a.OrgID)
+	}
+}
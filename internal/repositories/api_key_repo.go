@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *entities.APIKey) error
+	FindByID(ctx context.Context, id string) (*entities.APIKey, error)
+	FindByHash(ctx context.Context, hash string) (*entities.APIKey, error)
+	List(ctx context.Context) ([]entities.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+	// TouchLastUsed sets last_used_at to now unless it is already later than
+	// notBefore, so busy keys cost at most one write per interval.
+	TouchLastUsed(ctx context.Context, id string, now, notBefore time.Time) error
+}
+
+type apiKeyRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewAPIKeyRepository returns a GORM-backed APIKeyRepository.
+func NewAPIKeyRepository(db *gorm.DB, log *zap.Logger) APIKeyRepository {
+	return &apiKeyRepo{
+		db:  db,
+		log: log.Named("api-key-repository"),
+	}
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, key *entities.APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		r.log.Error("failed to create api key", zap.String("name", key.Name), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) FindByID(ctx context.Context, id string) (*entities.APIKey, error) {
+	return r.find(ctx, "id = ?", id)
+}
+
+func (r *apiKeyRepo) FindByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	return r.find(ctx, "key_hash = ?", hash)
+}
+
+func (r *apiKeyRepo) find(ctx context.Context, query string, arg string) (*entities.APIKey, error) {
+	var k entities.APIKey
+	err := r.db.WithContext(ctx).First(&k, query, arg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("find api key failed", zap.Error(err))
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *apiKeyRepo) List(ctx context.Context) ([]entities.APIKey, error) {
+	var keys []entities.APIKey
+	if err := r.db.WithContext(ctx).Order("created_at DESC").Find(&keys).Error; err != nil {
+		r.log.Error("List failed", zap.Error(err))
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).
+		Model(&entities.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC())
+	if res.Error != nil {
+		r.log.Error("Revoke failed", zap.String("id", id), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id string, now, notBefore time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&entities.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, notBefore).
+		Update("last_used_at", now).Error
+	if err != nil {
+		r.log.Error("TouchLastUsed failed", zap.String("id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -9,8 +9,19 @@ import (
 	"gorm.io/gorm"
 )
 
+// AttachmentRepository lookups by ID and note are scoped to the context's
+// actor, see access.go; the maintenance queries are not.
 type AttachmentRepository interface {
 	Create(ctx context.Context, attachment *entities.Attachment) error
+	FindByID(ctx context.Context, id string) (*entities.Attachment, error)
+	FindByNoteID(ctx context.Context, noteID string) ([]entities.Attachment, error)
+	FindByPreviewStatus(ctx context.Context, status entities.PreviewStatus, limit int) ([]entities.Attachment, error)
+	FindPreviewedByHash(ctx context.Context, hash string) (*entities.Attachment, error)
+	FindUnscopedByID(ctx context.Context, id string) (*entities.Attachment, error)
+	ListStorageKeys(ctx context.Context, includeDeleted bool) ([]string, error)
+	SumSizeByNoteID(ctx context.Context, noteID string) (int64, error)
+	Update(ctx context.Context, attachment *entities.Attachment) error
+	HardDelete(ctx context.Context, id string) error
 }
 
 type attachmentRepo struct {
@@ -36,14 +47,91 @@ func (r *attachmentRepo) Create(ctx context.Context, attachment *entities.Attach
 	return nil
 }
 
+// SumSizeByNoteID returns the total bytes of live attachments on a note.
+func (r *attachmentRepo) SumSizeByNoteID(ctx context.Context, noteID string) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).
+		Model(&entities.Attachment{}).
+		Where("note_id = ?", noteID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	if err != nil {
+		r.log.Error("SumSizeByNoteID failed", zap.String("noteID", noteID), zap.Error(err))
+		return 0, err
+	}
+	return total, nil
+}
+
 func (r *attachmentRepo) FindByID(ctx context.Context, id string) (*entities.Attachment, error) {
 	var a entities.Attachment
-	err := r.db.WithContext(ctx).First(&a, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Scopes(attachmentAccess(ctx)).First(&a, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *attachmentRepo) FindByNoteID(ctx context.Context, noteID string) ([]entities.Attachment, error) {
+	var attachments []entities.Attachment
+	err := r.db.WithContext(ctx).
+		Scopes(attachmentAccess(ctx)).
+		Where("note_id = ?", noteID).
+		Order("created_at ASC").
+		Find(&attachments).Error
+	if err != nil {
+		r.log.Error("FindByNoteID failed", zap.String("noteID", noteID), zap.Error(err))
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// FindByPreviewStatus returns the oldest attachments in the given preview
+// state, used to pick up work the in-memory queue lost on restart.
+func (r *attachmentRepo) FindByPreviewStatus(ctx context.Context, status entities.PreviewStatus, limit int) ([]entities.Attachment, error) {
+	var attachments []entities.Attachment
+	err := r.db.WithContext(ctx).
+		Where("preview_status = ?", status).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&attachments).Error
+	if err != nil {
+		r.log.Error("FindByPreviewStatus failed", zap.String("status", string(status)), zap.Error(err))
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// FindPreviewedByHash returns any attachment sharing the blob whose preview
+// is already generated, so duplicates can reuse it.
+func (r *attachmentRepo) FindPreviewedByHash(ctx context.Context, hash string) (*entities.Attachment, error) {
+	var a entities.Attachment
+	err := r.db.WithContext(ctx).
+		Where("sha256 = ? AND preview_status = ?", hash, entities.PreviewReady).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindPreviewedByHash failed", zap.String("hash", hash), zap.Error(err))
+		return nil, err
+	}
+	return &a, nil
+}
+
+// FindUnscopedByID also returns soft-deleted attachments.
+func (r *attachmentRepo) FindUnscopedByID(ctx context.Context, id string) (*entities.Attachment, error) {
+	var a entities.Attachment
+	err := r.db.WithContext(ctx).Unscoped().First(&a, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindUnscopedByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
 	}
 	return &a, nil
 }
@@ -53,13 +141,13 @@ func (r *attachmentRepo) List(ctx context.Context, offset, limit int) ([]entitie
 	var total int64
 
 	// count total
-	if err := r.db.WithContext(ctx).Model(&entities.Attachment{}).Count(&total).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entities.Attachment{}).Scopes(attachmentAccess(ctx)).Count(&total).Error; err != nil {
 		r.log.Error("List count failed", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// list
-	if err := r.db.WithContext(ctx).Offset(offset).Limit(limit).Find(&attachments).Error; err != nil {
+	if err := r.db.WithContext(ctx).Scopes(attachmentAccess(ctx)).Offset(offset).Limit(limit).Find(&attachments).Error; err != nil {
 		r.log.Error("List query failed", zap.Error(err))
 		return nil, 0, err
 	}
@@ -88,3 +176,46 @@ func (r *attachmentRepo) SoftDelete(ctx context.Context, id string) error {
 	r.log.Info("attachment soft-deleted", zap.String("attachmentID", id))
 	return nil
 }
+
+// ListStorageKeys returns every S3 key (originals and ready previews)
+// referenced by an attachment row, optionally including soft-deleted rows.
+func (r *attachmentRepo) ListStorageKeys(ctx context.Context, includeDeleted bool) ([]string, error) {
+	scoped := func() *gorm.DB {
+		q := r.db.WithContext(ctx).Model(&entities.Attachment{})
+		if includeDeleted {
+			q = q.Unscoped()
+		}
+		return q
+	}
+
+	var keys, previewKeys []string
+	if err := scoped().Distinct().Pluck("s3_key", &keys).Error; err != nil {
+		r.log.Error("ListStorageKeys failed", zap.Error(err))
+		return nil, err
+	}
+	err := scoped().
+		Where("preview_status = ? AND preview_key <> ''", entities.PreviewReady).
+		Distinct().
+		Pluck("preview_key", &previewKeys).Error
+	if err != nil {
+		r.log.Error("ListStorageKeys failed", zap.Error(err))
+		return nil, err
+	}
+
+	return append(keys, previewKeys...), nil
+}
+
+// HardDelete permanently removes the row, soft-deleted or not.
+func (r *attachmentRepo) HardDelete(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).Unscoped().Delete(&entities.Attachment{}, "id = ?", id)
+	if res.Error != nil {
+		r.log.Error("HardDelete failed", zap.String("attachmentID", id), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	r.log.Info("attachment purged", zap.String("attachmentID", id))
+	return nil
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AuditRepository appends audit events; there is deliberately no way to
+// change or remove one.
+type AuditRepository interface {
+	// Append seals the event onto the end of the chain and stores it.
+	Append(ctx context.Context, event *entities.AuditEvent) error
+	List(ctx context.Context, filter AuditFilter, offset, limit int) ([]entities.AuditEvent, int64, error)
+	// ListAfter returns up to limit matching events with a sequence number
+	// above afterSeq, in chain order.
+	ListAfter(ctx context.Context, filter AuditFilter, afterSeq int64, limit int) ([]entities.AuditEvent, error)
+	// PatientOf returns the patient a note or attachment belongs to, even if
+	// it is deleted or not visible to the actor.
+	PatientOf(ctx context.Context, resourceType, id string) (string, error)
+}
+
+// AuditFilter narrows audit queries; zero fields match everything.
+type AuditFilter struct {
+	ActorID      string
+	PatientID    string // also matches lists naming the patient in a "patientIds" detail
+	ResourceType string
+	ResourceID   string
+	Action       string
+	Outcome      string
+	From         time.Time // inclusive
+	To           time.Time // exclusive
+	FromSeq      int64     // inclusive
+	ToSeq        int64     // inclusive
+}
+
+type auditRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewAuditRepository returns a GORM-backed AuditRepository.
+func NewAuditRepository(db *gorm.DB, log *zap.Logger) AuditRepository {
+	return &auditRepo{
+		db:  db,
+		log: log.Named("audit-repository"),
+	}
+}
+
+func (r *auditRepo) Append(ctx context.Context, event *entities.AuditEvent) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", entities.AuditChainLock).Error; err != nil {
+			return err
+		}
+		var last entities.AuditEvent
+		err := tx.Where("seq IS NOT NULL").Order("seq DESC").Take(&last).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			event.Seal(nil)
+		case err != nil:
+			return err
+		default:
+			event.Seal(&last)
+		}
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		r.log.Error("failed to append audit event", zap.String("action", event.Action), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *auditRepo) List(ctx context.Context, filter AuditFilter, offset, limit int) ([]entities.AuditEvent, int64, error) {
+	var events []entities.AuditEvent
+	var total int64
+
+	if err := r.db.WithContext(ctx).Model(&entities.AuditEvent{}).Scopes(filter.scope).Count(&total).Error; err != nil {
+		r.log.Error("List count failed", zap.Error(err))
+		return nil, 0, err
+	}
+	err := r.db.WithContext(ctx).Scopes(filter.scope).Order("seq DESC").Offset(offset).Limit(limit).Find(&events).Error
+	if err != nil {
+		r.log.Error("List query failed", zap.Error(err))
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (r *auditRepo) ListAfter(ctx context.Context, filter AuditFilter, afterSeq int64, limit int) ([]entities.AuditEvent, error) {
+	var events []entities.AuditEvent
+	err := r.db.WithContext(ctx).Scopes(filter.scope).
+		Where("seq > ?", afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		r.log.Error("ListAfter failed", zap.Int64("afterSeq", afterSeq), zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *auditRepo) PatientOf(ctx context.Context, resourceType, id string) (string, error) {
+	var query string
+	switch resourceType {
+	case "note":
+		query = "SELECT patient_id FROM notes WHERE id = ?"
+	case "attachment":
+		query = "SELECT n.patient_id FROM attachments a JOIN notes n ON n.id = a.note_id WHERE a.id = ?"
+	default:
+		return "", ErrNotFound
+	}
+
+	var patientIDs []string
+	if err := r.db.WithContext(ctx).Raw(query, id).Scan(&patientIDs).Error; err != nil {
+		r.log.Error("PatientOf failed", zap.String("resourceType", resourceType), zap.String("id", id), zap.Error(err))
+		return "", err
+	}
+	if len(patientIDs) == 0 {
+		return "", ErrNotFound
+	}
+	return patientIDs[0], nil
+}
+
+func (f AuditFilter) scope(db *gorm.DB) *gorm.DB {
+	for col, v := range map[string]string{
+		"actor_id":      f.ActorID,
+		"resource_type": f.ResourceType,
+		"resource_id":   f.ResourceID,
+		"action":        f.Action,
+		"outcome":       f.Outcome,
+	} {
+		if v != "" {
+			db = db.Where(col+" = ?", v)
+		}
+	}
+	if f.PatientID != "" {
+		db = db.Where("(patient_id = ? OR details->'patientIds' @> jsonb_build_array(?::text))", f.PatientID, f.PatientID)
+	}
+	if !f.From.IsZero() {
+		db = db.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		db = db.Where("created_at < ?", f.To)
+	}
+	if f.FromSeq > 0 {
+		db = db.Where("seq >= ?", f.FromSeq)
+	}
+	if f.ToSeq > 0 {
+		db = db.Where("seq <= ?", f.ToSeq)
+	}
+	return db
+}
@@ -0,0 +1,89 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/database/databasetest"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+func TestPatientFilterMatchesListViews(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	repo := repositories.NewAuditRepository(db, zap.NewNop())
+
+	shown, other := uuid.NewString(), uuid.NewString()
+	read := &entities.AuditEvent{Action: "patient.read", ResourceType: "patient", ResourceID: shown, PatientID: &shown}
+	list := &entities.AuditEvent{Action: "patient.list", ResourceType: "patient", Details: map[string]any{"patientIds": []string{shown, other}}}
+	for _, e := range []*entities.AuditEvent{read, list} {
+		if err := repo.Append(ctx, e); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	for patientID, want := range map[string][]string{
+		shown:            {list.ID, read.ID},
+		other:            {list.ID},
+		uuid.NewString(): nil,
+	} {
+		events, total, err := repo.List(ctx, repositories.AuditFilter{PatientID: patientID}, 0, 10)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var got []string
+		for _, e := range events {
+			got = append(got, e.ID)
+		}
+		if int(total) != len(want) || len(got) != len(want) {
+			t.Errorf("patient %s: events %v (total %d), want %v", patientID, got, total, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("patient %s: events %v, want %v", patientID, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestStoredEventsKeepTheirHash(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	repo := repositories.NewAuditRepository(db, zap.NewNop())
+
+	// jsonb reorders keys and rewrites numbers, e.g. 1e21 as 21 digits.
+	event := &entities.AuditEvent{
+		Action:       entities.AuditRetentionPurged,
+		ResourceType: "retention",
+		ResourceID:   uuid.NewString(),
+		Details: map[string]any{
+			"purged":  int64(1<<53 + 1),
+			"ratio":   0.1,
+			"big":     1e21,
+			"tables":  []string{"patients", "notes"},
+			"counts":  map[string]int{"notes": 2, "attachments": 0},
+			"dryRun":  false,
+			"skipped": nil,
+		},
+	}
+	if err := repo.Append(ctx, event); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	var stored entities.AuditEvent
+	if err := db.First(&stored, "id = ?", event.ID).Error; err != nil {
+		t.Fatalf("reading event back: %v", err)
+	}
+	if stored.Hash != event.Hash {
+		t.Fatalf("stored hash %s, sealed %s", stored.Hash, event.Hash)
+	}
+	if got := stored.ComputeHash(); got != stored.Hash {
+		t.Errorf("hash recomputed from the row = %s, want %s; details %v", got, stored.Hash, stored.Details)
+	}
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlobRepository interface {
+	// Acquire adds a reference to the blob, inserting it as pending if
+	// needed, and returns the new reference count. blob.Status is set to the
+	// stored status: unless it is uploaded, the caller must upload the object
+	// and call MarkUploaded, or Release its reference if that fails.
+	Acquire(ctx context.Context, blob *entities.Blob) (int64, error)
+	// MarkUploaded records that the blob's object is in S3.
+	MarkUploaded(ctx context.Context, hash string) error
+	// Release drops a reference. When it was the last one, onLast runs while
+	// the blob row is still locked and the row is deleted only if onLast
+	// succeeds, so a concurrent Acquire can never see a half-deleted blob.
+	Release(ctx context.Context, hash string, onLast func(blob *entities.Blob) error) (int64, error)
+	FindByHash(ctx context.Context, hash string) (*entities.Blob, error)
+	ListS3Keys(ctx context.Context) ([]string, error)
+}
+
+type blobRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewBlobRepository returns a GORM-backed BlobRepository.
+func NewBlobRepository(db *gorm.DB, log *zap.Logger) BlobRepository {
+	return &blobRepo{
+		db:  db,
+		log: log.Named("blob-repository"),
+	}
+}
+
+func (r *blobRepo) Acquire(ctx context.Context, blob *entities.Blob) (int64, error) {
+	var row struct {
+		RefCount int64
+		Status   entities.BlobStatus
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO blobs (hash, s3_key, type, size, ref_count, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?, NOW(), NOW())
+		ON CONFLICT (hash) DO UPDATE
+		SET ref_count = blobs.ref_count + 1, updated_at = NOW()
+		RETURNING ref_count, status`,
+		blob.Hash, blob.S3Key, blob.Type, blob.Size, entities.BlobPending,
+	).Scan(&row).Error
+	if err != nil {
+		r.log.Error("Acquire failed", zap.String("hash", blob.Hash), zap.Error(err))
+		return 0, err
+	}
+
+	blob.RefCount = row.RefCount
+	blob.Status = row.Status
+	return row.RefCount, nil
+}
+
+func (r *blobRepo) MarkUploaded(ctx context.Context, hash string) error {
+	err := r.db.WithContext(ctx).Model(&entities.Blob{}).
+		Where("hash = ?", hash).
+		Update("status", entities.BlobUploaded).Error
+	if err != nil {
+		r.log.Error("MarkUploaded failed", zap.String("hash", hash), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *blobRepo) Release(ctx context.Context, hash string, onLast func(blob *entities.Blob) error) (int64, error) {
+	var remaining int64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var b entities.Blob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, "hash = ?", hash).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		remaining = b.RefCount - 1
+		if remaining > 0 {
+			return tx.Model(&b).Update("ref_count", remaining).Error
+		}
+
+		remaining = 0
+		if err := onLast(&b); err != nil {
+			return err
+		}
+		return tx.Delete(&b).Error
+	})
+	if err != nil {
+		r.log.Error("Release failed", zap.String("hash", hash), zap.Error(err))
+		return 0, err
+	}
+
+	return remaining, nil
+}
+
+func (r *blobRepo) FindByHash(ctx context.Context, hash string) (*entities.Blob, error) {
+	var b entities.Blob
+	err := r.db.WithContext(ctx).First(&b, "hash = ?", hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindByHash failed", zap.String("hash", hash), zap.Error(err))
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *blobRepo) ListS3Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	if err := r.db.WithContext(ctx).Model(&entities.Blob{}).Pluck("s3_key", &keys).Error; err != nil {
+		r.log.Error("ListS3Keys failed", zap.Error(err))
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CareTeamRepository interface {
+	// Add is a no-op if the user is already on the patient's care team.
+	Add(ctx context.Context, member *entities.CareTeamMember) error
+	Remove(ctx context.Context, patientID, userID string) error
+	ListByPatientID(ctx context.Context, patientID string) ([]entities.CareTeamMember, error)
+}
+
+type careTeamRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewCareTeamRepository returns a GORM-backed CareTeamRepository.
+func NewCareTeamRepository(db *gorm.DB, log *zap.Logger) CareTeamRepository {
+	return &careTeamRepo{
+		db:  db,
+		log: log.Named("care-team-repository"),
+	}
+}
+
+func (r *careTeamRepo) Add(ctx context.Context, member *entities.CareTeamMember) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(member).Error
+	if err != nil {
+		r.log.Error("Add failed", zap.String("patientID", member.PatientID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *careTeamRepo) Remove(ctx context.Context, patientID, userID string) error {
+	res := r.db.WithContext(ctx).Delete(&entities.CareTeamMember{}, "patient_id = ? AND user_id = ?", patientID, userID)
+	if res.Error != nil {
+		r.log.Error("Remove failed", zap.String("patientID", patientID), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *careTeamRepo) ListByPatientID(ctx context.Context, patientID string) ([]entities.CareTeamMember, error) {
+	var members []entities.CareTeamMember
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("patient_id = ?", patientID).
+		Order("created_at ASC").
+		Find(&members).Error
+	if err != nil {
+		r.log.Error("ListByPatientID failed", zap.String("patientID", patientID), zap.Error(err))
+		return nil, err
+	}
+	return members, nil
+}
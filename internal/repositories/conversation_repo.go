@@ -9,6 +9,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// ConversationRepository reads are scoped to the context's actor through
+// the conversation's note, see access.go.
 type ConversationRepository interface {
 	Create(ctx context.Context, conversation *entities.Conversation) error
 	FindByNoteID(ctx context.Context, noteID string, offset *int, limit *int) (*entities.Conversation, error)
@@ -34,6 +36,7 @@ func NewConversationRepository(db *gorm.DB, log *zap.Logger) ConversationReposit
 func (r *conversationRepo) Create(ctx context.Context, conversation *entities.Conversation) error {
 	if err := r.db.WithContext(ctx).Create(conversation).Error; err != nil {
 		r.log.Error("failed to create conversation", zap.String("conversationID", conversation.ID), zap.Error(err))
+		return err
 	}
 	r.log.Info("conversation created", zap.String("conversationID", conversation.ID))
 	return nil
@@ -41,12 +44,13 @@ func (r *conversationRepo) Create(ctx context.Context, conversation *entities.Co
 
 func (r *conversationRepo) FindByID(ctx context.Context, id string) (*entities.Conversation, error) {
 	var c entities.Conversation
-	err := r.db.WithContext(ctx).First(&c, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Scopes(conversationAccess(ctx)).First(&c, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
 	}
 	return &c, nil
 }
@@ -83,6 +87,7 @@ func (r *conversationRepo) FindByNoteID(
 				Where("notes.deleted_at IS NULL").
 				Order("notes.created_at ASC")
 		}).
+		Scopes(conversationAccess(ctx)).
 		First(&c, "note_id = ?", noteID).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -105,13 +110,13 @@ func (r *conversationRepo) List(ctx context.Context, offset, limit int) ([]entit
 	var total int64
 
 	// count total
-	if err := r.db.WithContext(ctx).Model(&entities.Conversation{}).Count(&total).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entities.Conversation{}).Scopes(conversationAccess(ctx)).Count(&total).Error; err != nil {
 		r.log.Error("List count failed", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// list
-	if err := r.db.WithContext(ctx).Offset(offset).Limit(limit).Find(&conversations).Error; err != nil {
+	if err := r.db.WithContext(ctx).Scopes(conversationAccess(ctx)).Offset(offset).Limit(limit).Find(&conversations).Error; err != nil {
 		r.log.Error("List query failed", zap.Error(err))
 		return nil, 0, err
 	}
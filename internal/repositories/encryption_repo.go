@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FieldEncryptionRepository rewrites encrypted columns (see
+// database.fieldEncryption) that are not yet under the active key: rows
+// written before encryption was enabled, or before a key rotation, and rows
+// whose blind index has not been computed.
+type FieldEncryptionRepository interface {
+	// Reencrypt rewrites up to limit stale rows of model's table, including
+	// soft-deleted ones, and returns how many it rewrote. Rows are read
+	// through the Cipher and written back without touching updated_at, but
+	// only if their stored values are still the ones read: a row changed
+	// in the meantime is skipped rather than overwritten, and picked up by
+	// a later run if it is still stale.
+	Reencrypt(ctx context.Context, model any, limit int) (int, error)
+}
+
+type fieldEncryptionRepo struct {
+	db     *gorm.DB
+	fields *fieldcrypt.Cipher
+	log    *zap.Logger
+}
+
+// NewFieldEncryptionRepository returns a GORM-backed FieldEncryptionRepository.
+// fields must be the Cipher the database was connected with.
+func NewFieldEncryptionRepository(db *gorm.DB, fields *fieldcrypt.Cipher, log *zap.Logger) FieldEncryptionRepository {
+	return &fieldEncryptionRepo{
+		db:     db,
+		fields: fields,
+		log:    log.Named("field-encryption-repository"),
+	}
+}
+
+func (r *fieldEncryptionRepo) Reencrypt(ctx context.Context, model any, limit int) (int, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	table := stmt.Schema.Table
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("%s: no primary key", table)
+	}
+
+	var (
+		columns []string // written back
+		guards  []string // compared with what was read before writing
+		stale   []string
+		args    []any
+	)
+	guard := func(column string) {
+		if !slices.Contains(guards, column) {
+			guards = append(guards, column)
+		}
+	}
+	activePrefix := escapeLike(r.fields.ActivePrefix()) + "%"
+	for _, field := range stmt.Schema.Fields {
+		if field.TagSettings["SERIALIZER"] == "encrypted" {
+			columns = append(columns, field.DBName)
+			guard(field.DBName)
+			if r.fields.Enabled() {
+				stale = append(stale, fmt.Sprintf("(%s <> '' AND %s NOT LIKE ?)", field.DBName, field.DBName))
+				args = append(args, activePrefix)
+			}
+		}
+		if name := field.TagSettings["BLINDINDEX"]; name != "" {
+			src := stmt.Schema.LookUpField(name)
+			if src == nil {
+				return 0, fmt.Errorf("%s: blind index %s: no field %q", table, field.Name, name)
+			}
+			columns = append(columns, field.DBName)
+			guard(field.DBName)
+			guard(src.DBName)
+			stale = append(stale, fmt.Sprintf("(%s IS NULL AND %s <> '')", field.DBName, src.DBName))
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	// The stored values come first, as read without the Cipher; each row is
+	// then loaded through it. Should a row change in between, the values
+	// loaded are newer than the stored ones and the guarded update skips it.
+	var stored []map[string]any
+	err := r.db.WithContext(ctx).Table(table).
+		Select(append([]string{pk.DBName}, guards...)).
+		Where(strings.Join(stale, " OR "), args...).
+		Order(pk.DBName).
+		Limit(limit).
+		Find(&stored).Error
+	if err != nil {
+		r.log.Error("Reencrypt query failed", zap.String("table", table), zap.Error(err))
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, old := range stored {
+		row := reflect.New(stmt.Schema.ModelType).Interface()
+		err := r.db.WithContext(ctx).Unscoped().First(row, pk.DBName+" = ?", old[pk.DBName]).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // purged since
+		}
+		if err != nil {
+			r.log.Error("Reencrypt load failed", zap.String("table", table), zap.Error(err))
+			return rewritten, err
+		}
+
+		// UpdateColumns skips hooks and updated_at; the field encryption
+		// callback still recomputes the blind indexes.
+		q := r.db.WithContext(ctx).Unscoped().Model(row)
+		for _, column := range guards {
+			q = q.Where(column+" IS NOT DISTINCT FROM ?", old[column])
+		}
+		res := q.Select(columns).UpdateColumns(row)
+		if res.Error != nil {
+			r.log.Error("Reencrypt update failed", zap.String("table", table), zap.Error(res.Error))
+			return rewritten, res.Error
+		}
+		if res.RowsAffected == 0 {
+			r.log.Info("Reencrypt skipped a row changed meanwhile", zap.String("table", table), zap.Any("id", old[pk.DBName]))
+			continue
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// escapeLike quotes LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,78 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/jamesphm04/splose-clone-be/internal/database/databasetest"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+// staleEmail returns the patient's email and whether its blind index is
+// still missing.
+func staleEmail(t *testing.T, db *gorm.DB, patientID string) (email string, stale bool) {
+	t.Helper()
+	var row struct {
+		Email      string
+		EmailIndex *string
+	}
+	if err := db.Table("patients").Select("email, email_index").Where("id = ?", patientID).Take(&row).Error; err != nil {
+		t.Fatalf("reading patient: %v", err)
+	}
+	return row.Email, row.EmailIndex == nil
+}
+
+func TestReencryptSkipsRowChangedMeanwhile(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	_, racedID, _ := seedPatient(t, db)
+	_, quietID, _ := seedPatient(t, db)
+	// As if written before the column had a blind index.
+	if err := db.Exec("UPDATE patients SET email_index = NULL WHERE id IN ?", []string{racedID, quietID}).Error; err != nil {
+		t.Fatalf("clearing blind indexes: %v", err)
+	}
+
+	// Someone edits the raced patient's email right after Reencrypt loaded it.
+	const edited = "edited@example.com"
+	raced := false
+	err := db.Callback().Query().After("gorm:query").Register("test:edit_after_load", func(tx *gorm.DB) {
+		if p, ok := tx.Statement.Dest.(*entities.Patient); ok && p.ID == racedID && !raced {
+			raced = true
+			if err := tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE patients SET email = ? WHERE id = ?", edited, racedID).Error; err != nil {
+				t.Errorf("editing patient: %v", err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repositories.NewFieldEncryptionRepository(db, databasetest.Fields(), zap.NewNop())
+	// Rows are never cleaned up, so other tests may have left stale ones.
+	if _, err := repo.Reencrypt(ctx, &entities.Patient{}, 10000); err != nil {
+		t.Fatalf("Reencrypt: %v", err)
+	}
+	if !raced {
+		t.Fatal("Reencrypt did not load the raced patient")
+	}
+	if email, stale := staleEmail(t, db, racedID); email != edited || !stale {
+		t.Errorf("raced patient: email %q, index missing %v; want the edit kept and the row left for later", email, stale)
+	}
+	if _, stale := staleEmail(t, db, quietID); stale {
+		t.Error("untouched patient was not re-indexed")
+	}
+
+	// The next run picks the raced row up, indexing the edited email.
+	if _, err := repo.Reencrypt(ctx, &entities.Patient{}, 10000); err != nil {
+		t.Fatalf("Reencrypt: %v", err)
+	}
+	var index string
+	db.Table("patients").Where("id = ?", racedID).Pluck("email_index", &index)
+	if want := databasetest.Fields().BlindIndex("patients.email", edited); index != want {
+		t.Errorf("raced patient indexed as %q, want the index of the edited email %q", index, want)
+	}
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *entities.UserIdentity) error
+	FindBySubject(ctx context.Context, issuer, subject string) (*entities.UserIdentity, error)
+	// SaveState stores an SSO login state until the callback consumes it.
+	SaveState(ctx context.Context, state *entities.OIDCLoginState) error
+	// ConsumeState deletes and returns the unexpired state with this hash,
+	// or ErrNotFound, so each state can be redeemed once.
+	ConsumeState(ctx context.Context, stateHash string) (*entities.OIDCLoginState, error)
+	DeleteExpiredStates(ctx context.Context) (int64, error)
+}
+
+type identityRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewIdentityRepository returns a GORM-backed IdentityRepository.
+func NewIdentityRepository(db *gorm.DB, log *zap.Logger) IdentityRepository {
+	return &identityRepo{
+		db:  db,
+		log: log.Named("identity-repository"),
+	}
+}
+
+func (r *identityRepo) Create(ctx context.Context, identity *entities.UserIdentity) error {
+	if err := r.db.WithContext(ctx).Create(identity).Error; err != nil {
+		r.log.Error("failed to create identity", zap.String("userID", identity.UserID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *identityRepo) FindBySubject(ctx context.Context, issuer, subject string) (*entities.UserIdentity, error) {
+	var i entities.UserIdentity
+	err := r.db.WithContext(ctx).First(&i, "issuer = ? AND subject = ?", issuer, subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindBySubject failed", zap.String("issuer", issuer), zap.Error(err))
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (r *identityRepo) SaveState(ctx context.Context, state *entities.OIDCLoginState) error {
+	if err := r.db.WithContext(ctx).Create(state).Error; err != nil {
+		r.log.Error("failed to save oidc state", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *identityRepo) ConsumeState(ctx context.Context, stateHash string) (*entities.OIDCLoginState, error) {
+	var states []entities.OIDCLoginState
+	res := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("state_hash = ? AND expires_at > ?", stateHash, time.Now().UTC()).
+		Delete(&states)
+	if res.Error != nil {
+		r.log.Error("ConsumeState failed", zap.Error(res.Error))
+		return nil, res.Error
+	}
+	if len(states) == 0 {
+		return nil, ErrNotFound
+	}
+	return &states[0], nil
+}
+
+func (r *identityRepo) DeleteExpiredStates(ctx context.Context) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now().UTC()).
+		Delete(&entities.OIDCLoginState{})
+	if res.Error != nil {
+		r.log.Error("DeleteExpiredStates failed", zap.Error(res.Error))
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
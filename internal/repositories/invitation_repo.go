@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// InvitationRepository is scoped to the context actor's organisation by
+// tenancy; FindByTokenID is called before sign-in, where it is not.
+type InvitationRepository interface {
+	Create(ctx context.Context, inv *entities.Invitation) error
+	FindByID(ctx context.Context, id string) (*entities.Invitation, error)
+	FindByTokenID(ctx context.Context, tokenID string) (*entities.Invitation, error)
+	// FindPending returns the organisation's open invitation for email.
+	FindPending(ctx context.Context, orgID, email string) (*entities.Invitation, error)
+	List(ctx context.Context, offset, limit int) ([]entities.Invitation, int64, error)
+	Update(ctx context.Context, inv *entities.Invitation) error
+	// Accept marks the invitation accepted by userID. It returns false if
+	// it was accepted or revoked meanwhile.
+	Accept(ctx context.Context, id, userID string, at time.Time) (bool, error)
+}
+
+type invitationRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewInvitationRepository returns a GORM-backed InvitationRepository.
+func NewInvitationRepository(db *gorm.DB, log *zap.Logger) InvitationRepository {
+	return &invitationRepo{
+		db:  db,
+		log: log.Named("invitation-repository"),
+	}
+}
+
+func (r *invitationRepo) Create(ctx context.Context, inv *entities.Invitation) error {
+	if err := r.db.WithContext(ctx).Create(inv).Error; err != nil {
+		r.log.Error("failed to create invitation", zap.String("organizationID", inv.OrganizationID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *invitationRepo) FindByID(ctx context.Context, id string) (*entities.Invitation, error) {
+	return r.first(ctx, "id = ?", id)
+}
+
+func (r *invitationRepo) FindByTokenID(ctx context.Context, tokenID string) (*entities.Invitation, error) {
+	return r.first(ctx, "token_id = ?", tokenID)
+}
+
+func (r *invitationRepo) FindPending(ctx context.Context, orgID, email string) (*entities.Invitation, error) {
+	return r.first(ctx,
+		"organization_id = ? AND LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+		orgID, email, time.Now().UTC())
+}
+
+func (r *invitationRepo) first(ctx context.Context, query string, args ...any) (*entities.Invitation, error) {
+	var inv entities.Invitation
+	err := r.db.WithContext(ctx).Where(query, args...).First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("finding invitation failed", zap.Error(err))
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *invitationRepo) List(ctx context.Context, offset, limit int) ([]entities.Invitation, int64, error) {
+	var invs []entities.Invitation
+	var total int64
+
+	if err := r.db.WithContext(ctx).Model(&entities.Invitation{}).Count(&total).Error; err != nil {
+		r.log.Error("List count failed", zap.Error(err))
+		return nil, 0, err
+	}
+	if err := r.db.WithContext(ctx).Order("created_at DESC").Offset(offset).Limit(limit).Find(&invs).Error; err != nil {
+		r.log.Error("List query failed", zap.Error(err))
+		return nil, 0, err
+	}
+	return invs, total, nil
+}
+
+func (r *invitationRepo) Update(ctx context.Context, inv *entities.Invitation) error {
+	if err := r.db.WithContext(ctx).Save(inv).Error; err != nil {
+		r.log.Error("Update failed", zap.String("invitationID", inv.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *invitationRepo) Accept(ctx context.Context, id, userID string, at time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&entities.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]any{"accepted_at": at, "accepted_by": userID})
+	if res.Error != nil {
+		r.log.Error("Accept failed", zap.String("invitationID", id), zap.Error(res.Error))
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
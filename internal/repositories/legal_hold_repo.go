@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// LegalHoldRepository reads are scoped to the context's actor like the
+// patients they belong to, see access.go.
+type LegalHoldRepository interface {
+	// Create locks the patient while adding the hold, so it waits for a
+	// purge of the patient to finish, see RetentionRepository.HardDelete.
+	// It returns ErrNotFound if the patient has been purged.
+	Create(ctx context.Context, hold *entities.LegalHold) error
+	FindByID(ctx context.Context, id string) (*entities.LegalHold, error)
+	// FindByPatientID returns the patient's holds, active and released,
+	// newest first.
+	FindByPatientID(ctx context.Context, patientID string) ([]entities.LegalHold, error)
+	Update(ctx context.Context, hold *entities.LegalHold) error
+}
+
+type legalHoldRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewLegalHoldRepository returns a GORM-backed LegalHoldRepository.
+func NewLegalHoldRepository(db *gorm.DB, log *zap.Logger) LegalHoldRepository {
+	return &legalHoldRepo{
+		db:  db,
+		log: log.Named("legal-hold-repository"),
+	}
+}
+
+func holdAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "legal_holds.patient_id", visiblePatientIDs)
+}
+
+func (r *legalHoldRepo) Create(ctx context.Context, hold *entities.LegalHold) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Raw("SELECT id FROM patients WHERE id = ? FOR SHARE", hold.PatientID).Scan(&ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+		return tx.Create(hold).Error
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		r.log.Error("failed to create legal hold", zap.String("patientID", hold.PatientID), zap.Error(err))
+	}
+	return err
+}
+
+func (r *legalHoldRepo) FindByID(ctx context.Context, id string) (*entities.LegalHold, error) {
+	var h entities.LegalHold
+	err := r.db.WithContext(ctx).Scopes(holdAccess(ctx)).First(&h, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindByID failed", zap.String("holdID", id), zap.Error(err))
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (r *legalHoldRepo) FindByPatientID(ctx context.Context, patientID string) ([]entities.LegalHold, error) {
+	var holds []entities.LegalHold
+	err := r.db.WithContext(ctx).Scopes(holdAccess(ctx)).
+		Where("patient_id = ?", patientID).
+		Order("created_at DESC").
+		Find(&holds).Error
+	if err != nil {
+		r.log.Error("FindByPatientID failed", zap.String("patientID", patientID), zap.Error(err))
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (r *legalHoldRepo) Update(ctx context.Context, hold *entities.LegalHold) error {
+	if err := r.db.WithContext(ctx).Save(hold).Error; err != nil {
+		r.log.Error("Update failed", zap.String("holdID", hold.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
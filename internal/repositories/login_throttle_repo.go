@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type LoginThrottleRepository interface {
+	// Find returns the throttle for key, or ErrNotFound if it has none.
+	Find(ctx context.Context, key string) (*entities.LoginThrottle, error)
+	// RecordFailure adds a failure to key and returns the new count.
+	// Failures before windowStart are forgotten first.
+	RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Clear(ctx context.Context, key string) error
+	// DeleteStale removes throttles with no failure since before and no
+	// lock still in force at now.
+	DeleteStale(ctx context.Context, before, now time.Time) (int64, error)
+}
+
+type loginThrottleRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewLoginThrottleRepository returns a GORM-backed LoginThrottleRepository.
+func NewLoginThrottleRepository(db *gorm.DB, log *zap.Logger) LoginThrottleRepository {
+	return &loginThrottleRepo{
+		db:  db,
+		log: log.Named("login-throttle-repository"),
+	}
+}
+
+func (r *loginThrottleRepo) Find(ctx context.Context, key string) (*entities.LoginThrottle, error) {
+	var t entities.LoginThrottle
+	err := r.db.WithContext(ctx).First(&t, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("Find failed", zap.Error(err))
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *loginThrottleRepo) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	var failures int
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`, key, now, windowStart).Scan(&failures).Error
+	if err != nil {
+		r.log.Error("RecordFailure failed", zap.Error(err))
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (r *loginThrottleRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&entities.LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+	if err != nil {
+		r.log.Error("Lock failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *loginThrottleRepo) Clear(ctx context.Context, key string) error {
+	if err := r.db.WithContext(ctx).Delete(&entities.LoginThrottle{}, "key = ?", key).Error; err != nil {
+		r.log.Error("Clear failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *loginThrottleRepo) DeleteStale(ctx context.Context, before, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, now).
+		Delete(&entities.LoginThrottle{})
+	if res.Error != nil {
+		r.log.Error("DeleteStale failed", zap.Error(res.Error))
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
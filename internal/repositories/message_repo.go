@@ -9,6 +9,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// MessageRepository lookups by conversation or note are scoped to the
+// context's actor, see access.go.
 type MessageRepository interface {
 	Create(ctx context.Context, message *entities.Message) error
 	FindByID(ctx context.Context, id string) (*entities.Message, error)
@@ -101,8 +103,10 @@ func (r *messageRepo) FindByConversationID(ctx context.Context, conversationID s
 	err := r.db.
 		WithContext(ctx).
 		Preload("Attachments").
-		Where("conversation_id = ?", conversationID).
-		Order("created_at ASC").
+		Joins("JOIN conversations ON messages.conversation_id = conversations.id").
+		Scopes(conversationAccess(ctx)).
+		Where("messages.conversation_id = ?", conversationID).
+		Order("messages.created_at ASC").
 		Find(&msgs).Error
 	if err != nil {
 		r.log.Error("FindByConversationID failed", zap.String("conversationID", conversationID), zap.Error(err))
@@ -119,6 +123,7 @@ func (r *messageRepo) FindByNoteID(ctx context.Context, noteID string) ([]entiti
 		WithContext(ctx).
 		Table("messages").
 		Joins("JOIN conversations ON messages.conversation_id = conversations.id").
+		Scopes(conversationAccess(ctx)).
 		Where("conversations.note_id = ?", noteID).
 		Order("messages.created_at ASC").
 		Preload("Attachments").
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFAPolicyRepository interface {
+	List(ctx context.Context) ([]entities.MFAPolicy, error)
+	// IsRequired reports whether the role must use MFA; roles without a
+	// policy row do not.
+	IsRequired(ctx context.Context, role string) (bool, error)
+	// IsRequiredForUser reports whether the role the user holds in any of
+	// their organisations must use MFA.
+	IsRequiredForUser(ctx context.Context, userID string) (bool, error)
+	Upsert(ctx context.Context, policy *entities.MFAPolicy) error
+}
+
+type mfaPolicyRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewMFAPolicyRepository returns a GORM-backed MFAPolicyRepository.
+func NewMFAPolicyRepository(db *gorm.DB, log *zap.Logger) MFAPolicyRepository {
+	return &mfaPolicyRepo{
+		db:  db,
+		log: log.Named("mfa-policy-repository"),
+	}
+}
+
+func (r *mfaPolicyRepo) List(ctx context.Context) ([]entities.MFAPolicy, error) {
+	var policies []entities.MFAPolicy
+	if err := r.db.WithContext(ctx).Order("role").Find(&policies).Error; err != nil {
+		r.log.Error("List failed", zap.Error(err))
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (r *mfaPolicyRepo) IsRequired(ctx context.Context, role string) (bool, error) {
+	var p entities.MFAPolicy
+	err := r.db.WithContext(ctx).First(&p, "role = ?", role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		r.log.Error("IsRequired failed", zap.String("role", role), zap.Error(err))
+		return false, err
+	}
+	return p.Required, nil
+}
+
+func (r *mfaPolicyRepo) IsRequiredForUser(ctx context.Context, userID string) (bool, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&entities.MFAPolicy{}).
+		Joins("JOIN memberships ON memberships.role = mfa_policies.role").
+		Where("memberships.user_id = ? AND mfa_policies.required", userID).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("IsRequiredForUser failed", zap.String("userID", userID), zap.Error(err))
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *mfaPolicyRepo) Upsert(ctx context.Context, policy *entities.MFAPolicy) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required", "updated_at"}),
+	}).Create(policy).Error
+	if err != nil {
+		r.log.Error("Upsert failed", zap.String("role", policy.Role), zap.Error(err))
+		return err
+	}
+	return nil
+}
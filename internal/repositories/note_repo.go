@@ -9,6 +9,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// NoteRepository is scoped to the context's actor through the note's
+// patient, see access.go.
 type NoteRepository interface {
 	Create(ctx context.Context, note *entities.Note) error
 	FindByID(ctx context.Context, id string) (*entities.Note, error)
@@ -32,8 +34,20 @@ func NewNoteRepository(db *gorm.DB, log *zap.Logger) NoteRepository {
 }
 
 func (r *noteRepo) Create(ctx context.Context, note *entities.Note) error {
+	var visible int64
+	err := r.db.WithContext(ctx).Model(&entities.Patient{}).Scopes(patientAccess(ctx)).
+		Where("id = ?", note.PatientID).Count(&visible).Error
+	if err != nil {
+		r.log.Error("checking note patient failed", zap.String("patientID", note.PatientID), zap.Error(err))
+		return err
+	}
+	if visible == 0 {
+		return ErrNotFound
+	}
+
 	if err := r.db.WithContext(ctx).Create(note).Error; err != nil {
 		r.log.Error("failed to create note", zap.String("noteID", note.ID), zap.Error(err))
+		return err
 	}
 
 	// Reload with relations
@@ -56,12 +70,14 @@ func (r *noteRepo) FindByID(ctx context.Context, id string) (*entities.Note, err
 		WithContext(ctx).
 		Preload("User").
 		Preload("Patient").
+		Scopes(noteAccess(ctx)).
 		First(&n, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
 	}
 
 	return &n, nil
@@ -73,6 +89,7 @@ func (r *noteRepo) FindByPatientID(ctx context.Context, patientID string) ([]ent
 	err := r.db.
 		WithContext(ctx).
 		Preload("User").
+		Scopes(noteAccess(ctx)).
 		Where("patient_id = ?", patientID).
 		Order("updated_at DESC").
 		Find(&notes).Error
@@ -81,6 +98,7 @@ func (r *noteRepo) FindByPatientID(ctx context.Context, patientID string) ([]ent
 	}
 	if err != nil {
 		r.log.Error("FindByPatientID failed", zap.String("patientID", patientID), zap.Error(err))
+		return nil, err
 	}
 
 	return notes, nil
@@ -91,13 +109,13 @@ func (r *noteRepo) List(ctx context.Context, offset, limit int) ([]entities.Note
 	var total int64
 
 	// count total
-	if err := r.db.WithContext(ctx).Model(&entities.Note{}).Count(&total).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entities.Note{}).Scopes(noteAccess(ctx)).Count(&total).Error; err != nil {
 		r.log.Error("List count failed", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// list
-	if err := r.db.WithContext(ctx).Offset(offset).Limit(limit).Find(&notes).Error; err != nil {
+	if err := r.db.WithContext(ctx).Scopes(noteAccess(ctx)).Offset(offset).Limit(limit).Find(&notes).Error; err != nil {
 		r.log.Error("List query failed", zap.Error(err))
 		return nil, 0, err
 	}
@@ -115,7 +133,7 @@ func (r *noteRepo) Update(ctx context.Context, note *entities.Note) error {
 }
 
 func (r *noteRepo) SoftDelete(ctx context.Context, id string) error {
-	res := r.db.WithContext(ctx).Delete(&entities.Note{}, "id = ?", id)
+	res := r.db.WithContext(ctx).Scopes(noteAccess(ctx)).Delete(&entities.Note{}, "id = ?", id)
 	if res.Error != nil {
 		r.log.Error("SoftDelete failed", zap.String("noteID", id), zap.Error(res.Error))
 	}
@@ -0,0 +1,173 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrganizationRepository interface {
+	// Create fails with ErrDuplicateKey if the slug is taken.
+	Create(ctx context.Context, org *entities.Organization) error
+	FindByID(ctx context.Context, id string) (*entities.Organization, error)
+	List(ctx context.Context, offset, limit int) ([]entities.Organization, int64, error)
+	// AddMember is a no-op if the user already belongs to the organisation.
+	AddMember(ctx context.Context, m *entities.Membership) error
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	IsMember(ctx context.Context, orgID, userID string) (bool, error)
+	FindMembership(ctx context.Context, orgID, userID string) (*entities.Membership, error)
+	// UpdateRole sets the role a member holds in the organisation.
+	UpdateRole(ctx context.Context, orgID, userID, role string) error
+	// ListByUserID returns the user's memberships, oldest first, with their
+	// organisations loaded.
+	ListByUserID(ctx context.Context, userID string) ([]entities.Membership, error)
+	ListMembers(ctx context.Context, orgID string) ([]entities.Membership, error)
+}
+
+type organizationRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewOrganizationRepository returns a GORM-backed OrganizationRepository.
+func NewOrganizationRepository(db *gorm.DB, log *zap.Logger) OrganizationRepository {
+	return &organizationRepo{
+		db:  db,
+		log: log.Named("organization-repository"),
+	}
+}
+
+func (r *organizationRepo) Create(ctx context.Context, org *entities.Organization) error {
+	err := r.db.WithContext(ctx).Create(org).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateKey
+	}
+	if err != nil {
+		r.log.Error("failed to create organization", zap.String("slug", org.Slug), zap.Error(err))
+		return err
+	}
+
+	r.log.Info("organization created", zap.String("organizationID", org.ID))
+	return nil
+}
+
+func (r *organizationRepo) FindByID(ctx context.Context, id string) (*entities.Organization, error) {
+	var o entities.Organization
+	err := r.db.WithContext(ctx).First(&o, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *organizationRepo) List(ctx context.Context, offset, limit int) ([]entities.Organization, int64, error) {
+	var orgs []entities.Organization
+	var total int64
+
+	if err := r.db.WithContext(ctx).Model(&entities.Organization{}).Count(&total).Error; err != nil {
+		r.log.Error("List count failed", zap.Error(err))
+		return nil, 0, err
+	}
+	if err := r.db.WithContext(ctx).Order("name ASC").Offset(offset).Limit(limit).Find(&orgs).Error; err != nil {
+		r.log.Error("List query failed", zap.Error(err))
+		return nil, 0, err
+	}
+	return orgs, total, nil
+}
+
+func (r *organizationRepo) AddMember(ctx context.Context, m *entities.Membership) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(m).Error
+	if err != nil {
+		r.log.Error("AddMember failed", zap.String("organizationID", m.OrganizationID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *organizationRepo) RemoveMember(ctx context.Context, orgID, userID string) error {
+	res := r.db.WithContext(ctx).Delete(&entities.Membership{}, "organization_id = ? AND user_id = ?", orgID, userID)
+	if res.Error != nil {
+		r.log.Error("RemoveMember failed", zap.String("organizationID", orgID), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *organizationRepo) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&entities.Membership{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("IsMember failed", zap.String("organizationID", orgID), zap.Error(err))
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *organizationRepo) FindMembership(ctx context.Context, orgID, userID string) (*entities.Membership, error) {
+	var m entities.Membership
+	err := r.db.WithContext(ctx).First(&m, "organization_id = ? AND user_id = ?", orgID, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindMembership failed", zap.String("organizationID", orgID), zap.Error(err))
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *organizationRepo) UpdateRole(ctx context.Context, orgID, userID, role string) error {
+	res := r.db.WithContext(ctx).Model(&entities.Membership{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role)
+	if res.Error != nil {
+		r.log.Error("UpdateRole failed", zap.String("organizationID", orgID), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *organizationRepo) ListByUserID(ctx context.Context, userID string) ([]entities.Membership, error) {
+	var memberships []entities.Membership
+	err := r.db.WithContext(ctx).
+		Preload("Organization").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id AND organizations.deleted_at IS NULL").
+		Where("memberships.user_id = ?", userID).
+		Order("memberships.created_at ASC").
+		Find(&memberships).Error
+	if err != nil {
+		r.log.Error("ListByUserID failed", zap.String("userID", userID), zap.Error(err))
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *organizationRepo) ListMembers(ctx context.Context, orgID string) ([]entities.Membership, error) {
+	var members []entities.Membership
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("organization_id = ?", orgID).
+		Order("created_at ASC").
+		Find(&members).Error
+	if err != nil {
+		r.log.Error("ListMembers failed", zap.String("organizationID", orgID), zap.Error(err))
+		return nil, err
+	}
+	return members, nil
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PatientExportRepository reads are scoped to the context's actor like the
+// patients they belong to, see access.go.
+type PatientExportRepository interface {
+	Create(ctx context.Context, export *entities.PatientExport) error
+	FindByID(ctx context.Context, id string) (*entities.PatientExport, error)
+	FindByPatientID(ctx context.Context, patientID string) ([]entities.PatientExport, error)
+	// FindByStatus returns the oldest exports in one of statuses, used to
+	// pick up work the in-memory queue lost on restart.
+	FindByStatus(ctx context.Context, statuses []entities.ExportStatus, limit int) ([]entities.PatientExport, error)
+	// FindExpired returns ready exports whose link expired before t.
+	FindExpired(ctx context.Context, t time.Time, limit int) ([]entities.PatientExport, error)
+	Update(ctx context.Context, export *entities.PatientExport) error
+}
+
+type patientExportRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewPatientExportRepository returns a GORM-backed PatientExportRepository.
+func NewPatientExportRepository(db *gorm.DB, log *zap.Logger) PatientExportRepository {
+	return &patientExportRepo{
+		db:  db,
+		log: log.Named("patient-export-repository"),
+	}
+}
+
+func exportAccess(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return scopeByColumn(ctx, "patient_exports.patient_id", visiblePatientIDs)
+}
+
+func (r *patientExportRepo) Create(ctx context.Context, export *entities.PatientExport) error {
+	if err := r.db.WithContext(ctx).Create(export).Error; err != nil {
+		r.log.Error("failed to create patient export", zap.String("patientID", export.PatientID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *patientExportRepo) FindByID(ctx context.Context, id string) (*entities.PatientExport, error) {
+	var e entities.PatientExport
+	err := r.db.WithContext(ctx).Scopes(exportAccess(ctx)).First(&e, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindByID failed", zap.String("exportID", id), zap.Error(err))
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *patientExportRepo) FindByPatientID(ctx context.Context, patientID string) ([]entities.PatientExport, error) {
+	var exports []entities.PatientExport
+	err := r.db.WithContext(ctx).Scopes(exportAccess(ctx)).
+		Where("patient_id = ?", patientID).
+		Order("created_at DESC").
+		Find(&exports).Error
+	if err != nil {
+		r.log.Error("FindByPatientID failed", zap.String("patientID", patientID), zap.Error(err))
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *patientExportRepo) FindByStatus(ctx context.Context, statuses []entities.ExportStatus, limit int) ([]entities.PatientExport, error) {
+	var exports []entities.PatientExport
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", statuses).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&exports).Error
+	if err != nil {
+		r.log.Error("FindByStatus failed", zap.Error(err))
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *patientExportRepo) FindExpired(ctx context.Context, t time.Time, limit int) ([]entities.PatientExport, error) {
+	var exports []entities.PatientExport
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at < ?", entities.ExportReady, t).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&exports).Error
+	if err != nil {
+		r.log.Error("FindExpired failed", zap.Error(err))
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *patientExportRepo) Update(ctx context.Context, export *entities.PatientExport) error {
+	if err := r.db.WithContext(ctx).Save(export).Error; err != nil {
+		r.log.Error("Update failed", zap.String("exportID", export.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -5,13 +5,20 @@ import (
 	"errors"
 
 	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/fieldcrypt"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+// PatientRepository reads are scoped to the context's actor, see access.go.
+// FindByEmail and FindByPhoneNumber are not: they back uniqueness checks,
+// which like all patient queries only see the actor's organisation.
 type PatientRepository interface {
 	Create(ctx context.Context, patient *entities.Patient) error
 	FindByID(ctx context.Context, id string) (*entities.Patient, error)
+	// FindUnscopedByID also returns soft-deleted patients, to users who may
+	// see every patient.
+	FindUnscopedByID(ctx context.Context, id string) (*entities.Patient, error)
 	FindByEmail(ctx context.Context, email string) (*entities.Patient, error)
 	FindByPhoneNumber(ctx context.Context, phoneNumber string) (*entities.Patient, error)
 	List(ctx context.Context, offset, limit int) ([]entities.Patient, int64, error)
@@ -20,15 +27,18 @@ type PatientRepository interface {
 }
 
 type patientRepo struct {
-	db  *gorm.DB
-	log *zap.Logger
+	db     *gorm.DB
+	fields *fieldcrypt.Cipher
+	log    *zap.Logger
 }
 
-// NewPatientRepository returns a GORM-backed PatientRepository
-func NewPatientRepository(db *gorm.DB, log *zap.Logger) PatientRepository {
+// NewPatientRepository returns a GORM-backed PatientRepository. fields must
+// be the Cipher the database was connected with, to compute blind indexes.
+func NewPatientRepository(db *gorm.DB, fields *fieldcrypt.Cipher, log *zap.Logger) PatientRepository {
 	return &patientRepo{
-		db:  db,
-		log: log.Named("patient-repository"),
+		db:     db,
+		fields: fields,
+		log:    log.Named("patient-repository"),
 	}
 }
 
@@ -44,12 +54,27 @@ func (r *patientRepo) Create(ctx context.Context, patient *entities.Patient) err
 
 func (r *patientRepo) FindByID(ctx context.Context, id string) (*entities.Patient, error) {
 	var p entities.Patient
-	err := r.db.WithContext(ctx).First(&p, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Scopes(patientAccess(ctx)).First(&p, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *patientRepo) FindUnscopedByID(ctx context.Context, id string) (*entities.Patient, error) {
+	var p entities.Patient
+	err := r.db.WithContext(ctx).Unscoped().Scopes(patientAccess(ctx)).First(&p, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindUnscopedByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
 	}
 
 	return &p, nil
@@ -57,7 +82,7 @@ func (r *patientRepo) FindByID(ctx context.Context, id string) (*entities.Patien
 
 func (r *patientRepo) FindByEmail(ctx context.Context, email string) (*entities.Patient, error) {
 	var p entities.Patient
-	err := r.db.WithContext(ctx).First(&p, "email = ?", email).Error
+	err := r.db.WithContext(ctx).Scopes(r.byBlindIndex("email", email)).First(&p).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
 	}
@@ -70,7 +95,7 @@ func (r *patientRepo) FindByEmail(ctx context.Context, email string) (*entities.
 func (r *patientRepo) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*entities.Patient, error) {
 	var p entities.Patient
 	err := r.db.WithContext(ctx).
-		Where("phone_number = ?", phoneNumber).
+		Scopes(r.byBlindIndex("phone_number", phoneNumber)).
 		First(&p).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
@@ -81,18 +106,31 @@ func (r *patientRepo) FindByPhoneNumber(ctx context.Context, phoneNumber string)
 	return &p, nil
 }
 
+// byBlindIndex matches an encrypted column by its blind index, under any
+// key. Rows written before the index existed are matched by the plaintext
+// they still hold until they are re-encrypted.
+func (r *patientRepo) byBlindIndex(column, value string) func(*gorm.DB) *gorm.DB {
+	indexes := r.fields.BlindIndexes("patients."+column, value)
+	return func(db *gorm.DB) *gorm.DB {
+		if len(indexes) == 0 {
+			return db.Where(column + "_index IS NULL AND " + column + " = ''")
+		}
+		return db.Where("("+column+"_index IN ? OR ("+column+"_index IS NULL AND "+column+" = ?))", indexes, value)
+	}
+}
+
 func (r *patientRepo) List(ctx context.Context, offset, limit int) ([]entities.Patient, int64, error) {
 	var patients []entities.Patient
 	var total int64
 
 	// count total
-	if err := r.db.WithContext(ctx).Model(&entities.Patient{}).Count(&total).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entities.Patient{}).Scopes(patientAccess(ctx)).Count(&total).Error; err != nil {
 		r.log.Error("List count failed", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// list
-	if err := r.db.WithContext(ctx).Order("updated_at ASC").Offset(offset).Limit(limit).Find(&patients).Error; err != nil {
+	if err := r.db.WithContext(ctx).Scopes(patientAccess(ctx)).Order("updated_at ASC").Offset(offset).Limit(limit).Find(&patients).Error; err != nil {
 		r.log.Error("List query failed", zap.Error(err))
 		return nil, 0, err
 	}
@@ -110,7 +148,7 @@ func (r *patientRepo) Update(ctx context.Context, patient *entities.Patient) err
 }
 
 func (r *patientRepo) SoftDelete(ctx context.Context, id string) error {
-	res := r.db.WithContext(ctx).Delete(&entities.Patient{}, "id = ?", id)
+	res := r.db.WithContext(ctx).Scopes(patientAccess(ctx)).Delete(&entities.Patient{}, "id = ?", id)
 	if res.Error != nil {
 		r.log.Error("SoftDelete failed", zap.String("patientID", id), zap.Error(res.Error))
 	}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/ratelimit"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitRepository is a ratelimit.Store in Postgres, so limits hold
+// across replicas.
+type RateLimitRepository interface {
+	ratelimit.Store
+	// DeleteIdle removes buckets that have refilled by now.
+	DeleteIdle(ctx context.Context, now time.Time) (int64, error)
+}
+
+type rateLimitRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewRateLimitRepository returns a GORM-backed RateLimitRepository.
+func NewRateLimitRepository(db *gorm.DB, log *zap.Logger) RateLimitRepository {
+	return &rateLimitRepo{
+		db:  db,
+		log: log.Named("rate-limit-repository"),
+	}
+}
+
+func (r *rateLimitRepo) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	var res ratelimit.Result
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Create the bucket full if it is missing, so the row can be locked
+		// even on a key's first request.
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entities.RateLimitBucket{
+			Key:     key,
+			Tokens:  float64(limit.Burst),
+			TakenAt: now,
+			IdleAt:  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var row entities.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		var next ratelimit.Bucket
+		next, res = limit.Take(&ratelimit.Bucket{Tokens: row.Tokens, TakenAt: row.TakenAt}, now)
+		return tx.Model(&row).Updates(map[string]any{
+			"tokens":   next.Tokens,
+			"taken_at": next.TakenAt,
+			"idle_at":  next.TakenAt.Add(limit.Idle()),
+		}).Error
+	})
+	if err != nil {
+		r.log.Error("Take failed", zap.String("key", key), zap.Error(err))
+		return ratelimit.Result{}, err
+	}
+	return res, nil
+}
+
+func (r *rateLimitRepo) DeleteIdle(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("idle_at < ?", now).Delete(&entities.RateLimitBucket{})
+	if res.Error != nil {
+		r.log.Error("DeleteIdle failed", zap.Error(res.Error))
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
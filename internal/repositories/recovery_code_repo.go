@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository interface {
+	// Replace deletes the user's codes and stores a new set in one transaction.
+	Replace(ctx context.Context, userID string, hashes []string) error
+	// Consume marks the user's unused code with this hash as used. It
+	// returns ErrNotFound if there is none.
+	Consume(ctx context.Context, userID, hash string) error
+	CountUnused(ctx context.Context, userID string) (int64, error)
+	DeleteForUser(ctx context.Context, userID string) error
+}
+
+type recoveryCodeRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewRecoveryCodeRepository returns a GORM-backed RecoveryCodeRepository.
+func NewRecoveryCodeRepository(db *gorm.DB, log *zap.Logger) RecoveryCodeRepository {
+	return &recoveryCodeRepo{
+		db:  db,
+		log: log.Named("recovery-code-repository"),
+	}
+}
+
+func (r *recoveryCodeRepo) Replace(ctx context.Context, userID string, hashes []string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]entities.RecoveryCode, len(hashes))
+		for i, h := range hashes {
+			codes[i] = entities.RecoveryCode{UserID: userID, CodeHash: h}
+		}
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		r.log.Error("Replace failed", zap.String("userID", userID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *recoveryCodeRepo) Consume(ctx context.Context, userID, hash string) error {
+	res := r.db.WithContext(ctx).
+		Model(&entities.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now().UTC())
+	if res.Error != nil {
+		r.log.Error("Consume failed", zap.String("userID", userID), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *recoveryCodeRepo) CountUnused(ctx context.Context, userID string) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).
+		Model(&entities.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("CountUnused failed", zap.String("userID", userID), zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *recoveryCodeRepo) DeleteForUser(ctx context.Context, userID string) error {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error; err != nil {
+		r.log.Error("DeleteForUser failed", zap.String("userID", userID), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PurgeCutoffs select the soft-deleted rows of a table that are due for
+// purging, see config.RetentionRule.
+type PurgeCutoffs struct {
+	// DeletedBefore matches rows soft-deleted before it.
+	DeletedBefore time.Time
+	// ChangedBefore protects rows changed since, whatever else matches.
+	ChangedBefore time.Time
+	// ExpiredBefore, if set, matches rows last changed before it however
+	// recently they were deleted.
+	ExpiredBefore *time.Time
+}
+
+// purgeTable describes how to judge the rows of a purgeable table.
+type purgeTable struct {
+	// changedAt is when a row was last changed. A patient counts as
+	// changed whenever one of their notes is.
+	changedAt string
+	// patientID is the patient a row belongs to, for legal holds; empty if
+	// rows belong to none.
+	patientID string
+}
+
+var purgeTables = map[string]purgeTable{
+	"patients": {
+		changedAt: `GREATEST(patients.updated_at, COALESCE(
+			(SELECT MAX(n.updated_at) FROM notes n WHERE n.patient_id = patients.id), patients.updated_at))`,
+		patientID: "patients.id",
+	},
+	"notes": {
+		changedAt: "notes.updated_at",
+		patientID: "notes.patient_id",
+	},
+	"messages": {
+		changedAt: "messages.created_at",
+		patientID: `(SELECT n.patient_id FROM conversations c JOIN notes n ON n.id = c.note_id
+			WHERE c.id = messages.conversation_id)`,
+	},
+	"attachments": {
+		changedAt: "attachments.created_at",
+		patientID: "(SELECT n.patient_id FROM notes n WHERE n.id = attachments.note_id)",
+	},
+	"prompts": {
+		changedAt: "prompts.updated_at",
+	},
+}
+
+// onHold matches patients with an active legal hold.
+const onHold = "EXISTS (SELECT 1 FROM legal_holds h WHERE h.patient_id = %s AND h.released_at IS NULL)"
+
+// RetentionRepository finds and hard-deletes soft-deleted rows for the
+// retention purge. Its queries are never scoped to an actor.
+type RetentionRepository interface {
+	// FindPurgeable returns the IDs of rows of table, after afterID in ID
+	// order, that match c and belong to no held patient.
+	FindPurgeable(ctx context.Context, table string, c PurgeCutoffs, afterID string, limit int) ([]string, error)
+	// CountHeldPatients counts patients matching c that are kept only
+	// because of a legal hold.
+	CountHeldPatients(ctx context.Context, c PurgeCutoffs) (int64, error)
+	// CountUnchangedPatients counts live patients last changed before t.
+	CountUnchangedPatients(ctx context.Context, t time.Time) (int64, error)
+	// FindAttachmentIDs returns every attachment, soft-deleted or not, of a
+	// patient, note or message. They must be purged, releasing their
+	// blobs, before their parent.
+	FindAttachmentIDs(ctx context.Context, table, id string) ([]string, error)
+	// HardDelete removes a row of table and everything under it, except
+	// attachments, in one transaction. It first locks the patient the row
+	// belongs to, so no legal hold can be placed meanwhile, and returns
+	// ErrOnHold if one already is. Otherwise before runs while the lock is
+	// held, to remove what lives outside the database, and the rows are
+	// deleted only if it succeeds. ErrNotFound means the row was already
+	// gone.
+	HardDelete(ctx context.Context, table, id string, before func() error) error
+
+	CreateReport(ctx context.Context, report *entities.PurgeReport) error
+	FindReportByID(ctx context.Context, id string) (*entities.PurgeReport, error)
+	// ListReports returns a page of reports, latest first, and the total.
+	ListReports(ctx context.Context, offset, limit int) ([]entities.PurgeReport, int64, error)
+}
+
+type retentionRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewRetentionRepository returns a GORM-backed RetentionRepository.
+func NewRetentionRepository(db *gorm.DB, log *zap.Logger) RetentionRepository {
+	return &retentionRepo{
+		db:  db,
+		log: log.Named("retention-repository"),
+	}
+}
+
+// due matches the soft-deleted rows of table that c selects, held or not.
+func due(db *gorm.DB, table string, t purgeTable, c PurgeCutoffs) *gorm.DB {
+	q := db.Table(table).
+		Where(table+".deleted_at IS NOT NULL").
+		Where(t.changedAt+" < ?", c.ChangedBefore)
+	if c.ExpiredBefore != nil {
+		return q.Where("("+table+".deleted_at < ? OR "+t.changedAt+" < ?)", c.DeletedBefore, *c.ExpiredBefore)
+	}
+	return q.Where(table+".deleted_at < ?", c.DeletedBefore)
+}
+
+func (r *retentionRepo) FindPurgeable(ctx context.Context, table string, c PurgeCutoffs, afterID string, limit int) ([]string, error) {
+	t, ok := purgeTables[table]
+	if !ok {
+		return nil, fmt.Errorf("table %q cannot be purged", table)
+	}
+
+	q := due(r.db.WithContext(ctx), table, t, c)
+	if t.patientID != "" {
+		q = q.Where("NOT " + fmt.Sprintf(onHold, t.patientID))
+	}
+	if afterID != "" {
+		q = q.Where(table+".id > ?", afterID)
+	}
+
+	var ids []string
+	if err := q.Order(table+".id").Limit(limit).Pluck(table+".id", &ids).Error; err != nil {
+		r.log.Error("FindPurgeable failed", zap.String("table", table), zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *retentionRepo) CountHeldPatients(ctx context.Context, c PurgeCutoffs) (int64, error) {
+	t := purgeTables["patients"]
+	var n int64
+	err := due(r.db.WithContext(ctx), "patients", t, c).
+		Where(fmt.Sprintf(onHold, t.patientID)).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("CountHeldPatients failed", zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *retentionRepo) CountUnchangedPatients(ctx context.Context, t time.Time) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Table("patients").
+		Where("patients.deleted_at IS NULL").
+		Where(purgeTables["patients"].changedAt+" < ?", t).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("CountUnchangedPatients failed", zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *retentionRepo) FindAttachmentIDs(ctx context.Context, table, id string) ([]string, error) {
+	q := r.db.WithContext(ctx).Table("attachments")
+	switch table {
+	case "patients":
+		q = q.Where("note_id IN (SELECT id FROM notes WHERE patient_id = ?)", id)
+	case "notes":
+		q = q.Where("note_id = ?", id)
+	case "messages":
+		q = q.Where("message_id = ?", id)
+	default:
+		return nil, nil
+	}
+
+	var ids []string
+	if err := q.Pluck("id", &ids).Error; err != nil {
+		r.log.Error("FindAttachmentIDs failed", zap.String("table", table), zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	return ids, nil
+}
+
+// cascades lists, child first, the statements that hard-delete a row of
+// each table and what hangs off it. Each binds the row's ID once.
+var cascades = map[string][]string{
+	"patients": {
+		`DELETE FROM messages WHERE conversation_id IN (
+			SELECT c.id FROM conversations c JOIN notes n ON n.id = c.note_id WHERE n.patient_id = ?)`,
+		"DELETE FROM conversations WHERE note_id IN (SELECT id FROM notes WHERE patient_id = ?)",
+		"DELETE FROM notes WHERE patient_id = ?",
+		"DELETE FROM care_team_members WHERE patient_id = ?",
+		"DELETE FROM patient_exports WHERE patient_id = ?",
+		"DELETE FROM patients WHERE id = ?",
+	},
+	"notes": {
+		"DELETE FROM messages WHERE conversation_id IN (SELECT id FROM conversations WHERE note_id = ?)",
+		"DELETE FROM conversations WHERE note_id = ?",
+		"DELETE FROM notes WHERE id = ?",
+	},
+	"messages": {
+		"DELETE FROM messages WHERE id = ?",
+	},
+	"prompts": {
+		"DELETE FROM prompts WHERE id = ?",
+	},
+	// Attachments are deleted by the attachment service, in before, so
+	// their blobs are released.
+	"attachments": nil,
+}
+
+func (r *retentionRepo) HardDelete(ctx context.Context, table, id string, before func() error) error {
+	stmts, ok := cascades[table]
+	if !ok {
+		return fmt.Errorf("table %q cannot be purged", table)
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if t := purgeTables[table]; t.patientID != "" {
+			// Placing a hold locks the patient too, so once this returns
+			// no hold can appear until the purge is done.
+			var patient struct {
+				ID   string
+				Held bool
+			}
+			held := fmt.Sprintf(onHold, "patients.id")
+			err := tx.Raw(fmt.Sprintf(`SELECT patients.id, %s AS held FROM patients
+				WHERE patients.id = (SELECT %s FROM %s WHERE %s.id = ?)
+				FOR UPDATE OF patients`, held, t.patientID, table, table), id).
+				Scan(&patient).Error
+			if err != nil {
+				return err
+			}
+			if patient.Held {
+				return ErrOnHold
+			}
+		}
+
+		if err := before(); err != nil {
+			return err
+		}
+
+		var res *gorm.DB
+		for _, stmt := range stmts {
+			if res = tx.Exec(stmt, id); res.Error != nil {
+				return res.Error
+			}
+		}
+		// The last statement deletes the row itself.
+		if res != nil && res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrOnHold) {
+		r.log.Error("HardDelete failed", zap.String("table", table), zap.String("id", id), zap.Error(err))
+	}
+	return err
+}
+
+func (r *retentionRepo) CreateReport(ctx context.Context, report *entities.PurgeReport) error {
+	if err := r.db.WithContext(ctx).Create(report).Error; err != nil {
+		r.log.Error("failed to create purge report", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *retentionRepo) FindReportByID(ctx context.Context, id string) (*entities.PurgeReport, error) {
+	var report entities.PurgeReport
+	err := r.db.WithContext(ctx).First(&report, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindReportByID failed", zap.String("reportID", id), zap.Error(err))
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *retentionRepo) ListReports(ctx context.Context, offset, limit int) ([]entities.PurgeReport, int64, error) {
+	var (
+		reports []entities.PurgeReport
+		total   int64
+	)
+	if err := r.db.WithContext(ctx).Model(&entities.PurgeReport{}).Count(&total).Error; err != nil {
+		r.log.Error("ListReports count failed", zap.Error(err))
+		return nil, 0, err
+	}
+	err := r.db.WithContext(ctx).Order("finished_at DESC").Offset(offset).Limit(limit).Find(&reports).Error
+	if err != nil {
+		r.log.Error("ListReports failed", zap.Error(err))
+		return nil, 0, err
+	}
+	return reports, total, nil
+}
+
+// ErrOnHold is returned by HardDelete for rows of a patient under a legal
+// hold.
+var ErrOnHold = errors.New("patient is under a legal hold")
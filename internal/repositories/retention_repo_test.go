@@ -0,0 +1,129 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jamesphm04/splose-clone-be/internal/database/databasetest"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+// seedPatient writes a clinic with one soft-deleted patient and a note,
+// returning their IDs.
+func seedPatient(t *testing.T, db *gorm.DB) (userID, patientID, noteID string) {
+	t.Helper()
+	tag := uuid.NewString()[:8]
+	create := func(v any) {
+		t.Helper()
+		if err := db.Omit(clause.Associations).Create(v).Error; err != nil {
+			t.Fatalf("seeding %T: %v", v, err)
+		}
+	}
+
+	org := &entities.Organization{Name: "Retention " + tag, Slug: "retention-" + tag}
+	create(org)
+	user := &entities.User{Email: uuid.NewString() + "@example.com", Username: "practitioner", PasswordHash: "-"}
+	create(user)
+	patient := &entities.Patient{
+		OrganizationID: org.ID,
+		Email:          "patient-" + tag + "@example.com",
+		FirstName:      "Pat",
+		LastName:       "Ient",
+		Gender:         entities.GenderUnknown,
+		UserID:         user.ID,
+	}
+	create(patient)
+	note := &entities.Note{OrganizationID: org.ID, PatientID: patient.ID, UserID: user.ID, Title: "Discharge", Content: "summary"}
+	create(note)
+	if err := db.Delete(patient).Error; err != nil {
+		t.Fatalf("soft-deleting patient: %v", err)
+	}
+	return user.ID, patient.ID, note.ID
+}
+
+func exists(t *testing.T, db *gorm.DB, table, id string) bool {
+	t.Helper()
+	var n int64
+	if err := db.Table(table).Where("id = ?", id).Count(&n).Error; err != nil {
+		t.Fatalf("counting %s: %v", table, err)
+	}
+	return n > 0
+}
+
+func TestHardDeleteKeepsHeldPatient(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	userID, patientID, noteID := seedPatient(t, db)
+	repo := repositories.NewRetentionRepository(db, zap.NewNop())
+
+	// Placed after the purge found the patient.
+	var orgID string
+	db.Table("patients").Where("id = ?", patientID).Pluck("organization_id", &orgID)
+	hold := &entities.LegalHold{OrganizationID: orgID, PatientID: patientID, Reason: "litigation", PlacedBy: userID}
+	if err := repositories.NewLegalHoldRepository(db, zap.NewNop()).Create(ctx, hold); err != nil {
+		t.Fatalf("placing hold: %v", err)
+	}
+
+	for table, id := range map[string]string{"patients": patientID, "notes": noteID} {
+		called := false
+		err := repo.HardDelete(ctx, table, id, func() error {
+			called = true
+			return nil
+		})
+		if !errors.Is(err, repositories.ErrOnHold) {
+			t.Errorf("HardDelete(%s): err = %v, want ErrOnHold", table, err)
+		}
+		if called {
+			t.Errorf("HardDelete(%s) deleted storage of a held patient", table)
+		}
+		if !exists(t, db, table, id) {
+			t.Errorf("HardDelete(%s) deleted the row of a held patient", table)
+		}
+	}
+}
+
+func TestHardDeleteLocksPatientAgainstNewHolds(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	userID, patientID, noteID := seedPatient(t, db)
+	repo := repositories.NewRetentionRepository(db, zap.NewNop())
+	holds := repositories.NewLegalHoldRepository(db, zap.NewNop())
+
+	var orgID string
+	db.Table("patients").Where("id = ?", patientID).Pluck("organization_id", &orgID)
+	newHold := func() *entities.LegalHold {
+		return &entities.LegalHold{OrganizationID: orgID, PatientID: patientID, Reason: "litigation", PlacedBy: userID}
+	}
+
+	err := repo.HardDelete(ctx, "patients", patientID, func() error {
+		// Storage goes first, while the rows still refer to it...
+		if !exists(t, db, "notes", noteID) {
+			t.Error("rows deleted before storage")
+		}
+		// ...and no hold can slip in before the rows go too.
+		waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		if err := holds.Create(waitCtx, newHold()); err == nil {
+			t.Error("hold placed while the patient was being purged")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("HardDelete: %v", err)
+	}
+
+	if exists(t, db, "patients", patientID) || exists(t, db, "notes", noteID) {
+		t.Error("patient rows left behind")
+	}
+	if err := holds.Create(ctx, newHold()); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("placing hold on purged patient: err = %v, want ErrNotFound", err)
+	}
+}
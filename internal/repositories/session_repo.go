@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *entities.Session) error
+	FindByID(ctx context.Context, id string) (*entities.Session, error)
+	// ListActiveByUserID returns unrevoked, unexpired sessions, most
+	// recently used first.
+	ListActiveByUserID(ctx context.Context, userID string) ([]entities.Session, error)
+	// Rotate swaps the session's current token from fromTokenID to
+	// in.TokenID. It returns false when the session was revoked or its
+	// current token is no longer fromTokenID, i.e. another refresh won.
+	Rotate(ctx context.Context, id, fromTokenID string, in RotateSession) (bool, error)
+	// Touch records that the session was used at t.
+	Touch(ctx context.Context, id string, t time.Time) error
+	Revoke(ctx context.Context, id, reason string) error
+	// RevokeAllForUser revokes the user's sessions, and those in which
+	// they impersonate someone.
+	RevokeAllForUser(ctx context.Context, userID, reason string) (int64, error)
+	// DeleteExpired removes sessions that expired before cutoff.
+	DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// RotateSession is the new state written by Rotate.
+type RotateSession struct {
+	TokenID        string
+	ExpiresAt      time.Time
+	UserAgent      string
+	IP             string
+	OrganizationID *string
+}
+
+type sessionRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewSessionRepository returns a GORM-backed SessionRepository.
+func NewSessionRepository(db *gorm.DB, log *zap.Logger) SessionRepository {
+	return &sessionRepo{
+		db:  db,
+		log: log.Named("session-repository"),
+	}
+}
+
+func (r *sessionRepo) Create(ctx context.Context, session *entities.Session) error {
+	if err := r.db.WithContext(ctx).Create(session).Error; err != nil {
+		r.log.Error("failed to create session", zap.String("userID", session.UserID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepo) FindByID(ctx context.Context, id string) (*entities.Session, error) {
+	var s entities.Session
+	err := r.db.WithContext(ctx).First(&s, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sessionRepo) ListActiveByUserID(ctx context.Context, userID string) ([]entities.Session, error) {
+	var sessions []entities.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now().UTC()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		r.log.Error("ListActiveByUserID failed", zap.String("userID", userID), zap.Error(err))
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepo) Rotate(ctx context.Context, id, fromTokenID string, in RotateSession) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&entities.Session{}).
+		Where("id = ? AND current_token_id = ? AND revoked_at IS NULL", id, fromTokenID).
+		Updates(map[string]any{
+			"current_token_id": in.TokenID,
+			"expires_at":       in.ExpiresAt,
+			"user_agent":       in.UserAgent,
+			"ip":               in.IP,
+			"organization_id":  in.OrganizationID,
+			"last_seen_at":     time.Now().UTC(),
+		})
+	if res.Error != nil {
+		r.log.Error("Rotate failed", zap.String("sessionID", id), zap.Error(res.Error))
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *sessionRepo) Touch(ctx context.Context, id string, t time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&entities.Session{}).
+		Where("id = ?", id).
+		UpdateColumn("last_seen_at", t).Error
+	if err != nil {
+		r.log.Error("Touch failed", zap.String("sessionID", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepo) Revoke(ctx context.Context, id, reason string) error {
+	res := r.db.WithContext(ctx).
+		Model(&entities.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]any{
+			"revoked_at":     time.Now().UTC(),
+			"revoked_reason": reason,
+		})
+	if res.Error != nil {
+		r.log.Error("Revoke failed", zap.String("sessionID", id), zap.Error(res.Error))
+		return res.Error
+	}
+	return nil
+}
+
+func (r *sessionRepo) RevokeAllForUser(ctx context.Context, userID, reason string) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Model(&entities.Session{}).
+		Where("(user_id = ? OR impersonator_id = ?) AND revoked_at IS NULL AND expires_at > ?", userID, userID, time.Now().UTC()).
+		Updates(map[string]any{
+			"revoked_at":     time.Now().UTC(),
+			"revoked_reason": reason,
+		})
+	if res.Error != nil {
+		r.log.Error("RevokeAllForUser failed", zap.String("userID", userID), zap.Error(res.Error))
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+func (r *sessionRepo) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&entities.Session{})
+	if res.Error != nil {
+		r.log.Error("DeleteExpired failed", zap.Error(res.Error))
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
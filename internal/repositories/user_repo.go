@@ -9,13 +9,22 @@ import (
 	"gorm.io/gorm"
 )
 
+// UserRepository lists only members of the context actor's organisation,
+// see access.go; lookups by ID or email are not scoped.
 type UserRepository interface {
 	Create(ctx context.Context, user *entities.User) error
 	FindByID(ctx context.Context, id string) (*entities.User, error)
 	FindByEmail(ctx context.Context, email string) (*entities.User, error)
 	List(ctx context.Context, offset, limit int) ([]entities.User, int64, error)
+	// Update fails with ErrDuplicateKey if the email is taken.
 	Update(ctx context.Context, user *entities.User) error
 	SoftDelete(ctx context.Context, id string) error
+	// Restore undoes SoftDelete. It returns ErrNotFound unless the user
+	// exists and is deleted.
+	Restore(ctx context.Context, id string) error
+	// AdvanceMFAStep records step as the user's last accepted TOTP step. It
+	// returns false if a code from this step or a later one was already used.
+	AdvanceMFAStep(ctx context.Context, id string, step int64) (bool, error)
 }
 
 type userRepo struct {
@@ -49,6 +58,7 @@ func (r *userRepo) FindByID(ctx context.Context, id string) (*entities.User, err
 	}
 	if err != nil {
 		r.log.Error("FindByID failed", zap.String("id", id), zap.Error(err))
+		return nil, err
 	}
 
 	return &u, nil
@@ -62,6 +72,7 @@ func (r *userRepo) FindByEmail(ctx context.Context, email string) (*entities.Use
 	}
 	if err != nil {
 		r.log.Error("FindByEmail failed", zap.String("email", email), zap.Error(err))
+		return nil, err
 	}
 	return &u, nil
 }
@@ -71,13 +82,13 @@ func (r *userRepo) List(ctx context.Context, offset, limit int) ([]entities.User
 	var total int64
 
 	// count total
-	if err := r.db.WithContext(ctx).Model(&entities.User{}).Count(&total).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entities.User{}).Scopes(memberAccess(ctx)).Count(&total).Error; err != nil {
 		r.log.Error("List count failed", zap.Error(err))
 		return nil, 0, err
 	}
 
 	// list
-	if err := r.db.WithContext(ctx).Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	if err := r.db.WithContext(ctx).Scopes(memberAccess(ctx)).Offset(offset).Limit(limit).Find(&users).Error; err != nil {
 		r.log.Error("List query failed", zap.Error(err))
 		return nil, 0, err
 	}
@@ -86,7 +97,11 @@ func (r *userRepo) List(ctx context.Context, offset, limit int) ([]entities.User
 }
 
 func (r *userRepo) Update(ctx context.Context, user *entities.User) error {
-	if err := r.db.WithContext(ctx).Save(user).Error; err != nil {
+	err := r.db.WithContext(ctx).Save(user).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateKey
+	}
+	if err != nil {
 		r.log.Error("Update failed", zap.String("userID", user.ID), zap.Error(err))
 		return err
 	}
@@ -108,6 +123,35 @@ func (r *userRepo) SoftDelete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (r *userRepo) Restore(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).Unscoped().
+		Model(&entities.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		r.log.Error("Restore failed", zap.String("userID", id), zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	r.log.Info("user restored", zap.String("userID", id))
+	return nil
+}
+
+func (r *userRepo) AdvanceMFAStep(ctx context.Context, id string, step int64) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&entities.User{}).
+		Where("id = ? AND mfa_last_step < ?", id, step).
+		UpdateColumn("mfa_last_step", step)
+	if res.Error != nil {
+		r.log.Error("AdvanceMFAStep failed", zap.String("userID", id), zap.Error(res.Error))
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
 // Share between repos
 var (
 	ErrNotFound     = errors.New("record not found")
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *entities.UserToken) error
+	// Consume marks the unused, unexpired token with this hash as used and
+	// returns it. It returns ErrNotFound if there is no such token, so a
+	// token can be redeemed at most once even under concurrent requests.
+	Consume(ctx context.Context, purpose entities.TokenPurpose, hash string) (*entities.UserToken, error)
+	// InvalidateAll marks every outstanding token of the user for purpose as used.
+	InvalidateAll(ctx context.Context, userID string, purpose entities.TokenPurpose) error
+	CountSince(ctx context.Context, userID string, purpose entities.TokenPurpose, since time.Time) (int64, error)
+}
+
+type userTokenRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+// NewUserTokenRepository returns a GORM-backed UserTokenRepository.
+func NewUserTokenRepository(db *gorm.DB, log *zap.Logger) UserTokenRepository {
+	return &userTokenRepo{
+		db:  db,
+		log: log.Named("user-token-repository"),
+	}
+}
+
+func (r *userTokenRepo) Create(ctx context.Context, token *entities.UserToken) error {
+	if err := r.db.WithContext(ctx).Create(token).Error; err != nil {
+		r.log.Error("failed to create user token", zap.String("userID", token.UserID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *userTokenRepo) Consume(ctx context.Context, purpose entities.TokenPurpose, hash string) (*entities.UserToken, error) {
+	var tokens []entities.UserToken
+	now := time.Now().UTC()
+	res := r.db.WithContext(ctx).
+		Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		r.log.Error("Consume failed", zap.String("purpose", string(purpose)), zap.Error(res.Error))
+		return nil, res.Error
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (r *userTokenRepo) InvalidateAll(ctx context.Context, userID string, purpose entities.TokenPurpose) error {
+	err := r.db.WithContext(ctx).
+		Model(&entities.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now().UTC()).Error
+	if err != nil {
+		r.log.Error("InvalidateAll failed", zap.String("userID", userID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *userTokenRepo) CountSince(ctx context.Context, userID string, purpose entities.TokenPurpose, since time.Time) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).
+		Model(&entities.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, since).
+		Count(&n).Error
+	if err != nil {
+		r.log.Error("CountSince failed", zap.String("userID", userID), zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
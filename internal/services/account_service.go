@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+	"github.com/jamesphm04/splose-clone-be/pkg/mailer"
+)
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"    validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AccountService handles the email-based account flows: verification and
+// password reset. Emails are sent from a background queue so responses do
+// not reveal whether an address is registered.
+type AccountService struct {
+	userRepo   repositories.UserRepository
+	tokenRepo  repositories.UserTokenRepository
+	sessionSvc *SessionService
+	mailer     mailer.Mailer
+	mailQueue  *jobs.Queue
+	cfg        config.AuthConfig
+	bcryptCost int
+	log        *zap.Logger
+}
+
+func NewAccountService(
+	userRepo repositories.UserRepository,
+	tokenRepo repositories.UserTokenRepository,
+	sessionSvc *SessionService,
+	m mailer.Mailer,
+	mailQueue *jobs.Queue,
+	cfg config.AuthConfig,
+	bcryptCost int,
+	log *zap.Logger,
+) *AccountService {
+	return &AccountService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		sessionSvc: sessionSvc,
+		mailer:     m,
+		mailQueue:  mailQueue,
+		cfg:        cfg,
+		bcryptCost: bcryptCost,
+		log:        log.Named("account_service"),
+	}
+}
+
+// SendVerification emails the user a link confirming their address.
+func (s *AccountService) SendVerification(ctx context.Context, user *entities.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issue(ctx, user.ID, entities.TokenEmailVerify, s.cfg.EmailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in %s.\n\n%s\n\nIf you did not create an account, ignore this email.\n",
+			user.Username, s.cfg.EmailVerifyTTL, s.link("/verify-email", token)),
+	})
+	return nil
+}
+
+// VerifyEmail redeems a verification token.
+func (s *AccountService) VerifyEmail(ctx context.Context, in VerifyEmailInput) error {
+	t, err := s.tokenRepo.Consume(ctx, entities.TokenEmailVerify, auth.HashOpaqueToken(in.Token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrInvalidAccountToken
+		}
+		return fmt.Errorf("consuming token: %w", err)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, t.UserID)
+	if err != nil {
+		return ErrInvalidAccountToken
+	}
+	if err := s.markVerified(ctx, user); err != nil {
+		return err
+	}
+
+	s.log.Info("email verified", zap.String("userID", user.ID))
+	return nil
+}
+
+// ForgotPassword emails a reset link if the address belongs to a user. It
+// succeeds either way so callers cannot probe for registered addresses.
+func (s *AccountService) ForgotPassword(ctx context.Context, in ForgotPasswordInput) error {
+	user, err := s.userRepo.FindByEmail(ctx, in.Email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("finding user: %w", err)
+	}
+
+	err = s.SendPasswordReset(ctx, user)
+	if errors.Is(err, ErrTooManyAccountTokens) {
+		// Same response as success; the throttle is not an oracle either.
+		s.log.Warn("password reset throttled", zap.String("userID", user.ID))
+		return nil
+	}
+	return err
+}
+
+// SendPasswordReset emails the user a password reset link.
+func (s *AccountService) SendPasswordReset(ctx context.Context, user *entities.User) error {
+	token, err := s.issue(ctx, user.ID, entities.TokenPasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nReset your password by opening the link below. It expires in %s and can be used once.\n\n%s\n\nIf you did not ask for this, ignore this email; your password is unchanged.\n",
+			user.Username, s.cfg.PasswordResetTTL, s.link("/reset-password", token)),
+	})
+	return nil
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out everywhere.
+func (s *AccountService) ResetPassword(ctx context.Context, in ResetPasswordInput) error {
+	t, err := s.tokenRepo.Consume(ctx, entities.TokenPasswordReset, auth.HashOpaqueToken(in.Token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrInvalidAccountToken
+		}
+		return fmt.Errorf("consuming token: %w", err)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, t.UserID)
+	if err != nil {
+		return ErrInvalidAccountToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), s.bcryptCost)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	user.PasswordHash = string(hash)
+	// Following the link proves control of the mailbox.
+	if user.EmailVerifiedAt == nil {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
+	if err := s.tokenRepo.InvalidateAll(ctx, user.ID, entities.TokenPasswordReset); err != nil {
+		return err
+	}
+	if _, err := s.sessionSvc.RevokeAll(ctx, user.ID, entities.SessionRevokedPasswordReset); err != nil {
+		return err
+	}
+
+	s.log.Info("password reset", zap.String("userID", user.ID))
+	return nil
+}
+
+func (s *AccountService) markVerified(ctx context.Context, user *entities.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	user.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("marking email verified: %w", err)
+	}
+	return s.tokenRepo.InvalidateAll(ctx, user.ID, entities.TokenEmailVerify)
+}
+
+// issue creates a token after checking the per-user hourly limit. Older
+// tokens for the same purpose are invalidated so only the newest link works.
+func (s *AccountService) issue(ctx context.Context, userID string, purpose entities.TokenPurpose, ttl time.Duration) (string, error) {
+	if s.cfg.TokenIssueLimit > 0 {
+		n, err := s.tokenRepo.CountSince(ctx, userID, purpose, time.Now().UTC().Add(-time.Hour))
+		if err != nil {
+			return "", fmt.Errorf("counting tokens: %w", err)
+		}
+		if n >= int64(s.cfg.TokenIssueLimit) {
+			return "", ErrTooManyAccountTokens
+		}
+	}
+
+	if err := s.tokenRepo.InvalidateAll(ctx, userID, purpose); err != nil {
+		return "", fmt.Errorf("invalidating tokens: %w", err)
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.tokenRepo.Create(ctx, &entities.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}); err != nil {
+		return "", fmt.Errorf("saving token: %w", err)
+	}
+	return token, nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return tokenLink(s.cfg.AppBaseURL, path, token)
+}
+
+func (s *AccountService) send(msg mailer.Message) {
+	queueMail(s.mailQueue, s.mailer, msg, s.log)
+}
+
+var (
+	ErrInvalidAccountToken  = errors.New("token is invalid or has expired")
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+	ErrTooManyAccountTokens = errors.New("too many requests; try again later")
+)
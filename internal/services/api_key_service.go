@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// apiKeyTouchInterval is how stale last-used may get before a request
+// records it again.
+const apiKeyTouchInterval = time.Minute
+
+type CreateAPIKeyInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// UserID is the user the key acts as; it defaults to the caller.
+	UserID     string     `json:"userId"     validate:"omitempty,uuid"`
+	Scopes     []string   `json:"scopes"     validate:"required,min=1,dive,required"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	AllowedIPs []string   `json:"allowedIps" validate:"dive,required"`
+}
+
+// CreatedAPIKey is returned once, at creation; Key is never shown again.
+type CreatedAPIKey struct {
+	*entities.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyService mints and checks API keys for integrations.
+type APIKeyService struct {
+	repo     repositories.APIKeyRepository
+	userRepo repositories.UserRepository
+	orgRepo  repositories.OrganizationRepository
+	log      *zap.Logger
+}
+
+func NewAPIKeyService(
+	repo repositories.APIKeyRepository,
+	userRepo repositories.UserRepository,
+	orgRepo repositories.OrganizationRepository,
+	log *zap.Logger,
+) *APIKeyService {
+	return &APIKeyService{repo: repo, userRepo: userRepo, orgRepo: orgRepo, log: log.Named("api_key_service")}
+}
+
+// Create mints a key on behalf of the admin creatorID. The key reaches the
+// data of orgID, the organisation the admin is signed in to, and its user
+// must be a member of it.
+func (s *APIKeyService) Create(ctx context.Context, creatorID, orgID string, in CreateAPIKeyInput) (*CreatedAPIKey, error) {
+	for _, scope := range in.Scopes {
+		if !slices.Contains(entities.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidAPIKeyExpiry
+	}
+	allowed, err := normalizePrefixes(in.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := in.UserID
+	if userID == "" {
+		userID = creatorID
+	}
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if orgID == "" {
+		return nil, ErrNoOrganization
+	}
+	member, err := s.orgRepo.IsMember(ctx, orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("checking membership: %w", err)
+	}
+	if !member {
+		return nil, ErrAPIKeyUserNotMember
+	}
+
+	key, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	record := &entities.APIKey{
+		Name:           in.Name,
+		Prefix:         key[:len(auth.APIKeyPrefix)+6],
+		KeyHash:        hash,
+		UserID:         userID,
+		OrganizationID: orgID,
+		CreatedBy:      creatorID,
+		Scopes:         slices.Compact(slices.Sorted(slices.Values(in.Scopes))),
+		AllowedIPs:     allowed,
+		ExpiresAt:      in.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, record); err != nil {
+		return nil, fmt.Errorf("saving api key: %w", err)
+	}
+
+	s.log.Info("api key created",
+		zap.String("keyID", record.ID),
+		zap.String("userID", userID),
+		zap.String("createdBy", creatorID),
+		zap.Strings("scopes", record.Scopes),
+	)
+	return &CreatedAPIKey{APIKey: record, Key: key}, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context) ([]entities.APIKey, error) {
+	return s.repo.List(ctx)
+}
+
+// Revoke disables a key immediately.
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+	s.log.Info("api key revoked", zap.String("keyID", id))
+	return nil
+}
+
+// VerifyAPIKey resolves a presented key to its principal. It returns nil
+// without an error when the key is unknown, revoked, expired, used from a
+// disallowed address, or its user no longer exists or has left the key's
+// organisation.
+func (s *APIKeyService) VerifyAPIKey(ctx context.Context, key, ip string) (*auth.APIKeyPrincipal, error) {
+	record, err := s.repo.FindByHash(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("finding api key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if !record.Usable(now) {
+		return nil, nil
+	}
+	if !ipAllowed(record.AllowedIPs, ip) {
+		s.log.Warn("api key used from disallowed address", zap.String("keyID", record.ID), zap.String("ip", ip))
+		return nil, nil
+	}
+
+	user, err := s.userRepo.FindByID(ctx, record.UserID)
+	if err != nil || user.Disabled() {
+		return nil, nil
+	}
+	member, err := s.orgRepo.FindMembership(ctx, record.OrganizationID, record.UserID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding membership: %w", err)
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, record.ID, now, now.Add(-apiKeyTouchInterval)); err != nil {
+		// Last-used is informational; do not fail the request over it.
+		s.log.Warn("updating api key last-used failed", zap.String("keyID", record.ID), zap.Error(err))
+	}
+
+	return &auth.APIKeyPrincipal{
+		KeyID:  record.ID,
+		UserID: record.UserID,
+		Role:   member.Role,
+		OrgID:  record.OrganizationID,
+		Scopes: record.Scopes,
+	}, nil
+}
+
+// normalizePrefixes parses IPs and CIDRs, turning bare IPs into
+// single-address prefixes.
+func normalizePrefixes(items []string) ([]string, error) {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()).String())
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAllowedIP, item)
+		}
+		out = append(out, p.Masked().String())
+	}
+	return out, nil
+}
+
+func ipAllowed(prefixes []string, ip string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if prefix, err := netip.ParsePrefix(p); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrInvalidAPIKeyScope  = errors.New("unknown api key scope")
+	ErrInvalidAPIKeyExpiry = errors.New("expiresAt must be in the future")
+	ErrInvalidAllowedIP    = errors.New("invalid IP address or CIDR")
+	ErrAPIKeyUserNotMember = errors.New("the key's user is not a member of your organization")
+)
@@ -2,103 +2,155 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
-	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/jamesphm04/splose-clone-be/internal/config"
 	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
 	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
 	"github.com/jamesphm04/splose-clone-be/pkg/storage"
 	"go.uber.org/zap"
 )
 
+// Attachment uses select which allowlist in config.AttachmentConfig applies.
+const (
+	AttachmentUseMessage = "message"
+)
+
 type FileUploadInput struct {
 	NoteID     string                // FK → notes.id
 	MessageID  string                // FK → messages.id
+	Use        string                // key into the allowed types config
 	File       multipart.File        // open file handle (caller must close)
 	FileHeader *multipart.FileHeader // carries Name, Size, Header (MIME)
 }
 
+// inspectedUpload is what the server concluded about an upload, independent
+// of anything the client claimed.
+type inspectedUpload struct {
+	contentType string
+	safeName    string
+	size        int64
+	sha256      string // hex digest of the full content
+}
+
 type AttachmentService struct {
-	repo     repositories.AttachmentRepository
-	s3Client *storage.Client
-	log      *zap.Logger
+	repo       repositories.AttachmentRepository
+	blobRepo   repositories.BlobRepository
+	s3Client   *storage.Client
+	previewSvc *PreviewService
+	cfg        config.AttachmentConfig
+	log        *zap.Logger
 }
 
 func NewAttachmentService(
 	repo repositories.AttachmentRepository,
+	blobRepo repositories.BlobRepository,
 	s3Client *storage.Client,
+	previewSvc *PreviewService,
+	cfg config.AttachmentConfig,
 	log *zap.Logger,
 ) *AttachmentService {
 	return &AttachmentService{
-		repo:     repo,
-		s3Client: s3Client,
-		log:      log.Named("attachment_service"),
+		repo:       repo,
+		blobRepo:   blobRepo,
+		s3Client:   s3Client,
+		previewSvc: previewSvc,
+		cfg:        cfg,
+		log:        log.Named("attachment_service"),
 	}
 }
 
+// Validate runs every upload check without storing anything, so callers can
+// reject a bad file before creating records that depend on it.
+func (s *AttachmentService) Validate(ctx context.Context, in FileUploadInput) error {
+	_, err := s.inspect(ctx, in)
+	return err
+}
+
+// Create stores an upload as an attachment. Content is addressed by its
+// SHA-256: identical bytes share one reference-counted blob in S3, so a
+// re-uploaded file only costs a new row once the first upload of it has
+// finished.
 func (s *AttachmentService) Create(ctx context.Context, in FileUploadInput) (*entities.Attachment, string, error) {
-	s.log.Info("creating attachmenttttt", zap.String("input", fmt.Sprintf("%+v", in)))
-	// S3
-	safeName := filepath.Base(in.FileHeader.Filename)
-	safeName = strings.ReplaceAll(safeName, " ", "_")
-
-	s3Key := fmt.Sprintf("attachments/%s/%d_%s",
-		in.NoteID,
-		time.Now().UnixMilli(),
-		safeName,
-	)
+	s.log.Info("creating attachment", zap.String("noteID", in.NoteID), zap.String("messageID", in.MessageID))
 
-	// Detect MIME type
-	// Prefer the Content-Type the client sent; fall back to octet-stream.
-	contentType := in.FileHeader.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	upload, err := s.inspect(ctx, in)
+	if err != nil {
+		return nil, "", err
 	}
 
-	s.log.Info("uploading attachment to S3",
-		zap.String("key", s3Key),
-		zap.String("contentType", contentType),
-		zap.Int64("size", in.FileHeader.Size),
-	)
-
-	// Upload to S3
-	uploadOut, err := s.s3Client.Upload(ctx, storage.UploadInput{
-		Key:         s3Key,
-		Body:        in.File,
-		ContentType: contentType,
-		Size:        in.FileHeader.Size,
-	})
+	s3Key := blobKey(upload.sha256)
+	blob := &entities.Blob{
+		Hash:  upload.sha256,
+		S3Key: s3Key,
+		Type:  upload.contentType,
+		Size:  upload.size,
+	}
+	refs, err := s.blobRepo.Acquire(ctx, blob)
 	if err != nil {
-		return nil, "", fmt.Errorf("uploading attachment to S3: %w", err)
+		return nil, "", fmt.Errorf("acquiring blob: %w", err)
+	}
+
+	// Reuse the object only once it is in S3. A pending blob may be another
+	// request's upload still in flight, or one that is about to fail, so
+	// put the identical bytes under the same key ourselves.
+	if blob.Status != entities.BlobUploaded {
+		s.log.Info("uploading attachment to S3",
+			zap.String("key", s3Key),
+			zap.String("contentType", upload.contentType),
+			zap.Int64("size", upload.size),
+		)
+
+		_, err = s.s3Client.Upload(ctx, storage.UploadInput{
+			Key:         s3Key,
+			Body:        in.File,
+			ContentType: upload.contentType,
+			Size:        upload.size,
+		})
+		if err != nil {
+			s.releaseBlob(ctx, upload.sha256)
+			return nil, "", fmt.Errorf("uploading attachment to S3: %w", err)
+		}
+		if err := s.blobRepo.MarkUploaded(ctx, upload.sha256); err != nil {
+			s.releaseBlob(ctx, upload.sha256)
+			return nil, "", fmt.Errorf("marking blob uploaded: %w", err)
+		}
+	} else {
+		s.log.Info("attachment deduplicated",
+			zap.String("key", s3Key),
+			zap.Int64("refCount", refs),
+		)
 	}
 
 	// Save to DB
 	att := &entities.Attachment{
 		NoteID:    in.NoteID,
 		MessageID: in.MessageID,
-		URL:       uploadOut.URL,
+		URL:       s.s3Client.ObjectURL(s3Key),
 		Name:      in.FileHeader.Filename, // keep original display name
-		Type:      contentType,
-		Size:      in.FileHeader.Size,
+		Type:      upload.contentType,
+		Size:      upload.size,
 		S3Key:     s3Key, // stored so we can delete later
+		SHA256:    upload.sha256,
 	}
+	s.initPreview(ctx, att)
 
 	if err := s.repo.Create(ctx, att); err != nil {
-		// DB write failed after a successful S3 upload.
-		// Attempt to clean up the orphaned S3 object.
-		s.log.Error("DB write failed after S3 upload – attempting S3 rollback",
+		// DB write failed after the blob was referenced; give the reference
+		// back, which removes the object if nobody else uses it.
+		s.log.Error("DB write failed after S3 upload – releasing blob",
 			zap.String("key", s3Key),
 			zap.Error(err),
 		)
-		if delErr := s.s3Client.Delete(ctx, s3Key); delErr != nil {
-			s.log.Error("S3 rollback also failed – orphaned object",
-				zap.String("key", s3Key),
-				zap.Error(delErr),
-			)
-		}
+		s.releaseBlob(ctx, upload.sha256)
 		return nil, "", fmt.Errorf("saving attachment metadata: %w", err)
 	}
 
@@ -108,5 +160,258 @@ func (s *AttachmentService) Create(ctx context.Context, in FileUploadInput) (*en
 		zap.String("s3Key", s3Key),
 		zap.Int64("size", att.Size),
 	)
-	return att, uploadOut.PresignedURL, nil
+
+	if att.PreviewStatus == entities.PreviewPending {
+		s.previewSvc.Enqueue(att.ID)
+	}
+
+	url, _, err := s.URLs(ctx, att)
+	if err != nil {
+		return nil, "", err
+	}
+	return att, url, nil
 }
+
+// Purge permanently deletes an attachment. Its object and preview are
+// removed from S3 only when no other attachment references the same blob.
+func (s *AttachmentService) Purge(ctx context.Context, id string) error {
+	att, err := s.repo.FindUnscopedByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("finding attachment: %w", err)
+	}
+
+	// Delete the row before releasing: if the release then fails the blob
+	// leaks (recoverable) instead of being deleted while still referenced.
+	if err := s.repo.HardDelete(ctx, id); err != nil {
+		return fmt.Errorf("purging attachment: %w", err)
+	}
+
+	if att.SHA256 == "" {
+		// Uploaded before deduplication: the object belongs to this row alone.
+		if err := s.deleteObjects(ctx, att.S3Key); err != nil {
+			return fmt.Errorf("deleting attachment objects: %w", err)
+		}
+		return nil
+	}
+
+	remaining, err := s.blobRepo.Release(ctx, att.SHA256, func(b *entities.Blob) error {
+		return s.deleteObjects(ctx, b.S3Key)
+	})
+	if err != nil {
+		return fmt.Errorf("releasing blob: %w", err)
+	}
+
+	s.log.Info("attachment purged",
+		zap.String("attachmentID", id),
+		zap.String("sha256", att.SHA256),
+		zap.Int64("remainingRefs", remaining),
+	)
+	return nil
+}
+
+// initPreview reuses a preview already rendered for the same blob, or
+// marks the attachment pending when its type can be previewed.
+func (s *AttachmentService) initPreview(ctx context.Context, att *entities.Attachment) {
+	att.PreviewStatus = entities.PreviewNone
+	if !s.previewSvc.Supports(att.Type) {
+		return
+	}
+
+	if sibling, err := s.repo.FindPreviewedByHash(ctx, att.SHA256); err == nil {
+		att.PreviewStatus = entities.PreviewReady
+		att.PreviewKey = sibling.PreviewKey
+		att.Width = sibling.Width
+		att.Height = sibling.Height
+		att.PageCount = sibling.PageCount
+		return
+	}
+	att.PreviewStatus = entities.PreviewPending
+}
+
+// releaseBlob is the rollback path for Create; failures are only logged
+// because the caller is already returning an error.
+func (s *AttachmentService) releaseBlob(ctx context.Context, hash string) {
+	_, err := s.blobRepo.Release(ctx, hash, func(b *entities.Blob) error {
+		return s.deleteObjects(ctx, b.S3Key)
+	})
+	if err != nil {
+		s.log.Error("blob release failed – possible orphaned object",
+			zap.String("sha256", hash),
+			zap.Error(err),
+		)
+	}
+}
+
+// deleteObjects removes an original and its derived preview.
+func (s *AttachmentService) deleteObjects(ctx context.Context, key string) error {
+	if err := s.s3Client.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.s3Client.Delete(ctx, previewKey(key))
+}
+
+func (s *AttachmentService) GetByID(ctx context.Context, id string) (*entities.Attachment, error) {
+	att, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving attachment: %w", err)
+	}
+	return att, nil
+}
+
+// Open streams an attachment's content, or its preview when preview is
+// set, decrypting it if needed. The caller must close the reader.
+func (s *AttachmentService) Open(ctx context.Context, att *entities.Attachment, preview bool) (io.ReadCloser, error) {
+	key := att.S3Key
+	if preview {
+		if att.PreviewStatus != entities.PreviewReady || att.PreviewKey == "" {
+			return nil, ErrPreviewNotReady
+		}
+		key = att.PreviewKey
+	}
+
+	body, err := s.s3Client.Download(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("downloading attachment: %w", err)
+	}
+	return body, nil
+}
+
+func (s *AttachmentService) ListByNoteID(ctx context.Context, noteID string) ([]entities.Attachment, error) {
+	attachments, err := s.repo.FindByNoteID(ctx, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("listing attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// URLs returns links for the attachment and, once generated, its preview
+// thumbnail: pre-signed S3 links, or API paths when storage is encrypted.
+func (s *AttachmentService) URLs(ctx context.Context, att *entities.Attachment) (url, previewURL string, err error) {
+	// Encrypted objects are ciphertext in the bucket, so clients fetch them
+	// through the API, which decrypts on the fly.
+	if s.s3Client.Encrypted() {
+		url = "/api/v1/attachments/" + att.ID + "/content"
+		if att.PreviewStatus == entities.PreviewReady && att.PreviewKey != "" {
+			previewURL = "/api/v1/attachments/" + att.ID + "/preview"
+		}
+		return url, previewURL, nil
+	}
+
+	url, err = s.s3Client.PresignURL(ctx, att.S3Key, 0)
+	if err != nil {
+		return "", "", fmt.Errorf("presigning attachment: %w", err)
+	}
+
+	if att.PreviewStatus == entities.PreviewReady && att.PreviewKey != "" {
+		previewURL, err = s.s3Client.PresignURL(ctx, att.PreviewKey, 0)
+		if err != nil {
+			return "", "", fmt.Errorf("presigning preview: %w", err)
+		}
+	}
+	return url, previewURL, nil
+}
+
+// inspect enforces size limits and the type allowlist and hashes the
+// content. The MIME type comes from the file's magic bytes; the client's
+// Content-Type header is ignored. The file is rewound afterwards so it can be
+// read again for the upload.
+func (s *AttachmentService) inspect(ctx context.Context, in FileUploadInput) (*inspectedUpload, error) {
+	allowed, ok := s.cfg.AllowedTypes[in.Use]
+	if !ok {
+		return nil, fmt.Errorf("unknown attachment use %q", in.Use)
+	}
+
+	size := in.FileHeader.Size
+	if size <= 0 {
+		return nil, ErrAttachmentEmpty
+	}
+	if s.cfg.MaxFileSize > 0 && size > s.cfg.MaxFileSize {
+		s.log.Warn("attachment rejected: too large",
+			zap.String("noteID", in.NoteID),
+			zap.Int64("size", size),
+			zap.Int64("limit", s.cfg.MaxFileSize),
+		)
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrAttachmentTooLarge, size, s.cfg.MaxFileSize)
+	}
+
+	if s.cfg.MaxNoteSize > 0 {
+		used, err := s.repo.SumSizeByNoteID(ctx, in.NoteID)
+		if err != nil {
+			return nil, fmt.Errorf("checking note attachment quota: %w", err)
+		}
+		if used+size > s.cfg.MaxNoteSize {
+			s.log.Warn("attachment rejected: note quota exceeded",
+				zap.String("noteID", in.NoteID),
+				zap.Int64("used", used),
+				zap.Int64("size", size),
+				zap.Int64("limit", s.cfg.MaxNoteSize),
+			)
+			return nil, fmt.Errorf("%w: %d of %d bytes already used", ErrNoteQuotaExceeded, used, s.cfg.MaxNoteSize)
+		}
+	}
+
+	// One pass over the file: sniff the header and hash everything.
+	hasher := sha256.New()
+	detected, err := mimetype.DetectReader(io.TeeReader(in.File, hasher))
+	if err != nil {
+		return nil, fmt.Errorf("detecting attachment type: %w", err)
+	}
+	if _, err := io.Copy(hasher, in.File); err != nil {
+		return nil, fmt.Errorf("hashing attachment: %w", err)
+	}
+	if _, err := in.File.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding attachment: %w", err)
+	}
+
+	if !mimeAllowed(detected, allowed) {
+		s.log.Warn("attachment rejected: type not allowed",
+			zap.String("noteID", in.NoteID),
+			zap.String("detected", detected.String()),
+			zap.String("claimed", in.FileHeader.Header.Get("Content-Type")),
+		)
+		return nil, fmt.Errorf("%w: %s", ErrAttachmentTypeNotAllowed, detected.String())
+	}
+
+	return &inspectedUpload{
+		contentType: detected.String(),
+		safeName:    utils.SanitizeFilename(in.FileHeader.Filename, "file"+detected.Extension()),
+		size:        size,
+		sha256:      hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// blobKey is the content-addressed S3 key for a SHA-256 digest.
+func blobKey(hash string) string {
+	return fmt.Sprintf("attachments/sha256/%s/%s", hash[:2], hash)
+}
+
+// mimeAllowed reports whether the detected type, or any type it specialises
+// (e.g. text/csv → text/plain), matches an allowlist entry. Entries of the
+// form "type/*" match every subtype.
+func mimeAllowed(detected *mimetype.MIME, allowed []string) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		base, _, _ := strings.Cut(m.String(), ";")
+		for _, a := range allowed {
+			if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+				if strings.HasPrefix(base, prefix+"/") {
+					return true
+				}
+				continue
+			}
+			if m.Is(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upload rejections. Each is wrapped with details, so match with errors.Is.
+var (
+	ErrAttachmentEmpty          = errors.New("attachment is empty")
+	ErrAttachmentTooLarge       = errors.New("attachment exceeds the maximum file size")
+	ErrAttachmentTypeNotAllowed = errors.New("attachment type is not allowed")
+	ErrNoteQuotaExceeded        = errors.New("note attachment quota exceeded")
+)
+
+var ErrPreviewNotReady = errors.New("attachment preview is not available")
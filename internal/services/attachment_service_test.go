@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/preview"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+)
+
+// s3Stub answers the PutObject and DeleteObject calls of storage.Client,
+// recording their keys. Puts are refused while failPuts is set.
+type s3Stub struct {
+	mu       sync.Mutex
+	failPuts bool
+	puts     []string
+	deletes  []string
+	// onDelete, if set, is also told of each delete.
+	onDelete func(key string)
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if s.failPuts {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`)
+			return
+		}
+		s.puts = append(s.puts, key)
+		w.Header().Set("ETag", `"stub"`)
+	case http.MethodDelete:
+		s.deletes = append(s.deletes, key)
+		if s.onDelete != nil {
+			s.onDelete(key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+const attachmentContent = "Referral letter: please assess lower back pain.\n"
+
+func attachmentHash() string {
+	sum := sha256.Sum256([]byte(attachmentContent))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAttachmentFixture(t *testing.T, blobs *fakeBlobRepo) (*AttachmentService, *fakeAttachmentRepo, *s3Stub) {
+	t.Helper()
+	stub := &s3Stub{}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	log := zap.NewNop()
+	s3, err := storage.NewClient(context.Background(), "us-east-1", "key", "secret", "bucket", srv.URL, time.Minute, log)
+	if err != nil {
+		t.Fatalf("storage.NewClient: %v", err)
+	}
+	attachments := &fakeAttachmentRepo{}
+	previews := NewPreviewService(attachments, s3, preview.NewGenerator(256, "", ""), nil, log)
+	cfg := config.AttachmentConfig{AllowedTypes: map[string][]string{"message": {"text/plain"}}}
+	return NewAttachmentService(attachments, blobs, s3, previews, cfg, log), attachments, stub
+}
+
+// upload returns attachmentContent as a message attachment, parsed the way
+// a request's multipart form is.
+func upload(t *testing.T) FileUploadInput {
+	t.Helper()
+	return uploadFile(t, "referral.txt", "text/plain", attachmentContent)
+}
+
+// uploadFile returns content as a message attachment with the filename and
+// Content-Type the client claimed.
+func uploadFile(t *testing.T, filename, contentType, content string) FileUploadInput {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachment"; filename=%q`, filename))
+	h.Set("Content-Type", contentType)
+	fw, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(fw, content)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = form.RemoveAll() })
+	header := form.File["attachment"][0]
+	f, err := header.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return FileUploadInput{NoteID: uuid.NewString(), MessageID: uuid.NewString(), Use: AttachmentUseMessage, File: f, FileHeader: header}
+}
+
+func TestCreateReusesUploadedBlob(t *testing.T) {
+	hash := attachmentHash()
+	blobs := newFakeBlobRepo(entities.Blob{Hash: hash, S3Key: blobKey(hash), RefCount: 1, Status: entities.BlobUploaded})
+	svc, attachments, stub := newAttachmentFixture(t, blobs)
+
+	att, _, err := svc.Create(context.Background(), upload(t))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if len(stub.puts) != 0 {
+		t.Errorf("uploaded %v, want the existing object reused", stub.puts)
+	}
+	if att.S3Key != blobKey(hash) || len(attachments.attachments) != 1 {
+		t.Errorf("attachment not recorded against the blob: %+v", att)
+	}
+	if b := blobs.blobs[hash]; b.RefCount != 2 {
+		t.Errorf("refCount = %d, want 2", b.RefCount)
+	}
+}
+
+func TestCreateUploadsOverPendingBlob(t *testing.T) {
+	// Another request has referenced the blob but not finished uploading it.
+	hash := attachmentHash()
+	blobs := newFakeBlobRepo(entities.Blob{Hash: hash, S3Key: blobKey(hash), RefCount: 1, Status: entities.BlobPending})
+	svc, _, stub := newAttachmentFixture(t, blobs)
+
+	if _, _, err := svc.Create(context.Background(), upload(t)); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if len(stub.puts) != 1 || stub.puts[0] != blobKey(hash) {
+		t.Errorf("puts = %v, want the object uploaded to %s", stub.puts, blobKey(hash))
+	}
+	b := blobs.blobs[hash]
+	if b.Status != entities.BlobUploaded {
+		t.Errorf("status = %q, want uploaded", b.Status)
+	}
+	if b.RefCount != 2 {
+		t.Errorf("refCount = %d, want 2", b.RefCount)
+	}
+}
+
+func TestCreateReleasesBlobWhenUploadFails(t *testing.T) {
+	hash := attachmentHash()
+
+	t.Run("new blob", func(t *testing.T) {
+		blobs := newFakeBlobRepo()
+		svc, attachments, stub := newAttachmentFixture(t, blobs)
+		stub.failPuts = true
+
+		if _, _, err := svc.Create(context.Background(), upload(t)); err == nil {
+			t.Fatal("Create succeeded despite the failed upload")
+		}
+		if b, ok := blobs.blobs[hash]; ok {
+			t.Errorf("blob kept after failed upload: %+v", b)
+		}
+		if len(attachments.attachments) != 0 {
+			t.Errorf("attachment recorded for a failed upload: %+v", attachments.attachments)
+		}
+	})
+
+	t.Run("blob pending for another request", func(t *testing.T) {
+		blobs := newFakeBlobRepo(entities.Blob{Hash: hash, S3Key: blobKey(hash), RefCount: 1, Status: entities.BlobPending})
+		svc, _, stub := newAttachmentFixture(t, blobs)
+		stub.failPuts = true
+
+		if _, _, err := svc.Create(context.Background(), upload(t)); err == nil {
+			t.Fatal("Create succeeded despite the failed upload")
+		}
+		b, ok := blobs.blobs[hash]
+		if !ok || b.RefCount != 1 || b.Status != entities.BlobPending {
+			t.Errorf("blob = %+v, want the other request's pending reference left alone", b)
+		}
+		if len(stub.deletes) != 0 {
+			t.Errorf("deleted %v while another request still references the blob", stub.deletes)
+		}
+	})
+}
+
+// pngHeader is enough of a PNG for it to be detected as one.
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestMimeAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		allowed []string
+		want    bool
+	}{
+		{"exact", attachmentContent, []string{"application/pdf", "text/plain"}, true},
+		{"subtype of an allowed type", "name,age\nPat,42\nSam,37\n", []string{"text/plain"}, true},
+		{"wildcard", pngHeader, []string{"image/*"}, true},
+		{"wildcard over a parent", "name,age\nPat,42\nSam,37\n", []string{"text/*"}, true},
+		{"other subtype", pngHeader, []string{"image/jpeg"}, false},
+		{"other type under wildcard", pngHeader, []string{"text/*"}, false},
+		{"wildcard is not a prefix match", attachmentContent, []string{"tex/*"}, false},
+		{"parent does not allow its subtypes", attachmentContent, []string{"text/csv"}, false},
+		{"unknown binary", "\x00\x01\x02\x03\xff\xfe", []string{"image/*", "text/plain"}, false},
+		{"nothing allowed", attachmentContent, nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			detected := mimetype.Detect([]byte(tc.content))
+			if got := mimeAllowed(detected, tc.allowed); got != tc.want {
+				t.Errorf("mimeAllowed(%s, %q) = %v, want %v", detected, tc.allowed, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	svc, attachments, _ := newAttachmentFixture(t, newFakeBlobRepo())
+	svc.cfg.MaxFileSize = 64
+	svc.cfg.MaxNoteSize = 100
+
+	for _, tc := range []struct {
+		name     string
+		in       func(t *testing.T) FileUploadInput
+		wantErr  error
+		wantType string
+		wantName string
+	}{
+		{"claimed type ignored", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, "scan.png", "image/png", attachmentContent)
+		}, nil, "text/plain; charset=utf-8", "scan.png"},
+		{"disguised as text", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, "notes.txt", "text/plain", pngHeader)
+		}, ErrAttachmentTypeNotAllowed, "", ""},
+		{"empty", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, "empty.txt", "text/plain", "")
+		}, ErrAttachmentEmpty, "", ""},
+		{"too large", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, "long.txt", "text/plain", strings.Repeat("a", 65))
+		}, ErrAttachmentTooLarge, "", ""},
+		{"note quota used up", func(t *testing.T) FileUploadInput {
+			in := upload(t)
+			attachments.attachments = append(attachments.attachments, &entities.Attachment{ID: uuid.NewString(), NoteID: in.NoteID, Size: 60})
+			return in
+		}, ErrNoteQuotaExceeded, "", ""},
+		{"unsafe name", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, `..\..\etc\passwd`, "text/plain", attachmentContent)
+		}, nil, "text/plain; charset=utf-8", "passwd"},
+		{"no usable name", func(t *testing.T) FileUploadInput {
+			return uploadFile(t, "...", "text/plain", attachmentContent)
+		}, nil, "text/plain; charset=utf-8", "file.txt"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.in(t)
+			got, err := svc.inspect(context.Background(), in)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("inspect: err = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.contentType != tc.wantType || got.safeName != tc.wantName {
+				t.Errorf("type %q, name %q; want %q, %q", got.contentType, got.safeName, tc.wantType, tc.wantName)
+			}
+			if got.sha256 != attachmentHash() || got.size != int64(len(attachmentContent)) {
+				t.Errorf("hash %s of %d bytes, want %s of %d", got.sha256, got.size, attachmentHash(), len(attachmentContent))
+			}
+			// The upload reads the file again from the start.
+			if rest, _ := io.ReadAll(in.File); string(rest) != attachmentContent {
+				t.Errorf("file not rewound: %d bytes left", len(rest))
+			}
+		})
+	}
+}
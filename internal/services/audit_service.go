@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+const (
+	// auditExportBatch is how many events Export reads per query.
+	auditExportBatch = 500
+	// maxAuditResourceID is the width of audit_events.resource_id.
+	maxAuditResourceID = 100
+)
+
+// AuditService records who did what, to the tamper-evident audit log. The
+// actor is taken from the context, see authz.WithActor.
+type AuditService struct {
+	repo repositories.AuditRepository
+	log  *zap.Logger
+}
+
+func NewAuditService(repo repositories.AuditRepository, log *zap.Logger) *AuditService {
+	return &AuditService{repo: repo, log: log.Named("audit_service")}
+}
+
+// Record writes an audit event for action on a resource.
+func (s *AuditService) Record(ctx context.Context, action, resourceType, resourceID string, details map[string]any) error {
+	return s.RecordEvent(ctx, &entities.AuditEvent{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      details,
+	})
+}
+
+// RecordEvent appends e, filling in the actor from the context. Events
+// about a note, or anything under one (a "noteId" detail), are attributed
+// to its patient when e does not name one.
+func (s *AuditService) RecordEvent(ctx context.Context, e *entities.AuditEvent) error {
+	if a, ok := authz.ActorFrom(ctx); ok {
+		if a.UserID != "" {
+			e.ActorID = &a.UserID
+		}
+		if a.ImpersonatorID != "" {
+			e.ImpersonatorID = &a.ImpersonatorID
+		}
+		if a.OrgID != "" {
+			e.OrganizationID = &a.OrgID
+		}
+	}
+	// IDs may come straight from the request; keep the event storable.
+	if e.PatientID != nil && uuid.Validate(*e.PatientID) != nil {
+		e.PatientID = nil
+	}
+	if len(e.ResourceID) > maxAuditResourceID {
+		e.ResourceID = strings.ToValidUTF8(e.ResourceID[:maxAuditResourceID], "")
+	}
+	if e.PatientID == nil {
+		e.PatientID = s.patientOf(ctx, e)
+	}
+
+	if err := s.repo.Append(ctx, e); err != nil {
+		return fmt.Errorf("recording audit event: %w", err)
+	}
+
+	s.log.Debug("audit event recorded", zap.String("action", e.Action), zap.String("resourceID", e.ResourceID), zap.Int64("seq", e.Seq))
+	return nil
+}
+
+func (s *AuditService) patientOf(ctx context.Context, e *entities.AuditEvent) *string {
+	resourceType, id := e.ResourceType, e.ResourceID
+	if noteID, ok := e.Details["noteId"].(string); ok && noteID != "" {
+		resourceType, id = "note", noteID
+	}
+	if resourceType != "note" && resourceType != "attachment" {
+		return nil
+	}
+	if uuid.Validate(id) != nil {
+		return nil
+	}
+
+	patientID, err := s.repo.PatientOf(ctx, resourceType, id)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrNotFound) {
+			s.log.Warn("resolving audited patient failed", zap.String("resourceType", resourceType), zap.String("id", id), zap.Error(err))
+		}
+		return nil
+	}
+	return &patientID
+}
+
+// List returns matching events, newest first.
+func (s *AuditService) List(ctx context.Context, filter repositories.AuditFilter, offset, limit int) ([]entities.AuditEvent, int64, error) {
+	return s.repo.List(ctx, filter, offset, limit)
+}
+
+// Export passes matching events to fn in chain order, reading them in
+// batches so exports of any size run in constant memory.
+func (s *AuditService) Export(ctx context.Context, filter repositories.AuditFilter, fn func(*entities.AuditEvent) error) error {
+	var after int64
+	for {
+		events, err := s.repo.ListAfter(ctx, filter, after, auditExportBatch)
+		if err != nil {
+			return fmt.Errorf("reading audit events: %w", err)
+		}
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+		if len(events) < auditExportBatch {
+			return nil
+		}
+		after = events[len(events)-1].Seq
+	}
+}
@@ -104,8 +104,6 @@ func buildAIConversation(messages []entities.Message) []open_ai_client.Message {
 }
 
 func (s *ConversationService) SendMessage(ctx context.Context, in SendMessageInput) (*entities.Message, error) {
-	var presignedURL string
-
 	offset := 1
 	limit := 0
 	currentConversation, err := s.GetByNoteID(ctx, in.NoteID, &offset, &limit)
@@ -118,6 +116,19 @@ func (s *ConversationService) SendMessage(ctx context.Context, in SendMessageInp
 		return nil, fmt.Errorf("retrieving note: %w", err)
 	}
 
+	// Reject a bad attachment before anything is written
+	if in.File != nil && in.FileHeader != nil {
+		err = s.attachmentSvc.Validate(ctx, FileUploadInput{
+			NoteID:     in.NoteID,
+			Use:        AttachmentUseMessage,
+			File:       in.File,
+			FileHeader: in.FileHeader,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("validating attachment: %w", err)
+		}
+	}
+
 	// Save user message
 	userMsgIn := CreateMessageInput{
 		ConversationID: currentConversation.ID,
@@ -137,6 +148,7 @@ func (s *ConversationService) SendMessage(ctx context.Context, in SendMessageInp
 		attachmentIn := FileUploadInput{
 			NoteID:     in.NoteID,
 			MessageID:  userMsg.ID,
+			Use:        AttachmentUseMessage,
 			File:       in.File,
 			FileHeader: in.FileHeader,
 		}
@@ -145,7 +157,7 @@ func (s *ConversationService) SendMessage(ctx context.Context, in SendMessageInp
 		if err != nil {
 			return nil, fmt.Errorf("creating attachment: %w", err)
 		}
-		s.log.Info("attachment saved", zap.String("presignedURL", presignedURL))
+		s.log.Info("attachment saved", zap.String("messageID", userMsg.ID))
 	}
 
 	// Send message to AI
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+// In-memory repositories for service tests. Each embeds its interface, so
+// calling a method a test did not expect panics on the nil embedded value.
+
+type fakeUserRepo struct {
+	repositories.UserRepository
+	mu    sync.Mutex
+	users map[string]*entities.User
+}
+
+func newFakeUserRepo(users ...*entities.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: map[string]*entities.User{}}
+	for _, u := range users {
+		if u.ID == "" {
+			u.ID = uuid.NewString()
+		}
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *fakeUserRepo) Create(_ context.Context, user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(_ context.Context, id string) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeUserRepo) FindByEmail(_ context.Context, email string) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeUserRepo) Update(_ context.Context, user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.ID != user.ID && u.Email == user.Email {
+			return repositories.ErrDuplicateKey
+		}
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+type fakeSessionRepo struct {
+	repositories.SessionRepository
+	mu      sync.Mutex
+	revoked map[string]string // user ID to reason
+}
+
+func (r *fakeSessionRepo) RevokeAllForUser(_ context.Context, userID, reason string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.revoked == nil {
+		r.revoked = map[string]string{}
+	}
+	r.revoked[userID] = reason
+	return 1, nil
+}
+
+type fakeOrgRepo struct {
+	repositories.OrganizationRepository
+	mu          sync.Mutex
+	memberships []entities.Membership
+}
+
+func (r *fakeOrgRepo) AddMember(_ context.Context, m *entities.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.memberships {
+		if existing.OrganizationID == m.OrganizationID && existing.UserID == m.UserID {
+			return nil
+		}
+	}
+	r.memberships = append(r.memberships, *m)
+	return nil
+}
+
+func (r *fakeOrgRepo) FindMembership(_ context.Context, orgID, userID string) (*entities.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.memberships {
+		if m.OrganizationID == orgID && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeOrgRepo) ListByUserID(_ context.Context, userID string) ([]entities.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []entities.Membership
+	for _, m := range r.memberships {
+		if m.UserID == userID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+type fakeInvitationRepo struct {
+	repositories.InvitationRepository
+	invitations []*entities.Invitation
+}
+
+func (r *fakeInvitationRepo) FindByTokenID(_ context.Context, tokenID string) (*entities.Invitation, error) {
+	for _, inv := range r.invitations {
+		if inv.TokenID == tokenID {
+			return inv, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeInvitationRepo) Accept(_ context.Context, id, userID string, at time.Time) (bool, error) {
+	for _, inv := range r.invitations {
+		if inv.ID == id && inv.AcceptedAt == nil && inv.RevokedAt == nil {
+			inv.AcceptedAt, inv.AcceptedBy = &at, &userID
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeThrottleRepo struct {
+	repositories.LoginThrottleRepository
+	mu        sync.Mutex
+	throttles map[string]*entities.LoginThrottle
+}
+
+func (r *fakeThrottleRepo) Find(_ context.Context, key string) (*entities.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.throttles[key]; ok {
+		return t, nil
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeThrottleRepo) RecordFailure(_ context.Context, key string, now, windowStart time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.throttles == nil {
+		r.throttles = map[string]*entities.LoginThrottle{}
+	}
+	t, ok := r.throttles[key]
+	if !ok || t.LastFailureAt.Before(windowStart) {
+		t = &entities.LoginThrottle{Key: key}
+		r.throttles[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	return t.Failures, nil
+}
+
+func (r *fakeThrottleRepo) Lock(_ context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeThrottleRepo) Clear(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttles, key)
+	return nil
+}
+
+type fakeRecoveryRepo struct {
+	repositories.RecoveryCodeRepository
+}
+
+func (fakeRecoveryRepo) Consume(context.Context, string, string) error {
+	return repositories.ErrNotFound
+}
+
+type fakeBlobRepo struct {
+	repositories.BlobRepository
+	mu    sync.Mutex
+	blobs map[string]*entities.Blob
+}
+
+func newFakeBlobRepo(blobs ...entities.Blob) *fakeBlobRepo {
+	r := &fakeBlobRepo{blobs: map[string]*entities.Blob{}}
+	for i := range blobs {
+		r.blobs[blobs[i].Hash] = &blobs[i]
+	}
+	return r
+}
+
+func (r *fakeBlobRepo) Acquire(_ context.Context, blob *entities.Blob) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.blobs[blob.Hash]
+	if !ok {
+		b = &entities.Blob{Hash: blob.Hash, S3Key: blob.S3Key, Type: blob.Type, Size: blob.Size, Status: entities.BlobPending}
+		r.blobs[blob.Hash] = b
+	}
+	b.RefCount++
+	blob.RefCount, blob.Status = b.RefCount, b.Status
+	return b.RefCount, nil
+}
+
+func (r *fakeBlobRepo) MarkUploaded(_ context.Context, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blobs[hash].Status = entities.BlobUploaded
+	return nil
+}
+
+func (r *fakeBlobRepo) Release(_ context.Context, hash string, onLast func(*entities.Blob) error) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.blobs[hash]
+	if !ok {
+		return 0, repositories.ErrNotFound
+	}
+	if b.RefCount > 1 {
+		b.RefCount--
+		return b.RefCount, nil
+	}
+	if err := onLast(b); err != nil {
+		return 0, err
+	}
+	delete(r.blobs, hash)
+	return 0, nil
+}
+
+type fakeAttachmentRepo struct {
+	repositories.AttachmentRepository
+	mu          sync.Mutex
+	attachments []*entities.Attachment
+}
+
+func (r *fakeAttachmentRepo) Create(_ context.Context, a *entities.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a.ID == "" {
+		a.ID = uuid.NewString()
+	}
+	r.attachments = append(r.attachments, a)
+	return nil
+}
+
+func (r *fakeAttachmentRepo) FindUnscopedByID(_ context.Context, id string) (*entities.Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.attachments {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeAttachmentRepo) HardDelete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.attachments {
+		if a.ID == id {
+			r.attachments = append(r.attachments[:i], r.attachments[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+func (r *fakeAttachmentRepo) SumSizeByNoteID(_ context.Context, noteID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for _, a := range r.attachments {
+		if a.NoteID == noteID {
+			total += a.Size
+		}
+	}
+	return total, nil
+}
+
+type fakeAuditRepo struct {
+	repositories.AuditRepository
+	mu     sync.Mutex
+	events []*entities.AuditEvent
+}
+
+func (r *fakeAuditRepo) Append(_ context.Context, e *entities.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	r.events = append(r.events, e)
+	return nil
+}
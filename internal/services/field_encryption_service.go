@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"go.uber.org/zap"
+)
+
+// reencryptBatchSize bounds the rows rewritten per query.
+const reencryptBatchSize = 200
+
+// FieldEncryptionService brings encrypted columns up to date with the
+// active key after encryption is enabled or a key is rotated. A retired key
+// can be removed from the key file once a run reports nothing left to do.
+type FieldEncryptionService struct {
+	repo repositories.FieldEncryptionRepository
+	log  *zap.Logger
+}
+
+func NewFieldEncryptionService(repo repositories.FieldEncryptionRepository, log *zap.Logger) *FieldEncryptionService {
+	return &FieldEncryptionService{
+		repo: repo,
+		log:  log.Named("field_encryption_service"),
+	}
+}
+
+// Reencrypt rewrites every stale row of the tables with encrypted columns.
+func (s *FieldEncryptionService) Reencrypt(ctx context.Context) error {
+	models := []any{&entities.Patient{}, &entities.Note{}, &entities.Message{}}
+	for _, model := range models {
+		total := 0
+		for {
+			n, err := s.repo.Reencrypt(ctx, model, reencryptBatchSize)
+			total += n
+			if err != nil {
+				return fmt.Errorf("re-encrypting %T: %w", model, err)
+			}
+			if n < reencryptBatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+		if total > 0 {
+			s.log.Info("fields re-encrypted", zap.String("model", fmt.Sprintf("%T", model)), zap.Int("rows", total))
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+	"github.com/jamesphm04/splose-clone-be/pkg/mailer"
+)
+
+type InviteInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role"  validate:"required"`
+}
+
+// AcceptInvitationInput redeems an invitation. Someone without an account
+// picks a username and password; someone with one confirms their password.
+type AcceptInvitationInput struct {
+	Token    string `json:"token"    validate:"required"`
+	Username string `json:"username" validate:"omitempty,min=3,max=50"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+// AcceptSignedInInput redeems an invitation for the signed-in user.
+type AcceptSignedInInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// InvitationService lets clinic staff bring colleagues into their
+// organisation. Invitations are listed and managed within the actor's
+// organisation; accepting one happens before sign-in.
+type InvitationService struct {
+	repo       repositories.InvitationRepository
+	userRepo   repositories.UserRepository
+	orgRepo    repositories.OrganizationRepository
+	guard      *LoginGuard
+	jwtManager *auth.Manager
+	mailer     mailer.Mailer
+	mailQueue  *jobs.Queue
+	cfg        config.AuthConfig
+	bcryptCost int
+	log        *zap.Logger
+}
+
+func NewInvitationService(
+	repo repositories.InvitationRepository,
+	userRepo repositories.UserRepository,
+	orgRepo repositories.OrganizationRepository,
+	guard *LoginGuard,
+	jwtManager *auth.Manager,
+	m mailer.Mailer,
+	mailQueue *jobs.Queue,
+	cfg config.AuthConfig,
+	bcryptCost int,
+	log *zap.Logger,
+) *InvitationService {
+	return &InvitationService{
+		repo:       repo,
+		userRepo:   userRepo,
+		orgRepo:    orgRepo,
+		guard:      guard,
+		jwtManager: jwtManager,
+		mailer:     m,
+		mailQueue:  mailQueue,
+		cfg:        cfg,
+		bcryptCost: bcryptCost,
+		log:        log.Named("invitation_service"),
+	}
+}
+
+// Invite emails an invitation to join orgID with a role the inviter can
+// manage.
+func (s *InvitationService) Invite(ctx context.Context, inviterID, inviterRole, orgID string, in InviteInput) (*entities.Invitation, error) {
+	if orgID == "" {
+		return nil, ErrNoOrganization
+	}
+	if !authz.ValidRole(in.Role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, in.Role)
+	}
+	if !authz.CanManage(inviterRole, in.Role) {
+		return nil, authz.ErrForbidden
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, in.Email)
+	switch {
+	case err == nil:
+		member, err := s.orgRepo.IsMember(ctx, orgID, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("checking membership: %w", err)
+		}
+		if member {
+			return nil, ErrAlreadyMember
+		}
+	case !errors.Is(err, repositories.ErrNotFound):
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+
+	if _, err := s.repo.FindPending(ctx, orgID, in.Email); err == nil {
+		return nil, ErrInvitationPending
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+
+	inv := &entities.Invitation{
+		OrganizationID: orgID,
+		Email:          in.Email,
+		Role:           in.Role,
+		InvitedBy:      inviterID,
+	}
+	token := s.renew(inv)
+	if err := s.repo.Create(ctx, inv); err != nil {
+		return nil, fmt.Errorf("creating invitation: %w", err)
+	}
+	if err := s.send(ctx, inv, token); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("invitation sent", zap.String("invitationID", inv.ID), zap.String("organizationID", orgID), zap.String("role", inv.Role))
+	return inv, nil
+}
+
+func (s *InvitationService) List(ctx context.Context, offset, limit int) ([]entities.Invitation, int64, error) {
+	return s.repo.List(ctx, offset, limit)
+}
+
+// Resend emails a fresh link with a new expiry. Earlier links stop
+// working.
+func (s *InvitationService) Resend(ctx context.Context, actorRole, id string) (*entities.Invitation, error) {
+	inv, err := s.find(ctx, actorRole, id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return nil, ErrInvitationClosed
+	}
+
+	token := s.renew(inv)
+	if err := s.repo.Update(ctx, inv); err != nil {
+		return nil, fmt.Errorf("renewing invitation: %w", err)
+	}
+	if err := s.send(ctx, inv, token); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("invitation resent", zap.String("invitationID", inv.ID))
+	return inv, nil
+}
+
+// Revoke withdraws an invitation that has not been accepted.
+func (s *InvitationService) Revoke(ctx context.Context, actorRole, id string) error {
+	inv, err := s.find(ctx, actorRole, id)
+	if err != nil {
+		return err
+	}
+	if inv.AcceptedAt != nil {
+		return ErrInvitationClosed
+	}
+	if inv.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	inv.RevokedAt = &now
+	if err := s.repo.Update(ctx, inv); err != nil {
+		return fmt.Errorf("revoking invitation: %w", err)
+	}
+
+	s.log.Info("invitation revoked", zap.String("invitationID", inv.ID))
+	return nil
+}
+
+// Accept redeems an invitation token and returns the member, who joins
+// the organisation with the invited role. A new user is created with a
+// verified email, since the token arrived in that mailbox. An existing user
+// must confirm their password, throttled like a login; their roles in
+// other organisations are unchanged. Users without a password, who sign in
+// through single sign-on, accept with AcceptSignedIn instead.
+func (s *InvitationService) Accept(ctx context.Context, in AcceptInvitationInput, client ClientInfo) (*entities.User, error) {
+	inv, err := s.pending(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, inv.Email)
+	switch {
+	case err == nil:
+		if err := s.checkPassword(ctx, user, in.Password, client); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, repositories.ErrNotFound):
+		if user, err = s.createUser(ctx, inv, in); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+
+	if err := s.admit(ctx, inv, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AcceptSignedIn redeems an invitation for the signed-in user userID,
+// whose verified email must be the one invited.
+func (s *InvitationService) AcceptSignedIn(ctx context.Context, userID string, in AcceptSignedInInput) (*entities.User, error) {
+	inv, err := s.pending(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	// Reported like a bad token: whoever holds it learns nothing.
+	if !strings.EqualFold(user.Email, inv.Email) || user.EmailVerifiedAt == nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	if err := s.admit(ctx, inv, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// pending returns the invitation a token redeems, if it is still open.
+func (s *InvitationService) pending(ctx context.Context, token string) (*entities.Invitation, error) {
+	claims, err := s.jwtManager.Parse(token)
+	if err != nil || claims.TokenType != auth.InvitationToken {
+		return nil, ErrInvalidInvitation
+	}
+	inv, err := s.repo.FindByTokenID(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if !inv.Pending(time.Now().UTC()) {
+		return nil, ErrInvalidInvitation
+	}
+	return inv, nil
+}
+
+// checkPassword confirms an existing user's password through the login
+// guard, so an invitation token is no way around its lockouts.
+func (s *InvitationService) checkPassword(ctx context.Context, user *entities.User, password string, client ClientInfo) error {
+	if user.PasswordHash == "" {
+		return ErrSignInToAccept
+	}
+	if err := s.guard.Check(ctx, user.Email, client.IP); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		if err := s.guard.Failure(ctx, user.Email, client.IP); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	if user.Disabled() {
+		return ErrAccountDisabled
+	}
+	// As with logins, wrong second factors stay counted for MFA users.
+	if user.MFAEnabledAt == nil {
+		if err := s.guard.Success(ctx, user.Email); err != nil {
+			s.log.Warn("clearing login failures failed", zap.String("userID", user.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// admit claims the invitation for user and adds their membership.
+func (s *InvitationService) admit(ctx context.Context, inv *entities.Invitation, user *entities.User) error {
+	// Claimed before the membership is added, so a token raced through
+	// twice admits only once.
+	claimed, err := s.repo.Accept(ctx, inv.ID, user.ID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrInvalidInvitation
+	}
+	member := &entities.Membership{OrganizationID: inv.OrganizationID, UserID: user.ID, Role: inv.Role}
+	if err := s.orgRepo.AddMember(ctx, member); err != nil {
+		return fmt.Errorf("adding member: %w", err)
+	}
+
+	s.log.Info("invitation accepted", zap.String("invitationID", inv.ID), zap.String("userID", user.ID))
+	return nil
+}
+
+func (s *InvitationService) createUser(ctx context.Context, inv *entities.Invitation, in AcceptInvitationInput) (*entities.User, error) {
+	if in.Username == "" {
+		return nil, ErrUsernameRequired
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), s.bcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+	now := time.Now().UTC()
+	user := &entities.User{
+		Email:           inv.Email,
+		Username:        in.Username,
+		PasswordHash:    string(hash),
+		EmailVerifiedAt: &now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating user: %w", err)
+	}
+	return user, nil
+}
+
+// find loads an invitation the actor may manage. Those for roles above
+// the actor's are reported as forbidden.
+func (s *InvitationService) find(ctx context.Context, actorRole, id string) (*entities.Invitation, error) {
+	inv, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !authz.CanManage(actorRole, inv.Role) {
+		return nil, authz.ErrForbidden
+	}
+	return inv, nil
+}
+
+// renew gives the invitation a new token id and expiry, and returns the
+// token to email.
+func (s *InvitationService) renew(inv *entities.Invitation) string {
+	now := time.Now().UTC()
+	inv.TokenID = uuid.NewString()
+	inv.ExpiresAt = now.Add(s.cfg.InvitationTTL)
+	inv.SentAt = now
+	return inv.TokenID
+}
+
+func (s *InvitationService) send(ctx context.Context, inv *entities.Invitation, tokenID string) error {
+	token, err := s.jwtManager.GenerateInvitation(tokenID, s.cfg.InvitationTTL)
+	if err != nil {
+		return fmt.Errorf("signing invitation: %w", err)
+	}
+	org, err := s.orgRepo.FindByID(ctx, inv.OrganizationID)
+	if err != nil {
+		return fmt.Errorf("finding organization: %w", err)
+	}
+
+	queueMail(s.mailQueue, s.mailer, mailer.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You are invited to join %s", org.Name),
+		Text: fmt.Sprintf("Hi,\n\nYou have been invited to join %s as %s. Accept by opening the link below. It expires in %s.\n\n%s\n\nIf you were not expecting this, ignore this email.\n",
+			org.Name, inv.Role, s.cfg.InvitationTTL, tokenLink(s.cfg.AppBaseURL, "/accept-invitation", token)),
+	}, s.log)
+	return nil
+}
+
+var (
+	ErrInvalidInvitation = errors.New("invitation is invalid or has expired")
+	ErrInvitationPending = errors.New("an invitation for this email is already pending")
+	ErrInvitationClosed  = errors.New("invitation has already been accepted or revoked")
+	ErrAlreadyMember     = errors.New("user is already a member of this organization")
+	ErrUsernameRequired  = errors.New("username is required to create an account")
+	ErrSignInToAccept    = errors.New("this account has no password; sign in to accept the invitation")
+)
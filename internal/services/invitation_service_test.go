@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// newAcceptFixture returns an InvitationService holding one pending
+// invitation to orgID as role for email, and the token that redeems it.
+func newAcceptFixture(t *testing.T, users *fakeUserRepo, orgs *fakeOrgRepo, orgID, email, role string) (*InvitationService, string) {
+	t.Helper()
+	jwt := auth.NewManager("test-secret", time.Minute, time.Hour)
+	inv := &entities.Invitation{
+		ID:             uuid.NewString(),
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		TokenID:        uuid.NewString(),
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+	token, err := jwt.GenerateInvitation(inv.TokenID, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateInvitation: %v", err)
+	}
+	guard := NewLoginGuard(&fakeThrottleRepo{}, config.SecurityConfig{
+		LoginFailureWindow:    time.Hour,
+		LoginLockoutThreshold: 3,
+		LoginLockoutDuration:  15 * time.Minute,
+	}, zap.NewNop())
+	svc := NewInvitationService(
+		&fakeInvitationRepo{invitations: []*entities.Invitation{inv}},
+		users, orgs, guard, jwt, nil, nil,
+		config.AuthConfig{InvitationTTL: time.Hour},
+		bcrypt.MinCost,
+		zap.NewNop(),
+	)
+	return svc, token
+}
+
+func TestAcceptNewUserJoinsWithInvitedRole(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUserRepo()
+	orgs := &fakeOrgRepo{}
+	orgID := uuid.NewString()
+	svc, token := newAcceptFixture(t, users, orgs, orgID, "new@example.com", authz.RoleReceptionist)
+
+	user, err := svc.Accept(ctx, AcceptInvitationInput{Token: token, Username: "newbie", Password: "correct horse"}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	m, err := orgs.FindMembership(ctx, orgID, user.ID)
+	if err != nil {
+		t.Fatalf("membership not added: %v", err)
+	}
+	if m.Role != authz.RoleReceptionist {
+		t.Errorf("membership role = %q, want %q", m.Role, authz.RoleReceptionist)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("email of a new user accepting an invitation is not verified")
+	}
+}
+
+func TestAcceptExistingUserJoinsWithInvitedRole(t *testing.T) {
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &entities.User{Email: "staff@example.com", Username: "staff", PasswordHash: string(hash)}
+	users := newFakeUserRepo(existing)
+	otherOrg := uuid.NewString()
+	orgs := &fakeOrgRepo{memberships: []entities.Membership{
+		{OrganizationID: otherOrg, UserID: existing.ID, Role: authz.RoleClinicAdmin},
+	}}
+	orgID := uuid.NewString()
+	svc, token := newAcceptFixture(t, users, orgs, orgID, existing.Email, authz.RoleBilling)
+
+	user, err := svc.Accept(ctx, AcceptInvitationInput{Token: token, Password: "correct horse"}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Fatalf("Accept returned user %s, want the existing %s", user.ID, existing.ID)
+	}
+
+	m, err := orgs.FindMembership(ctx, orgID, existing.ID)
+	if err != nil {
+		t.Fatalf("membership not added: %v", err)
+	}
+	if m.Role != authz.RoleBilling {
+		t.Errorf("membership role = %q, want the invited %q", m.Role, authz.RoleBilling)
+	}
+	other, err := orgs.FindMembership(ctx, otherOrg, existing.ID)
+	if err != nil {
+		t.Fatalf("other membership lost: %v", err)
+	}
+	if other.Role != authz.RoleClinicAdmin {
+		t.Errorf("role in other organisation = %q, want it unchanged as %q", other.Role, authz.RoleClinicAdmin)
+	}
+}
+
+func TestAcceptExistingUserRequiresPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &entities.User{Email: "staff@example.com", Username: "staff", PasswordHash: string(hash)}
+	orgs := &fakeOrgRepo{}
+	svc, token := newAcceptFixture(t, newFakeUserRepo(existing), orgs, uuid.NewString(), existing.Email, authz.RoleBilling)
+
+	if _, err := svc.Accept(context.Background(), AcceptInvitationInput{Token: token, Password: "wrong password"}, ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Accept with wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if len(orgs.memberships) != 0 {
+		t.Errorf("membership added despite wrong password: %+v", orgs.memberships)
+	}
+}
+
+func TestAcceptExistingUserIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &entities.User{Email: "staff@example.com", Username: "staff", PasswordHash: string(hash)}
+	orgs := &fakeOrgRepo{}
+	svc, token := newAcceptFixture(t, newFakeUserRepo(existing), orgs, uuid.NewString(), existing.Email, authz.RoleBilling)
+	client := ClientInfo{IP: "198.51.100.7"}
+
+	for range 3 {
+		if _, err := svc.Accept(ctx, AcceptInvitationInput{Token: token, Password: "wrong password"}, client); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Accept with wrong password: err = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	// Locked now, even for the right password.
+	if _, err := svc.Accept(ctx, AcceptInvitationInput{Token: token, Password: "correct horse"}, client); !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("Accept after three wrong passwords: err = %v, want ErrLoginLocked", err)
+	}
+	if len(orgs.memberships) != 0 {
+		t.Errorf("membership added while locked out: %+v", orgs.memberships)
+	}
+}
+
+func TestAcceptRejectsDisabledUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledAt := time.Now().Add(-time.Hour)
+	existing := &entities.User{Email: "gone@example.com", Username: "gone", PasswordHash: string(hash), DisabledAt: &disabledAt}
+	orgs := &fakeOrgRepo{}
+	svc, token := newAcceptFixture(t, newFakeUserRepo(existing), orgs, uuid.NewString(), existing.Email, authz.RoleBilling)
+
+	if _, err := svc.Accept(context.Background(), AcceptInvitationInput{Token: token, Password: "correct horse"}, ClientInfo{}); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("Accept by a disabled user: err = %v, want ErrAccountDisabled", err)
+	}
+	if _, err := svc.AcceptSignedIn(context.Background(), existing.ID, AcceptSignedInInput{Token: token}); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("AcceptSignedIn by a disabled user: err = %v, want ErrAccountDisabled", err)
+	}
+	if len(orgs.memberships) != 0 {
+		t.Errorf("disabled user admitted: %+v", orgs.memberships)
+	}
+}
+
+// Users created through single sign-on have no password to confirm, so
+// they accept once signed in.
+func TestAcceptPasswordlessUserSignedIn(t *testing.T) {
+	ctx := context.Background()
+	verified := time.Now().Add(-time.Hour)
+	sso := &entities.User{Email: "sso@example.com", Username: "sso", EmailVerifiedAt: &verified}
+	other := &entities.User{Email: "other@example.com", Username: "other", EmailVerifiedAt: &verified}
+	orgs := &fakeOrgRepo{}
+	orgID := uuid.NewString()
+	svc, token := newAcceptFixture(t, newFakeUserRepo(sso, other), orgs, orgID, sso.Email, authz.RolePractitioner)
+
+	if _, err := svc.Accept(ctx, AcceptInvitationInput{Token: token, Password: "anything at all"}, ClientInfo{}); !errors.Is(err, ErrSignInToAccept) {
+		t.Fatalf("Accept for a passwordless user: err = %v, want ErrSignInToAccept", err)
+	}
+	if _, err := svc.AcceptSignedIn(ctx, other.ID, AcceptSignedInInput{Token: token}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("AcceptSignedIn by someone else: err = %v, want ErrInvalidInvitation", err)
+	}
+
+	user, err := svc.AcceptSignedIn(ctx, sso.ID, AcceptSignedInInput{Token: token})
+	if err != nil {
+		t.Fatalf("AcceptSignedIn: %v", err)
+	}
+	m, err := orgs.FindMembership(ctx, orgID, user.ID)
+	if err != nil {
+		t.Fatalf("membership not added: %v", err)
+	}
+	if m.Role != authz.RolePractitioner {
+		t.Errorf("membership role = %q, want %q", m.Role, authz.RolePractitioner)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// LoginLockedError is returned while an account or client IP is locked
+// out. It matches ErrLoginLocked with errors.Is.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string        { return ErrLoginLocked.Error() }
+func (e *LoginLockedError) Is(target error) bool { return target == ErrLoginLocked }
+
+// LoginGuard slows down password guessing. Failures are counted per account
+// and per client IP within a window. Past a soft threshold each further
+// account failure locks the account for a doubling delay; past the hard
+// threshold it is locked for the full lockout duration.
+//
+// Accounts are keyed by the hashed email as typed, registered or not, so a
+// lockout looks the same for addresses that do not exist.
+type LoginGuard struct {
+	repo repositories.LoginThrottleRepository
+	cfg  config.SecurityConfig
+	log  *zap.Logger
+}
+
+func NewLoginGuard(repo repositories.LoginThrottleRepository, cfg config.SecurityConfig, log *zap.Logger) *LoginGuard {
+	return &LoginGuard{repo: repo, cfg: cfg, log: log.Named("login_guard")}
+}
+
+// Check returns a *LoginLockedError if the account or IP is locked.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	now := time.Now().UTC()
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		t, err := g.repo.Find(ctx, key)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("checking login throttle: %w", err)
+		}
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			return &LoginLockedError{RetryAfter: t.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// Failure records a failed attempt and applies any delay or lockout.
+func (g *LoginGuard) Failure(ctx context.Context, email, ip string) error {
+	now := time.Now().UTC()
+	windowStart := now.Add(-g.cfg.LoginFailureWindow)
+
+	key := accountKey(email)
+	n, err := g.repo.RecordFailure(ctx, key, now, windowStart)
+	if err != nil {
+		return fmt.Errorf("recording login failure: %w", err)
+	}
+	if lock := g.accountLock(n); lock > 0 {
+		if err := g.repo.Lock(ctx, key, now.Add(lock)); err != nil {
+			return fmt.Errorf("locking account: %w", err)
+		}
+		if n >= g.cfg.LoginLockoutThreshold {
+			g.log.Warn("account locked after failed logins", zap.String("key", key), zap.Int("failures", n))
+		}
+	}
+
+	if ip == "" {
+		return nil
+	}
+	key = ipKey(ip)
+	n, err = g.repo.RecordFailure(ctx, key, now, windowStart)
+	if err != nil {
+		return fmt.Errorf("recording login failure: %w", err)
+	}
+	if g.cfg.LoginIPThreshold > 0 && n >= g.cfg.LoginIPThreshold {
+		if err := g.repo.Lock(ctx, key, now.Add(g.cfg.LoginLockoutDuration)); err != nil {
+			return fmt.Errorf("locking ip: %w", err)
+		}
+		g.log.Warn("client ip locked after failed logins", zap.String("ip", ip), zap.Int("failures", n))
+	}
+	return nil
+}
+
+// Success forgets the account's failures. IP failures are kept, so one
+// valid login does not reset a spraying client.
+func (g *LoginGuard) Success(ctx context.Context, email string) error {
+	return g.repo.Clear(ctx, accountKey(email))
+}
+
+// Unlock clears the account's failures and lock.
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	if err := g.repo.Clear(ctx, accountKey(email)); err != nil {
+		return fmt.Errorf("unlocking account: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes throttles with no recent failures and no lock in force.
+func (g *LoginGuard) Prune(ctx context.Context) error {
+	now := time.Now().UTC()
+	n, err := g.repo.DeleteStale(ctx, now.Add(-g.cfg.LoginFailureWindow), now)
+	if err != nil {
+		return fmt.Errorf("pruning login throttles: %w", err)
+	}
+	g.log.Info("stale login throttles pruned", zap.Int64("count", n))
+	return nil
+}
+
+// accountLock is how long to lock an account after its nth failure.
+func (g *LoginGuard) accountLock(n int) time.Duration {
+	switch {
+	case g.cfg.LoginLockoutThreshold > 0 && n >= g.cfg.LoginLockoutThreshold:
+		return g.cfg.LoginLockoutDuration
+	case g.cfg.LoginDelayAfter > 0 && n >= g.cfg.LoginDelayAfter:
+		// 1s, 2s, 4s, ... capped at the lockout duration.
+		shift := min(n-g.cfg.LoginDelayAfter, 20)
+		return min(time.Second<<shift, g.cfg.LoginLockoutDuration)
+	}
+	return 0
+}
+
+func accountKey(email string) string {
+	return "acct:" + auth.HashOpaqueToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+var ErrLoginLocked = errors.New("too many failed login attempts; try again later")
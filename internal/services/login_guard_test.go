@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// A correct password must not wipe the wrong second factors counted
+// against the account, or whoever holds the password could keep guessing
+// codes by signing in again before each lockout.
+func TestPasswordStepKeepsMFAFailures(t *testing.T) {
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	user := &entities.User{Email: "mfa@example.com", PasswordHash: string(hash), MFAEnabledAt: &now, MFASecret: "JBSWY3DPEHPK3PXP"}
+	users := newFakeUserRepo(user)
+
+	guard := NewLoginGuard(&fakeThrottleRepo{}, config.SecurityConfig{
+		LoginFailureWindow:    time.Hour,
+		LoginLockoutThreshold: 3,
+		LoginLockoutDuration:  15 * time.Minute,
+	}, zap.NewNop())
+	jwt := auth.NewManager("test-secret", time.Minute, time.Hour)
+	mfaSvc := NewMFAService(users, fakeRecoveryRepo{}, nil, nil, guard, jwt, "test", zap.NewNop())
+	userSvc := NewUserService(users, nil, mfaSvc, nil, nil, guard, bcrypt.MinCost, time.Hour, false, zap.NewNop())
+
+	login := func() string {
+		t.Helper()
+		_, res, err := userSvc.Login(ctx, LoginInput{Email: user.Email, Password: "correct horse"}, ClientInfo{})
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		if res.MFAChallenge == "" {
+			t.Fatal("Login did not ask for a second factor")
+		}
+		return res.MFAChallenge
+	}
+	wrongCode := func(challenge string) error {
+		_, _, err := mfaSvc.CompleteLogin(ctx, MFAVerifyInput{ChallengeToken: challenge, Code: "not-a-code"}, ClientInfo{})
+		return err
+	}
+
+	challenge := login()
+	for range 2 {
+		if err := wrongCode(challenge); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("CompleteLogin with a wrong code: err = %v, want ErrInvalidMFACode", err)
+		}
+	}
+
+	// Third wrong code after signing in again reaches the threshold.
+	if err := wrongCode(login()); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("CompleteLogin with a wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := wrongCode(challenge); !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("CompleteLogin after three wrong codes: err = %v, want ErrLoginLocked", err)
+	}
+}
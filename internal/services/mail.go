@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"net/url"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
+	"github.com/jamesphm04/splose-clone-be/pkg/mailer"
+)
+
+// queueMail hands msg to the mail queue. A full queue is logged, not
+// returned: whatever the email links to has been issued already, and the
+// user can ask for another email.
+func queueMail(q *jobs.Queue, m mailer.Mailer, msg mailer.Message, log *zap.Logger) {
+	err := q.Enqueue(jobs.Job{
+		Name: "send-email",
+		Run: func(ctx context.Context) error {
+			return m.Send(ctx, msg)
+		},
+	})
+	if err != nil {
+		log.Error("queueing email failed", zap.String("subject", msg.Subject), zap.Error(err))
+	}
+}
+
+// tokenLink builds the front-end URL that redeems token.
+func tokenLink(baseURL, path, token string) string {
+	return baseURL + path + "?token=" + url.QueryEscape(token)
+}
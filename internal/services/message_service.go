@@ -38,8 +38,6 @@ func (s *MessageService) Create(ctx context.Context, in CreateMessageInput) (*en
 		Content:        in.Content,
 	}
 
-	s.log.Debug("HEREEEEEEEEEEEEE", zap.Any("msg", msg))
-
 	if err := s.repo.Create(ctx, msg); err != nil {
 		s.log.Error("message creation failed", zap.Error(err))
 		return nil, fmt.Errorf("creating message: %w", err)
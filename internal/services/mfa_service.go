@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// recoveryCodeCount is how many recovery codes a user holds at a time.
+const recoveryCodeCount = 10
+
+type MFASetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"` // render as a QR code for authenticator apps
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFAVerifyInput struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	// Code is a current TOTP code or an unused recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+type MFAPolicyInput struct {
+	Required bool `json:"required"`
+}
+
+// MFAService manages TOTP enrolment, recovery codes, the second login step
+// and per-role MFA policies.
+type MFAService struct {
+	userRepo     repositories.UserRepository
+	recoveryRepo repositories.RecoveryCodeRepository
+	policyRepo   repositories.MFAPolicyRepository
+	sessionSvc   *SessionService
+	guard        *LoginGuard
+	jwtManager   *auth.Manager
+	issuer       string
+	log          *zap.Logger
+}
+
+func NewMFAService(
+	userRepo repositories.UserRepository,
+	recoveryRepo repositories.RecoveryCodeRepository,
+	policyRepo repositories.MFAPolicyRepository,
+	sessionSvc *SessionService,
+	guard *LoginGuard,
+	jwtManager *auth.Manager,
+	issuer string,
+	log *zap.Logger,
+) *MFAService {
+	return &MFAService{
+		userRepo:     userRepo,
+		recoveryRepo: recoveryRepo,
+		policyRepo:   policyRepo,
+		sessionSvc:   sessionSvc,
+		guard:        guard,
+		jwtManager:   jwtManager,
+		issuer:       issuer,
+		log:          log.Named("mfa_service"),
+	}
+}
+
+// BeginSetup generates a secret for the user to add to an authenticator
+// app. MFA is not enabled until ConfirmSetup receives a valid code.
+func (s *MFAService) BeginSetup(ctx context.Context, userID string) (*MFASetup, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.MFAPendingSecret = secret
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("saving pending secret: %w", err)
+	}
+
+	return &MFASetup{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmSetup enables MFA once the user proves their app produces valid
+// codes, and returns a fresh set of recovery codes. They are shown once.
+func (s *MFAService) ConfirmSetup(ctx context.Context, userID string, in MFACodeInput) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFAPendingSecret == "" {
+		return nil, ErrMFANotPending
+	}
+
+	step, ok := auth.VerifyTOTP(user.MFAPendingSecret, normalizeCode(in.Code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	now := time.Now().UTC()
+	user.MFASecret = user.MFAPendingSecret
+	user.MFAPendingSecret = ""
+	user.MFAEnabledAt = &now
+	user.MFALastStep = step
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("enabling mfa: %w", err)
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("mfa enabled", zap.String("userID", user.ID))
+	return codes, nil
+}
+
+// Disable turns MFA off after checking a current code. It is refused when
+// the user's role in any of their organisations requires MFA.
+func (s *MFAService) Disable(ctx context.Context, userID string, in MFACodeInput) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+	if user.MFAEnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	required, err := s.policyRepo.IsRequiredForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("checking mfa policy: %w", err)
+	}
+	if required {
+		return ErrMFARequiredByPolicy
+	}
+	if err := s.verifyCode(ctx, user, in.Code); err != nil {
+		return err
+	}
+
+	user.MFAEnabledAt = nil
+	user.MFASecret = ""
+	user.MFAPendingSecret = ""
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("disabling mfa: %w", err)
+	}
+	if err := s.recoveryRepo.DeleteForUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("deleting recovery codes: %w", err)
+	}
+
+	s.log.Info("mfa disabled", zap.String("userID", user.ID))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current TOTP code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID string, in MFACodeInput) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if user.MFAEnabledAt == nil {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.verifyTOTP(ctx, user, in.Code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, user.ID)
+}
+
+// Challenge is returned by Login instead of tokens when the user has MFA.
+func (s *MFAService) Challenge(user *entities.User) (string, error) {
+	token, err := s.jwtManager.GenerateMFAChallenge(user.ID)
+	if err != nil {
+		return "", fmt.Errorf("generating mfa challenge: %w", err)
+	}
+	return token, nil
+}
+
+// CompleteLogin exchanges a login challenge and a second factor for a
+// session. Wrong codes count towards the same lockout as wrong passwords.
+func (s *MFAService) CompleteLogin(ctx context.Context, in MFAVerifyInput, client ClientInfo) (*entities.User, *TokenPair, error) {
+	claims, err := s.jwtManager.Parse(in.ChallengeToken)
+	if err != nil || claims.TokenType != auth.MFAChallengeToken {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil || user.MFAEnabledAt == nil {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	if err := s.guard.Check(ctx, user.Email, client.IP); err != nil {
+		return nil, nil, err
+	}
+	if err := s.verifyCode(ctx, user, in.Code); err != nil {
+		s.log.Debug("mfa verification failed", zap.String("userID", user.ID))
+		if errors.Is(err, ErrInvalidMFACode) {
+			if ferr := s.guard.Failure(ctx, user.Email, client.IP); ferr != nil {
+				return nil, nil, ferr
+			}
+		}
+		return nil, nil, err
+	}
+	if err := s.guard.Success(ctx, user.Email); err != nil {
+		s.log.Warn("clearing login failures failed", zap.String("userID", user.ID), zap.Error(err))
+	}
+
+	pair, err := s.sessionSvc.Start(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.log.Info("user logged in with mfa", zap.String("userID", user.ID))
+	return user, pair, nil
+}
+
+// ListPolicies returns every role with an explicit MFA policy.
+func (s *MFAService) ListPolicies(ctx context.Context) ([]entities.MFAPolicy, error) {
+	return s.policyRepo.List(ctx)
+}
+
+// SetPolicy requires (or stops requiring) MFA for a role. Affected users
+// who have not enrolled get a restricted token at their next login or
+// refresh until they do.
+func (s *MFAService) SetPolicy(ctx context.Context, role string, in MFAPolicyInput) (*entities.MFAPolicy, error) {
+	p := &entities.MFAPolicy{Role: role, Required: in.Required}
+	if err := s.policyRepo.Upsert(ctx, p); err != nil {
+		return nil, fmt.Errorf("saving mfa policy: %w", err)
+	}
+	s.log.Info("mfa policy updated", zap.String("role", role), zap.Bool("required", in.Required))
+	return p, nil
+}
+
+// verifyCode accepts a TOTP code or, failing that, a recovery code.
+func (s *MFAService) verifyCode(ctx context.Context, user *entities.User, code string) error {
+	code = normalizeCode(code)
+	if isTOTPCode(code) {
+		return s.verifyTOTP(ctx, user, code)
+	}
+
+	err := s.recoveryRepo.Consume(ctx, user.ID, auth.HashOpaqueToken(code))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return fmt.Errorf("consuming recovery code: %w", err)
+	}
+
+	remaining, err := s.recoveryRepo.CountUnused(ctx, user.ID)
+	if err == nil {
+		s.log.Info("recovery code used", zap.String("userID", user.ID), zap.Int64("remaining", remaining))
+	}
+	return nil
+}
+
+func (s *MFAService) verifyTOTP(ctx context.Context, user *entities.User, code string) error {
+	step, ok := auth.VerifyTOTP(user.MFASecret, normalizeCode(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	fresh, err := s.userRepo.AdvanceMFAStep(ctx, user.ID, step)
+	if err != nil {
+		return fmt.Errorf("recording mfa step: %w", err)
+	}
+	if !fresh {
+		// The code was valid but has already been used.
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *MFAService) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = auth.HashOpaqueToken(normalizeCode(code))
+	}
+
+	if err := s.recoveryRepo.Replace(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("saving recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns 80 random bits as xxxx-xxxx-xxxx-xxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating recovery code: %w", err)
+	}
+	raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeCode strips the separators users type or paste along with codes.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrMFANotEnabled       = errors.New("mfa is not enabled")
+	ErrMFANotPending       = errors.New("mfa setup has not been started")
+	ErrMFARequiredByPolicy = errors.New("mfa is required for your role and cannot be disabled")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge = errors.New("mfa challenge is invalid or has expired")
+)
@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
 	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
 	"github.com/jamesphm04/splose-clone-be/internal/repositories"
 	"go.uber.org/zap"
@@ -88,6 +91,9 @@ func (s *NoteService) Update(ctx context.Context, id string, in UpdateNoteInput)
 		s.log.Error("note update failed", zap.String("id", id), zap.Error(err))
 		return nil, fmt.Errorf("updating note: %w", err)
 	}
+	if note.SignedAt != nil {
+		return nil, ErrNoteSigned
+	}
 
 	if in.UserID != nil {
 		note.UserID = *in.UserID
@@ -110,7 +116,40 @@ func (s *NoteService) Update(ctx context.Context, id string, in UpdateNoteInput)
 	return note, nil
 }
 
+// Sign finalises a note on behalf of signerID. Signed notes can no longer
+// be edited or deleted.
+func (s *NoteService) Sign(ctx context.Context, signerID, signerRole, id string) (*entities.Note, error) {
+	if err := authz.Check(signerRole, authz.NoteSign); err != nil {
+		return nil, err
+	}
+	note, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("signing note: %w", err)
+	}
+	if note.SignedAt != nil {
+		return nil, ErrNoteSigned
+	}
+
+	now := time.Now().UTC()
+	note.SignedAt = &now
+	note.SignedBy = &signerID
+	if err := s.repo.Update(ctx, note); err != nil {
+		s.log.Error("note sign failed", zap.String("id", id), zap.Error(err))
+		return nil, fmt.Errorf("signing note: %w", err)
+	}
+
+	s.log.Info("note signed", zap.String("id", id), zap.String("signedBy", signerID))
+	return note, nil
+}
+
 func (s *NoteService) SoftDelete(ctx context.Context, id string) error {
+	note, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("soft deleting note: %w", err)
+	}
+	if note.SignedAt != nil {
+		return ErrNoteSigned
+	}
 	if err := s.repo.SoftDelete(ctx, id); err != nil {
 		s.log.Error("note soft delete failed", zap.String("id", id), zap.Error(err))
 		return fmt.Errorf("soft deleting note: %w", err)
@@ -119,3 +158,5 @@ func (s *NoteService) SoftDelete(ctx context.Context, id string) error {
 	s.log.Info("note soft deleted", zap.String("id", id))
 	return nil
 }
+
+var ErrNoteSigned = errors.New("note is signed and can no longer be changed")
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+	"github.com/jamesphm04/splose-clone-be/pkg/oidc"
+)
+
+type OIDCAuthorization struct {
+	// AuthorizationURL is where the web app sends the browser.
+	AuthorizationURL string `json:"authorizationUrl"`
+	// State must be kept by the browser that started the login, e.g. in a
+	// cookie, and handed to Complete with the callback.
+	State     string    `json:"-"`
+	ExpiresAt time.Time `json:"-"`
+}
+
+type OIDCCallbackInput struct {
+	Code  string `json:"code"  validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// OIDCService signs users in through an OpenID Connect provider using the
+// authorization-code flow with PKCE. The web app owns the redirect URL and
+// posts the code and state back here, from the browser that started the
+// login.
+type OIDCService struct {
+	provider     *oidc.Provider
+	identityRepo repositories.IdentityRepository
+	userRepo     repositories.UserRepository
+	orgRepo      repositories.OrganizationRepository
+	userSvc      *UserService
+	cfg          config.OIDCConfig
+	log          *zap.Logger
+}
+
+func NewOIDCService(
+	provider *oidc.Provider,
+	identityRepo repositories.IdentityRepository,
+	userRepo repositories.UserRepository,
+	orgRepo repositories.OrganizationRepository,
+	userSvc *UserService,
+	cfg config.OIDCConfig,
+	log *zap.Logger,
+) *OIDCService {
+	return &OIDCService{
+		provider:     provider,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		orgRepo:      orgRepo,
+		userSvc:      userSvc,
+		cfg:          cfg,
+		log:          log.Named("oidc_service"),
+	}
+}
+
+// Begin starts a login and returns the provider URL to redirect to.
+func (s *OIDCService) Begin(ctx context.Context) (*OIDCAuthorization, error) {
+	req, err := s.provider.NewAuthRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building authorization request: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.StateTTL)
+	err = s.identityRepo.SaveState(ctx, &entities.OIDCLoginState{
+		StateHash:    auth.HashOpaqueToken(req.State),
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("saving login state: %w", err)
+	}
+	return &OIDCAuthorization{AuthorizationURL: req.URL, State: req.State, ExpiresAt: expiresAt}, nil
+}
+
+// Complete redeems the provider's callback and signs the user in, the same
+// way a password login would (including the MFA step, if enrolled).
+// browserState is the state kept by the browser posting the callback; it
+// must match, so a code obtained by someone else cannot be used to sign
+// this browser in to their account.
+func (s *OIDCService) Complete(ctx context.Context, in OIDCCallbackInput, browserState string, client ClientInfo) (*entities.User, *LoginResult, error) {
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(in.State)) != 1 {
+		s.log.Warn("oidc callback from a browser that did not start the login")
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	state, err := s.identityRepo.ConsumeState(ctx, auth.HashOpaqueToken(in.State))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, ErrInvalidOIDCState
+		}
+		return nil, nil, fmt.Errorf("consuming login state: %w", err)
+	}
+
+	tok, err := s.provider.Exchange(ctx, in.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		s.log.Warn("oidc code exchange failed", zap.Error(err))
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, tok)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.syncUser(ctx, user, tok); err != nil {
+		return nil, nil, err
+	}
+
+	res, err := s.userSvc.IssueLogin(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, res, nil
+}
+
+// Prune deletes login states that were never redeemed.
+func (s *OIDCService) Prune(ctx context.Context) error {
+	n, err := s.identityRepo.DeleteExpiredStates(ctx)
+	if err != nil {
+		return fmt.Errorf("pruning oidc states: %w", err)
+	}
+	s.log.Info("expired oidc states pruned", zap.Int64("count", n))
+	return nil
+}
+
+// resolveUser finds the user for an ID token: by linked subject first, then
+// by verified email, then by provisioning a new account.
+func (s *OIDCService) resolveUser(ctx context.Context, tok *oidc.IDToken) (*entities.User, error) {
+	identity, err := s.identityRepo.FindBySubject(ctx, tok.Issuer, tok.Subject)
+	if err == nil {
+		user, err := s.userRepo.FindByID(ctx, identity.UserID)
+		if err != nil {
+			// Linked to an account that has since been deleted.
+			return nil, ErrOIDCNoAccount
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, fmt.Errorf("finding identity: %w", err)
+	}
+
+	// An unverified address could belong to anyone; never match on it.
+	if tok.Email == "" || !tok.EmailVerified {
+		s.log.Info("oidc login rejected: no verified email", zap.String("subject", tok.Subject))
+		return nil, ErrOIDCNoAccount
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, tok.Email)
+	switch {
+	case err == nil:
+		if !s.cfg.LinkByEmail {
+			return nil, ErrOIDCNoAccount
+		}
+	case errors.Is(err, repositories.ErrNotFound):
+		if !s.cfg.AutoProvision {
+			return nil, ErrOIDCNoAccount
+		}
+		if user, err = s.provision(ctx, tok); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+
+	if err := s.identityRepo.Create(ctx, &entities.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  tok.Issuer,
+		Subject: tok.Subject,
+		Email:   tok.Email,
+	}); err != nil {
+		return nil, fmt.Errorf("linking identity: %w", err)
+	}
+	s.log.Info("oidc identity linked", zap.String("userID", user.ID), zap.String("issuer", tok.Issuer))
+	return user, nil
+}
+
+// provision creates a user for a first-time SSO sign-in. The account has no
+// password; the user can set one through the reset flow if needed. It
+// belongs to no organisation until the user is invited or added to one.
+func (s *OIDCService) provision(ctx context.Context, tok *oidc.IDToken) (*entities.User, error) {
+	username := tok.Name
+	if username == "" {
+		username, _, _ = strings.Cut(tok.Email, "@")
+	}
+	now := time.Now().UTC()
+	user := &entities.User{
+		Email:           tok.Email,
+		Username:        username,
+		EmailVerifiedAt: &now,
+	}
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("provisioning user: %w", err)
+	}
+	s.log.Info("user provisioned from oidc", zap.String("userID", user.ID))
+	return user, nil
+}
+
+// syncUser applies what the provider asserts on every sign-in: the role in
+// each of the user's organisations, when mapped from a claim, and email
+// verification.
+func (s *OIDCService) syncUser(ctx context.Context, user *entities.User, tok *oidc.IDToken) error {
+	if s.cfg.RoleClaim != "" {
+		memberships, err := s.orgRepo.ListByUserID(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("listing memberships: %w", err)
+		}
+		role := s.mapRole(tok.Claims)
+		for _, m := range memberships {
+			if m.Role == role {
+				continue
+			}
+			if _, err := s.userSvc.ChangeRole(ctx, m.OrganizationID, user.ID, ChangeRoleInput{Role: role}); err != nil {
+				return fmt.Errorf("applying mapped role: %w", err)
+			}
+		}
+	}
+
+	if user.EmailVerifiedAt == nil && tok.EmailVerified && strings.EqualFold(tok.Email, user.Email) {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return fmt.Errorf("marking email verified: %w", err)
+		}
+	}
+	return nil
+}
+
+// mapRole maps the role claim (a string or a list of strings) to a role:
+// "admin" if it contains one of the admin values, else the most privileged
+// role named in it, else the default role.
+func (s *OIDCService) mapRole(claims map[string]any) string {
+	var values []string
+	switch v := claims[s.cfg.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+	for _, v := range values {
+		if slices.Contains(s.cfg.AdminRoleValues, v) {
+			return authz.RoleAdmin
+		}
+	}
+	for _, role := range authz.Roles {
+		if role != authz.RoleAdmin && slices.Contains(values, role) {
+			return role
+		}
+	}
+	return authz.DefaultRole
+}
+
+var (
+	ErrInvalidOIDCState = errors.New("sign-in request is invalid or has expired; start again")
+	ErrOIDCLoginFailed  = errors.New("sign-in with the identity provider failed")
+	ErrOIDCNoAccount    = errors.New("no account is linked to this identity")
+)
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+)
+
+func TestCompleteRequiresStateFromSameBrowser(t *testing.T) {
+	// No repositories: the state must be rejected before any is used, so a
+	// stray callback cannot burn the real browser's login.
+	svc := NewOIDCService(nil, nil, nil, nil, nil, config.OIDCConfig{}, zap.NewNop())
+	in := OIDCCallbackInput{Code: "code", State: "state-from-the-url"}
+
+	for name, browserState := range map[string]string{
+		"no cookie":       "",
+		"other browser's": "state-of-another-login",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := svc.Complete(context.Background(), in, browserState, ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+				t.Fatalf("Complete: err = %v, want ErrInvalidOIDCState", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+type CreateOrganizationInput struct {
+	Name string `json:"name" validate:"required,max=255"`
+	// Slug defaults to one derived from Name.
+	Slug string `json:"slug" validate:"omitempty,max=100"`
+}
+
+type AddMemberInput struct {
+	UserID string `json:"userId" validate:"required,uuid"`
+	// Role is what the user may do in this organisation; it defaults to
+	// authz.DefaultRole.
+	Role string `json:"role"`
+}
+
+type SwitchOrganizationInput struct {
+	OrganizationID string `json:"organizationId" validate:"required,uuid"`
+}
+
+// OrganizationService manages clinics and who belongs to them.
+type OrganizationService struct {
+	repo       repositories.OrganizationRepository
+	userRepo   repositories.UserRepository
+	sessionSvc *SessionService
+	log        *zap.Logger
+}
+
+func NewOrganizationService(
+	repo repositories.OrganizationRepository,
+	userRepo repositories.UserRepository,
+	sessionSvc *SessionService,
+	log *zap.Logger,
+) *OrganizationService {
+	return &OrganizationService{
+		repo:       repo,
+		userRepo:   userRepo,
+		sessionSvc: sessionSvc,
+		log:        log.Named("organization_service"),
+	}
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Create sets up an organisation. creatorID, if set, becomes its first
+// member, holding creatorRole.
+func (s *OrganizationService) Create(ctx context.Context, creatorID, creatorRole string, in CreateOrganizationInput) (*entities.Organization, error) {
+	slug := in.Slug
+	if slug == "" {
+		slug = newSlug(in.Name)
+	} else if !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+
+	org := &entities.Organization{Name: in.Name, Slug: slug}
+	if err := s.repo.Create(ctx, org); err != nil {
+		if errors.Is(err, repositories.ErrDuplicateKey) {
+			return nil, ErrSlugTaken
+		}
+		return nil, fmt.Errorf("creating organization: %w", err)
+	}
+	if creatorID != "" {
+		m := &entities.Membership{OrganizationID: org.ID, UserID: creatorID, Role: creatorRole}
+		if err := s.repo.AddMember(ctx, m); err != nil {
+			return nil, fmt.Errorf("adding creator: %w", err)
+		}
+	}
+
+	s.log.Info("organization created", zap.String("organizationID", org.ID), zap.String("createdBy", creatorID))
+	return org, nil
+}
+
+func (s *OrganizationService) List(ctx context.Context, offset, limit int) ([]entities.Organization, int64, error) {
+	return s.repo.List(ctx, offset, limit)
+}
+
+// ListForUser returns the organisations a user can sign in to.
+func (s *OrganizationService) ListForUser(ctx context.Context, userID string) ([]entities.Membership, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+func (s *OrganizationService) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	return s.repo.IsMember(ctx, orgID, userID)
+}
+
+func (s *OrganizationService) FindMembership(ctx context.Context, orgID, userID string) (*entities.Membership, error) {
+	return s.repo.FindMembership(ctx, orgID, userID)
+}
+
+func (s *OrganizationService) UpdateRole(ctx context.Context, orgID, userID, role string) error {
+	return s.repo.UpdateRole(ctx, orgID, userID, role)
+}
+
+func (s *OrganizationService) ListMembers(ctx context.Context, orgID string) ([]entities.Membership, error) {
+	if _, err := s.repo.FindByID(ctx, orgID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, orgID)
+}
+
+// AddMember lets an existing user sign in to the organisation.
+func (s *OrganizationService) AddMember(ctx context.Context, orgID string, in AddMemberInput) (*entities.Membership, error) {
+	if in.Role == "" {
+		in.Role = authz.DefaultRole
+	}
+	if !authz.ValidRole(in.Role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, in.Role)
+	}
+	if _, err := s.repo.FindByID(ctx, orgID); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.FindByID(ctx, in.UserID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUnknownMember
+		}
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+
+	m := &entities.Membership{OrganizationID: orgID, UserID: in.UserID, Role: in.Role}
+	if err := s.repo.AddMember(ctx, m); err != nil {
+		return nil, fmt.Errorf("adding member: %w", err)
+	}
+
+	s.log.Info("organization member added", zap.String("organizationID", orgID), zap.String("userID", in.UserID), zap.String("role", in.Role))
+	return m, nil
+}
+
+// RemoveMember takes a user out of the organisation. Their sessions may be
+// signed in to it, so they are revoked.
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, userID string) error {
+	if err := s.repo.RemoveMember(ctx, orgID, userID); err != nil {
+		return err
+	}
+	if _, err := s.sessionSvc.RevokeAll(ctx, userID, entities.SessionRevokedMembership); err != nil {
+		return err
+	}
+
+	s.log.Info("organization member removed", zap.String("organizationID", orgID), zap.String("userID", userID))
+	return nil
+}
+
+// newSlug derives a slug from name, with a random suffix so clinics with
+// the same name do not collide.
+func newSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	base := strings.TrimSuffix(b.String(), "-")
+	if len(base) > 80 {
+		base = strings.TrimSuffix(base[:80], "-")
+	}
+
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	if base == "" {
+		return "clinic-" + hex.EncodeToString(suffix)
+	}
+	return base + "-" + hex.EncodeToString(suffix)
+}
+
+var (
+	ErrInvalidSlug    = errors.New("slug may only contain lowercase letters, digits and single hyphens")
+	ErrSlugTaken      = errors.New("slug already taken")
+	ErrUnknownMember  = errors.New("user does not exist")
+	ErrNotMember      = errors.New("you are not a member of that organization")
+	ErrNoOrganization = errors.New("you are not signed in to an organization")
+)
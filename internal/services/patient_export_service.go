@@ -0,0 +1,575 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/internal/utils"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// exportsPrefix is where archives live, apart from attachments so
+	// reconciliation leaves them alone.
+	exportsPrefix = "exports/"
+	// exportFormat versions the manifest layout.
+	exportFormat = "splose-patient-export/v1"
+	// maxPresignTTL is the longest S3 accepts for a presigned URL.
+	maxPresignTTL = 7 * 24 * time.Hour
+	// exportBatchSize bounds the exports resumed or pruned per pass.
+	exportBatchSize = 100
+)
+
+// PatientExportService builds a patient's copy of their record in the
+// background: a zip archive of a JSON manifest, an HTML summary and the
+// attachment files, kept in storage behind an expiring link.
+type PatientExportService struct {
+	repo           repositories.PatientExportRepository
+	patientRepo    repositories.PatientRepository
+	noteRepo       repositories.NoteRepository
+	convRepo       repositories.ConversationRepository
+	attachmentRepo repositories.AttachmentRepository
+	s3Client       *storage.Client
+	audit          *AuditService
+	queue          *jobs.Queue
+	linkTTL        time.Duration
+	log            *zap.Logger
+}
+
+func NewPatientExportService(
+	repo repositories.PatientExportRepository,
+	patientRepo repositories.PatientRepository,
+	noteRepo repositories.NoteRepository,
+	convRepo repositories.ConversationRepository,
+	attachmentRepo repositories.AttachmentRepository,
+	s3Client *storage.Client,
+	audit *AuditService,
+	queue *jobs.Queue,
+	linkTTL time.Duration,
+	log *zap.Logger,
+) *PatientExportService {
+	return &PatientExportService{
+		repo:           repo,
+		patientRepo:    patientRepo,
+		noteRepo:       noteRepo,
+		convRepo:       convRepo,
+		attachmentRepo: attachmentRepo,
+		s3Client:       s3Client,
+		audit:          audit,
+		queue:          queue,
+		linkTTL:        linkTTL,
+		log:            log.Named("patient_export_service"),
+	}
+}
+
+// Request starts an export of a patient the context's actor can see. An
+// export already under way for the patient is returned instead of a new one.
+func (s *PatientExportService) Request(ctx context.Context, patientID, requestedBy string) (*entities.PatientExport, error) {
+	patient, err := s.patientRepo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	exports, err := s.repo.FindByPatientID(ctx, patient.ID)
+	if err != nil {
+		return nil, fmt.Errorf("listing exports: %w", err)
+	}
+	for i := range exports {
+		if st := exports[i].Status; st == entities.ExportPending || st == entities.ExportRunning {
+			return &exports[i], nil
+		}
+	}
+
+	export := &entities.PatientExport{
+		OrganizationID: patient.OrganizationID,
+		PatientID:      patient.ID,
+		RequestedBy:    requestedBy,
+		Status:         entities.ExportPending,
+	}
+	if err := s.repo.Create(ctx, export); err != nil {
+		return nil, fmt.Errorf("creating export: %w", err)
+	}
+	s.enqueue(export.ID)
+
+	s.log.Info("patient export requested", zap.String("exportID", export.ID), zap.String("patientID", patient.ID))
+	return export, nil
+}
+
+// Get returns one of the patient's exports.
+func (s *PatientExportService) Get(ctx context.Context, patientID, id string) (*entities.PatientExport, error) {
+	export, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if export.PatientID != patientID {
+		return nil, repositories.ErrNotFound
+	}
+	return export, nil
+}
+
+// ListByPatientID returns the patient's exports, newest first.
+func (s *PatientExportService) ListByPatientID(ctx context.Context, patientID string) ([]entities.PatientExport, error) {
+	if _, err := s.patientRepo.FindByID(ctx, patientID); err != nil {
+		return nil, err
+	}
+	exports, err := s.repo.FindByPatientID(ctx, patientID)
+	if err != nil {
+		return nil, fmt.Errorf("listing exports: %w", err)
+	}
+	return exports, nil
+}
+
+// DownloadURL returns a link to the archive that stops working when the
+// export expires, or "" if it cannot be downloaded.
+func (s *PatientExportService) DownloadURL(ctx context.Context, export *entities.PatientExport) (string, error) {
+	if !export.Downloadable(time.Now()) {
+		return "", nil
+	}
+	// Encrypted archives are ciphertext in the bucket, so clients fetch
+	// them through the API, which decrypts on the fly and checks expiry.
+	if s.s3Client.Encrypted() {
+		return "/api/v1/patients/" + export.PatientID + "/exports/" + export.ID + "/download", nil
+	}
+
+	ttl := min(time.Until(*export.ExpiresAt), maxPresignTTL)
+	url, err := s.s3Client.PresignURL(ctx, export.S3Key, ttl)
+	if err != nil {
+		return "", fmt.Errorf("presigning export: %w", err)
+	}
+	return url, nil
+}
+
+// Open returns the archive for streaming. The caller must close it.
+func (s *PatientExportService) Open(ctx context.Context, export *entities.PatientExport) (io.ReadCloser, error) {
+	switch {
+	case export.Status == entities.ExportExpired,
+		export.Status == entities.ExportReady && !export.Downloadable(time.Now()):
+		return nil, ErrExportExpired
+	case export.Status != entities.ExportReady:
+		return nil, ErrExportNotReady
+	}
+
+	body, err := s.s3Client.Download(ctx, export.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("downloading export: %w", err)
+	}
+	return body, nil
+}
+
+// enqueue schedules an export. A full queue is not fatal: the export stays
+// "pending" and is picked up by ResumePending.
+func (s *PatientExportService) enqueue(exportID string) {
+	err := s.queue.Enqueue(jobs.Job{
+		Name: "patient-export:" + exportID,
+		Run: func(ctx context.Context) error {
+			return s.Generate(ctx, exportID)
+		},
+	})
+	if err != nil {
+		s.log.Warn("patient export not queued", zap.String("exportID", exportID), zap.Error(err))
+	}
+}
+
+// ResumePending re-queues exports that never finished, e.g. because the
+// process restarted while they were queued or running.
+func (s *PatientExportService) ResumePending(ctx context.Context) error {
+	pending, err := s.repo.FindByStatus(ctx, []entities.ExportStatus{entities.ExportPending, entities.ExportRunning}, exportBatchSize)
+	if err != nil {
+		return fmt.Errorf("finding pending exports: %w", err)
+	}
+	for _, e := range pending {
+		s.enqueue(e.ID)
+	}
+	if len(pending) > 0 {
+		s.log.Info("pending patient exports re-queued", zap.Int("count", len(pending)))
+	}
+	return nil
+}
+
+// Generate builds and uploads the archive for one export, records the
+// outcome on the export and in the audit log.
+func (s *PatientExportService) Generate(ctx context.Context, exportID string) error {
+	export, err := s.repo.FindByID(ctx, exportID)
+	if err != nil {
+		return fmt.Errorf("finding export: %w", err)
+	}
+	if export.Status != entities.ExportPending && export.Status != entities.ExportRunning {
+		return nil
+	}
+
+	export.Status = entities.ExportRunning
+	if err := s.repo.Update(ctx, export); err != nil {
+		return fmt.Errorf("starting export: %w", err)
+	}
+
+	summary, err := s.build(ctx, export)
+	if err != nil {
+		export.Status = entities.ExportFailed
+		export.Error = "the archive could not be built"
+		if updErr := s.repo.Update(ctx, export); updErr != nil {
+			s.log.Error("recording export failure failed", zap.String("exportID", export.ID), zap.Error(updErr))
+		}
+		s.record(ctx, export, entities.AuditFailure, map[string]any{"error": err.Error()})
+		return fmt.Errorf("building export: %w", err)
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(s.linkTTL)
+	export.Status = entities.ExportReady
+	export.CompletedAt = &now
+	export.ExpiresAt = &expires
+	if err := s.repo.Update(ctx, export); err != nil {
+		return fmt.Errorf("saving export: %w", err)
+	}
+	s.record(ctx, export, entities.AuditSuccess, map[string]any{
+		"size":        export.Size,
+		"sha256":      export.SHA256,
+		"notes":       summary.notes,
+		"attachments": summary.attachments,
+	})
+
+	s.log.Info("patient export ready",
+		zap.String("exportID", export.ID),
+		zap.Int64("size", export.Size),
+		zap.Int("notes", summary.notes),
+		zap.Int("attachments", summary.attachments),
+	)
+	return nil
+}
+
+// PruneExpired deletes the archives of exports whose link has expired.
+func (s *PatientExportService) PruneExpired(ctx context.Context) error {
+	expired, err := s.repo.FindExpired(ctx, time.Now().UTC(), exportBatchSize)
+	if err != nil {
+		return fmt.Errorf("finding expired exports: %w", err)
+	}
+	for i := range expired {
+		e := &expired[i]
+		if err := s.s3Client.Delete(ctx, e.S3Key); err != nil {
+			return fmt.Errorf("deleting export %s: %w", e.ID, err)
+		}
+		e.Status = entities.ExportExpired
+		e.S3Key = ""
+		if err := s.repo.Update(ctx, e); err != nil {
+			return fmt.Errorf("expiring export %s: %w", e.ID, err)
+		}
+	}
+	if len(expired) > 0 {
+		s.log.Info("expired patient exports deleted", zap.Int("count", len(expired)))
+	}
+	return nil
+}
+
+// record audits the outcome of an export on behalf of whoever requested it.
+func (s *PatientExportService) record(ctx context.Context, export *entities.PatientExport, outcome string, details map[string]any) {
+	details["exportId"] = export.ID
+	err := s.audit.RecordEvent(ctx, &entities.AuditEvent{
+		ActorID:        &export.RequestedBy,
+		OrganizationID: &export.OrganizationID,
+		Action:         "patient.export_completed",
+		ResourceType:   "patient",
+		ResourceID:     export.PatientID,
+		PatientID:      &export.PatientID,
+		Outcome:        outcome,
+		Details:        details,
+	})
+	if err != nil {
+		s.log.Error("recording export audit event failed", zap.String("exportID", export.ID), zap.Error(err))
+	}
+}
+
+// exportCounts summarises what went into an archive.
+type exportCounts struct {
+	notes, attachments int
+}
+
+// build writes the archive to a temporary file, then uploads it and sets
+// the export's storage key, size and hash.
+func (s *PatientExportService) build(ctx context.Context, export *entities.PatientExport) (*exportCounts, error) {
+	manifest, files, err := s.collect(ctx, export)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "patient-export-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(tmp, hash))
+	if err := s.writeArchive(ctx, zw, manifest, files); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key := exportsPrefix + export.ID + ".zip"
+	_, err = s.s3Client.Upload(ctx, storage.UploadInput{
+		Key:         key,
+		Body:        tmp,
+		ContentType: "application/zip",
+		Size:        info.Size(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("uploading archive: %w", err)
+	}
+
+	export.S3Key = key
+	export.Size = info.Size()
+	export.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return &exportCounts{notes: len(manifest.Notes), attachments: len(files)}, nil
+}
+
+// exportManifest is manifest.json, the machine-readable record.
+type exportManifest struct {
+	Format      string            `json:"format"`
+	ExportID    string            `json:"exportId"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Patient     *entities.Patient `json:"patient"`
+	Notes       []exportNote      `json:"notes"`
+}
+
+type exportNote struct {
+	ID          string             `json:"id"`
+	AuthorID    string             `json:"authorId"`
+	Title       string             `json:"title"`
+	Content     string             `json:"content"`
+	SignedAt    *time.Time         `json:"signedAt,omitempty"`
+	SignedBy    *string            `json:"signedBy,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	Messages    []exportMessage    `json:"messages"`
+	Attachments []exportAttachment `json:"attachments"`
+}
+
+type exportMessage struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type exportAttachment struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"messageId,omitempty"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// File is the attachment's path in the archive.
+	File string `json:"file"`
+}
+
+// exportFile is an attachment to copy into the archive.
+type exportFile struct {
+	path  string
+	s3Key string
+}
+
+// collect reads everything that goes into the archive. It runs without an
+// actor, so it sees the whole record whoever requested it.
+func (s *PatientExportService) collect(ctx context.Context, export *entities.PatientExport) (*exportManifest, []exportFile, error) {
+	patient, err := s.patientRepo.FindByID(ctx, export.PatientID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding patient: %w", err)
+	}
+	notes, err := s.noteRepo.FindByPatientID(ctx, patient.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing notes: %w", err)
+	}
+
+	manifest := &exportManifest{
+		Format:      exportFormat,
+		ExportID:    export.ID,
+		GeneratedAt: time.Now().UTC(),
+		Patient:     patient,
+		Notes:       make([]exportNote, 0, len(notes)),
+	}
+	var files []exportFile
+	for _, n := range notes {
+		note := exportNote{
+			ID:          n.ID,
+			AuthorID:    n.UserID,
+			Title:       n.Title,
+			Content:     n.Content,
+			SignedAt:    n.SignedAt,
+			SignedBy:    n.SignedBy,
+			CreatedAt:   n.CreatedAt,
+			UpdatedAt:   n.UpdatedAt,
+			Messages:    []exportMessage{},
+			Attachments: []exportAttachment{},
+		}
+
+		conv, err := s.convRepo.FindByNoteID(ctx, n.ID, nil, nil)
+		switch {
+		case err == nil:
+			for _, m := range conv.Messages {
+				note.Messages = append(note.Messages, exportMessage{
+					ID:        m.ID,
+					Role:      string(m.Role),
+					Content:   m.Content,
+					CreatedAt: m.CreatedAt,
+				})
+			}
+		case !errors.Is(err, repositories.ErrNotFound):
+			return nil, nil, fmt.Errorf("finding conversation of note %s: %w", n.ID, err)
+		}
+
+		attachments, err := s.attachmentRepo.FindByNoteID(ctx, n.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing attachments of note %s: %w", n.ID, err)
+		}
+		for _, a := range attachments {
+			path := "attachments/" + a.ID + "/" + utils.SanitizeFilename(a.Name, "file")
+			note.Attachments = append(note.Attachments, exportAttachment{
+				ID:        a.ID,
+				MessageID: a.MessageID,
+				Name:      a.Name,
+				Type:      a.Type,
+				Size:      a.Size,
+				SHA256:    a.SHA256,
+				CreatedAt: a.CreatedAt,
+				File:      path,
+			})
+			files = append(files, exportFile{path: path, s3Key: a.S3Key})
+		}
+
+		manifest.Notes = append(manifest.Notes, note)
+	}
+	return manifest, files, nil
+}
+
+func (s *PatientExportService) writeArchive(ctx context.Context, zw *zip.Writer, manifest *exportManifest, files []exportFile) error {
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	w, err = zw.Create("summary.html")
+	if err != nil {
+		return err
+	}
+	if err := exportSummary.Execute(w, manifest); err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.copyFile(ctx, zw, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PatientExportService) copyFile(ctx context.Context, zw *zip.Writer, f exportFile) error {
+	body, err := s.s3Client.Download(ctx, f.s3Key)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", f.path, err)
+	}
+	defer body.Close()
+
+	w, err := zw.Create(f.path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return fmt.Errorf("copying %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// exportSummary is summary.html, the human-readable record. Links to
+// attachments are relative, so they work once the archive is extracted.
+var exportSummary = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Health record of {{.Patient.FirstName}} {{.Patient.LastName}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; line-height: 1.4; }
+dt { font-weight: bold; } dd { margin: 0 0 .5em 0; }
+.note { border-top: 1px solid #ccc; margin-top: 2em; }
+.content { white-space: pre-wrap; }
+.meta { color: #555; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>Health record of {{.Patient.FirstName}} {{.Patient.LastName}}</h1>
+<p class="meta">Generated {{.GeneratedAt.Format "2 January 2006 15:04 MST"}}. The same record is in manifest.json, in machine-readable form.</p>
+
+<h2>Personal details</h2>
+<dl>
+<dt>Name</dt><dd>{{.Patient.FirstName}} {{.Patient.LastName}}</dd>
+{{with .Patient.DateOfBirth}}<dt>Date of birth</dt><dd>{{.Format "2 January 2006"}}</dd>{{end}}
+{{with .Patient.Gender}}<dt>Gender</dt><dd>{{.}}</dd>{{end}}
+{{with .Patient.Email}}<dt>Email</dt><dd>{{.}}</dd>{{end}}
+{{with .Patient.PhoneNumber}}<dt>Phone</dt><dd>{{.}}</dd>{{end}}
+{{with .Patient.FullAddress}}<dt>Address</dt><dd>{{.}}</dd>{{end}}
+</dl>
+
+<h2>Notes ({{len .Notes}})</h2>
+{{range .Notes}}
+<section class="note">
+<h3>{{if .Title}}{{.Title}}{{else}}Untitled note{{end}}</h3>
+<p class="meta">Written {{.CreatedAt.Format "2 January 2006 15:04 MST"}}{{with .SignedAt}}, signed {{.Format "2 January 2006 15:04 MST"}}{{end}}</p>
+<div class="content">{{.Content}}</div>
+{{if .Attachments}}
+<h4>Attachments</h4>
+<ul>
+{{range .Attachments}}<li><a href="{{.File}}">{{.Name}}</a> <span class="meta">({{.Type}}, {{.Size}} bytes)</span></li>
+{{end}}</ul>
+{{end}}
+{{if .Messages}}
+<h4>Conversation</h4>
+{{range .Messages}}<p><strong>{{.Role}}</strong> <span class="meta">{{.CreatedAt.Format "2 January 2006 15:04 MST"}}</span></p>
+<div class="content">{{.Content}}</div>
+{{end}}
+{{end}}
+</section>
+{{else}}
+<p>There are no notes.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var (
+	ErrExportNotReady = errors.New("export is not ready")
+	ErrExportExpired  = errors.New("export has expired")
+)
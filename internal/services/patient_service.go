@@ -34,16 +34,29 @@ type UpdatePatientInput struct {
 	FullAddress *string `json:"fullAddress" validate:"omitempty,min=2,max=255"`
 }
 
+type AddCareTeamMemberInput struct {
+	UserID string `json:"userId" validate:"required,uuid"`
+}
+
 // Service
 type PatientService struct {
-	repo repositories.PatientRepository
-	log  *zap.Logger
+	repo         repositories.PatientRepository
+	careTeamRepo repositories.CareTeamRepository
+	orgRepo      repositories.OrganizationRepository
+	log          *zap.Logger
 }
 
-func NewPatientService(repo repositories.PatientRepository, log *zap.Logger) *PatientService {
+func NewPatientService(
+	repo repositories.PatientRepository,
+	careTeamRepo repositories.CareTeamRepository,
+	orgRepo repositories.OrganizationRepository,
+	log *zap.Logger,
+) *PatientService {
 	return &PatientService{
-		repo: repo,
-		log:  log.Named("patient-service"),
+		repo:         repo,
+		careTeamRepo: careTeamRepo,
+		orgRepo:      orgRepo,
+		log:          log.Named("patient-service"),
 	}
 }
 
@@ -162,8 +175,61 @@ func (s *PatientService) Update(ctx context.Context, id string, in UpdatePatient
 	return patient, nil
 }
 
+// ListCareTeam returns the users who share access to a patient with its
+// owner.
+func (s *PatientService) ListCareTeam(ctx context.Context, patientID string) ([]entities.CareTeamMember, error) {
+	if _, err := s.repo.FindByID(ctx, patientID); err != nil {
+		return nil, err
+	}
+	return s.careTeamRepo.ListByPatientID(ctx, patientID)
+}
+
+// AddCareTeamMember gives a user access to a patient on behalf of addedBy,
+// who must be able to see the patient themselves.
+func (s *PatientService) AddCareTeamMember(ctx context.Context, patientID, addedBy string, in AddCareTeamMemberInput) (*entities.CareTeamMember, error) {
+	patient, err := s.repo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if in.UserID == patient.UserID {
+		return nil, ErrCareTeamOwner
+	}
+	inOrg, err := s.orgRepo.IsMember(ctx, patient.OrganizationID, in.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("checking membership: %w", err)
+	}
+	if !inOrg {
+		return nil, ErrUnknownCareTeamUser
+	}
+
+	member := &entities.CareTeamMember{PatientID: patientID, UserID: in.UserID, AddedBy: addedBy}
+	if err := s.careTeamRepo.Add(ctx, member); err != nil {
+		return nil, fmt.Errorf("adding care team member: %w", err)
+	}
+	s.log.Info("care team member added",
+		zap.String("patientID", patientID),
+		zap.String("userID", in.UserID),
+		zap.String("addedBy", addedBy),
+	)
+	return member, nil
+}
+
+// RemoveCareTeamMember takes a user's shared access to a patient away.
+func (s *PatientService) RemoveCareTeamMember(ctx context.Context, patientID, userID string) error {
+	if _, err := s.repo.FindByID(ctx, patientID); err != nil {
+		return err
+	}
+	if err := s.careTeamRepo.Remove(ctx, patientID, userID); err != nil {
+		return err
+	}
+	s.log.Info("care team member removed", zap.String("patientID", patientID), zap.String("userID", userID))
+	return nil
+}
+
 var (
-	ErrPhoneNumberTaken   = errors.New("phone number already taken")
-	ErrInvalidGender      = errors.New("invalid gender")
-	ErrInvalidDateOfBirth = errors.New("invalid date of birth")
+	ErrCareTeamOwner       = errors.New("the patient's owner already has access")
+	ErrUnknownCareTeamUser = errors.New("user is not a member of the patient's organization")
+	ErrPhoneNumberTaken    = errors.New("phone number already taken")
+	ErrInvalidGender       = errors.New("invalid gender")
+	ErrInvalidDateOfBirth  = errors.New("invalid date of birth")
 )
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/jobs"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/preview"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+	"go.uber.org/zap"
+)
+
+// resumeBatchSize is how many pending previews are re-queued at startup.
+const resumeBatchSize = 500
+
+// PreviewService renders attachment thumbnails on a background queue and
+// stores them next to the original object.
+type PreviewService struct {
+	repo      repositories.AttachmentRepository
+	s3Client  *storage.Client
+	generator *preview.Generator
+	queue     *jobs.Queue
+	log       *zap.Logger
+}
+
+func NewPreviewService(
+	repo repositories.AttachmentRepository,
+	s3Client *storage.Client,
+	generator *preview.Generator,
+	queue *jobs.Queue,
+	log *zap.Logger,
+) *PreviewService {
+	return &PreviewService{
+		repo:      repo,
+		s3Client:  s3Client,
+		generator: generator,
+		queue:     queue,
+		log:       log.Named("preview_service"),
+	}
+}
+
+// Supports reports whether a preview will be generated for the MIME type.
+func (s *PreviewService) Supports(contentType string) bool {
+	return s.generator.Supports(contentType)
+}
+
+// Enqueue schedules preview generation. A full queue is not fatal: the
+// attachment stays "pending" and is picked up by ResumePending.
+func (s *PreviewService) Enqueue(attachmentID string) {
+	err := s.queue.Enqueue(jobs.Job{
+		Name: "preview:" + attachmentID,
+		Run: func(ctx context.Context) error {
+			return s.Generate(ctx, attachmentID)
+		},
+	})
+	if err != nil {
+		s.log.Warn("preview not queued", zap.String("attachmentID", attachmentID), zap.Error(err))
+	}
+}
+
+// ResumePending re-queues attachments whose preview never finished, e.g.
+// because the process restarted with jobs still buffered.
+func (s *PreviewService) ResumePending(ctx context.Context) error {
+	pending, err := s.repo.FindByPreviewStatus(ctx, entities.PreviewPending, resumeBatchSize)
+	if err != nil {
+		return fmt.Errorf("finding pending previews: %w", err)
+	}
+	for _, a := range pending {
+		s.Enqueue(a.ID)
+	}
+	if len(pending) > 0 {
+		s.log.Info("pending previews re-queued", zap.Int("count", len(pending)))
+	}
+	return nil
+}
+
+// Generate renders and uploads the preview for one attachment and records
+// the outcome on the attachment row.
+func (s *PreviewService) Generate(ctx context.Context, attachmentID string) error {
+	att, err := s.repo.FindByID(ctx, attachmentID)
+	if err != nil {
+		return fmt.Errorf("finding attachment: %w", err)
+	}
+	if att.PreviewStatus == entities.PreviewReady {
+		return nil
+	}
+
+	res, err := s.render(ctx, att)
+	if err != nil {
+		att.PreviewStatus = entities.PreviewFailed
+		if errors.Is(err, preview.ErrUnsupported) || errors.Is(err, preview.ErrTooLarge) {
+			att.PreviewStatus = entities.PreviewUnsupported
+		}
+		if updErr := s.repo.Update(ctx, att); updErr != nil {
+			s.log.Error("recording preview failure failed", zap.String("attachmentID", att.ID), zap.Error(updErr))
+		}
+		return fmt.Errorf("rendering preview: %w", err)
+	}
+
+	key := previewKey(att.S3Key)
+	_, err = s.s3Client.Upload(ctx, storage.UploadInput{
+		Key:         key,
+		Body:        bytes.NewReader(res.JPEG),
+		ContentType: "image/jpeg",
+		Size:        int64(len(res.JPEG)),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading preview: %w", err)
+	}
+
+	att.PreviewKey = key
+	att.PreviewStatus = entities.PreviewReady
+	att.Width = res.Width
+	att.Height = res.Height
+	att.PageCount = res.PageCount
+	if err := s.repo.Update(ctx, att); err != nil {
+		return fmt.Errorf("saving preview metadata: %w", err)
+	}
+
+	s.log.Info("preview generated",
+		zap.String("attachmentID", att.ID),
+		zap.String("previewKey", key),
+		zap.Int("width", res.Width),
+		zap.Int("height", res.Height),
+		zap.Int("pageCount", res.PageCount),
+	)
+	return nil
+}
+
+func (s *PreviewService) render(ctx context.Context, att *entities.Attachment) (*preview.Result, error) {
+	body, err := s.s3Client.Download(ctx, att.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("downloading original: %w", err)
+	}
+	defer body.Close()
+
+	return s.generator.Generate(ctx, att.Type, body)
+}
+
+// previewKey derives where a thumbnail lives from its original's key.
+func previewKey(s3Key string) string {
+	return s3Key + ".preview.jpg"
+}
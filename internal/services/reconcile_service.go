@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+	"go.uber.org/zap"
+)
+
+// attachmentsPrefix is where every attachment object (and preview) lives.
+const attachmentsPrefix = "attachments/"
+
+type ReconcileOptions struct {
+	// DeleteOrphans removes unreferenced objects older than GracePeriod.
+	// Without it the run only reports.
+	DeleteOrphans bool
+	// GracePeriod protects uploads whose database row has not been written
+	// yet. Orphans younger than this are reported but never deleted.
+	GracePeriod time.Duration
+}
+
+// OrphanObject is an object in S3 that no database row refers to.
+type OrphanObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Deleted      bool      `json:"deleted"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// ReconcileReport is the outcome of comparing the bucket with Postgres.
+type ReconcileReport struct {
+	StartedAt      time.Time      `json:"startedAt"`
+	FinishedAt     time.Time      `json:"finishedAt"`
+	ObjectsScanned int            `json:"objectsScanned"`
+	KeysReferenced int            `json:"keysReferenced"`
+	Orphans        []OrphanObject `json:"orphans"`
+	// Missing lists keys that live attachment rows point at but which are
+	// absent from the bucket.
+	Missing        []string `json:"missing"`
+	OrphansDeleted int      `json:"orphansDeleted"`
+	OrphanBytes    int64    `json:"orphanBytes"`
+}
+
+// ReconcileService compares attachment objects in S3 against the rows that
+// reference them. Keys referenced by soft-deleted rows are retained: they
+// are only released by a purge.
+type ReconcileService struct {
+	attachmentRepo repositories.AttachmentRepository
+	blobRepo       repositories.BlobRepository
+	s3Client       *storage.Client
+	log            *zap.Logger
+}
+
+func NewReconcileService(
+	attachmentRepo repositories.AttachmentRepository,
+	blobRepo repositories.BlobRepository,
+	s3Client *storage.Client,
+	log *zap.Logger,
+) *ReconcileService {
+	return &ReconcileService{
+		attachmentRepo: attachmentRepo,
+		blobRepo:       blobRepo,
+		s3Client:       s3Client,
+		log:            log.Named("reconcile_service"),
+	}
+}
+
+func (s *ReconcileService) Run(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	report := &ReconcileReport{StartedAt: time.Now().UTC()}
+
+	// Read the database before listing the bucket: an upload that lands in
+	// between shows up as a young orphan, which the grace period protects.
+	referenced, err := s.referencedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	liveKeys, err := s.attachmentRepo.ListStorageKeys(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("listing live attachment keys: %w", err)
+	}
+
+	objects, err := s.s3Client.List(ctx, attachmentsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing bucket: %w", err)
+	}
+
+	report.ObjectsScanned = len(objects)
+	report.KeysReferenced = len(referenced)
+
+	inBucket := make(map[string]struct{}, len(objects))
+	cutoff := time.Now().Add(-opts.GracePeriod)
+
+	for _, o := range objects {
+		inBucket[o.Key] = struct{}{}
+		if _, ok := referenced[o.Key]; ok {
+			continue
+		}
+
+		orphan := OrphanObject{Key: o.Key, Size: o.Size, LastModified: o.LastModified}
+		report.OrphanBytes += o.Size
+
+		if opts.DeleteOrphans && o.LastModified.Before(cutoff) {
+			if err := s.s3Client.Delete(ctx, o.Key); err != nil {
+				orphan.Error = err.Error()
+			} else {
+				orphan.Deleted = true
+				report.OrphansDeleted++
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	for _, key := range liveKeys {
+		if _, ok := inBucket[key]; !ok {
+			report.Missing = append(report.Missing, key)
+		}
+	}
+	sort.Strings(report.Missing)
+
+	report.FinishedAt = time.Now().UTC()
+	s.log.Info("reconciliation finished",
+		zap.Int("objectsScanned", report.ObjectsScanned),
+		zap.Int("orphans", len(report.Orphans)),
+		zap.Int("orphansDeleted", report.OrphansDeleted),
+		zap.Int("missing", len(report.Missing)),
+		zap.Bool("deleteOrphans", opts.DeleteOrphans),
+	)
+	return report, nil
+}
+
+// referencedKeys is every key some row still needs: originals and previews
+// of all attachments including soft-deleted ones, plus every blob.
+func (s *ReconcileService) referencedKeys(ctx context.Context) (map[string]struct{}, error) {
+	attachmentKeys, err := s.attachmentRepo.ListStorageKeys(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("listing attachment keys: %w", err)
+	}
+	blobKeys, err := s.blobRepo.ListS3Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing blob keys: %w", err)
+	}
+
+	keys := make(map[string]struct{}, len(attachmentKeys)+2*len(blobKeys))
+	for _, k := range attachmentKeys {
+		keys[k] = struct{}{}
+	}
+	for _, k := range blobKeys {
+		keys[k] = struct{}{}
+		keys[previewKey(k)] = struct{}{}
+	}
+	return keys, nil
+}
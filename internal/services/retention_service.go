@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/storage"
+	"go.uber.org/zap"
+)
+
+// purgeBatchSize bounds the rows read per query.
+const purgeBatchSize = 100
+
+// purgeOrder lists the purgeable tables children first, so rows whose
+// parent is also due are purged on their own rules before it. Users and
+// organisations are never purged: records and the audit log refer to them.
+var purgeOrder = []string{"attachments", "messages", "notes", "patients", "prompts"}
+
+type PlaceLegalHoldInput struct {
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
+
+// RetentionService purges soft-deleted rows for good once their table's
+// retention rule allows it, along with what hangs off them and their
+// objects in storage. Patients under a legal hold are never purged, nor is
+// anything of theirs.
+type RetentionService struct {
+	repo          repositories.RetentionRepository
+	holdRepo      repositories.LegalHoldRepository
+	patientRepo   repositories.PatientRepository
+	exportRepo    repositories.PatientExportRepository
+	attachmentSvc *AttachmentService
+	s3Client      *storage.Client
+	audit         *AuditService
+	rules         map[string]config.RetentionRule
+	log           *zap.Logger
+}
+
+func NewRetentionService(
+	repo repositories.RetentionRepository,
+	holdRepo repositories.LegalHoldRepository,
+	patientRepo repositories.PatientRepository,
+	exportRepo repositories.PatientExportRepository,
+	attachmentSvc *AttachmentService,
+	s3Client *storage.Client,
+	audit *AuditService,
+	cfg config.RetentionConfig,
+	log *zap.Logger,
+) *RetentionService {
+	return &RetentionService{
+		repo:          repo,
+		holdRepo:      holdRepo,
+		patientRepo:   patientRepo,
+		exportRepo:    exportRepo,
+		attachmentSvc: attachmentSvc,
+		s3Client:      s3Client,
+		audit:         audit,
+		rules:         cfg.Rules,
+		log:           log.Named("retention_service"),
+	}
+}
+
+// Purge runs the purge and saves its report. On a dry run nothing is
+// deleted and the report lists what would have been.
+func (s *RetentionService) Purge(ctx context.Context, dryRun bool) (*entities.PurgeReport, error) {
+	now := time.Now().UTC()
+	report := &entities.PurgeReport{DryRun: dryRun, StartedAt: now}
+
+	for _, table := range purgeOrder {
+		rule, ok := s.rules[table]
+		if !ok {
+			continue
+		}
+		counts, err := s.purgeTable(ctx, table, cutoffs(rule, now), dryRun, report)
+		report.Tables = append(report.Tables, counts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule, ok := s.rules["patients"]; ok {
+		held, err := s.repo.CountHeldPatients(ctx, cutoffs(rule, now))
+		if err != nil {
+			return nil, fmt.Errorf("counting held patients: %w", err)
+		}
+		report.HeldPatients = int(held)
+		if rule.MaxRetention > 0 {
+			overdue, err := s.repo.CountUnchangedPatients(ctx, now.Add(-rule.MaxRetention))
+			if err != nil {
+				return nil, fmt.Errorf("counting overdue patients: %w", err)
+			}
+			report.OverduePatients = int(overdue)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		report.Errors = append(report.Errors, "interrupted: "+err.Error())
+		// Save the report of what was done regardless.
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	if err := s.repo.CreateReport(ctx, report); err != nil {
+		return nil, fmt.Errorf("saving purge report: %w", err)
+	}
+	if !dryRun {
+		s.record(ctx, &entities.AuditEvent{
+			Action:       entities.AuditRetentionPurged,
+			ResourceType: "purge_report",
+			ResourceID:   report.ID,
+			Outcome:      outcomeOf(len(report.Errors) == 0),
+			Details:      reportDetails(report),
+		})
+	}
+
+	s.log.Info("retention purge finished",
+		zap.String("reportID", report.ID),
+		zap.Bool("dryRun", dryRun),
+		zap.Any("purged", reportDetails(report)),
+		zap.Int("errors", len(report.Errors)),
+	)
+	return report, nil
+}
+
+// purgeTable purges the due rows of one table, adding failures to the
+// report. Only a failure to find the rows is returned.
+func (s *RetentionService) purgeTable(ctx context.Context, table string, c repositories.PurgeCutoffs, dryRun bool, report *entities.PurgeReport) (entities.PurgedTable, error) {
+	counts := entities.PurgedTable{Table: table}
+	afterID := ""
+	for ctx.Err() == nil {
+		ids, err := s.repo.FindPurgeable(ctx, table, c, afterID, purgeBatchSize)
+		if err != nil {
+			return counts, fmt.Errorf("finding purgeable %s: %w", table, err)
+		}
+		for _, id := range ids {
+			counts.Eligible++
+			if dryRun {
+				counts.IDs = append(counts.IDs, id)
+				continue
+			}
+			err := s.purge(ctx, table, id)
+			if errors.Is(err, repositories.ErrOnHold) {
+				// Held since it was found: neither purged nor failed.
+				s.log.Info("purge skipped for legal hold", zap.String("table", table), zap.String("id", id))
+				continue
+			}
+			if errors.Is(err, repositories.ErrNotFound) {
+				// Deleted since it was found, e.g. by another purge.
+				counts.Gone++
+				s.log.Info("purge skipped for a row already gone", zap.String("table", table), zap.String("id", id))
+				continue
+			}
+			if err != nil {
+				counts.Failed++
+				report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", table, id, err))
+				s.log.Error("purge failed", zap.String("table", table), zap.String("id", id), zap.Error(err))
+				continue
+			}
+			counts.Purged++
+			counts.IDs = append(counts.IDs, id)
+		}
+		if len(ids) < purgeBatchSize {
+			break
+		}
+		afterID = ids[len(ids)-1]
+	}
+	return counts, nil
+}
+
+// purge hard-deletes one row: its attachments first, through the
+// attachment service so shared blobs are only removed with their last
+// reference, then the row and everything else under it. The repository
+// re-checks the legal hold, and keeps the patient locked, before anything
+// is deleted: a hold may have been placed since the row was found.
+// ErrNotFound means someone else deleted the row first, so there is
+// nothing to record.
+func (s *RetentionService) purge(ctx context.Context, table, id string) error {
+	var attachmentIDs []string
+	err := s.repo.HardDelete(ctx, table, id, func() error {
+		if table == "attachments" {
+			return s.purgeAttachment(ctx, id)
+		}
+
+		var err error
+		if attachmentIDs, err = s.repo.FindAttachmentIDs(ctx, table, id); err != nil {
+			return fmt.Errorf("listing attachments: %w", err)
+		}
+		for _, attID := range attachmentIDs {
+			if err := s.purgeAttachment(ctx, attID); err != nil {
+				return err
+			}
+		}
+		if table == "patients" {
+			return s.deleteExports(ctx, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if table == "patients" {
+		s.record(ctx, &entities.AuditEvent{
+			Action:       entities.AuditPatientPurged,
+			ResourceType: "patient",
+			ResourceID:   id,
+			PatientID:    &id,
+			Details:      map[string]any{"attachments": len(attachmentIDs)},
+		})
+	}
+	return nil
+}
+
+func (s *RetentionService) purgeAttachment(ctx context.Context, id string) error {
+	err := s.attachmentSvc.Purge(ctx, id)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("purging attachment %s: %w", id, err)
+	}
+	return nil
+}
+
+// deleteExports removes the patient's export archives from storage; the
+// rows go with the patient.
+func (s *RetentionService) deleteExports(ctx context.Context, patientID string) error {
+	exports, err := s.exportRepo.FindByPatientID(ctx, patientID)
+	if err != nil {
+		return fmt.Errorf("listing exports: %w", err)
+	}
+	for _, e := range exports {
+		if e.S3Key == "" {
+			continue
+		}
+		if err := s.s3Client.Delete(ctx, e.S3Key); err != nil {
+			return fmt.Errorf("deleting export %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *RetentionService) record(ctx context.Context, e *entities.AuditEvent) {
+	if err := s.audit.RecordEvent(ctx, e); err != nil {
+		s.log.Error("recording purge audit event failed", zap.String("action", e.Action), zap.Error(err))
+	}
+}
+
+// cutoffs turns a rule into the times that select due rows at now.
+func cutoffs(rule config.RetentionRule, now time.Time) repositories.PurgeCutoffs {
+	c := repositories.PurgeCutoffs{
+		DeletedBefore: now.Add(-rule.PurgeAfter),
+		ChangedBefore: now.Add(-rule.MinRetention),
+	}
+	if rule.MaxRetention > 0 {
+		expired := now.Add(-rule.MaxRetention)
+		c.ExpiredBefore = &expired
+	}
+	return c
+}
+
+// reportDetails summarises a report for the audit log: rows purged per
+// table, and failures.
+func reportDetails(report *entities.PurgeReport) map[string]any {
+	details := map[string]any{"heldPatients": report.HeldPatients}
+	for _, t := range report.Tables {
+		if report.DryRun {
+			details[t.Table] = t.Eligible
+		} else {
+			details[t.Table] = t.Purged
+		}
+		if t.Failed > 0 {
+			details[t.Table+"Failed"] = t.Failed
+		}
+	}
+	return details
+}
+
+func outcomeOf(ok bool) string {
+	if ok {
+		return entities.AuditSuccess
+	}
+	return entities.AuditFailure
+}
+
+// PlaceHold puts a legal hold on a patient, deleted or not.
+func (s *RetentionService) PlaceHold(ctx context.Context, patientID, placedBy string, in PlaceLegalHoldInput) (*entities.LegalHold, error) {
+	patient, err := s.patientRepo.FindUnscopedByID(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &entities.LegalHold{
+		OrganizationID: patient.OrganizationID,
+		PatientID:      patient.ID,
+		Reason:         strings.TrimSpace(in.Reason),
+		PlacedBy:       placedBy,
+	}
+	if hold.Reason == "" {
+		return nil, ErrHoldReasonRequired
+	}
+	if err := s.holdRepo.Create(ctx, hold); err != nil {
+		return nil, fmt.Errorf("creating legal hold: %w", err)
+	}
+
+	s.log.Info("legal hold placed", zap.String("holdID", hold.ID), zap.String("patientID", patient.ID))
+	return hold, nil
+}
+
+// ListHolds returns a patient's holds, active and released, newest first.
+func (s *RetentionService) ListHolds(ctx context.Context, patientID string) ([]entities.LegalHold, error) {
+	if _, err := s.patientRepo.FindUnscopedByID(ctx, patientID); err != nil {
+		return nil, err
+	}
+	holds, err := s.holdRepo.FindByPatientID(ctx, patientID)
+	if err != nil {
+		return nil, fmt.Errorf("listing legal holds: %w", err)
+	}
+	return holds, nil
+}
+
+// ReleaseHold ends a hold. The patient can be purged again once no other
+// hold is active.
+func (s *RetentionService) ReleaseHold(ctx context.Context, patientID, holdID, releasedBy string) (*entities.LegalHold, error) {
+	hold, err := s.holdRepo.FindByID(ctx, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.PatientID != patientID {
+		return nil, repositories.ErrNotFound
+	}
+	if !hold.Active() {
+		return nil, ErrHoldReleased
+	}
+
+	now := time.Now().UTC()
+	hold.ReleasedBy = &releasedBy
+	hold.ReleasedAt = &now
+	if err := s.holdRepo.Update(ctx, hold); err != nil {
+		return nil, fmt.Errorf("releasing legal hold: %w", err)
+	}
+
+	s.log.Info("legal hold released", zap.String("holdID", hold.ID), zap.String("patientID", patientID))
+	return hold, nil
+}
+
+// ListReports returns a page of purge reports, latest first, and the total.
+func (s *RetentionService) ListReports(ctx context.Context, offset, limit int) ([]entities.PurgeReport, int64, error) {
+	reports, total, err := s.repo.ListReports(ctx, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing purge reports: %w", err)
+	}
+	return reports, total, nil
+}
+
+func (s *RetentionService) GetReport(ctx context.Context, id string) (*entities.PurgeReport, error) {
+	return s.repo.FindReportByID(ctx, id)
+}
+
+var (
+	ErrHoldReasonRequired = errors.New("a reason is required")
+	ErrHoldReleased       = errors.New("legal hold has already been released")
+)
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/config"
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+// purgeLog records, in order, what a purge deletes.
+type purgeLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *purgeLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+// fakeRetentionRepo offers one due patient, who is put under a legal hold
+// between FindPurgeable and HardDelete when heldSinceFound is set, or
+// deleted by someone else when goneSinceFound is.
+type fakeRetentionRepo struct {
+	repositories.RetentionRepository
+	patientID      string
+	attachmentIDs  []string
+	heldSinceFound bool
+	goneSinceFound bool
+	log            *purgeLog
+	report         *entities.PurgeReport
+}
+
+func (r *fakeRetentionRepo) FindPurgeable(_ context.Context, table string, _ repositories.PurgeCutoffs, afterID string, _ int) ([]string, error) {
+	if table != "patients" || afterID != "" {
+		return nil, nil
+	}
+	return []string{r.patientID}, nil
+}
+
+func (r *fakeRetentionRepo) FindAttachmentIDs(context.Context, string, string) ([]string, error) {
+	return r.attachmentIDs, nil
+}
+
+func (r *fakeRetentionRepo) HardDelete(_ context.Context, table, id string, before func() error) error {
+	if r.heldSinceFound {
+		return repositories.ErrOnHold
+	}
+	if r.goneSinceFound {
+		return repositories.ErrNotFound
+	}
+	if err := before(); err != nil {
+		return err
+	}
+	r.log.add("rows of " + table + " " + id)
+	return nil
+}
+
+func (r *fakeRetentionRepo) CountHeldPatients(context.Context, repositories.PurgeCutoffs) (int64, error) {
+	if r.heldSinceFound {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *fakeRetentionRepo) CreateReport(_ context.Context, report *entities.PurgeReport) error {
+	report.ID = uuid.NewString()
+	r.report = report
+	return nil
+}
+
+type fakeExportRepo struct {
+	repositories.PatientExportRepository
+	exports []entities.PatientExport
+}
+
+func (r *fakeExportRepo) FindByPatientID(_ context.Context, patientID string) ([]entities.PatientExport, error) {
+	var out []entities.PatientExport
+	for _, e := range r.exports {
+		if e.PatientID == patientID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// newRetentionFixture returns a retention service purging a patient with
+// one attachment and one export archive, and what it deletes.
+func newRetentionFixture(t *testing.T, heldSinceFound bool) (*RetentionService, *fakeRetentionRepo, *fakeAttachmentRepo, *s3Stub) {
+	t.Helper()
+	hash := attachmentHash()
+	blobs := newFakeBlobRepo(entities.Blob{Hash: hash, S3Key: blobKey(hash), RefCount: 1, Status: entities.BlobUploaded})
+	attachmentSvc, attachments, stub := newAttachmentFixture(t, blobs)
+
+	log := &purgeLog{}
+	stub.onDelete = func(key string) { log.add("object " + key) }
+	patientID := uuid.NewString()
+	att := &entities.Attachment{ID: uuid.NewString(), S3Key: blobKey(hash), SHA256: hash}
+	attachments.attachments = append(attachments.attachments, att)
+	exports := &fakeExportRepo{exports: []entities.PatientExport{{ID: uuid.NewString(), PatientID: patientID, S3Key: "exports/" + patientID + ".zip"}}}
+
+	repo := &fakeRetentionRepo{patientID: patientID, attachmentIDs: []string{att.ID}, heldSinceFound: heldSinceFound, log: log}
+	cfg := config.RetentionConfig{Rules: map[string]config.RetentionRule{"patients": {PurgeAfter: 24 * time.Hour}}}
+	audit := NewAuditService(&fakeAuditRepo{}, zap.NewNop())
+	svc := NewRetentionService(repo, nil, nil, exports, attachmentSvc, attachmentSvc.s3Client, audit, cfg, zap.NewNop())
+	return svc, repo, attachments, stub
+}
+
+func TestPurgeSkipsPatientHeldSinceFound(t *testing.T) {
+	svc, repo, attachments, stub := newRetentionFixture(t, true)
+
+	report, err := svc.Purge(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	if len(stub.deletes) != 0 || len(repo.log.events) != 0 {
+		t.Errorf("deleted %v of a held patient", repo.log.events)
+	}
+	if len(attachments.attachments) != 1 {
+		t.Error("purged the attachment of a held patient")
+	}
+	if got := report.Tables[0]; got.Purged != 0 || got.Failed != 0 {
+		t.Errorf("patients purged = %d, failed = %d, want neither", got.Purged, got.Failed)
+	}
+	if len(report.Errors) != 0 || report.HeldPatients != 1 {
+		t.Errorf("report errors = %v, held = %d, want the patient counted as held", report.Errors, report.HeldPatients)
+	}
+}
+
+func TestPurgeDeletesInDependencyOrder(t *testing.T) {
+	svc, repo, attachments, _ := newRetentionFixture(t, false)
+
+	report, err := svc.Purge(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if report.Tables[0].Purged != 1 {
+		t.Fatalf("report = %+v, want the patient purged", report.Tables[0])
+	}
+
+	// The attachment's objects go with its row, then the export archives,
+	// and only then the patient's rows, once nothing refers to them.
+	key := blobKey(attachmentHash())
+	want := []string{
+		"object " + key,
+		"object " + previewKey(key),
+		"object exports/" + repo.patientID + ".zip",
+		"rows of patients " + repo.patientID,
+	}
+	if !slices.Equal(repo.log.events, want) {
+		t.Errorf("deleted\n\t%v\nwant\n\t%v", repo.log.events, want)
+	}
+	if len(attachments.attachments) != 0 {
+		t.Error("attachment row left behind")
+	}
+}
+
+// patientsPurged returns the patients the purge recorded as purged.
+func patientsPurged(svc *RetentionService) []string {
+	var ids []string
+	for _, e := range svc.audit.repo.(*fakeAuditRepo).events {
+		if e.Action == entities.AuditPatientPurged {
+			ids = append(ids, e.ResourceID)
+		}
+	}
+	return ids
+}
+
+func TestPurgeRecordsPatient(t *testing.T) {
+	svc, repo, _, _ := newRetentionFixture(t, false)
+
+	if _, err := svc.Purge(context.Background(), false); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if got := patientsPurged(svc); !slices.Equal(got, []string{repo.patientID}) {
+		t.Errorf("patients recorded as purged = %v, want %s", got, repo.patientID)
+	}
+}
+
+func TestPurgeSkipsPatientGoneSinceFound(t *testing.T) {
+	svc, repo, _, _ := newRetentionFixture(t, false)
+	repo.goneSinceFound = true
+
+	report, err := svc.Purge(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	if got := report.Tables[0]; got.Purged != 0 || got.Failed != 0 || got.Gone != 1 || len(got.IDs) != 0 {
+		t.Errorf("patients = %+v, want the patient counted as gone only", got)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("report errors = %v", report.Errors)
+	}
+	if got := patientsPurged(svc); len(got) != 0 {
+		t.Errorf("recorded %v as purged, though someone else deleted them", got)
+	}
+}
@@ -0,0 +1,571 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+	"github.com/jamesphm04/splose-clone-be/pkg/auth"
+)
+
+// ClientInfo describes the device a session is used from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionService issues token pairs backed by server-side sessions and
+// rotates refresh tokens. Access tokens are checked against their session
+// through a short-lived cache, so on other replicas a revocation takes
+// effect within one cache TTL.
+type SessionService struct {
+	repo       repositories.SessionRepository
+	userRepo   repositories.UserRepository
+	policyRepo repositories.MFAPolicyRepository
+	orgRepo    repositories.OrganizationRepository
+	jwtManager *auth.Manager
+	cache      *sessionCache
+	log        *zap.Logger
+}
+
+func NewSessionService(
+	repo repositories.SessionRepository,
+	userRepo repositories.UserRepository,
+	policyRepo repositories.MFAPolicyRepository,
+	orgRepo repositories.OrganizationRepository,
+	jwtManager *auth.Manager,
+	cacheTTL time.Duration,
+	log *zap.Logger,
+) *SessionService {
+	return &SessionService{
+		repo:       repo,
+		userRepo:   userRepo,
+		policyRepo: policyRepo,
+		orgRepo:    orgRepo,
+		jwtManager: jwtManager,
+		cache:      newSessionCache(cacheTTL),
+		log:        log.Named("session_service"),
+	}
+}
+
+// Start opens a new session for an authenticated user, signed in to the
+// organisation they joined first.
+func (s *SessionService) Start(ctx context.Context, user *entities.User, client ClientInfo) (*TokenPair, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	member, err := s.activeMembership(ctx, user.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &entities.Session{
+		UserID:         user.ID,
+		CurrentTokenID: uuid.NewString(),
+		OrganizationID: organizationOf(member),
+		ExpiresAt:      now.Add(s.jwtManager.RefreshTTL()),
+		UserAgent:      truncate(client.UserAgent, 512),
+		IP:             client.IP,
+		LastSeenAt:     now,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+
+	return s.issueTokenPair(ctx, user, session.ID, session.CurrentTokenID, member)
+}
+
+// Refresh exchanges a refresh token for a new pair. The presented token is
+// consumed: presenting it again revokes the session.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error) {
+	claims, err := s.jwtManager.Parse(refreshToken)
+	if err != nil {
+		s.log.Debug("token refresh failed: invalid token", zap.Error(err))
+		return nil, ErrInvalidRefreshToken
+	}
+	// Tokens minted before sessions existed carry no sid and cannot be rotated.
+	if claims.TokenType != auth.RefreshToken || claims.SessionID == "" || claims.ID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.repo.FindByID(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("finding session: %w", err)
+	}
+	if session.UserID != claims.UserID || !session.Active(time.Now()) {
+		s.log.Debug("token refresh failed: session inactive", zap.String("sessionID", session.ID))
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.CurrentTokenID != claims.ID {
+		return nil, s.reuseDetected(ctx, session)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		s.log.Warn("token refresh failed: user not found", zap.String("userID", session.UserID))
+		return nil, ErrInvalidRefreshToken
+	}
+	if user.Disabled() {
+		s.log.Debug("token refresh failed: user disabled", zap.String("userID", user.ID))
+		return nil, ErrInvalidRefreshToken
+	}
+	member, err := s.activeMembership(ctx, user.ID, session.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := uuid.NewString()
+	rotated, err := s.repo.Rotate(ctx, session.ID, claims.ID, repositories.RotateSession{
+		TokenID:        next,
+		ExpiresAt:      time.Now().UTC().Add(s.jwtManager.RefreshTTL()),
+		UserAgent:      truncate(client.UserAgent, 512),
+		IP:             client.IP,
+		OrganizationID: organizationOf(member),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rotating session: %w", err)
+	}
+	if !rotated {
+		// Another request rotated (or revoked) the session between the read
+		// and the update, so this token was presented twice.
+		return nil, s.reuseDetected(ctx, session)
+	}
+
+	pair, err := s.issueTokenPair(ctx, user, session.ID, next, member)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("tokens refreshed", zap.String("userID", user.ID), zap.String("sessionID", session.ID))
+	return pair, nil
+}
+
+// SwitchOrganization signs the session in to another of the user's
+// organisations and returns a new pair carrying it. The session's previous
+// refresh token is consumed; access tokens already issued keep their
+// organisation until they expire.
+func (s *SessionService) SwitchOrganization(ctx context.Context, userID, sessionID, orgID string, client ClientInfo) (*TokenPair, error) {
+	member, err := s.orgRepo.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrNotMember
+		}
+		return nil, fmt.Errorf("finding membership: %w", err)
+	}
+
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID || !session.Active(time.Now()) {
+		return nil, repositories.ErrNotFound
+	}
+	// Switching would mint a refresh token, outliving the impersonation.
+	if session.ImpersonatorID != nil {
+		return nil, ErrImpersonating
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := uuid.NewString()
+	rotated, err := s.repo.Rotate(ctx, session.ID, session.CurrentTokenID, repositories.RotateSession{
+		TokenID:        next,
+		ExpiresAt:      time.Now().UTC().Add(s.jwtManager.RefreshTTL()),
+		UserAgent:      truncate(client.UserAgent, 512),
+		IP:             client.IP,
+		OrganizationID: &orgID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rotating session: %w", err)
+	}
+	if !rotated {
+		// A concurrent refresh won; the client should retry with its new pair.
+		return nil, repositories.ErrNotFound
+	}
+
+	pair, err := s.issueTokenPair(ctx, user, session.ID, next, member)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("session switched organization",
+		zap.String("userID", userID),
+		zap.String("sessionID", sessionID),
+		zap.String("organizationID", orgID),
+	)
+	return pair, nil
+}
+
+// Impersonation is an access token for an admin acting as another user.
+type Impersonation struct {
+	AccessToken string    `json:"accessToken"`
+	SessionID   string    `json:"sessionId"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// Impersonate opens a session in which admin acts as user, lasting ttl.
+// It yields an access token flagged with the admin's ID and no refresh
+// token, so the session ends when the token expires.
+func (s *SessionService) Impersonate(ctx context.Context, admin, user *entities.User, ttl time.Duration, client ClientInfo) (*Impersonation, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	member, err := s.activeMembership(ctx, user.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &entities.Session{
+		UserID:         user.ID,
+		ImpersonatorID: &admin.ID,
+		CurrentTokenID: uuid.NewString(),
+		OrganizationID: organizationOf(member),
+		ExpiresAt:      now.Add(ttl),
+		UserAgent:      truncate(client.UserAgent, 512),
+		IP:             client.IP,
+		LastSeenAt:     now,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+
+	restrictions, err := s.restrictions(ctx, user, member)
+	if err != nil {
+		return nil, err
+	}
+	sub := auth.Subject{
+		UserID:         user.ID,
+		SessionID:      session.ID,
+		Restrictions:   restrictions,
+		ImpersonatorID: admin.ID,
+	}
+	if member != nil {
+		sub.Role = member.Role
+		sub.OrgID = member.OrganizationID
+	}
+	token, err := s.jwtManager.GenerateImpersonation(sub, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("generating impersonation token: %w", err)
+	}
+
+	s.log.Info("impersonation started",
+		zap.String("userID", user.ID),
+		zap.String("impersonatorID", admin.ID),
+		zap.String("sessionID", session.ID),
+	)
+	return &Impersonation{AccessToken: token, SessionID: session.ID, ExpiresAt: session.ExpiresAt}, nil
+}
+
+// EndImpersonation revokes an impersonation session of userID and returns
+// it.
+func (s *SessionService) EndImpersonation(ctx context.Context, userID, sessionID string) (*entities.Session, error) {
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID || session.ImpersonatorID == nil {
+		return nil, ErrNotImpersonating
+	}
+
+	if err := s.repo.Revoke(ctx, sessionID, entities.SessionRevokedImpersonation); err != nil {
+		return nil, fmt.Errorf("revoking session: %w", err)
+	}
+	s.cache.forget(sessionID)
+	s.log.Info("impersonation ended", zap.String("userID", userID), zap.String("sessionID", sessionID))
+	return session, nil
+}
+
+// Logout revokes one of the user's sessions.
+func (s *SessionService) Logout(ctx context.Context, userID, sessionID string) error {
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return repositories.ErrNotFound
+	}
+
+	if err := s.repo.Revoke(ctx, sessionID, entities.SessionRevokedLogout); err != nil {
+		return fmt.Errorf("revoking session: %w", err)
+	}
+	s.cache.forget(sessionID)
+	s.log.Info("session revoked", zap.String("userID", userID), zap.String("sessionID", sessionID))
+	return nil
+}
+
+// RevokeAll revokes every active session of a user and returns how many
+// there were.
+func (s *SessionService) RevokeAll(ctx context.Context, userID, reason string) (int64, error) {
+	n, err := s.repo.RevokeAllForUser(ctx, userID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("revoking sessions: %w", err)
+	}
+	s.cache.forgetUser(userID)
+	s.log.Info("sessions revoked", zap.String("userID", userID), zap.String("reason", reason), zap.Int64("count", n))
+	return n, nil
+}
+
+// ListActive returns the user's sessions that can still be used.
+func (s *SessionService) ListActive(ctx context.Context, userID string) ([]entities.Session, error) {
+	sessions, err := s.repo.ListActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// SessionActive reports whether an access token's session is still live.
+// Answers are cached for the cache TTL; a miss also refreshes the session's
+// last-seen time, so that costs at most one write per session per TTL.
+func (s *SessionService) SessionActive(ctx context.Context, userID, sessionID string) (bool, error) {
+	now := time.Now()
+	if active, ok := s.cache.get(sessionID, now); ok {
+		return active, nil
+	}
+
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			s.cache.put(sessionID, userID, "", false, now)
+			return false, nil
+		}
+		return false, fmt.Errorf("finding session: %w", err)
+	}
+
+	active := session.UserID == userID && session.Active(now)
+	if active {
+		// Disabling revokes the user's sessions as well; this also catches
+		// one started while the account was being disabled.
+		if active, err = s.userEnabled(ctx, userID); err != nil {
+			return false, err
+		}
+	}
+	var impersonatorID string
+	if session.ImpersonatorID != nil {
+		impersonatorID = *session.ImpersonatorID
+		if active {
+			if active, err = s.userEnabled(ctx, impersonatorID); err != nil {
+				return false, err
+			}
+		}
+	}
+	s.cache.put(sessionID, userID, impersonatorID, active, now)
+	if active {
+		if err := s.repo.Touch(ctx, sessionID, now.UTC()); err != nil {
+			// Last-seen is informational; do not fail the request over it.
+			s.log.Warn("updating session last-seen failed", zap.String("sessionID", sessionID), zap.Error(err))
+		}
+	}
+	return active, nil
+}
+
+func (s *SessionService) userEnabled(ctx context.Context, userID string) (bool, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("finding user: %w", err)
+	}
+	return !user.Disabled(), nil
+}
+
+// Prune deletes sessions that expired more than retain ago.
+func (s *SessionService) Prune(ctx context.Context, retain time.Duration) error {
+	n, err := s.repo.DeleteExpired(ctx, time.Now().UTC().Add(-retain))
+	if err != nil {
+		return fmt.Errorf("pruning sessions: %w", err)
+	}
+	s.log.Info("expired sessions pruned", zap.Int64("count", n))
+	return nil
+}
+
+func (s *SessionService) reuseDetected(ctx context.Context, session *entities.Session) error {
+	s.log.Warn("refresh token reuse detected – revoking session",
+		zap.String("userID", session.UserID),
+		zap.String("sessionID", session.ID),
+	)
+	if err := s.repo.Revoke(ctx, session.ID, entities.SessionRevokedReuse); err != nil {
+		return fmt.Errorf("revoking session: %w", err)
+	}
+	s.cache.forget(session.ID)
+	return ErrInvalidRefreshToken
+}
+
+// activeMembership keeps the session's organisation while the user is
+// still a member of it, and otherwise falls back to their oldest
+// membership. It returns nil for users without one.
+func (s *SessionService) activeMembership(ctx context.Context, userID string, current *string) (*entities.Membership, error) {
+	if current != nil {
+		member, err := s.orgRepo.FindMembership(ctx, *current, userID)
+		if err == nil {
+			return member, nil
+		}
+		if !errors.Is(err, repositories.ErrNotFound) {
+			return nil, fmt.Errorf("finding membership: %w", err)
+		}
+	}
+	memberships, err := s.orgRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing memberships: %w", err)
+	}
+	if len(memberships) == 0 {
+		return nil, nil
+	}
+	return &memberships[0], nil
+}
+
+// organizationOf returns the organisation of m, or nil without one.
+func organizationOf(m *entities.Membership) *string {
+	if m == nil {
+		return nil
+	}
+	return &m.OrganizationID
+}
+
+// issueTokenPair generate a pair of tokens for an authenticated user,
+// carrying the role they hold in the organisation of member.
+func (s *SessionService) issueTokenPair(ctx context.Context, user *entities.User, sessionID, tokenID string, member *entities.Membership) (*TokenPair, error) {
+	restrictions, err := s.restrictions(ctx, user, member)
+	if err != nil {
+		return nil, err
+	}
+	sub := auth.Subject{
+		UserID:       user.ID,
+		SessionID:    sessionID,
+		Restrictions: restrictions,
+	}
+	if member != nil {
+		sub.Role = member.Role
+		sub.OrgID = member.OrganizationID
+	}
+	access, err := s.jwtManager.GenerateAccessToken(sub)
+	if err != nil {
+		return nil, fmt.Errorf("generating access token: %w", err)
+	}
+	refresh, err := s.jwtManager.GenerateRefreshToken(sub, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("generating refresh token: %w", err)
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+// Account restrictions carried in access tokens. A restricted token can
+// manage the account but cannot reach clinical data.
+const (
+	RestrictionEmailUnverified  = "email_unverified"
+	RestrictionMFASetupRequired = "mfa_setup_required"
+	// RestrictionNoOrganization is set until the user joins a clinic.
+	RestrictionNoOrganization = "no_organization"
+)
+
+// restrictions lists what the user must still do before full access to
+// the organisation of member.
+func (s *SessionService) restrictions(ctx context.Context, user *entities.User, member *entities.Membership) ([]string, error) {
+	var r []string
+	if member == nil {
+		r = append(r, RestrictionNoOrganization)
+	}
+	if user.EmailVerifiedAt == nil {
+		r = append(r, RestrictionEmailUnverified)
+	}
+	if user.MFAEnabledAt == nil && member != nil {
+		required, err := s.policyRepo.IsRequired(ctx, member.Role)
+		if err != nil {
+			return nil, fmt.Errorf("checking mfa policy: %w", err)
+		}
+		if required {
+			r = append(r, RestrictionMFASetupRequired)
+		}
+	}
+	return r, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// sessionCache remembers recent SessionActive answers. Revocations made
+// through this process evict entries immediately.
+type sessionCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	userID         string
+	impersonatorID string
+	active         bool
+	expires        time.Time
+}
+
+// sessionCacheSweepAt is the size at which put drops expired entries.
+const sessionCacheSweepAt = 10000
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{ttl: ttl, entries: make(map[string]sessionCacheEntry)}
+}
+
+func (c *sessionCache) get(sessionID string, now time.Time) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[sessionID]
+	if !ok || now.After(e.expires) {
+		return false, false
+	}
+	return e.active, true
+}
+
+func (c *sessionCache) put(sessionID, userID, impersonatorID string, active bool, now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= sessionCacheSweepAt {
+		for id, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	c.entries[sessionID] = sessionCacheEntry{userID: userID, impersonatorID: impersonatorID, active: active, expires: now.Add(c.ttl)}
+}
+
+func (c *sessionCache) forget(sessionID string) {
+	c.mu.Lock()
+	delete(c.entries, sessionID)
+	c.mu.Unlock()
+}
+
+func (c *sessionCache) forgetUser(userID string) {
+	c.mu.Lock()
+	for id, e := range c.entries {
+		if e.userID == userID || e.impersonatorID == userID {
+			delete(c.entries, id)
+		}
+	}
+	c.mu.Unlock()
+}
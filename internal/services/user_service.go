@@ -4,19 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/jamesphm04/splose-clone-be/internal/authz"
 	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
 	"github.com/jamesphm04/splose-clone-be/internal/repositories"
-	"github.com/jamesphm04/splose-clone-be/pkg/auth"
 )
 
 type RegisterInput struct {
 	Email    string `json:"email"    validate:"required,email"`
 	Username string `json:"username" validate:"required,min=3,max=50"`
 	Password string `json:"password" validate:"required,min=8"`
+	// OrganizationName, if set, signs up a new clinic with the user as its
+	// clinic admin. Without it the user has to be added to a clinic before
+	// they can see any clinical data.
+	OrganizationName string `json:"organizationName" validate:"omitempty,max=255"`
 }
 
 type LoginInput struct {
@@ -29,35 +35,89 @@ type TokenPair struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// LoginResult holds either a token pair or, for users with MFA, a
+// challenge to complete with a second factor.
+type LoginResult struct {
+	Tokens       *TokenPair
+	MFAChallenge string
+}
+
 type UpdateUserInput struct {
 	Username string `json:"username" validate:"omitempty,min=3,max=50"`
 	Email    string `json:"email"    validate:"omitempty,email"`
 }
 
+type ChangeRoleInput struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type ImpersonateInput struct {
+	// Reason is kept in the audit trail, e.g. a support ticket.
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
+type ForceLogoutInput struct {
+	// ResetPassword also clears the user's password, so they have to set a
+	// new one through the emailed reset link before signing in again.
+	ResetPassword bool `json:"resetPassword"`
+}
+
 // Service
 type UserService struct {
 	repo       repositories.UserRepository
-	jwtManager *auth.Manager
+	sessionSvc *SessionService
+	mfaSvc     *MFAService
+	orgSvc     *OrganizationService
+	auditSvc   *AuditService
+	guard      *LoginGuard
 	bcryptCost int
-	log        *zap.Logger
+	// impersonationTTL bounds Impersonate sessions.
+	impersonationTTL time.Duration
+	// selfRegistration opens Register to the public; when off, accounts
+	// come from invitations.
+	selfRegistration bool
+	// dummyHash is compared against when there is no real hash to check, so
+	// a login for an unknown email costs the same bcrypt work as any other.
+	dummyHash []byte
+	log       *zap.Logger
 }
 
 func NewUserService(
 	repo repositories.UserRepository,
-	jwtManager *auth.Manager,
+	sessionSvc *SessionService,
+	mfaSvc *MFAService,
+	orgSvc *OrganizationService,
+	auditSvc *AuditService,
+	guard *LoginGuard,
 	bcryptCost int,
+	impersonationTTL time.Duration,
+	selfRegistration bool,
 	log *zap.Logger,
 ) *UserService {
+	// Only an out-of-range cost fails here, and Register would fail on it too.
+	dummy, _ := bcrypt.GenerateFromPassword([]byte(uuid.NewString()), bcryptCost)
 	return &UserService{
 		repo:       repo,
-		jwtManager: jwtManager,
+		sessionSvc: sessionSvc,
+		mfaSvc:     mfaSvc,
+		orgSvc:     orgSvc,
+		auditSvc:   auditSvc,
+		guard:      guard,
 		bcryptCost: bcryptCost,
-		log:        log.Named("user_service"),
+
+		impersonationTTL: impersonationTTL,
+		selfRegistration: selfRegistration,
+		dummyHash:        dummy,
+		log:              log.Named("user_service"),
 	}
 }
 
-// Register creates a new user after hashing the password
+// Register creates a new user after hashing the password, and their
+// clinic if they are signing one up.
 func (s *UserService) Register(ctx context.Context, in RegisterInput) (*entities.User, error) {
+	if !s.selfRegistration {
+		return nil, ErrRegistrationClosed
+	}
 	if _, err := s.repo.FindByEmail(ctx, in.Email); err == nil {
 		s.log.Warn("registration attempt with existing email", zap.String("email", in.Email))
 		return nil, ErrEmailTaken
@@ -74,69 +134,85 @@ func (s *UserService) Register(ctx context.Context, in RegisterInput) (*entities
 		Email:        in.Email,
 		Username:     in.Username,
 		PasswordHash: string(hash),
-		Role:         "user",
 	}
 
 	if err := s.repo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("creating user: %w", err)
 	}
+	if in.OrganizationName != "" {
+		if _, err := s.orgSvc.Create(ctx, user.ID, authz.RoleClinicAdmin, CreateOrganizationInput{Name: in.OrganizationName}); err != nil {
+			return nil, err
+		}
+	}
 
 	s.log.Info("user registered", zap.String("userID", user.ID), zap.String("email", user.Email))
 	return user, nil
 }
 
-// Login authenticates credentials and returns a JWT token pair
-func (s *UserService) Login(ctx context.Context, in LoginInput) (*entities.User, *TokenPair, error) {
+// Login authenticates credentials and returns a JWT token pair, or an MFA
+// challenge when the user has a second factor enrolled. Unknown emails and
+// wrong passwords fail with the same error after the same work, and both
+// count towards lockout.
+func (s *UserService) Login(ctx context.Context, in LoginInput, client ClientInfo) (*entities.User, *LoginResult, error) {
+	if err := s.guard.Check(ctx, in.Email, client.IP); err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.repo.FindByEmail(ctx, in.Email)
-	if err != nil {
-		if errors.Is(err, repositories.ErrNotFound) {
-			// Not and error, just a fail attempt
-			s.log.Debug("login failed: email not found", zap.String("email", in.Email))
-			return nil, nil, err
-		}
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil, fmt.Errorf("finding user by email: %w", err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(in.Password)); err != nil {
-		// Not and error, just a fail attempt
-		s.log.Debug("login failed: wrong password", zap.String("userID", user.ID))
+	hash := s.dummyHash
+	if user != nil && user.PasswordHash != "" {
+		hash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(in.Password)); err != nil || user == nil || user.PasswordHash == "" {
+		if err := s.guard.Failure(ctx, in.Email, client.IP); err != nil {
+			return nil, nil, err
+		}
+		s.log.Debug("login failed", zap.Bool("knownEmail", user != nil))
 		return nil, nil, ErrInvalidCredentials
 	}
 
-	pair, err := s.issueTokenPair(user.ID, user.Role)
+	res, err := s.IssueLogin(ctx, user, client)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	s.log.Info("user logged in", zap.String("userID", user.ID))
-	return user, pair, nil
-}
-
-// RefreshTokens validates a refresh token and issues a new pair
-func (s *UserService) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
-	claims, err := s.jwtManager.Parse(refreshToken)
-	if err != nil {
-		s.log.Debug("token refresh failed: invalid token", zap.Error(err))
-		return nil, ErrInvalidRefreshToken
+	// Failures are only forgotten once the whole login succeeds; with MFA
+	// that is when the second factor is checked, see
+	// MFAService.CompleteLogin. Clearing them here would let a password
+	// holder reset the count of wrong codes.
+	if res.Tokens != nil {
+		if err := s.guard.Success(ctx, in.Email); err != nil {
+			s.log.Warn("clearing login failures failed", zap.String("userID", user.ID), zap.Error(err))
+		}
 	}
+	return user, res, nil
+}
 
-	if claims.TokenType != auth.RefreshToken {
-		return nil, ErrInvalidRefreshToken
+// IssueLogin finishes a login whose first factor has been checked: it
+// starts a session, or returns an MFA challenge if the user has MFA.
+func (s *UserService) IssueLogin(ctx context.Context, user *entities.User, client ClientInfo) (*LoginResult, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
 	}
-
-	user, err := s.repo.FindByID(ctx, claims.UserID)
-	if err != nil {
-		s.log.Warn("token refresh failed: user not found", zap.String("userID", claims.UserID))
-		return nil, ErrInvalidCredentials
+	if user.MFAEnabledAt != nil {
+		challenge, err := s.mfaSvc.Challenge(user)
+		if err != nil {
+			return nil, err
+		}
+		s.log.Debug("login awaiting mfa", zap.String("userID", user.ID))
+		return &LoginResult{MFAChallenge: challenge}, nil
 	}
 
-	// Create a new pair of token
-	pair, err := s.issueTokenPair(user.ID, user.Role)
+	pair, err := s.sessionSvc.Start(ctx, user, client)
 	if err != nil {
 		return nil, err
 	}
 
-	s.log.Info("tokens refreshed", zap.String("userID", user.ID))
-	return pair, nil
+	s.log.Info("user logged in", zap.String("userID", user.ID))
+	return &LoginResult{Tokens: pair}, nil
 }
 
 func (s *UserService) GetByID(ctx context.Context, id string) (*entities.User, error) {
@@ -157,41 +233,282 @@ func (s *UserService) Update(ctx context.Context, id string, in UpdateUserInput)
 		user.Username = in.Username
 	}
 
-	if in.Email != "" {
+	emailChanged := in.Email != "" && in.Email != user.Email
+	if emailChanged {
+		if _, err := s.repo.FindByEmail(ctx, in.Email); err == nil {
+			return nil, ErrEmailTaken
+		}
+		// Nobody has confirmed the new address yet.
 		user.Email = in.Email
+		user.EmailVerifiedAt = nil
 	}
 
 	if err := s.repo.Update(ctx, user); err != nil {
+		if errors.Is(err, repositories.ErrDuplicateKey) {
+			return nil, ErrEmailTaken
+		}
 		return nil, err
 	}
 
-	s.log.Info("user updated", zap.String("userID", id))
+	if emailChanged {
+		// Tokens carry their restrictions; sign in again to pick up
+		// email_unverified.
+		if _, err := s.sessionSvc.RevokeAll(ctx, id, entities.SessionRevokedEmailChanged); err != nil {
+			return nil, err
+		}
+	}
+
+	s.log.Info("user updated", zap.String("userID", id), zap.Bool("emailChanged", emailChanged))
 	return user, nil
 }
 
-func (s *UserService) SoftDelete(ctx context.Context, id string) error {
-	if err := s.repo.SoftDelete(ctx, id); err != nil {
+// CheckManage returns authz.ErrForbidden unless the actor may manage the
+// user id: themselves, or another user whose role in the actor's
+// organisation they can manage. Users outside the actor's organisation are
+// reported as not found, unless the actor administers the whole system.
+func (s *UserService) CheckManage(ctx context.Context, actorID, actorRole, id string) error {
+	if actorID == id {
+		return nil
+	}
+	var member *entities.Membership
+	if a, ok := authz.ActorFrom(ctx); ok && a.OrgID != "" {
+		m, err := s.orgSvc.FindMembership(ctx, a.OrgID, id)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return fmt.Errorf("finding membership: %w", err)
+		}
+		member = m
+	}
+	if member == nil && !authz.Has(actorRole, authz.SystemManage) {
+		return repositories.ErrNotFound
+	}
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
 		return err
 	}
-	s.log.Info("user deleted", zap.String("userID", id))
+	// Without a role to go by, only those who manage every role may act.
+	target := authz.RoleAdmin
+	if member != nil {
+		target = member.Role
+	}
+	if !authz.CanManage(actorRole, target) {
+		return authz.ErrForbidden
+	}
+	return nil
+}
+
+// AssignRole is ChangeRole on behalf of a staff member, in the organisation
+// they are signed in to. They may only move users between roles they can
+// manage, and not change their own.
+func (s *UserService) AssignRole(ctx context.Context, actorID, actorRole, orgID, id string, in ChangeRoleInput) (*entities.Membership, error) {
+	if actorID == id {
+		return nil, ErrOwnRole
+	}
+	if orgID == "" {
+		return nil, ErrNoOrganization
+	}
+	if !authz.CanManage(actorRole, in.Role) {
+		return nil, authz.ErrForbidden
+	}
+	if err := s.CheckManage(ctx, actorID, actorRole, id); err != nil {
+		return nil, err
+	}
+	return s.ChangeRole(ctx, orgID, id, in)
+}
+
+// ChangeRole sets the role a user holds in the organisation orgID; their
+// roles in other organisations are unchanged. Existing sessions carry the
+// old role in their tokens, so they are revoked and the user has to sign
+// in again.
+func (s *UserService) ChangeRole(ctx context.Context, orgID, id string, in ChangeRoleInput) (*entities.Membership, error) {
+	if !authz.ValidRole(in.Role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, in.Role)
+	}
+	member, err := s.orgSvc.FindMembership(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == in.Role {
+		return member, nil
+	}
+
+	from := member.Role
+	if err := s.orgSvc.UpdateRole(ctx, orgID, id, in.Role); err != nil {
+		return nil, err
+	}
+	member.Role = in.Role
+	if _, err := s.sessionSvc.RevokeAll(ctx, id, entities.SessionRevokedRoleChanged); err != nil {
+		return nil, err
+	}
+	details := map[string]any{"organizationId": orgID, "from": from, "to": in.Role}
+	if err := s.auditSvc.Record(ctx, entities.AuditUserRoleChanged, "user", id, details); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("user role changed", zap.String("userID", id), zap.String("organizationID", orgID), zap.String("role", in.Role))
+	return member, nil
+}
+
+// Unlock lifts a login lockout on the user's account.
+func (s *UserService) Unlock(ctx context.Context, id string) error {
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.guard.Unlock(ctx, user.Email); err != nil {
+		return err
+	}
+	s.log.Info("user login unlocked", zap.String("userID", id))
 	return nil
 }
 
-// issueTokenPair generate a pair of tokens for an authenticated user
-func (s *UserService) issueTokenPair(userID, role string) (*TokenPair, error) {
-	access, err := s.jwtManager.GenerateAccessToken(userID, role)
+// SetDisabled blocks or unblocks a user's account without deleting it.
+// Disabling signs the user out everywhere.
+func (s *UserService) SetDisabled(ctx context.Context, actorID, id string, disabled bool) (*entities.User, error) {
+	if disabled && actorID == id {
+		return nil, ErrOwnAccount
+	}
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled() == disabled {
+		return user, nil
+	}
+
+	action := entities.AuditUserEnabled
+	user.DisabledAt = nil
+	if disabled {
+		action = entities.AuditUserDisabled
+		now := time.Now().UTC()
+		user.DisabledAt = &now
+	}
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if disabled {
+		if _, err := s.sessionSvc.RevokeAll(ctx, id, entities.SessionRevokedUserDisabled); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.auditSvc.Record(ctx, action, "user", id, nil); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("user disabled state changed", zap.String("userID", id), zap.Bool("disabled", disabled))
+	return user, nil
+}
+
+// Restore brings back a soft-deleted user. Their sessions were revoked on
+// deletion, so they sign in again.
+func (s *UserService) Restore(ctx context.Context, id string) (*entities.User, error) {
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.auditSvc.Record(ctx, entities.AuditUserRestored, "user", id, nil); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("user restored", zap.String("userID", id))
+	return s.repo.FindByID(ctx, id)
+}
+
+// ForceLogout revokes all of a user's sessions, and clears their password
+// if in.ResetPassword is set. It returns the user so the caller can send
+// the reset email.
+func (s *UserService) ForceLogout(ctx context.Context, id string, in ForceLogoutInput) (*entities.User, error) {
+	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("generating access token: %w", err)
+		return nil, err
 	}
-	refresh, err := s.jwtManager.GenerateRefreshToken(userID, role)
+	if in.ResetPassword && user.PasswordHash != "" {
+		user.PasswordHash = ""
+		if err := s.repo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	n, err := s.sessionSvc.RevokeAll(ctx, id, entities.SessionRevokedAdmin)
 	if err != nil {
-		return nil, fmt.Errorf("generating refresh token: %w", err)
+		return nil, err
 	}
-	return &TokenPair{AccessToken: access, RefreshToken: refresh}, nil
+	details := map[string]any{"sessions": n, "resetPassword": in.ResetPassword}
+	if err := s.auditSvc.Record(ctx, entities.AuditUserLoggedOut, "user", id, details); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("user logged out by admin", zap.String("userID", id), zap.Bool("resetPassword", in.ResetPassword))
+	return user, nil
+}
+
+// Impersonate lets an admin act as another user for a limited time, to see
+// what they see. Users who are admins in any organisation cannot be
+// impersonated, nor can disabled users.
+func (s *UserService) Impersonate(ctx context.Context, actorID, actorRole, id string, in ImpersonateInput, client ClientInfo) (*Impersonation, error) {
+	if actorID == id {
+		return nil, ErrImpersonateSelf
+	}
+	admin, err := s.repo.FindByID(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := s.orgSvc.ListForUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("listing memberships: %w", err)
+	}
+	for _, m := range memberships {
+		if m.Role == authz.RoleAdmin || !authz.CanManage(actorRole, m.Role) {
+			return nil, ErrImpersonateAdmin
+		}
+	}
+
+	imp, err := s.sessionSvc.Impersonate(ctx, admin, user, s.impersonationTTL, client)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"reason": in.Reason, "sessionId": imp.SessionID, "expiresAt": imp.ExpiresAt}
+	if err := s.auditSvc.Record(ctx, entities.AuditImpersonationStarted, "user", id, details); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// EndImpersonation ends the impersonation session the request was made
+// in.
+func (s *UserService) EndImpersonation(ctx context.Context, userID, sessionID string) error {
+	session, err := s.sessionSvc.EndImpersonation(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	return s.auditSvc.Record(ctx, entities.AuditImpersonationEnded, "user", userID, map[string]any{"sessionId": session.ID})
+}
+
+func (s *UserService) SoftDelete(ctx context.Context, id string) error {
+	if err := s.repo.SoftDelete(ctx, id); err != nil {
+		return err
+	}
+	if _, err := s.sessionSvc.RevokeAll(ctx, id, entities.SessionRevokedUserDeleted); err != nil {
+		return err
+	}
+	if err := s.auditSvc.Record(ctx, entities.AuditUserDeleted, "user", id, nil); err != nil {
+		return err
+	}
+	s.log.Info("user deleted", zap.String("userID", id))
+	return nil
 }
 
 var (
 	ErrEmailTaken          = errors.New("email already taken")
 	ErrInvalidCredentials  = errors.New("invalid email or password")
 	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidRole         = errors.New("unknown role")
+	ErrOwnRole             = errors.New("you cannot change your own role")
+	ErrRegistrationClosed  = errors.New("registration is by invitation only")
+	ErrOwnAccount          = errors.New("you cannot disable your own account")
+	ErrAccountDisabled     = errors.New("account is disabled")
+	ErrImpersonateSelf     = errors.New("you cannot impersonate yourself")
+	ErrImpersonateAdmin    = errors.New("admins cannot be impersonated")
+	ErrImpersonating       = errors.New("not allowed while impersonating")
+	ErrNotImpersonating    = errors.New("this session is not an impersonation")
 )
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jamesphm04/splose-clone-be/internal/models/entities"
+	"github.com/jamesphm04/splose-clone-be/internal/repositories"
+)
+
+// racingUserRepo misses an address registered concurrently, which the
+// unique index then catches.
+type racingUserRepo struct {
+	*fakeUserRepo
+}
+
+func (racingUserRepo) FindByEmail(context.Context, string) (*entities.User, error) {
+	return nil, repositories.ErrNotFound
+}
+
+func newUserServiceFixture(repo repositories.UserRepository) (*UserService, *fakeSessionRepo) {
+	sessions := &fakeSessionRepo{}
+	sessionSvc := NewSessionService(sessions, repo, nil, nil, nil, time.Minute, zap.NewNop())
+	return NewUserService(repo, sessionSvc, nil, nil, nil, nil, bcrypt.MinCost, time.Hour, false, zap.NewNop()), sessions
+}
+
+func TestUpdateEmailNeedsVerifyingAgain(t *testing.T) {
+	verified := time.Now().Add(-time.Hour)
+	user := &entities.User{Email: "old@example.com", Username: "casey", EmailVerifiedAt: &verified}
+	svc, sessions := newUserServiceFixture(newFakeUserRepo(user))
+
+	got, err := svc.Update(context.Background(), user.ID, UpdateUserInput{Email: "new@example.com"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got.Email != "new@example.com" || got.EmailVerifiedAt != nil {
+		t.Errorf("email = %q, verified at %v; want the new address unverified", got.Email, got.EmailVerifiedAt)
+	}
+	if reason := sessions.revoked[user.ID]; reason != entities.SessionRevokedEmailChanged {
+		t.Errorf("sessions revoked with %q, want %q", reason, entities.SessionRevokedEmailChanged)
+	}
+}
+
+func TestUpdateKeepsVerificationOtherwise(t *testing.T) {
+	verified := time.Now().Add(-time.Hour)
+	user := &entities.User{Email: "same@example.com", Username: "casey", EmailVerifiedAt: &verified}
+	svc, sessions := newUserServiceFixture(newFakeUserRepo(user))
+
+	for _, in := range []UpdateUserInput{{Username: "casey2"}, {Email: "same@example.com"}} {
+		got, err := svc.Update(context.Background(), user.ID, in)
+		if err != nil {
+			t.Fatalf("Update(%+v): %v", in, err)
+		}
+		if got.EmailVerifiedAt == nil {
+			t.Errorf("Update(%+v) cleared the verification", in)
+		}
+	}
+	if len(sessions.revoked) != 0 {
+		t.Errorf("sessions revoked without an email change: %v", sessions.revoked)
+	}
+}
+
+func TestUpdateEmailTaken(t *testing.T) {
+	user := &entities.User{Email: "casey@example.com"}
+	other := &entities.User{Email: "taken@example.com"}
+	users := newFakeUserRepo(user, other)
+
+	for name, repo := range map[string]repositories.UserRepository{
+		"found first":          users,
+		"registered meanwhile": racingUserRepo{users},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc, _ := newUserServiceFixture(repo)
+			if _, err := svc.Update(context.Background(), user.ID, UpdateUserInput{Email: other.Email}); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("Update: err = %v, want ErrEmailTaken", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxFilenameLength caps the sanitised name so S3 keys stay well below the
+// 256 character column limit.
+const maxFilenameLength = 100
+
+// SanitizeFilename reduces a client supplied filename to a safe S3 key
+// segment: directory parts are dropped (for both / and \ separators), anything
+// outside [A-Za-z0-9._-] becomes "_", runs of "_" are collapsed, leading dots
+// are removed so the object is never "hidden", Windows device names such as
+// "CON" get a "_" so the file can be saved there, and the result is truncated
+// while keeping the extension. fallback is returned when nothing usable remains.
+func SanitizeFilename(name, fallback string) string {
+	// Treat Windows separators as path separators too before taking the base.
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = filepath.Base(name)
+	if name == "." || name == "/" {
+		name = ""
+	}
+
+	var b strings.Builder
+	lastUnderscore := false
+	for _, r := range name {
+		keep := r < unicode.MaxASCII &&
+			(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_')
+		if !keep {
+			r = '_'
+		}
+		if r == '_' {
+			if lastUnderscore {
+				continue
+			}
+			lastUnderscore = true
+		} else {
+			lastUnderscore = false
+		}
+		b.WriteRune(r)
+	}
+
+	safe := strings.TrimLeft(b.String(), "._")
+	safe = strings.TrimRight(safe, "_")
+	if safe == "" {
+		return fallback
+	}
+
+	// Windows refuses these names with any extension ("nul.txt" too).
+	if stem, ext, found := strings.Cut(safe, "."); reservedNames[strings.ToUpper(stem)] {
+		safe = stem + "_"
+		if found {
+			safe += "." + ext
+		}
+	}
+
+	if len(safe) > maxFilenameLength {
+		ext := filepath.Ext(safe)
+		if len(ext) > maxFilenameLength/4 {
+			ext = ""
+		}
+		safe = safe[:maxFilenameLength-len(ext)] + ext
+	}
+
+	return safe
+}
+
+// reservedNames are the Windows device names, upper-cased.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 150)
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"plain", "referral-2026_v2.pdf", "referral-2026_v2.pdf"},
+		{"unix path", "/etc/passwd", "passwd"},
+		{"traversal", "../../secrets.txt", "secrets.txt"},
+		{"windows path", `C:\Users\pat\scan.png`, "scan.png"},
+		{"windows traversal", `..\..\boot.ini`, "boot.ini"},
+		{"trailing separator", "reports/", "reports"},
+		{"spaces", "Pat Ient  scan.pdf", "Pat_Ient_scan.pdf"},
+		{"control characters", "scan\x00\r\n\t.pdf", "scan_.pdf"},
+		{"header injection", "a.pdf\"; filename=evil.exe", "a.pdf_filename_evil.exe"},
+		{"non-ASCII", "résumé €.pdf", "r_sum_.pdf"},
+		{"hidden", ".htaccess", "htaccess"},
+		{"underscores collapsed and trimmed", "__a___b__", "a_b"},
+		{"reserved", "CON", "CON_"},
+		{"reserved with extension", "nul.txt", "nul_.txt"},
+		{"reserved with two extensions", "Com1.tar.gz", "Com1_.tar.gz"},
+		{"merely starts like one", "console.log", "console.log"},
+		{"truncated keeping extension", long + ".pdf", long[:96] + ".pdf"},
+		{"truncated with an overlong extension", "a." + long, ("a." + long)[:100]},
+		{"empty", "", "fallback.bin"},
+		{"dot", ".", "fallback.bin"},
+		{"dot dot", "..", "fallback.bin"},
+		{"root", "/", "fallback.bin"},
+		{"nothing usable", "???", "fallback.bin"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SanitizeFilename(tc.in, "fallback.bin")
+			if got != tc.want {
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+			if len(got) > maxFilenameLength {
+				t.Errorf("%d characters, want at most %d", len(got), maxFilenameLength)
+			}
+		})
+	}
+}
@@ -67,6 +67,36 @@ func Conflict(c *gin.Context, msg string) {
 	c.JSON(http.StatusConflict, Response{Success: false, Error: msg})
 }
 
+// Gone sends a 410 error response, for resources that have expired.
+func Gone(c *gin.Context, msg string) {
+	c.JSON(http.StatusGone, Response{Success: false, Error: msg})
+}
+
+// PayloadTooLarge sends a 413 error response.
+func PayloadTooLarge(c *gin.Context, msg string) {
+	c.JSON(http.StatusRequestEntityTooLarge, Response{Success: false, Error: msg})
+}
+
+// UnsupportedMediaType sends a 415 error response.
+func UnsupportedMediaType(c *gin.Context, msg string) {
+	c.JSON(http.StatusUnsupportedMediaType, Response{Success: false, Error: msg})
+}
+
+// ForbiddenMsg sends a 403 error response with an explanation.
+func ForbiddenMsg(c *gin.Context, msg string) {
+	c.JSON(http.StatusForbidden, Response{Success: false, Error: msg})
+}
+
+// Accepted sends a 202 response for work that completes asynchronously.
+func Accepted(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusAccepted, Response{Success: true, Data: data})
+}
+
+// TooManyRequests sends a 429 error response.
+func TooManyRequests(c *gin.Context, msg string) {
+	c.JSON(http.StatusTooManyRequests, Response{Success: false, Error: msg})
+}
+
 // InternalError sends a 500 error response.
 // The raw err is NOT exposed to the client to avoid leaking internals.
 func InternalError(c *gin.Context) {
@@ -0,0 +1,30 @@
+package auth
+
+import "strings"
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a JWT.
+const APIKeyPrefix = "spk_"
+
+// APIKeyPrincipal is who an API key acts as and what it may do.
+type APIKeyPrincipal struct {
+	KeyID  string
+	UserID string
+	Role   string
+	OrgID  string
+	Scopes []string
+}
+
+// NewAPIKey returns a new API key and the hash to store in its place.
+func NewAPIKey() (key, hash string, err error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, HashOpaqueToken(key), nil
+}
+
+// IsAPIKey reports whether a bearer credential looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
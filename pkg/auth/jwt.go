@@ -14,57 +14,146 @@ type TokenType string
 const (
 	AccessToken  TokenType = "access"
 	RefreshToken TokenType = "refresh"
+	// MFAChallengeToken proves the password step of a login succeeded. It
+	// can only be exchanged, with a second factor, for a token pair.
+	MFAChallengeToken TokenType = "mfa_challenge"
+	// InvitationToken admits its holder to an organisation. Its "jti" names
+	// the invitation's current token, so resending one retires the last.
+	InvitationToken TokenType = "invitation"
 )
 
+// mfaChallengeTTL is how long a user has to enter their second factor.
+const mfaChallengeTTL = 5 * time.Minute
+
 // Claims extends the standard JWT registered claims with application-specific
 // fields. These are embedded in both access and refresh tokens
 type Claims struct {
 	UserID    string    `json:"id"`
 	Role      string    `json:"role"`
 	TokenType TokenType `json:"type"`
+	// SessionID ties the token to a server-side session (refresh-token
+	// family). RegisteredClaims.ID ("jti") identifies a refresh token within it.
+	SessionID string `json:"sid,omitempty"`
+	// OrgID is the organisation the token acts in; empty for users who
+	// belong to none.
+	OrgID string `json:"org,omitempty"`
+	// Restrictions limit what an access token may be used for until the
+	// account is fully set up, e.g. "email_unverified".
+	Restrictions []string `json:"rst,omitempty"`
+	// ImpersonatorID is set on access tokens an admin uses to act as
+	// UserID; it is the admin's own user ID.
+	ImpersonatorID string `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Subject is who a token is issued to.
+type Subject struct {
+	UserID       string
+	Role         string
+	SessionID    string
+	OrgID        string
+	Restrictions []string
+	// ImpersonatorID, if set, flags the token as an impersonation.
+	ImpersonatorID string
+}
+
 // Manager handles token signing and verification
 type Manager struct {
 	secret     []byte
+	keys       *KeySet
 	accessTTL  time.Duration
 	refreshTTL time.Duration
 }
 
-// NewManager creates a Manager with the given HMAC-SHA256 secret and TTLs.
-func NewManager(secret string, accessTTL, refreshTTL time.Duration) *Manager {
-	return &Manager{
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithKeySet signs tokens with the set's active key instead of the HMAC
+// secret. If a secret is also given it is kept for verification only, so
+// HS256 tokens issued before the switch stay valid until they expire.
+func WithKeySet(ks *KeySet) Option {
+	return func(m *Manager) { m.keys = ks }
+}
+
+// NewManager creates a Manager with the given TTLs. Without options tokens
+// are signed with HMAC-SHA256 using secret.
+func NewManager(secret string, accessTTL, refreshTTL time.Duration, opts ...Option) *Manager {
+	m := &Manager{
 		secret:     []byte(secret),
 		accessTTL:  accessTTL,
 		refreshTTL: refreshTTL,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // GenerateAccessToken mints a short-lived access JWT for the given user
-func (m *Manager) GenerateAccessToken(userID, role string) (string, error) {
-	return m.generate(userID, role, AccessToken, m.accessTTL)
+func (m *Manager) GenerateAccessToken(sub Subject) (string, error) {
+	return m.generate(sub, "", AccessToken, m.accessTTL)
 }
 
-// GenerateRefreshToken mints a long-lived refresh JWT for the given user
-func (m *Manager) GenerateRefreshToken(userID, role string) (string, error) {
-	return m.generate(userID, role, RefreshToken, m.refreshTTL)
+// GenerateRefreshToken mints a long-lived refresh JWT for the given user.
+// tokenID becomes the "jti" claim so the session can tell rotated tokens
+// apart. Restrictions are not carried: they are re-evaluated on refresh.
+func (m *Manager) GenerateRefreshToken(sub Subject, tokenID string) (string, error) {
+	sub.Restrictions = nil
+	return m.generate(sub, tokenID, RefreshToken, m.refreshTTL)
 }
 
-func (m *Manager) generate(userID, role string, tt TokenType, ttl time.Duration) (string, error) {
+// GenerateMFAChallenge mints a short-lived token that records a successful
+// password check for userID.
+func (m *Manager) GenerateMFAChallenge(userID string) (string, error) {
+	return m.generate(Subject{UserID: userID}, "", MFAChallengeToken, mfaChallengeTTL)
+}
+
+// GenerateInvitation mints an invitation token whose "jti" is tokenID.
+func (m *Manager) GenerateInvitation(tokenID string, ttl time.Duration) (string, error) {
+	return m.generate(Subject{}, tokenID, InvitationToken, ttl)
+}
+
+// GenerateImpersonation mints an access token for sub, which must name
+// its impersonator, lasting ttl. No refresh token goes with it.
+func (m *Manager) GenerateImpersonation(sub Subject, ttl time.Duration) (string, error) {
+	if sub.ImpersonatorID == "" {
+		return "", errors.New("impersonation token needs an impersonator")
+	}
+	return m.generate(sub, "", AccessToken, ttl)
+}
+
+// RefreshTTL is how long a refresh token, and so an idle session, lives.
+func (m *Manager) RefreshTTL() time.Duration {
+	return m.refreshTTL
+}
+
+func (m *Manager) generate(sub Subject, tokenID string, tt TokenType, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := Claims{
-		UserID:    userID,
-		Role:      role,
-		TokenType: tt,
+		UserID:         sub.UserID,
+		Role:           sub.Role,
+		TokenType:      tt,
+		SessionID:      sub.SessionID,
+		OrgID:          sub.OrgID,
+		Restrictions:   sub.Restrictions,
+		ImpersonatorID: sub.ImpersonatorID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(m.secret)
+	var signed string
+	var err error
+	if m.keys != nil {
+		k := m.keys.keys[m.keys.active]
+		token := jwt.NewWithClaims(k.method, claims)
+		token.Header["kid"] = k.kid
+		signed, err = token.SignedString(k.private)
+	} else {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -73,14 +162,7 @@ func (m *Manager) generate(userID, role string, tt TokenType, ttl time.Duration)
 }
 
 func (m *Manager) Parse(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		// Guard: ensure only HS256 is accepted
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-
-		return m.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, m.keyFunc, jwt.WithValidMethods(m.validMethods()))
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, jwt.ErrTokenExpired
@@ -97,6 +179,51 @@ func (m *Manager) Parse(tokenStr string) (*Claims, error) {
 	return claims, nil
 }
 
+// JWKS returns the public verification keys. It is empty when tokens are
+// signed with the HMAC secret, which must never be published.
+func (m *Manager) JWKS() JWKSet {
+	if m.keys == nil {
+		return JWKSet{Keys: []JWK{}}
+	}
+	return m.keys.JWKS()
+}
+
+// validMethods pins the accepted algorithms so a token cannot choose how it
+// is verified (e.g. "none", or HS256 keyed with a public key).
+func (m *Manager) validMethods() []string {
+	var methods []string
+	if m.keys != nil {
+		methods = m.keys.algorithms()
+	}
+	if len(m.secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+func (m *Manager) keyFunc(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(m.secret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return m.secret, nil
+	}
+
+	if m.keys == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	kid, _ := t.Header["kid"].(string)
+	k, ok := m.keys.keys[kid]
+	if !ok {
+		return nil, errUnknownKeyID
+	}
+	// A kid names one key of one type; the header alg must agree with it.
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("signing method %v does not match key %q", t.Header["alg"], kid)
+	}
+	return k.public, nil
+}
+
 // Sentinel errors returned by Parse so callers can switch on them.
 var (
 	ErrTokenExpired = errors.New("token has expired")
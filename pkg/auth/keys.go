@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// KeySet holds the asymmetric keys used to sign and verify tokens. Each key
+// is identified by a kid, which is written to the token header so the
+// verifier knows which key to use.
+//
+// Keys are loaded from a directory of PEM files named <kid>.pem. A private
+// key (PKCS#8, or PKCS#1 for RSA) can sign and verify; a public key (PKIX)
+// can only verify. Generate keys with e.g.
+//
+//	openssl genpkey -algorithm ed25519 -out keys/2026-10.pem
+//	openssl genpkey -algorithm rsa -pkeyopt rsa_keygen_bits:3072 -out keys/2026-10.pem
+//
+// To rotate without downtime: add the new key file to every replica, then
+// make it active, then delete the old file once the refresh TTL has passed.
+type KeySet struct {
+	active string
+	keys   map[string]*signingKey
+}
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for verify-only keys
+	public  crypto.PublicKey
+}
+
+// LoadKeySet reads every *.pem file in dir. active names the key used for
+// signing; it must be a private key.
+func LoadKeySet(dir, active string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("listing signing keys: %w", err)
+	}
+
+	ks := &KeySet{active: active, keys: make(map[string]*signingKey, len(paths))}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading signing key %q: %w", kid, err)
+		}
+		key, err := parseSigningKey(kid, raw)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[kid] = key
+	}
+
+	k, ok := ks.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found in %s", active, dir)
+	}
+	if k.private == nil {
+		return nil, fmt.Errorf("active signing key %q is a public key", active)
+	}
+	return ks, nil
+}
+
+func parseSigningKey(kid string, raw []byte) (*signingKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q: no PEM block", kid)
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signing key %q: unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", kid, err)
+	}
+
+	k := &signingKey{kid: kid}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.private, k.public = key, &key.PublicKey
+	case ed25519.PrivateKey:
+		k.private, k.public = key, key.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		k.public = key
+	default:
+		return nil, fmt.Errorf("signing key %q: unsupported key type %T", kid, parsed)
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("signing key %q: RSA keys must be at least %d bits", kid, minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	}
+	return k, nil
+}
+
+// algorithms lists the JWS algorithms of the keys in the set.
+func (ks *KeySet) algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range ks.keys {
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the set, sorted by kid.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+var errUnknownKeyID = errors.New("unknown key id")
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app assumes, so they are not configurable.
+const (
+	totpDigits = 6
+	totpPeriod = 30 // seconds
+	// totpSkew is how many steps either side of now are accepted, to allow
+	// for clock drift and slow typing.
+	totpSkew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new 160-bit secret, base32 encoded.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating totp secret: %w", err)
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI that authenticator apps
+// read from a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// VerifyTOTP checks code against secret at time t. On success it returns
+// the time step that matched; callers must persist it and reject any code
+// whose step is not greater, or a code could be replayed within its window.
+func VerifyTOTP(secret, code string, t time.Time) (step int64, ok bool) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := t.Unix() / totpPeriod
+	for s := now - totpSkew; s <= now+totpSkew; s++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(s))), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is HOTP (RFC 4226) with dynamic truncation.
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1_000_000)
+}
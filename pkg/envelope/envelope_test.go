@@ -0,0 +1,209 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newKeys writes a key file with a fresh key for each of ids and loads it.
+func newKeys(t *testing.T, active string, ids ...string) *FileKeyProvider {
+	t.Helper()
+	f := keyFile{Active: active, Keys: map[string]string{}}
+	for _, id := range ids {
+		key, err := GenerateMasterKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Keys[id] = key
+	}
+	raw, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("NewFileKeyProvider: %v", err)
+	}
+	return keys
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func encrypt(t *testing.T, e *Encryptor, plaintext []byte) ([]byte, *Header) {
+	t.Helper()
+	r, h, err := e.Encrypt(context.Background(), bytes.NewReader(plaintext), int64(len(plaintext)))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading ciphertext: %v", err)
+	}
+	return ciphertext, h
+}
+
+func decrypt(e *Encryptor, ciphertext []byte, h *Header) ([]byte, error) {
+	r, err := e.Decrypt(context.Background(), bytes.NewReader(ciphertext), h)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	e := NewEncryptor(newKeys(t, "k1", "k1"))
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		plaintext := randomBytes(t, size)
+		ciphertext, h := encrypt(t, e, plaintext)
+
+		if got, want := int64(len(ciphertext)), CiphertextSize(int64(size)); got != want {
+			t.Errorf("size %d: ciphertext is %d bytes, CiphertextSize says %d", size, got, want)
+		}
+		if h.Algorithm != Algorithm || h.KeyID != "k1" {
+			t.Errorf("size %d: header %+v", size, h)
+		}
+		got, err := decrypt(e, ciphertext, h)
+		if err != nil {
+			t.Fatalf("size %d: Decrypt: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: plaintext differs after the round trip", size)
+		}
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	keys := newKeys(t, "k1", "k1")
+	e := NewEncryptor(keys)
+	// Three chunks, the last one short.
+	ciphertext, h := encrypt(t, e, randomBytes(t, 2*chunkSize+100))
+	const sealed = chunkSize + tagSize
+
+	for _, tc := range []struct {
+		name   string
+		tamper func(ct []byte, h *Header) ([]byte, *Header, *Encryptor)
+		want   error
+	}{
+		{"truncated on a chunk boundary", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			return ct[:2*sealed], h, e
+		}, ErrCorrupt},
+		{"empty", func(_ []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			return nil, h, e
+		}, ErrCorrupt},
+		{"chunks swapped", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			out := append(append(append([]byte{}, ct[sealed:2*sealed]...), ct[:sealed]...), ct[2*sealed:]...)
+			return out, h, e
+		}, ErrCorrupt},
+		{"chunk dropped", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			return append(append([]byte{}, ct[:sealed]...), ct[2*sealed:]...), h, e
+		}, ErrCorrupt},
+		{"tag byte flipped", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			out := bytes.Clone(ct)
+			out[len(out)-1] ^= 1
+			return out, h, e
+		}, ErrCorrupt},
+		{"unknown master key", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			return ct, h, NewEncryptor(newKeys(t, "k2", "k2"))
+		}, ErrUnknownKey},
+		{"wrong master key under the same ID", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			return ct, h, NewEncryptor(newKeys(t, "k1", "k1"))
+		}, ErrUnwrapFailed},
+		{"relabelled wrapped key", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			// k2 holds the very same key, but the wrapping names k1.
+			same := newKeys(t, "k2", "k2")
+			same.keys["k2"] = keys.keys["k1"]
+			out := *h
+			out.KeyID = "k2"
+			return ct, &out, NewEncryptor(same)
+		}, ErrUnwrapFailed},
+		{"unsupported algorithm", func(ct []byte, h *Header) ([]byte, *Header, *Encryptor) {
+			out := *h
+			out.Algorithm = "AES256-GCM"
+			return ct, &out, e
+		}, ErrUnsupportedAlgorithm},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ct, h, e := tc.tamper(ciphertext, h)
+			if _, err := decrypt(e, ct, h); !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncryptChecksDeclaredSize(t *testing.T) {
+	e := NewEncryptor(newKeys(t, "k1", "k1"))
+
+	for _, tc := range []struct {
+		name     string
+		actual   int
+		declared int64
+	}{
+		{"shorter than declared", chunkSize, chunkSize + 1},
+		{"short within a chunk", 10, 20},
+		{"longer than declared", chunkSize + 1, chunkSize},
+		{"data when none declared", 1, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _, err := e.Encrypt(context.Background(), bytes.NewReader(randomBytes(t, tc.actual)), tc.declared)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if _, err := io.ReadAll(r); !errors.Is(err, ErrSizeMismatch) {
+				t.Errorf("err = %v, want ErrSizeMismatch", err)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := newKeys(t, "2026-01", "2026-01")
+	plaintext := randomBytes(t, chunkSize+1)
+	ciphertext, h := encrypt(t, NewEncryptor(old), plaintext)
+
+	// Rotate: the old key is retired but still in the file.
+	rotated := newKeys(t, "2026-10", "2026-10")
+	rotated.keys["2026-01"] = old.keys["2026-01"]
+	e := NewEncryptor(rotated)
+
+	rewrapped, ok, err := e.Rewrap(context.Background(), h)
+	if err != nil || !ok {
+		t.Fatalf("Rewrap: ok = %v, err = %v", ok, err)
+	}
+	if rewrapped.KeyID != "2026-10" || h.KeyID != "2026-01" {
+		t.Errorf("key IDs: rewrapped %q, original %q", rewrapped.KeyID, h.KeyID)
+	}
+
+	// Once nothing is wrapped with it, the old key can go.
+	delete(rotated.keys, "2026-01")
+	got, err := decrypt(e, ciphertext, rewrapped)
+	if err != nil {
+		t.Fatalf("Decrypt after rewrap: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("plaintext differs after rewrap")
+	}
+
+	if again, ok, err := e.Rewrap(context.Background(), rewrapped); err != nil || ok || again != rewrapped {
+		t.Errorf("Rewrap under the active key: ok = %v, err = %v; want it left alone", ok, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package envelope implements client-side envelope encryption: every object
+// is encrypted with its own random data key, and that data key is stored
+// alongside the object wrapped (encrypted) by a long-lived master key.
+// Rotating the master key only requires re-wrapping the small data keys.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// KeyProvider wraps and unwraps data keys with master keys identified by ID.
+// Implementations may be backed by a KMS; FileKeyProvider is for local use.
+type KeyProvider interface {
+	// ActiveKeyID names the master key new data keys are wrapped with.
+	ActiveKeyID() string
+	Wrap(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// keyFile is the on-disk format read by NewFileKeyProvider:
+//
+//	{"active": "2026-10", "keys": {"2026-01": "<base64>", "2026-10": "<base64>"}}
+//
+// Every key is 32 random bytes. Retired keys stay in the file until no
+// object is wrapped with them any more.
+type keyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// FileKeyProvider keeps master keys in memory, loaded from a JSON file.
+type FileKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewFileKeyProvider loads master keys from path.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("parsing key file: %w", err)
+	}
+
+	p := &FileKeyProvider{active: f.Active, keys: make(map[string][]byte, len(f.Keys))}
+	for id, encoded := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q: want 32 bytes, got %d", id, len(key))
+		}
+		p.keys[id] = key
+	}
+	if _, ok := p.keys[p.active]; !ok {
+		return nil, fmt.Errorf("active key %q not found in key file", p.active)
+	}
+
+	return p, nil
+}
+
+func (p *FileKeyProvider) ActiveKeyID() string {
+	return p.active
+}
+
+// KeyIDs lists every key in the file, active and retired.
+func (p *FileKeyProvider) KeyIDs() []string {
+	ids := make([]string, 0, len(p.keys))
+	for id := range p.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Key returns the raw master key for id. It lets other packages derive
+// purpose-specific keys from the same key file.
+func (p *FileKeyProvider) Key(id string) ([]byte, bool) {
+	k, ok := p.keys[id]
+	return k, ok
+}
+
+// Wrap seals dataKey with AES-256-GCM; the output is nonce || ciphertext.
+func (p *FileKeyProvider) Wrap(_ context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := p.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	// The key ID is authenticated so a wrapped key cannot be relabelled.
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func (p *FileKeyProvider) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrUnwrapFailed
+	}
+
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, ErrUnwrapFailed
+	}
+	return dataKey, nil
+}
+
+func (p *FileKeyProvider) aead(keyID string) (cipher.AEAD, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateMasterKey returns a new random master key, base64 encoded for
+// pasting into a key file.
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+var (
+	ErrUnknownKey   = errors.New("unknown master key")
+	ErrUnwrapFailed = errors.New("data key could not be unwrapped")
+)
@@ -0,0 +1,295 @@
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Algorithm identifies the stream format written by Encrypt. It is stored
+// with each object so the format can evolve.
+const Algorithm = "AES256-GCM-STREAM-64K"
+
+const (
+	chunkSize     = 64 << 10
+	tagSize       = 16
+	dataKeySize   = 32
+	noncePrefixSz = 7
+)
+
+// Header is everything needed, besides the master key, to decrypt an object.
+type Header struct {
+	Algorithm  string
+	KeyID      string
+	WrappedKey []byte
+	// NoncePrefix is combined with a chunk counter and a final-chunk flag
+	// to build the per-chunk GCM nonce.
+	NoncePrefix []byte
+}
+
+// Encryptor encrypts streams under fresh data keys wrapped by a KeyProvider.
+//
+// Plaintext is split into 64 KiB chunks, each sealed separately with
+// AES-256-GCM, so objects of any size are processed in constant memory.
+// The chunk index and a final-chunk flag are bound into every nonce, which
+// makes reordering, dropping or truncating chunks detectable.
+type Encryptor struct {
+	keys KeyProvider
+}
+
+func NewEncryptor(keys KeyProvider) *Encryptor {
+	return &Encryptor{keys: keys}
+}
+
+// ActiveKeyID is the master key new objects are wrapped with.
+func (e *Encryptor) ActiveKeyID() string {
+	return e.keys.ActiveKeyID()
+}
+
+// CiphertextSize returns the encrypted length of a plaintext of size bytes.
+func CiphertextSize(size int64) int64 {
+	return size + chunkCount(size)*tagSize
+}
+
+func chunkCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// Encrypt returns a reader producing the ciphertext of exactly size bytes
+// read from plaintext, together with the header to store alongside it.
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext io.Reader, size int64) (io.Reader, *Header, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("generating data key: %w", err)
+	}
+	prefix := make([]byte, noncePrefixSz)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	keyID := e.keys.ActiveKeyID()
+	wrapped, err := e.keys.Wrap(ctx, keyID, dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrapping data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := &Header{Algorithm: Algorithm, KeyID: keyID, WrappedKey: wrapped, NoncePrefix: prefix}
+	return &encryptReader{
+		src:       plaintext,
+		aead:      aead,
+		prefix:    prefix,
+		chunks:    chunkCount(size),
+		remaining: size,
+		buf:       make([]byte, chunkSize),
+		sealed:    make([]byte, 0, chunkSize+tagSize),
+	}, h, nil
+}
+
+// Decrypt returns a reader producing the plaintext of ciphertext. A read
+// error is returned as soon as any chunk fails authentication.
+func (e *Encryptor) Decrypt(ctx context.Context, ciphertext io.Reader, h *Header) (io.Reader, error) {
+	if h.Algorithm != Algorithm {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, h.Algorithm)
+	}
+	if len(h.NoncePrefix) != noncePrefixSz {
+		return nil, ErrCorrupt
+	}
+
+	dataKey, err := e.keys.Unwrap(ctx, h.KeyID, h.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		src:    bufio.NewReaderSize(ciphertext, chunkSize+tagSize),
+		aead:   aead,
+		prefix: h.NoncePrefix,
+		buf:    make([]byte, chunkSize+tagSize),
+		plain:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Rewrap returns a copy of h whose data key is wrapped by the active master
+// key. The ciphertext itself is unchanged. ok is false when h already uses
+// the active key.
+func (e *Encryptor) Rewrap(ctx context.Context, h *Header) (rewrapped *Header, ok bool, err error) {
+	active := e.keys.ActiveKeyID()
+	if h.KeyID == active {
+		return h, false, nil
+	}
+
+	dataKey, err := e.keys.Unwrap(ctx, h.KeyID, h.WrappedKey)
+	if err != nil {
+		return nil, false, err
+	}
+	wrapped, err := e.keys.Wrap(ctx, active, dataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("wrapping data key: %w", err)
+	}
+
+	out := *h
+	out.KeyID = active
+	out.WrappedKey = wrapped
+	return &out, true, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce is prefix(7) || counter(4, big endian) || final(1).
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSz:], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	chunks int64
+
+	counter   int64
+	remaining int64
+	buf       []byte
+	sealed    []byte
+	out       []byte
+	err       error
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.counter == r.chunks {
+			r.err = io.EOF
+			return 0, io.EOF
+		}
+		r.sealNext()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) sealNext() {
+	final := r.counter == r.chunks-1
+	want := min(r.remaining, chunkSize)
+
+	n, err := io.ReadFull(r.src, r.buf[:want])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrSizeMismatch
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+	if final {
+		// The declared size is exhausted; anything after it is an error.
+		if extra, _ := r.src.Read(make([]byte, 1)); extra > 0 {
+			r.err = ErrSizeMismatch
+			return
+		}
+	}
+
+	nonce := chunkNonce(r.prefix, uint32(r.counter), final)
+	r.out = r.aead.Seal(r.sealed[:0], nonce, r.buf[:n], nil)
+	r.remaining -= int64(n)
+	r.counter++
+}
+
+type decryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+
+	counter uint32
+	buf     []byte
+	plain   []byte
+	out     []byte
+	done    bool
+	err     error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			r.err = io.EOF
+			return 0, io.EOF
+		}
+		r.openNext()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) openNext() {
+	n, err := io.ReadFull(r.src, r.buf)
+	final := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		final = true
+	case err == io.EOF:
+		// Every stream ends with a final chunk; reaching EOF here means
+		// it was truncated on a chunk boundary.
+		r.err = ErrCorrupt
+		return
+	case err != nil:
+		r.err = err
+		return
+	default:
+		if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+			final = true
+		}
+	}
+
+	nonce := chunkNonce(r.prefix, r.counter, final)
+	plain, err := r.aead.Open(r.plain[:0], nonce, r.buf[:n], nil)
+	if err != nil {
+		r.err = ErrCorrupt
+		return
+	}
+	r.out = plain
+	r.counter++
+	r.done = final
+}
+
+var (
+	ErrCorrupt              = errors.New("ciphertext is corrupt or was tampered with")
+	ErrSizeMismatch         = errors.New("plaintext length does not match declared size")
+	ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+)
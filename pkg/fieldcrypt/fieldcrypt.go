@@ -0,0 +1,191 @@
+// Package fieldcrypt encrypts individual values for storage, such as
+// database columns holding personal data, and computes blind indexes so
+// encrypted values can still be looked up by equality.
+//
+// Values are sealed with AES-256-GCM under a key derived from a master key
+// of a Keyring, and stored as "enc:v1:<key id>:<base64>". The caller names
+// a context (e.g. the column) that is authenticated with the value, so a
+// ciphertext cannot be moved to another column. Values that do not carry
+// the prefix are returned as they are, so data written before encryption
+// was enabled stays readable until it is re-encrypted.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks encrypted values; the version allows the format to evolve.
+const prefix = "enc:v1:"
+
+// Keyring supplies master keys by ID. envelope.FileKeyProvider is one.
+type Keyring interface {
+	// ActiveKeyID names the key new values are encrypted with.
+	ActiveKeyID() string
+	KeyIDs() []string
+	Key(id string) ([]byte, bool)
+}
+
+// Cipher encrypts values and computes blind indexes with keys derived from
+// a Keyring. A Cipher without a keyring stores values in plaintext, and its
+// blind indexes are unkeyed hashes, so lookups work either way.
+type Cipher struct {
+	active string
+	ids    []string // active first
+	aeads  map[string]cipher.AEAD
+	index  map[string][]byte
+}
+
+// New derives encryption and index keys from every key of ring. ring may be
+// nil, for a Cipher that does not encrypt.
+func New(ring Keyring) (*Cipher, error) {
+	c := &Cipher{aeads: map[string]cipher.AEAD{}, index: map[string][]byte{}}
+	if ring == nil {
+		return c, nil
+	}
+
+	c.active = ring.ActiveKeyID()
+	c.ids = append(c.ids, c.active)
+	for _, id := range ring.KeyIDs() {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key %q: IDs cannot contain ':'", id)
+		}
+		master, ok := ring.Key(id)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+		}
+		encKey, err := hkdf.Key(sha256.New, master, nil, "fieldcrypt encryption", 32)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, err
+		}
+		if c.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		if c.index[id], err = hkdf.Key(sha256.New, master, nil, "fieldcrypt blind index", 32); err != nil {
+			return nil, err
+		}
+		if id != c.active {
+			c.ids = append(c.ids, id)
+		}
+	}
+	if _, ok := c.aeads[c.active]; !ok {
+		return nil, fmt.Errorf("%w: active key %q", ErrUnknownKey, c.active)
+	}
+	return c, nil
+}
+
+// Enabled reports whether values are encrypted.
+func (c *Cipher) Enabled() bool {
+	return c.active != ""
+}
+
+// ActivePrefix is how values encrypted with the active key begin, or ""
+// if encryption is off. Values without it are due for re-encryption.
+func (c *Cipher) ActivePrefix() string {
+	if !c.Enabled() {
+		return ""
+	}
+	return prefix + c.active + ":"
+}
+
+// Encrypt seals plaintext for storage, bound to context. Empty values stay
+// empty, so "not set" remains visible.
+func (c *Cipher) Encrypt(plaintext, context string) (string, error) {
+	if !c.Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+
+	aead := c.aeads[c.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(context))
+	return c.ActivePrefix() + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value written by Encrypt with the same context. Values
+// that were never encrypted are returned unchanged.
+func (c *Cipher) Decrypt(stored, context string) (string, error) {
+	rest, ok := strings.CutPrefix(stored, prefix)
+	if !ok {
+		return stored, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrMalformed
+	}
+	aead, ok := c.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(context))
+	if err != nil {
+		return "", ErrDecryptFailed
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns the index of value under the active key, or "" for
+// an empty value. Equal values in the same context have equal indexes;
+// the value cannot be recovered from one without the key.
+func (c *Cipher) BlindIndex(context, value string) string {
+	if value == "" {
+		return ""
+	}
+	return c.blindIndex(c.active, context, value)
+}
+
+// BlindIndexes returns the index of value under every key, active first,
+// and then the unkeyed one, to match rows not yet re-indexed after a
+// rotation or since encryption was turned on.
+func (c *Cipher) BlindIndexes(context, value string) []string {
+	if value == "" {
+		return nil
+	}
+	out := make([]string, 0, len(c.ids)+1)
+	for _, id := range c.ids {
+		out = append(out, c.blindIndex(id, context, value))
+	}
+	sum := sha256.Sum256(indexMessage(context, value))
+	return append(out, hex.EncodeToString(sum[:]))
+}
+
+func (c *Cipher) blindIndex(keyID, context, value string) string {
+	if !c.Enabled() {
+		sum := sha256.Sum256(indexMessage(context, value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, c.index[keyID])
+	mac.Write(indexMessage(context, value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func indexMessage(context, value string) []byte {
+	return []byte(context + "\x00" + value)
+}
+
+var (
+	ErrUnknownKey    = errors.New("unknown field encryption key")
+	ErrMalformed     = errors.New("malformed encrypted value")
+	ErrDecryptFailed = errors.New("encrypted value could not be decrypted")
+)
@@ -0,0 +1,195 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ring is a Keyring over fixed keys.
+type ring struct {
+	active string
+	keys   map[string][]byte
+}
+
+func (r ring) ActiveKeyID() string { return r.active }
+
+func (r ring) KeyIDs() []string {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (r ring) Key(id string) ([]byte, bool) {
+	k, ok := r.keys[id]
+	return k, ok
+}
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func newCipher(t *testing.T, r Keyring) *Cipher {
+	t.Helper()
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c := newCipher(t, ring{active: "k1", keys: map[string][]byte{"k1": oldKey}})
+
+	stored, err := c.Encrypt("alice@example.com", "patients.email")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(stored, c.ActivePrefix()) || strings.Contains(stored, "alice") {
+		t.Errorf("stored = %q, want it sealed under %q", stored, c.ActivePrefix())
+	}
+	if again, _ := c.Encrypt("alice@example.com", "patients.email"); again == stored {
+		t.Error("equal plaintexts encrypt to equal values")
+	}
+
+	got, err := c.Decrypt(stored, "patients.email")
+	if err != nil || got != "alice@example.com" {
+		t.Errorf("Decrypt = %q, %v; want the plaintext back", got, err)
+	}
+
+	// Moving the value to another column must not decrypt it there.
+	if _, err := c.Decrypt(stored, "patients.phone_number"); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Decrypt in another context: err = %v, want ErrDecryptFailed", err)
+	}
+
+	if stored, _ := c.Encrypt("", "patients.email"); stored != "" {
+		t.Errorf("empty value stored as %q", stored)
+	}
+}
+
+func TestDecryptPassesPlaintextThrough(t *testing.T) {
+	off := newCipher(t, nil)
+	on := newCipher(t, ring{active: "k1", keys: map[string][]byte{"k1": oldKey}})
+
+	if off.Enabled() || off.ActivePrefix() != "" {
+		t.Error("cipher without a keyring reports encryption on")
+	}
+	if stored, _ := off.Encrypt("alice@example.com", "patients.email"); stored != "alice@example.com" {
+		t.Errorf("cipher without a keyring stored %q", stored)
+	}
+	// Rows written before encryption was turned on stay readable.
+	for _, c := range []*Cipher{off, on} {
+		if got, err := c.Decrypt("alice@example.com", "patients.email"); err != nil || got != "alice@example.com" {
+			t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+		}
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	c := newCipher(t, ring{active: "k1", keys: map[string][]byte{"k1": oldKey}})
+	stored, err := c.Encrypt("alice@example.com", "patients.email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, c.ActivePrefix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	tampered := c.ActivePrefix() + base64.RawStdEncoding.EncodeToString(sealed)
+
+	for _, tc := range []struct {
+		name, stored string
+		want         error
+	}{
+		{"no key ID", prefix + "abc", ErrMalformed},
+		{"not base64", prefix + "k1:***", ErrMalformed},
+		{"shorter than a nonce", prefix + "k1:AAAA", ErrMalformed},
+		{"unknown key", prefix + "k9:" + strings.TrimPrefix(stored, c.ActivePrefix()), ErrUnknownKey},
+		{"tampered", tampered, ErrDecryptFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := c.Decrypt(tc.stored, "patients.email"); !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	before := newCipher(t, ring{active: "2026-01", keys: map[string][]byte{"2026-01": oldKey}})
+	after := newCipher(t, ring{active: "2026-10", keys: map[string][]byte{"2026-01": oldKey, "2026-10": newKey}})
+	retired := newCipher(t, ring{active: "2026-10", keys: map[string][]byte{"2026-10": newKey}})
+
+	stored, err := before.Encrypt("alice@example.com", "patients.email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(stored, after.ActivePrefix()) {
+		t.Errorf("%q looks current after rotation, so it would not be re-encrypted", stored)
+	}
+	if got, err := after.Decrypt(stored, "patients.email"); err != nil || got != "alice@example.com" {
+		t.Errorf("Decrypt with the retired key still in the ring = %q, %v", got, err)
+	}
+	if _, err := retired.Decrypt(stored, "patients.email"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with the key gone: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestBlindIndexes(t *testing.T) {
+	off := newCipher(t, nil)
+	before := newCipher(t, ring{active: "2026-01", keys: map[string][]byte{"2026-01": oldKey}})
+	after := newCipher(t, ring{active: "2026-10", keys: map[string][]byte{"2026-01": oldKey, "2026-10": newKey}})
+	const ctx, value = "patients.email", "alice@example.com"
+
+	got := after.BlindIndexes(ctx, value)
+	want := []string{
+		after.BlindIndex(ctx, value),  // written since the rotation
+		before.BlindIndex(ctx, value), // written under the retired key
+		off.BlindIndex(ctx, value),    // written before encryption was on
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("BlindIndexes = %q, want %q", got, want)
+	}
+	if len(slices.Compact(slices.Clone(want))) != len(want) {
+		t.Errorf("indexes under different keys collide: %q", want)
+	}
+
+	if after.BlindIndex(ctx, value) != after.BlindIndex(ctx, value) {
+		t.Error("equal values have different indexes")
+	}
+	if after.BlindIndex(ctx, value) == after.BlindIndex("patients.phone_number", value) {
+		t.Error("index does not depend on the context")
+	}
+	if after.BlindIndex(ctx, "") != "" || after.BlindIndexes(ctx, "") != nil {
+		t.Error("empty value has an index")
+	}
+	if got := off.BlindIndexes(ctx, value); !slices.Equal(got, []string{want[2]}) {
+		t.Errorf("BlindIndexes without a keyring = %q, want only the unkeyed index", got)
+	}
+}
+
+func TestNewRejectsBadKeyrings(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ring ring
+		want error
+	}{
+		{"':' in key ID", ring{active: "2026:01", keys: map[string][]byte{"2026:01": oldKey}}, nil},
+		{"active key missing", ring{active: "k2", keys: map[string][]byte{"k1": oldKey}}, ErrUnknownKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.ring)
+			if err == nil || tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
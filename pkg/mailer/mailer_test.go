@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogMailerDoesNotLogBody(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	m := NewLogMailer("noreply@example.com", "", zap.New(core))
+
+	const token = "eyJhbGciOiJIUzI1NiJ9.reset.c2lnbmF0dXJl"
+	err := m.Send(context.Background(), Message{
+		To:      "staff@example.com",
+		Subject: "Reset your password",
+		Text:    "Follow https://app.example.com/reset-password?token=" + token + " within the hour.",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if logs.Len() == 0 {
+		t.Fatal("message was not logged")
+	}
+	for _, e := range logs.All() {
+		for k, v := range e.ContextMap() {
+			if strings.Contains(fmt.Sprint(v), token) {
+				t.Errorf("field %q logs the token: %v", k, v)
+			}
+		}
+	}
+}
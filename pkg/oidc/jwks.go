@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval limits how often an unknown kid triggers a refetch, so
+// tokens with made-up kids cannot make us hammer the provider.
+const keyRefreshInterval = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// publicKeys decodes the signing keys it understands, skipping the rest.
+func (s jsonWebKeySet) publicKeys() map[string]any {
+	keys := make(map[string]any, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub := k.publicKey(); pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys
+}
+
+func (k jsonWebKey) publicKey() any {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil
+		}
+		return pub
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil
+		}
+		return ed25519.PublicKey(x)
+	}
+	return nil
+}
+
+// keyCache holds the provider's keys, refetching when a token names a kid
+// it has not seen (the provider has rotated).
+type keyCache struct {
+	fetch func(ctx context.Context) (map[string]any, error)
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+func newKeyCache(fetch func(ctx context.Context) (map[string]any, error)) *keyCache {
+	return &keyCache{fetch: fetch}
+}
+
+func (c *keyCache) get(ctx context.Context, kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if k, ok := c.lookup(kid); ok {
+		return k, nil
+	}
+	if time.Since(c.fetchedAt) < keyRefreshInterval {
+		return nil, errUnknownKey
+	}
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.keys, c.fetchedAt = keys, time.Now()
+
+	if k, ok := c.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, errUnknownKey
+}
+
+// lookup finds kid, or the only key when the token carries no kid.
+func (c *keyCache) lookup(kid string) (any, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+var errUnknownKey = errors.New("unknown signing key")
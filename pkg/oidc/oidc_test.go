@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "splose-web"
+	testClientSecret = "s3cret/with+symbols"
+	testRedirectURL  = "https://app.example.com/auth/oidc/callback"
+	testKeyID        = "key-1"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS, and a token
+// endpoint that checks client credentials and PKCE before issuing an ID
+// token signed with key.
+type mockIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+	// issuer is what discovery advertises; the server URL unless a test
+	// overrides it.
+	issuer string
+	// signer signs ID tokens; key unless a test swaps it.
+	signer *rsa.PrivateKey
+	// idNonce overrides the nonce put in ID tokens.
+	idNonce string
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is what the provider remembers about an authorization request.
+type grant struct {
+	challenge, nonce, redirectURI string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{t: t, key: key, signer: key, codes: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("POST /token", m.token)
+	m.srv = httptest.NewServer(mux)
+	m.issuer = m.srv.URL
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       m.srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, m.srv.Client())
+}
+
+func (m *mockIdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.srv.URL + "/authorize",
+		"token_endpoint":                        m.srv.URL + "/token",
+		"jwks_uri":                              m.srv.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIdP) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": testKeyID,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// authorize plays the browser's visit to the authorization URL, returning
+// the code the provider would redirect back with.
+func (m *mockIdP) authorize(authURL string) (code string, q url.Values) {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatalf("parsing authorization URL: %v", err)
+	}
+	q = u.Query()
+	code = "code-" + q.Get("state")[:8]
+	m.mu.Lock()
+	m.codes[code] = grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	m.mu.Unlock()
+	return code, q
+}
+
+func (m *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	m.mu.Lock()
+	g, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := g.nonce
+	if m.idNonce != "" {
+		nonce = m.idNonce
+	}
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.issuer,
+		"sub":            "idp-user-42",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "clinician@example.com",
+		"email_verified": true,
+		"name":           "Casey Clinician",
+	})
+	tok.Header["kid"] = testKeyID
+	raw, err := tok.SignedString(m.signer)
+	if err != nil {
+		m.t.Errorf("signing id token: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": raw})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestLoginAgainstMockProvider(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	req, err := p.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+	code, q := idp.authorize(req.URL)
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("authorization URL %s = %q, want %q", param, got, want)
+		}
+	}
+
+	tok, err := p.Exchange(ctx, code, req.CodeVerifier, req.Nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.Issuer != idp.srv.URL || tok.Subject != "idp-user-42" || tok.Email != "clinician@example.com" || !tok.EmailVerified {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	req, err := p.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+	code, _ := idp.authorize(req.URL)
+	other, err := p.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+
+	if _, err := p.Exchange(ctx, code, other.CodeVerifier, req.Nonce); !errors.Is(err, ErrExchangeFailed) {
+		t.Fatalf("Exchange with another request's verifier: err = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	idp.idNonce = "replayed-nonce"
+	p := idp.provider()
+
+	req, err := p.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+	code, _ := idp.authorize(req.URL)
+
+	if _, err := p.Exchange(ctx, code, req.CodeVerifier, req.Nonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange of a token for another nonce: err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestExchangeRejectsForgedSignature(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.signer = forger // same kid, wrong key
+	p := idp.provider()
+
+	req, err := p.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+	code, _ := idp.authorize(req.URL)
+
+	if _, err := p.Exchange(ctx, code, req.CodeVerifier, req.Nonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange of a token signed by another key: err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.issuer = "https://impostor.example.com"
+
+	if _, err := idp.provider().NewAuthRequest(context.Background()); err == nil {
+		t.Fatal("NewAuthRequest trusted discovery for another issuer")
+	}
+}
@@ -0,0 +1,258 @@
+// Package preview renders small JPEG thumbnails for images and the first
+// page of PDFs.
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxSourcePixels guards against decompression bombs: a tiny file that
+// declares enormous dimensions.
+const maxSourcePixels = 50_000_000
+
+const jpegQuality = 80
+
+// Result is a rendered thumbnail plus facts about the source document.
+type Result struct {
+	JPEG []byte
+	// Width and Height describe the source: pixels for images, PostScript
+	// points of the first page for PDFs.
+	Width  int
+	Height int
+	// PageCount is set for PDFs only.
+	PageCount int
+}
+
+// Generator produces thumbnails no larger than maxDimension on either side.
+// PDFs are rendered with poppler's pdftoppm/pdfinfo binaries.
+type Generator struct {
+	maxDimension int
+	pdftoppmPath string
+	pdfinfoPath  string
+}
+
+// NewGenerator resolves the poppler binaries on PATH; when pdftoppm cannot
+// be found PDF previews are reported as unsupported.
+func NewGenerator(maxDimension int, pdftoppmPath, pdfinfoPath string) *Generator {
+	return &Generator{
+		maxDimension: maxDimension,
+		pdftoppmPath: lookPath(pdftoppmPath),
+		pdfinfoPath:  lookPath(pdfinfoPath),
+	}
+}
+
+func lookPath(name string) string {
+	if name == "" {
+		return ""
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// Supports reports whether a preview can be generated for the MIME type.
+func (g *Generator) Supports(contentType string) bool {
+	switch baseType(contentType) {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	case "application/pdf":
+		return g.pdftoppmPath != ""
+	default:
+		return false
+	}
+}
+
+// Generate reads the whole document from r and renders its thumbnail.
+func (g *Generator) Generate(ctx context.Context, contentType string, r io.Reader) (*Result, error) {
+	switch baseType(contentType) {
+	case "image/png", "image/jpeg", "image/gif":
+		return g.image(r)
+	case "application/pdf":
+		if g.pdftoppmPath == "" {
+			return nil, ErrUnsupported
+		}
+		return g.pdf(ctx, r)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+func (g *Generator) image(r io.Reader) (*Result, error) {
+	// Buffer once so the header can be checked before the full decode.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxSourcePixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	w, h := fit(cfg.Width, cfg.Height, g.maxDimension)
+	thumb := resize(src, w, h)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+
+	return &Result{JPEG: buf.Bytes(), Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+func (g *Generator) pdf(ctx context.Context, r io.Reader) (*Result, error) {
+	dir, err := os.MkdirTemp("", "preview-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source.pdf")
+	f, err := os.Create(src)
+	if err != nil {
+		return nil, fmt.Errorf("creating temp file: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("closing temp file: %w", err)
+	}
+
+	res := &Result{}
+	if g.pdfinfoPath != "" {
+		out, err := exec.CommandContext(ctx, g.pdfinfoPath, src).Output()
+		if err != nil {
+			return nil, fmt.Errorf("pdfinfo: %w", err)
+		}
+		res.PageCount, res.Width, res.Height = parsePDFInfo(out)
+	}
+
+	outPrefix := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, g.pdftoppmPath,
+		"-f", "1", "-l", "1",
+		"-singlefile",
+		"-jpeg", "-jpegopt", "quality="+strconv.Itoa(jpegQuality),
+		"-scale-to", strconv.Itoa(g.maxDimension),
+		src, outPrefix,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	res.JPEG, err = os.ReadFile(outPrefix + ".jpg")
+	if err != nil {
+		return nil, fmt.Errorf("reading rendered page: %w", err)
+	}
+	return res, nil
+}
+
+// parsePDFInfo extracts the page count and first page size from pdfinfo
+// output, e.g. "Pages: 3" and "Page size: 612 x 792 pts (letter)".
+func parsePDFInfo(out []byte) (pages, width, height int) {
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Pages":
+			pages, _ = strconv.Atoi(value)
+		case "Page size":
+			var w, h float64
+			if _, err := fmt.Sscanf(value, "%f x %f", &w, &h); err == nil {
+				width, height = int(math.Round(w)), int(math.Round(h))
+			}
+		}
+	}
+	return pages, width, height
+}
+
+// fit scales w×h down to fit in a limit×limit box, keeping the aspect ratio.
+func fit(w, h, limit int) (int, int) {
+	if w <= limit && h <= limit {
+		return w, h
+	}
+	if w >= h {
+		return limit, int(math.Max(1, math.Round(float64(h)*float64(limit)/float64(w))))
+	}
+	return int(math.Max(1, math.Round(float64(w)*float64(limit)/float64(h)))), limit
+}
+
+// resize downsamples src to w×h by averaging a grid of source pixels per
+// destination pixel, flattening transparency onto white for JPEG output.
+func resize(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sh/h
+		y1 := max(sb.Min.Y+(y+1)*sh/h, y0+1)
+		ystep := max((y1-y0)/4, 1)
+
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sw/w
+			x1 := max(sb.Min.X+(x+1)*sw/w, x0+1)
+			xstep := max((x1-x0)/4, 1)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy += ystep {
+				for sx := x0; sx < x1; sx += xstep {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Premultiplied colour over an opaque white background.
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
+
+func baseType(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(strings.ToLower(base))
+}
+
+var (
+	ErrUnsupported = errors.New("preview not supported for this type")
+	ErrTooLarge    = errors.New("image dimensions too large to preview")
+)
@@ -0,0 +1,122 @@
+// Package ratelimit implements token-bucket rate limiting over a pluggable
+// store, so limits can be kept in process or shared between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit refills a bucket at Rate tokens per second up to Burst tokens. A
+// limit with a non-positive Rate or Burst is disabled.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of which may come at once.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Bucket is the stored state of one key.
+type Bucket struct {
+	Tokens  float64
+	TakenAt time.Time
+}
+
+// Result is the outcome of one Take.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed; zero
+	// if Allowed.
+	RetryAfter time.Duration
+}
+
+// Take refills b up to now and spends one token from it if it has one. A
+// nil b is treated as a full bucket. It returns the updated bucket.
+func (l Limit) Take(b *Bucket, now time.Time) (Bucket, Result) {
+	next := Bucket{Tokens: float64(l.Burst), TakenAt: now}
+	if b != nil {
+		elapsed := max(now.Sub(b.TakenAt).Seconds(), 0)
+		next.Tokens = math.Min(float64(l.Burst), b.Tokens+elapsed*l.Rate)
+	}
+
+	res := Result{Limit: l.Burst}
+	if next.Tokens >= 1 {
+		next.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.wait(1 - next.Tokens)
+	}
+	res.Remaining = int(next.Tokens)
+	res.Reset = l.wait(float64(l.Burst) - next.Tokens)
+	return next, res
+}
+
+// Idle is how long a bucket takes to refill completely; a bucket untouched
+// for longer is the same as no bucket and can be dropped.
+func (l Limit) Idle() time.Duration {
+	return l.wait(float64(l.Burst))
+}
+
+func (l Limit) wait(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.Rate * float64(time.Second)))
+}
+
+// Store holds buckets by key. Take must be atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// MemoryStore keeps buckets in process. Each replica then enforces limits
+// on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	idle time.Duration
+}
+
+// sweepInterval is how often a MemoryStore drops idle buckets.
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= sweepInterval {
+		for k, b := range s.buckets {
+			if now.Sub(b.TakenAt) >= b.idle {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	var prev *Bucket
+	if b, ok := s.buckets[key]; ok {
+		prev = &b.Bucket
+	}
+	next, res := limit.Take(prev, now)
+	s.buckets[key] = &memoryBucket{Bucket: next, idle: limit.Idle()}
+	return res, nil
+}
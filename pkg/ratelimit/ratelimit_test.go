@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3} // a token every 500ms
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after time.Duration // since start
+		want  Result
+	}
+	for _, tc := range []struct {
+		name  string
+		steps []step
+	}{
+		{"burst then denied", []step{
+			{0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+			{0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second}},
+			{0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+			{0, Result{Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		}},
+		{"refills at rate", []step{
+			{0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+			{0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second}},
+			{0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+			// Half a token back: still denied, and told when the rest comes.
+			{250 * time.Millisecond, Result{Limit: 3, Remaining: 0, Reset: 1250 * time.Millisecond, RetryAfter: 250 * time.Millisecond}},
+			{500 * time.Millisecond, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+		}},
+		{"never beyond burst", []step{
+			{0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+			{time.Hour, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+		}},
+		{"clock going back refills nothing", []step{
+			{time.Second, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+			{0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second}},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b *Bucket
+			for i, s := range tc.steps {
+				next, res := limit.Take(b, start.Add(s.after))
+				if res != s.want {
+					t.Fatalf("take %d: got %+v, want %+v", i+1, res, s.want)
+				}
+				b = &next
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeepsBucketsApart(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+	ctx := context.Background()
+
+	if res, _ := store.Take(ctx, "auth:ip:198.51.100.7", limit, now); !res.Allowed {
+		t.Fatal("first request denied")
+	}
+	if res, _ := store.Take(ctx, "auth:ip:198.51.100.7", limit, now); res.Allowed {
+		t.Fatal("second request from the same caller allowed")
+	}
+	if res, _ := store.Take(ctx, "auth:ip:198.51.100.8", limit, now); !res.Allowed {
+		t.Fatal("another caller shares the bucket")
+	}
+	if res, _ := store.Take(ctx, "auth:ip:198.51.100.7", limit, now.Add(time.Second)); !res.Allowed {
+		t.Fatal("bucket did not refill")
+	}
+}
@@ -3,15 +3,24 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"go.uber.org/zap"
+
+	"github.com/jamesphm04/splose-clone-be/pkg/envelope"
 )
 
 // Client wraps the AWS S3 Client with bucket-scroped operations
@@ -19,12 +28,23 @@ type Client struct {
 	s3              *s3.Client
 	bucket          string
 	presignedURLTTL time.Duration
+	enc             *envelope.Encryptor
 	log             *zap.Logger
 }
 
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// WithEncryption makes the client encrypt every object it uploads and
+// decrypt encrypted objects on download. Plaintext objects stored before
+// encryption was enabled remain readable.
+func WithEncryption(enc *envelope.Encryptor) Option {
+	return func(c *Client) { c.enc = enc }
+}
+
 // NewClient creates an S3 Client
 // if endpoint is non-empty the client points at that URL (LocalStack, MinIO)
-func NewClient(ctx context.Context, region, accessKey, secretKey, bucket, endpoint string, presignedURLTTL time.Duration, log *zap.Logger) (*Client, error) {
+func NewClient(ctx context.Context, region, accessKey, secretKey, bucket, endpoint string, presignedURLTTL time.Duration, log *zap.Logger, options ...Option) (*Client, error) {
 	opts := []func(*awsconfig.LoadOptions) error{
 		awsconfig.WithRegion(region),
 		awsconfig.WithCredentialsProvider(
@@ -46,15 +66,20 @@ func NewClient(ctx context.Context, region, accessKey, secretKey, bucket, endpoi
 	}
 
 	c := &Client{
-		s3:     s3.NewFromConfig(cfg, s3Opts...),
-		bucket: bucket,
-		log:    log.Named("s3"),
+		s3:              s3.NewFromConfig(cfg, s3Opts...),
+		bucket:          bucket,
+		presignedURLTTL: presignedURLTTL,
+		log:             log.Named("s3"),
+	}
+	for _, o := range options {
+		o(c)
 	}
 
 	log.Info("S3 client initialized",
 		zap.String("region", region),
 		zap.String("bucket", bucket),
 		zap.Bool("customEndpoint", endpoint != ""),
+		zap.Bool("encrypted", c.enc != nil),
 	)
 	return c, nil
 }
@@ -82,17 +107,27 @@ func (c *Client) Upload(ctx context.Context, in UploadInput) (*UploadOutput, err
 		ContentLength: aws.Int64(in.Size),
 	}
 
+	if c.enc != nil {
+		body, cleanup, err := c.encrypt(ctx, o, in)
+		if err != nil {
+			c.log.Error("encrypting object failed", zap.String("key", in.Key), zap.Error(err))
+			return nil, fmt.Errorf("encrypting %q: %w", in.Key, err)
+		}
+		defer cleanup()
+		o.Body = body
+	}
+
 	_, err := c.s3.PutObject(ctx, o)
 	if err != nil {
 		c.log.Error("PutObject failed", zap.String("key", in.Key), zap.Error(err))
 		return nil, fmt.Errorf("s3 PutObject %q: %w", in.Key, err)
 	}
 
-	url := fmt.Sprintf("https://%s.s3.amazonaws.com/%s", c.bucket, in.Key)
+	url := c.ObjectURL(in.Key)
 	c.log.Info("object uploaded", zap.String("key", in.Key), zap.Int64("size", in.Size))
 
 	// pre-sign the url
-	presignedURL, err := c.PresignURL(ctx, in.Key, 1*time.Hour)
+	presignedURL, err := c.PresignURL(ctx, in.Key, 0)
 	if err != nil {
 		c.log.Error("PresignURL failed", zap.String("key", in.Key), zap.Error(err))
 		return nil, fmt.Errorf("presigning %q: %w", in.Key, err)
@@ -101,6 +136,211 @@ func (c *Client) Upload(ctx context.Context, in UploadInput) (*UploadOutput, err
 	return &UploadOutput{URL: url, PresignedURL: presignedURL}, nil
 }
 
+// encrypt spools the ciphertext of in to a temporary file and records the
+// envelope header in the object's metadata. Spooling keeps memory flat and
+// gives the SDK a seekable body to sign.
+func (c *Client) encrypt(ctx context.Context, o *s3.PutObjectInput, in UploadInput) (io.Reader, func(), error) {
+	ciphertext, h, err := c.enc.Encrypt(ctx, in.Body, in.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "upload-*.enc")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	if _, err := io.Copy(tmp, ciphertext); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	o.ContentLength = aws.Int64(envelope.CiphertextSize(in.Size))
+	o.Metadata = headerMetadata(h, in.Size)
+	return tmp, cleanup, nil
+}
+
+// Encrypted reports whether stored objects are ciphertext. Presigned URLs
+// are useless to clients in that case; content must be served via Download.
+func (c *Client) Encrypted() bool {
+	return c.enc != nil
+}
+
+// ObjectURL returns the unsigned URL of an object.
+func (c *Client) ObjectURL(key string) string {
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", c.bucket, key)
+}
+
+// Download opens an object for reading, decrypting it if it was stored
+// encrypted. The caller must close the body.
+func (c *Client) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	o := &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+
+	out, err := c.s3.GetObject(ctx, o)
+	if err != nil {
+		c.log.Error("GetObject failed", zap.String("key", key), zap.Error(err))
+		return nil, fmt.Errorf("s3 GetObject %q: %w", key, err)
+	}
+
+	h, ok, err := parseHeader(out.Metadata)
+	if err != nil {
+		out.Body.Close()
+		return nil, fmt.Errorf("object %q: %w", key, err)
+	}
+	if !ok {
+		return out.Body, nil
+	}
+	if c.enc == nil {
+		out.Body.Close()
+		return nil, fmt.Errorf("object %q: %w", key, ErrEncryptionDisabled)
+	}
+
+	plaintext, err := c.enc.Decrypt(ctx, out.Body, h)
+	if err != nil {
+		out.Body.Close()
+		c.log.Error("decrypting object failed", zap.String("key", key), zap.String("keyID", h.KeyID), zap.Error(err))
+		return nil, fmt.Errorf("decrypting %q: %w", key, err)
+	}
+	return readCloser{Reader: plaintext, Closer: out.Body}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Rewrap re-wraps an encrypted object's data key with the active master key
+// by replacing its metadata in place; the ciphertext is not transferred.
+// It reports whether the object was changed: plaintext objects and objects
+// already on the active key are left alone.
+func (c *Client) Rewrap(ctx context.Context, key string) (bool, error) {
+	if c.enc == nil {
+		return false, ErrEncryptionDisabled
+	}
+
+	head, err := c.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, fmt.Errorf("s3 HeadObject %q: %w", key, err)
+	}
+
+	h, ok, err := parseHeader(head.Metadata)
+	if err != nil || !ok {
+		return false, err
+	}
+	rewrapped, changed, err := c.enc.Rewrap(ctx, h)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	meta := head.Metadata
+	for k, v := range headerMetadata(rewrapped, 0) {
+		if k != metaPlaintextSize {
+			meta[k] = v
+		}
+	}
+
+	// S3 cannot edit metadata; copying an object onto itself with the
+	// REPLACE directive is the supported way to change it.
+	_, err = c.s3.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(c.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(copySource(c.bucket, key)),
+		CopySourceIfMatch: head.ETag,
+		ContentType:       head.ContentType,
+		Metadata:          meta,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	if err != nil {
+		c.log.Error("CopyObject failed", zap.String("key", key), zap.Error(err))
+		return false, fmt.Errorf("s3 CopyObject %q: %w", key, err)
+	}
+
+	c.log.Info("object rewrapped",
+		zap.String("key", key),
+		zap.String("fromKeyID", h.KeyID),
+		zap.String("toKeyID", rewrapped.KeyID),
+	)
+	return true, nil
+}
+
+// EncryptInPlace replaces a plaintext object stored before encryption was
+// enabled with its encrypted form. Already encrypted objects are skipped.
+func (c *Client) EncryptInPlace(ctx context.Context, key string) (bool, error) {
+	if c.enc == nil {
+		return false, ErrEncryptionDisabled
+	}
+
+	out, err := c.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, fmt.Errorf("s3 GetObject %q: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	if _, ok, err := parseHeader(out.Metadata); err != nil || ok {
+		return false, err
+	}
+
+	if _, err := c.Upload(ctx, UploadInput{
+		Key:         key,
+		Body:        out.Body,
+		ContentType: aws.ToString(out.ContentType),
+		Size:        aws.ToInt64(out.ContentLength),
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ObjectInfo describes a stored object as returned by List.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// List returns every object whose key starts with prefix.
+func (c *Client) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	p := s3.NewListObjectsV2Paginator(c.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			c.log.Error("ListObjectsV2 failed", zap.String("prefix", prefix), zap.Error(err))
+			return nil, fmt.Errorf("s3 ListObjectsV2 %q: %w", prefix, err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(o.Key),
+				Size:         aws.ToInt64(o.Size),
+				LastModified: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
 // Delete removes an object from S3
 func (c *Client) Delete(ctx context.Context, key string) error {
 	o := &s3.DeleteObjectInput{
@@ -119,7 +359,14 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 }
 
 // PresignURL generates a time-limited pre-signed GET URL for private objects. Preview shortly -> Private
+// A zero ttl uses the client's configured default.
 func (c *Client) PresignURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = c.presignedURLTTL
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
 	presignClient := s3.NewPresignClient(c.s3)
 
 	o := &s3.GetObjectInput{
@@ -134,3 +381,57 @@ func (c *Client) PresignURL(ctx context.Context, key string, ttl time.Duration)
 	}
 	return req.URL, nil
 }
+
+// Object metadata keys for the envelope header. S3 stores them as
+// x-amz-meta-* headers and returns them lower-cased.
+const (
+	metaAlgorithm     = "enc-alg"
+	metaKeyID         = "enc-key-id"
+	metaWrappedKey    = "enc-wrapped-key"
+	metaNonce         = "enc-nonce"
+	metaPlaintextSize = "enc-plaintext-size"
+)
+
+func headerMetadata(h *envelope.Header, size int64) map[string]string {
+	return map[string]string{
+		metaAlgorithm:     h.Algorithm,
+		metaKeyID:         h.KeyID,
+		metaWrappedKey:    base64.StdEncoding.EncodeToString(h.WrappedKey),
+		metaNonce:         base64.StdEncoding.EncodeToString(h.NoncePrefix),
+		metaPlaintextSize: strconv.FormatInt(size, 10),
+	}
+}
+
+// parseHeader extracts the envelope header; ok is false for plaintext objects.
+func parseHeader(meta map[string]string) (h *envelope.Header, ok bool, err error) {
+	alg, found := meta[metaAlgorithm]
+	if !found {
+		return nil, false, nil
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(meta[metaWrappedKey])
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: wrapped key", ErrBadEnvelope)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(meta[metaNonce])
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: nonce", ErrBadEnvelope)
+	}
+
+	return &envelope.Header{
+		Algorithm:   alg,
+		KeyID:       meta[metaKeyID],
+		WrappedKey:  wrapped,
+		NoncePrefix: nonce,
+	}, true, nil
+}
+
+// copySource is the URL-encoded "bucket/key" form CopyObject expects.
+func copySource(bucket, key string) string {
+	return bucket + "/" + strings.ReplaceAll(url.PathEscape(key), "%2F", "/")
+}
+
+var (
+	ErrEncryptionDisabled = errors.New("object is encrypted but no encryption key provider is configured")
+	ErrBadEnvelope        = errors.New("malformed encryption metadata")
+)